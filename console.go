@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"mellium.im/xmpp/jid"
+
+	"github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/memserver"
+)
+
+const consoleHelp = `Type a message to send it to the bot, or a command:
+  /as <jid>              speak as a JID, or as a MUC occupant (room@service/nick)
+  /join <room> <nick>    simulate an occupant joining a room
+  /leave <room> <nick>   simulate an occupant leaving a room
+  /help                  show this help
+  /quit                  exit
+Lines starting with "<" are stanzas sent by the bot, "*" are events published.`
+
+// console runs the bot against an in-memory server driven from a terminal, so
+// that plugins can be tried out without an XMPP server.
+type console struct {
+	server *memserver.Server
+	as     jid.JID
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// runConsole loads the plugins for the first account configured and reads
+// messages to send to the bot from in until it is closed or /quit is typed.
+// MUCs in the configuration exist on the server, initially empty.
+func runConsole(ctx context.Context, config gofra.Config, as string, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Unless configured, the data plugins persist does not outlive the console
+	if config.DataDir == "" {
+		dir, err := os.MkdirTemp("", "gofra-console")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		config.DataDir = dir
+	}
+
+	accountConfig := config.AccountConfigs()[0]
+	if accountConfig.Jid == "" {
+		accountConfig.Jid = "gofra@localhost"
+	}
+
+	bot, err := jid.Parse(accountConfig.Jid + "/console")
+	if err != nil {
+		return fmt.Errorf("invalid bot JID: %w", err)
+	}
+
+	sender, err := jid.Parse(as)
+	if err != nil {
+		return fmt.Errorf("invalid sender JID %q: %w", as, err)
+	}
+
+	c := &console{server: memserver.NewServer(bot), as: sender, out: out}
+	for _, muc := range accountConfig.MUCs {
+		c.server.AddRoom(muc.Jid)
+	}
+
+	c.server.Observe(func(st memserver.Stanza) {
+		c.printf("< %s\n", st)
+	})
+	go c.server.Serve()
+	defer c.server.Close()
+
+	session, err := c.server.Session(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+
+	g := gofra.NewGofraWithSession(ctx, accountConfig, session)
+	g.Trace(c.printEvent)
+
+	if err := g.Init(); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := g.Connect(); err != nil && ctx.Err() == nil {
+			c.printf("Connection ended: %v\n", err)
+		}
+	}()
+
+	c.printf("%s\nSpeaking as %s\n", consoleHelp, c.as)
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if !c.handleLine(strings.TrimSpace(scanner.Text())) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+// handleLine runs a console command or sends the line as a message. It
+// returns false when the console should exit.
+func (c *console) handleLine(line string) bool {
+	if !strings.HasPrefix(line, "/") {
+		if line != "" {
+			c.server.Message(c.as, line)
+		}
+
+		return true
+	}
+
+	args := strings.Fields(line)
+	switch args[0] {
+	case "/as":
+		if len(args) != 2 {
+			c.printf("Usage: /as <jid>\n")
+			break
+		}
+
+		j, err := jid.Parse(args[1])
+		if err != nil {
+			c.printf("Invalid JID %q: %v\n", args[1], err)
+			break
+		}
+
+		c.as = j
+		c.printf("Speaking as %s\n", c.as)
+	case "/join", "/leave":
+		if len(args) != 3 {
+			c.printf("Usage: %s <room> <nick>\n", args[0])
+			break
+		}
+
+		if args[0] == "/join" {
+			c.server.Join(args[1], args[2])
+		} else {
+			c.server.Leave(args[1], args[2])
+		}
+	case "/help":
+		c.printf("%s\n", consoleHelp)
+	case "/quit":
+		return false
+	default:
+		c.printf("Unknown command %s, type /help for a list\n", args[0])
+	}
+
+	return true
+}
+
+func (c *console) printEvent(e gofra.Event) {
+	details := ""
+	if e.MB.Body != "" {
+		details = fmt.Sprintf(" from %s: %q", e.MB.From, e.MB.Body)
+	}
+
+	if len(e.Payload) > 0 {
+		keys := make([]string, 0, len(e.Payload))
+		for key := range e.Payload {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		details += fmt.Sprintf(" [%s]", strings.Join(keys, ", "))
+	}
+
+	c.printf("* %s%s\n", e.Name, details)
+}
+
+func (c *console) printf(format string, a ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(c.out, format, a...)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+)
+
+// output collects what the console prints, from several goroutines.
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.buf.Write(p)
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.buf.String()
+}
+
+func TestConsole(t *testing.T) {
+	config := gofra.Config{
+		Jid:     "gofra@localhost",
+		Nick:    "Gofra",
+		DataDir: t.TempDir(),
+		MUCs:    []gofra.MUCConfig{{Jid: "room@muc.localhost", Nick: "Gofra"}},
+	}
+	in, input := io.Pipe()
+	out := &output{}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runConsole(context.Background(), config, "alice@localhost/phone", in, out)
+	}()
+
+	say := func(line string) {
+		t.Helper()
+		_, err := io.WriteString(input, line+"\n")
+		assert.NoError(t, err)
+	}
+	expect := func(s string) {
+		t.Helper()
+		assert.Eventually(t, func() bool { return strings.Contains(out.String(), s) }, 2*time.Second, 10*time.Millisecond,
+			"%q not printed, got:\n%s", s, out)
+	}
+
+	expect("Speaking as alice@localhost/phone")
+
+	say("hello")
+	expect(`* messageReceived from alice@localhost/phone: "hello"`)
+
+	say("/as bob@localhost/laptop")
+	expect("Speaking as bob@localhost/laptop")
+	say("/as")
+	expect("Usage: /as <jid>")
+
+	say("/join room@muc.localhost carol")
+	expect("* presenceReceived")
+	say("/leave room@muc.localhost")
+	expect("Usage: /leave <room> <nick>")
+
+	say("/dance")
+	expect("Unknown command /dance, type /help for a list")
+
+	say("/quit")
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("console did not quit")
+	}
+}
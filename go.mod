@@ -6,6 +6,7 @@ require (
 	github.com/juju/errors v1.0.0
 	github.com/olebedev/when v0.0.0-20221205223600-4d190b02b8d8
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/net v0.8.0
 	gopkg.in/yaml.v3 v3.0.1
 	mellium.im/sasl v0.3.1
 	mellium.im/xmlstream v0.15.4
@@ -19,7 +20,6 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/crypto v0.7.0 // indirect
 	golang.org/x/mod v0.9.0 // indirect
-	golang.org/x/net v0.8.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
 	golang.org/x/text v0.8.0 // indirect
 	golang.org/x/tools v0.7.0 // indirect
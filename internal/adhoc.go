@@ -3,6 +3,8 @@ package gofra
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"regexp"
 	"sync"
 	"time"
 )
@@ -65,6 +67,40 @@ type CommandSession struct {
 	CreatedAt time.Time
 	ExpiresAt time.Time
 	mu        sync.Mutex
+	values    FormValues
+	response  *CommandResponse
+}
+
+// Values returns the values of the form submitted last in the session.
+func (s *CommandSession) Values() FormValues {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		return FormValues{}
+	}
+	return s.values
+}
+
+// SetValues stores the values of the form submitted in the session.
+func (s *CommandSession) SetValues(values FormValues) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = values
+}
+
+// LastResponse returns the response sent last to the requester, the form of
+// which the next submission is validated against.
+func (s *CommandSession) LastResponse() *CommandResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.response
+}
+
+// SetLastResponse stores the response sent to the requester.
+func (s *CommandSession) SetLastResponse(resp *CommandResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.response = resp
 }
 
 // Get retrieves a value from session data.
@@ -323,6 +359,7 @@ func NewFormBuilder(formType, title string) *FormBuilder {
 // FormBuilder helps construct XData forms.
 type FormBuilder struct {
 	form *XData
+	err  error
 }
 
 // Instructions sets the form instructions.
@@ -374,11 +411,121 @@ func (b *FormBuilder) AddFieldWithMultipleValues(varName, fieldType, label strin
 	return b
 }
 
+// Required marks the last field added as required.
+func (b *FormBuilder) Required() *FormBuilder {
+	if f := b.last(); f != nil {
+		f.Required = &struct{}{}
+	}
+	return b
+}
+
+// Desc sets the description of the last field added.
+func (b *FormBuilder) Desc(text string) *FormBuilder {
+	if f := b.last(); f != nil {
+		f.Desc = text
+	}
+	return b
+}
+
+// Validate sets the XEP-0122 validation of the last field added.
+func (b *FormBuilder) Validate(v XDataValidate) *FormBuilder {
+	if f := b.last(); f != nil {
+		f.Validate = &v
+	}
+	return b
+}
+
+// Datatype validates the last field added as the XML Schema datatype, like
+// xs:integer.
+func (b *FormBuilder) Datatype(datatype string) *FormBuilder {
+	if v := b.validation(); v != nil {
+		v.Datatype = datatype
+	}
+	return b
+}
+
+// Range bounds the values of the last field added, empty bounds being open.
+func (b *FormBuilder) Range(min, max string) *FormBuilder {
+	if v := b.validation(); v != nil {
+		v.Range = &XDataRange{Min: min, Max: max}
+	}
+	return b
+}
+
+// Regex requires the values of the last field added to match the regular
+// expression. A regular expression failing to compile is reported by Err.
+func (b *FormBuilder) Regex(regex string) *FormBuilder {
+	if _, err := regexp.Compile(regex); err != nil && b.err == nil {
+		if f := b.last(); f != nil {
+			b.err = fmt.Errorf("invalid regex of field %s: %w", f.Var, err)
+		}
+	}
+	if v := b.validation(); v != nil {
+		v.Regex = regex
+	}
+	return b
+}
+
+// Media adds media to the last field added, like a CAPTCHA image.
+func (b *FormBuilder) Media(media XDataMedia) *FormBuilder {
+	if f := b.last(); f != nil {
+		f.Media = &media
+	}
+	return b
+}
+
+// Reported sets the columns of the table of a result form.
+func (b *FormBuilder) Reported(fields ...XDataField) *FormBuilder {
+	b.form.Reported = &XDataReported{Fields: fields}
+	return b
+}
+
+// AddItem adds a row to the table of a result form, with a value for every
+// reported column in order.
+func (b *FormBuilder) AddItem(values ...string) *FormBuilder {
+	var item XDataItem
+	if b.form.Reported != nil {
+		for i, column := range b.form.Reported.Fields {
+			field := XDataField{Var: column.Var}
+			if i < len(values) && values[i] != "" {
+				field.Values = []string{values[i]}
+			}
+			item.Fields = append(item.Fields, field)
+		}
+	}
+	b.form.Items = append(b.form.Items, item)
+	return b
+}
+
+func (b *FormBuilder) last() *XDataField {
+	if len(b.form.Fields) == 0 {
+		return nil
+	}
+	return &b.form.Fields[len(b.form.Fields)-1]
+}
+
+func (b *FormBuilder) validation() *XDataValidate {
+	f := b.last()
+	if f == nil {
+		return nil
+	}
+	if f.Validate == nil {
+		f.Validate = &XDataValidate{}
+	}
+	return f.Validate
+}
+
 // Build returns the constructed form.
 func (b *FormBuilder) Build() *XData {
 	return b.form
 }
 
+// Err returns the first error found building the form, like a regular
+// expression failing to compile.
+func (b *FormBuilder) Err() error {
+	return b.err
+}
+
 // NewInfoNote creates an info note.
 func NewInfoNote(text string) Note {
 	return Note{Type: "info", Value: text}
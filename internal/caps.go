@@ -0,0 +1,101 @@
+package gofra
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// capsQueryTimeout bounds the disco#info queries for the features behind the
+// entity capabilities of a client.
+const capsQueryTimeout = 30 * time.Second
+
+// peerCaps learns the features of the clients the bot talks to from the
+// XEP-0115 entity capabilities in their presences. The features of every
+// capabilities string are asked once, to the first client announcing it, and
+// the hash is not verified.
+type peerCaps struct {
+	g      API
+	logger Logger
+
+	mu sync.Mutex
+	// Capabilities of every client, by full JID
+	clients map[string]string
+	// Features of every capabilities string, nil while being queried
+	features map[string][]string
+}
+
+func newPeerCaps(g API, logger Logger) *peerCaps {
+	return &peerCaps{
+		g:        g,
+		logger:   logger,
+		clients:  make(map[string]string),
+		features: make(map[string][]string),
+	}
+}
+
+// update records the capabilities announced in a presence of from, and asks
+// for their features when they are not known. Unavailable clients are
+// forgotten.
+func (c *peerCaps) update(from jid.JID, typ stanza.PresenceType, node, ver string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if typ == stanza.UnavailablePresence || ver == "" {
+		delete(c.clients, from.String())
+
+		return
+	}
+
+	caps := node + "#" + ver
+	c.clients[from.String()] = caps
+
+	if _, ok := c.features[caps]; ok {
+		return
+	}
+	c.features[caps] = nil
+
+	go c.query(from, caps)
+}
+
+func (c *peerCaps) query(from jid.JID, caps string) {
+	ctx, cancel := context.WithTimeout(c.g.Context(), capsQueryTimeout)
+	defer cancel()
+
+	var info discoInfoResult
+	r, err := c.g.SendIQ(ctx, from, stanza.GetIQ, discoInfoRequest{Node: caps})
+	if err == nil {
+		err = r.Decode(&info)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.logger.Debug(fmt.Sprintf("Error discovering the features of %s: %v", caps, err))
+		// The next client announcing them is asked
+		delete(c.features, caps)
+
+		return
+	}
+
+	c.features[caps] = info.features()
+}
+
+// supports reports whether the client at to supports feature, and whether its
+// features are known at all.
+func (c *peerCaps) supports(to jid.JID, feature string) (supported, known bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	features := c.features[c.clients[to.String()]]
+	if features == nil {
+		return false, false
+	}
+
+	return containsString(features, feature), true
+}
@@ -0,0 +1,173 @@
+package gofra
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+)
+
+// ChatStatesNS is the namespace for XEP-0085 Chat State Notifications.
+const ChatStatesNS = "http://jabber.org/protocol/chatstates"
+
+// Chat states of XEP-0085. Incoming ones are published as "chatstate/<state>"
+// events.
+const (
+	ChatStateActive    = "active"
+	ChatStateComposing = "composing"
+	ChatStatePaused    = "paused"
+	ChatStateInactive  = "inactive"
+	ChatStateGone      = "gone"
+)
+
+var chatStates = []string{ChatStateActive, ChatStateComposing, ChatStatePaused, ChatStateInactive, ChatStateGone}
+
+const (
+	defaultTypingDelay       = 500 * time.Millisecond
+	defaultTypingPausedAfter = 30 * time.Second
+)
+
+// ChatStateMessage is a message carrying nothing but a chat state.
+type ChatStateMessage struct {
+	stanza.Message
+	State struct {
+		XMLName xml.Name
+	}
+	// Standalone chat states are not worth archiving (XEP-0334)
+	NoStore struct{} `xml:"urn:xmpp:hints no-store"`
+}
+
+// ChatState returns a message telling the conversation mb was received from
+// the bot is in the given chat state.
+func (mb MessageBody) ChatState(state string) ChatStateMessage {
+	reply := mb.Reply("")
+
+	msg := ChatStateMessage{Message: reply.Message}
+	msg.State.XMLName = xml.Name{Space: ChatStatesNS, Local: state}
+
+	return msg
+}
+
+// Typing tells the conversation mb was received from that the bot is composing
+// an answer, until the returned function is called. Nothing is sent for
+// answers taking less than the configured delay, and the bot pauses when
+// composing takes too long. It is meant to wrap handlers that can take a while:
+//
+//	done := gofra.Typing(g, e.MB, config.ChatStates)
+//	defer done()
+func Typing(g API, mb MessageBody, config ChatStatesConfig) (done func()) {
+	if config.Disabled {
+		return func() {}
+	}
+
+	delay, pausedAfter := config.Delay, config.PausedAfter
+	if delay == 0 {
+		delay = defaultTypingDelay
+	}
+	if pausedAfter == 0 {
+		pausedAfter = defaultTypingPausedAfter
+	}
+
+	// Addressed right away, as the bot nicknames can change meanwhile
+	messages := make(map[string]ChatStateMessage)
+	for _, state := range []string{ChatStateComposing, ChatStatePaused, ChatStateActive} {
+		messages[state] = mb.ChatState(state)
+	}
+
+	send := func(state string) {
+		if err := g.SendStanza(messages[state]); err != nil {
+			g.Logger().Error(fmt.Sprintf("Error sending chat state %s: %v", state, err))
+		}
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-g.Clock().After(delay):
+		case <-stop:
+			return
+		}
+
+		send(ChatStateComposing)
+
+		select {
+		case <-g.Clock().After(pausedAfter):
+			send(ChatStatePaused)
+			<-stop
+		case <-stop:
+		}
+
+		send(ChatStateActive)
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-stopped
+		})
+	}
+}
+
+// chatStateHandler publishes the chat states received.
+type chatStateHandler struct {
+	logger  Logger
+	publish func(e Event)
+	state   string
+	// self reports whether a message from a room was sent by the bot
+	self func(from jid.JID) bool
+}
+
+// muxOptions registers a handler for every chat state, in chats and MUCs.
+func (h chatStateHandler) muxOptions() []mux.Option {
+	var opts []mux.Option
+	for _, state := range chatStates {
+		h.state = state
+		name := xml.Name{Space: ChatStatesNS, Local: state}
+		opts = append(opts,
+			mux.Message(stanza.ChatMessage, name, h),
+			mux.Message(stanza.GroupChatMessage, name, h),
+		)
+	}
+
+	return opts
+}
+
+func (h chatStateHandler) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEncoder) error {
+	mb := MessageBody{}
+	if err := xml.NewTokenDecoder(t).Decode(&mb); err != nil && err != io.EOF {
+		h.logger.Error(fmt.Sprintf("Error decoding message: %q", err))
+
+		return nil
+	}
+
+	// Our own chat states are reflected by the MUC
+	if msg.Type == stanza.GroupChatMessage && h.self(msg.From) {
+		return nil
+	}
+
+	h.logger.Debug(fmt.Sprintf("Chat state %s received from %s", h.state, msg.From))
+
+	e := Event{
+		Name:    "chatstate/" + h.state,
+		MB:      mb,
+		Payload: map[string]interface{}{"state": h.state},
+	}
+
+	e.SetStanza(mb)
+
+	go h.publish(e)
+
+	return nil
+}
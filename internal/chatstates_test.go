@@ -0,0 +1,156 @@
+package gofra_test
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+// slowPlugin answers "!slow" once released and "!fast" right away, and records
+// the chat states received.
+type slowPlugin struct {
+	g       gofra.API
+	release chan struct{}
+	states  chan gofra.Event
+}
+
+func newSlowPlugin() *slowPlugin {
+	return &slowPlugin{release: make(chan struct{}), states: make(chan gofra.Event, 10)}
+}
+
+func (p *slowPlugin) Name() string        { return "Slow" }
+func (p *slowPlugin) Description() string { return "" }
+func (p *slowPlugin) Help() string        { return "" }
+
+func (p *slowPlugin) Init(config gofra.Config, g gofra.API) {
+	p.g = g
+
+	g.Subscribe("command/slow", p.Name(), func(e gofra.Event) *gofra.Reply {
+		<-p.release
+		_ = g.SendStanza(e.MB.Reply("Done"))
+
+		return nil
+	}, 0)
+
+	g.Subscribe("command/fast", p.Name(), func(e gofra.Event) *gofra.Reply {
+		_ = g.SendStanza(e.MB.Reply("Done"))
+
+		return nil
+	}, 0)
+
+	g.Subscribe("chatstate/composing", p.Name(), func(e gofra.Event) *gofra.Reply {
+		p.states <- e
+
+		return nil
+	}, 0)
+}
+
+func chatStateTo(to, state string) func(gofratest.Stanza) bool {
+	return func(st gofratest.Stanza) bool {
+		return st.XMLName.Local == "message" && st.Attr("to") == to &&
+			st.Child() == xml.Name{Space: gofra.ChatStatesNS, Local: state}
+	}
+}
+
+func TestTyping(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.ChatStates = gofra.ChatStatesConfig{Delay: time.Millisecond, PausedAfter: 50 * time.Millisecond}
+	}))
+	p := newSlowPlugin()
+	h.Start(p, gofratest.Commands("!"))
+
+	h.Say("alice@example.com/phone", "!slow")
+	h.ExpectStanza("composing", chatStateTo("alice@example.com/phone", gofra.ChatStateComposing))
+	h.ExpectStanza("paused", chatStateTo("alice@example.com/phone", gofra.ChatStatePaused))
+
+	close(p.release)
+	h.ExpectMessage("alice@example.com/phone", "^Done$")
+	h.ExpectStanza("active", chatStateTo("alice@example.com/phone", gofra.ChatStateActive))
+}
+
+func TestTyping_MUC(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom("room@muc.example.com", "alice"), gofratest.WithConfig(func(c *gofra.Config) {
+		c.ChatStates = gofra.ChatStatesConfig{Delay: time.Millisecond}
+	}))
+	p := newSlowPlugin()
+	h.Start(p, gofratest.Commands("!"))
+
+	h.Say("room@muc.example.com/alice", "!slow")
+	st := h.ExpectStanza("composing", chatStateTo("room@muc.example.com", gofra.ChatStateComposing))
+	assert.Equal(t, "groupchat", st.Attr("type"))
+
+	close(p.release)
+	h.ExpectMessage("room@muc.example.com", "^Done$")
+	h.ExpectStanza("active", chatStateTo("room@muc.example.com", gofra.ChatStateActive))
+}
+
+func TestTyping_Fast(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.ChatStates = gofra.ChatStatesConfig{Delay: 100 * time.Millisecond}
+	}))
+	h.Start(newSlowPlugin(), gofratest.Commands("!"))
+
+	h.Say("alice@example.com/phone", "!fast")
+	h.ExpectMessage("alice@example.com/phone", "^Done$")
+
+	time.Sleep(150 * time.Millisecond)
+	for _, st := range h.Server.Sent() {
+		assert.NotEqual(t, gofra.ChatStatesNS, st.Child().Space, "unexpected chat state %s", st)
+	}
+}
+
+func TestTyping_UnknownCommand(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.ChatStates = gofra.ChatStatesConfig{Delay: time.Millisecond}
+	}))
+	h.Start(newSlowPlugin(), gofratest.Commands("!"))
+
+	h.Say("alice@example.com/phone", "!unknown")
+
+	time.Sleep(50 * time.Millisecond)
+	for _, st := range h.Server.Sent() {
+		assert.NotEqual(t, gofra.ChatStatesNS, st.Child().Space, "unexpected chat state %s", st)
+	}
+}
+
+func TestChatStates_Received(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom("room@muc.example.com", "alice"))
+	p := newSlowPlugin()
+	h.Start(p)
+
+	// Our own chat states reflected by the room are ignored
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" from="room@muc.example.com/Gofra" to="gofra@example.com/gofratest"><composing xmlns="http://jabber.org/protocol/chatstates"/></message>`)
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" from="room@muc.example.com/alice" to="gofra@example.com/gofratest"><composing xmlns="http://jabber.org/protocol/chatstates"/></message>`)
+	h.Server.Send(`<message xmlns="jabber:client" type="chat" from="bob@example.com/phone" to="gofra@example.com/gofratest"><composing xmlns="http://jabber.org/protocol/chatstates"/></message>`)
+
+	var from []string
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-p.states:
+			assert.Equal(t, gofra.ChatStateComposing, e.Payload["state"])
+			from = append(from, e.MB.From.String())
+		case <-time.After(time.Second):
+			t.Fatal("chat state not published")
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"room@muc.example.com/alice", "bob@example.com/phone"}, from)
+
+	select {
+	case e := <-p.states:
+		t.Fatalf("unexpected chat state from %s", e.MB.From)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChatStates_Advertised(t *testing.T) {
+	h := gofratest.New(t)
+	h.Start()
+
+	assert.Contains(t, h.Gofra.Disco().Features(), gofra.ChatStatesNS)
+}
@@ -0,0 +1,29 @@
+package gofra
+
+import "time"
+
+// Clock tells plugins the time, so that tests can control it.
+type Clock interface {
+	Now() time.Time
+	// After waits for the duration to elapse and then sends the current time
+	After(d time.Duration) <-chan time.Time
+	// At sends the current time once it is t, right away if t is in the past
+	At(t time.Time) <-chan time.Time
+}
+
+// SystemClock is the Clock of the engine unless set otherwise.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) At(t time.Time) <-chan time.Time {
+	return time.After(time.Until(t))
+}
@@ -1,15 +1,115 @@
 package gofra
 
+import (
+	"path/filepath"
+	"time"
+)
+
+const defaultDataDir = "/data"
+
 type Config struct {
-	Password    string                            `yaml:"password"`
-	PluginPaths []string                          `yaml:"pluginPaths"`
-	Jid         string                            `yaml:"jid"`
-	Nick        string                            `yaml:"nick"`
-	LogXML      bool                              `yaml:"logXML"`
-	Debug       bool                              `yaml:"debug"`
-	SkipSRV     bool                              `yaml:"skipSRV"`
-	MUCs        []MUCConfig                       `yaml:"mucs"`
-	Plugins     map[string]map[string]interface{} `yaml:"plugins"`
+	Password       string                            `yaml:"password"`
+	PluginPaths    []string                          `yaml:"pluginPaths"`
+	Jid            string                            `yaml:"jid"`
+	Nick           string                            `yaml:"nick"`
+	LogXML         bool                              `yaml:"logXML"`
+	Debug          bool                              `yaml:"debug"`
+	SkipSRV        bool                              `yaml:"skipSRV"`
+	WebSocket      WebSocketConfig                   `yaml:"websocket"`
+	DataDir        string                            `yaml:"dataDir"`
+	MUCs           []MUCConfig                       `yaml:"mucs"`
+	Keepalive      KeepaliveConfig                   `yaml:"keepalive"`
+	RateLimit      RateLimitConfig                   `yaml:"rateLimit"`
+	Messages       MessagesConfig                    `yaml:"messages"`
+	Roster         RosterConfig                      `yaml:"roster"`
+	ChatStates     ChatStatesConfig                  `yaml:"chatStates"`
+	EnabledPlugins []string                          `yaml:"enabledPlugins"`
+	Plugins        map[string]map[string]interface{} `yaml:"plugins"`
+	Accounts       []AccountConfig                   `yaml:"accounts"`
+}
+
+// Per-account configuration. Nick, enabled plugins and plugin configuration
+// default to the top-level ones.
+type AccountConfig struct {
+	Jid            string                            `yaml:"jid"`
+	Password       string                            `yaml:"password"`
+	Nick           string                            `yaml:"nick"`
+	MUCs           []MUCConfig                       `yaml:"mucs"`
+	WebSocket      *WebSocketConfig                  `yaml:"websocket"`
+	EnabledPlugins []string                          `yaml:"enabledPlugins"`
+	Plugins        map[string]map[string]interface{} `yaml:"plugins"`
+}
+
+// AccountConfigs returns the configuration of every account to run. Without
+// an accounts list the top-level configuration is the only account.
+// Each account of the list persists its data in its own directory under DataDir.
+func (c Config) AccountConfigs() []Config {
+	if c.DataDir == "" {
+		c.DataDir = defaultDataDir
+	}
+
+	if len(c.Accounts) == 0 {
+		return []Config{c}
+	}
+
+	configs := make([]Config, 0, len(c.Accounts))
+	for _, account := range c.Accounts {
+		ac := c
+		ac.Accounts = nil
+		ac.Jid = account.Jid
+		ac.Password = account.Password
+		ac.MUCs = account.MUCs
+		ac.DataDir = filepath.Join(c.DataDir, account.Jid)
+
+		if account.Nick != "" {
+			ac.Nick = account.Nick
+		}
+
+		if account.WebSocket != nil {
+			ac.WebSocket = *account.WebSocket
+		}
+
+		if account.EnabledPlugins != nil {
+			ac.EnabledPlugins = account.EnabledPlugins
+		}
+
+		ac.Plugins = make(map[string]map[string]interface{}, len(c.Plugins)+len(account.Plugins))
+		for name, pluginConfig := range c.Plugins {
+			ac.Plugins[name] = pluginConfig
+		}
+		for name, pluginConfig := range account.Plugins {
+			ac.Plugins[name] = pluginConfig
+		}
+
+		configs = append(configs, ac)
+	}
+
+	return configs
+}
+
+// IsPluginEnabled reports whether a plugin is to be loaded. All plugins are
+// enabled when EnabledPlugins is empty.
+func (c Config) IsPluginEnabled(name string) bool {
+	if len(c.EnabledPlugins) == 0 {
+		return true
+	}
+
+	for _, enabled := range c.EnabledPlugins {
+		if enabled == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebSocket transport (RFC 7395) configuration. The endpoint is discovered
+// through the server's host-meta file when URL is empty.
+type WebSocketConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	URL      string `yaml:"url"`
+	Origin   string `yaml:"origin"`
+	Insecure bool   `yaml:"insecure"`
 }
 
 // Per-MUC configuration
@@ -18,4 +118,60 @@ type MUCConfig struct {
 	JoinHistory int    `yaml:"mucJoinHistory"`
 	Jid         string `yaml:"mucJid"`
 	Password    string `yaml:"mucPasword"`
+	// Replay the messages archived by the room while the bot was out of it
+	CatchUp bool `yaml:"mucCatchUp"`
+}
+
+// Keepalive configuration (XEP-0199 pings and XEP-0410 MUC self-pings).
+// A zero Interval disables pinging.
+type KeepaliveConfig struct {
+	Interval    time.Duration `yaml:"interval"`
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxFailures int           `yaml:"maxFailures"`
+	MUCSelfPing bool          `yaml:"mucSelfPing"`
+	Reconnect   bool          `yaml:"reconnect"`
+}
+
+// Outbound rate limiting configuration. Rates are in stanzas per second, a zero
+// Rate and GlobalRate disables the outbound shaper.
+type RateLimitConfig struct {
+	Rate        float64 `yaml:"rate"`
+	Burst       int     `yaml:"burst"`
+	GlobalRate  float64 `yaml:"globalRate"`
+	GlobalBurst int     `yaml:"globalBurst"`
+	MaxQueue    int     `yaml:"maxQueue"`
+}
+
+// Outgoing message configuration. MaxLength is keyed by message type (chat,
+// groupchat, normal); longer bodies are split on line boundaries. Formatted
+// messages use XEP-0393 message styling unless Formatting is "plain", and
+// also carry an XHTML-IM body when XHTML is set.
+type MessagesConfig struct {
+	MaxLength          map[string]int `yaml:"maxLength"`
+	MaxParts           int            `yaml:"maxParts"`
+	RestInPrivate      bool           `yaml:"restInPrivate"`
+	ContinuationMarker string         `yaml:"continuationMarker"`
+	MoreHint           string         `yaml:"moreHint"`
+	Formatting         string         `yaml:"formatting"`
+	XHTML              bool           `yaml:"xhtml"`
+}
+
+// Roster configuration. Subscriptions is the policy for subscription requests:
+// "accept" them all, accept the JIDs and domains in Allow with "allowlist", or
+// "ask" Owner for the ones not in it. They are left unanswered by default.
+// SubscribeBack asks for a subscription in return when accepting one.
+type RosterConfig struct {
+	Subscriptions string   `yaml:"subscriptions"`
+	Allow         []string `yaml:"allow"`
+	Owner         string   `yaml:"owner"`
+	SubscribeBack bool     `yaml:"subscribeBack"`
+}
+
+// Chat state notifications (XEP-0085) configuration. Plugins tell they are
+// composing an answer when it takes longer than Delay, 500ms by default, and
+// that they paused after PausedAfter, 30s by default.
+type ChatStatesConfig struct {
+	Disabled    bool          `yaml:"disabled"`
+	Delay       time.Duration `yaml:"delay"`
+	PausedAfter time.Duration `yaml:"pausedAfter"`
 }
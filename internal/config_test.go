@@ -0,0 +1,74 @@
+package gofra
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountConfigs_SingleAccount(t *testing.T) {
+	config := Config{Jid: "bot@example.com", Nick: "gofra"}
+
+	configs := config.AccountConfigs()
+	assert.Len(t, configs, 1)
+	assert.Equal(t, "bot@example.com", configs[0].Jid)
+	assert.Equal(t, defaultDataDir, configs[0].DataDir)
+}
+
+func TestAccountConfigs_Accounts(t *testing.T) {
+	config := Config{
+		Nick:           "gofra",
+		DataDir:        "/tmp/gofra",
+		EnabledPlugins: []string{"Commands", "Dice"},
+		Plugins: map[string]map[string]interface{}{
+			"Commands": {"commandChar": "!"},
+			"Dice":     {"faces": 6},
+		},
+		Accounts: []AccountConfig{
+			{
+				Jid:  "one@example.com",
+				MUCs: []MUCConfig{{Jid: "room@muc.example.com"}},
+			},
+			{
+				Jid:            "two@example.org",
+				Nick:           "gofra2",
+				EnabledPlugins: []string{"Commands"},
+				Plugins: map[string]map[string]interface{}{
+					"Commands": {"commandChar": "."},
+				},
+			},
+		},
+	}
+
+	configs := config.AccountConfigs()
+	assert.Len(t, configs, 2)
+
+	one, two := configs[0], configs[1]
+
+	assert.Equal(t, "one@example.com", one.Jid)
+	assert.Equal(t, "gofra", one.Nick)
+	assert.Equal(t, "/tmp/gofra/one@example.com", one.DataDir)
+	assert.Len(t, one.MUCs, 1)
+	assert.Equal(t, []string{"Commands", "Dice"}, one.EnabledPlugins)
+	assert.Equal(t, "!", one.Plugins["Commands"]["commandChar"])
+	assert.Nil(t, one.Accounts)
+
+	assert.Equal(t, "two@example.org", two.Jid)
+	assert.Equal(t, "gofra2", two.Nick)
+	assert.Equal(t, "/tmp/gofra/two@example.org", two.DataDir)
+	assert.Empty(t, two.MUCs)
+	assert.Equal(t, []string{"Commands"}, two.EnabledPlugins)
+	assert.Equal(t, ".", two.Plugins["Commands"]["commandChar"])
+	assert.Equal(t, 6, two.Plugins["Dice"]["faces"])
+
+	// Account overrides must not leak into the shared configuration
+	assert.Equal(t, "!", config.Plugins["Commands"]["commandChar"])
+}
+
+func TestIsPluginEnabled(t *testing.T) {
+	assert.True(t, Config{}.IsPluginEnabled("Dice"))
+
+	config := Config{EnabledPlugins: []string{"Commands"}}
+	assert.True(t, config.IsPluginEnabled("Commands"))
+	assert.False(t, config.IsPluginEnabled("Dice"))
+}
@@ -0,0 +1,70 @@
+package gofra
+
+import "sync"
+
+// CorrectNS is the namespace for XEP-0308 Last Message Correction.
+const CorrectNS = "urn:xmpp:message-correct:0"
+
+// maxCorrectableMessages is how many received messages the IDs of the replies
+// to are kept, to correct them when the messages are.
+const maxCorrectableMessages = 1000
+
+// Replace marks a message as the correction of the one with ID.
+type Replace struct {
+	ID string `xml:"id,attr"`
+}
+
+// corrections turns the replies to a corrected message into corrections of the
+// replies to the original one. The n-th reply to the correction replaces the
+// n-th reply to the original message, any further one is sent as a new message.
+type corrections struct {
+	mu sync.Mutex
+	// IDs of the replies sent to every message, by sender and message ID
+	replies map[string][]string
+	order   []string
+}
+
+func newCorrections() *corrections {
+	return &corrections{replies: make(map[string][]string)}
+}
+
+// apply records the ID of a reply, giving it its own one if it has none or
+// the one of the message it answers, and marks it as a correction when it
+// answers a corrected message.
+func (c *corrections) apply(mb MessageBody) MessageBody {
+	if mb.inReplyTo == "" {
+		return mb
+	}
+
+	if mb.ID == "" || mb.ID == mb.inReplyTo {
+		mb.ID = generateSessionID()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := mb.requester.String() + " " + mb.inReplyTo
+	sent := len(c.replies[key])
+
+	id := mb.ID
+	if mb.correcting != "" {
+		original := c.replies[mb.requester.String()+" "+mb.correcting]
+		if sent < len(original) {
+			// Later corrections replace the original reply too
+			id = original[sent]
+			mb.Replace = &Replace{ID: id}
+		}
+	}
+
+	if sent == 0 {
+		c.order = append(c.order, key)
+	}
+	c.replies[key] = append(c.replies[key], id)
+
+	for len(c.order) > maxCorrectableMessages {
+		delete(c.replies, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	return mb
+}
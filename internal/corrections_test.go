@@ -0,0 +1,61 @@
+package gofra
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+func chatMessage(id, replaces string) MessageBody {
+	mb := MessageBody{
+		Message: stanza.Message{
+			ID:   id,
+			Type: stanza.ChatMessage,
+			From: jid.MustParse("alice@example.com/phone"),
+			To:   jid.MustParse("bot@example.com/gofra"),
+		},
+	}
+	if replaces != "" {
+		mb.Replace = &Replace{ID: replaces}
+	}
+
+	return mb
+}
+
+func TestCorrections(t *testing.T) {
+	c := newCorrections()
+
+	first := c.apply(chatMessage("m1", "").Reply("one"))
+	second := c.apply(chatMessage("m1", "").Reply("two"))
+	assert.NotEqual(t, "m1", first.ID)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Nil(t, first.Replace)
+
+	// Every reply to the correction replaces the matching original one
+	correction := chatMessage("m2", "m1")
+	assert.Equal(t, "m1", correction.Replaces())
+	assert.Equal(t, first.ID, c.apply(correction.Reply("uno")).Replaces())
+	assert.Equal(t, second.ID, c.apply(correction.Reply("dos")).Replaces())
+	assert.Empty(t, c.apply(correction.Reply("tres")).Replaces())
+
+	// Whether later corrections refer to the original message or the last one
+	assert.Equal(t, first.ID, c.apply(chatMessage("m3", "m1").Reply("ein")).Replaces())
+	assert.Equal(t, first.ID, c.apply(chatMessage("m4", "m2").Reply("un")).Replaces())
+
+	// Messages not answering one are left alone
+	assert.Empty(t, c.apply(MessageBody{Body: "hi"}).ID)
+}
+
+func TestCorrections_Forget(t *testing.T) {
+	c := newCorrections()
+
+	c.apply(chatMessage("m0", "").Reply("zero"))
+	for i := 1; i <= maxCorrectableMessages; i++ {
+		c.apply(chatMessage(fmt.Sprintf("msg%d", i), "").Reply("..."))
+	}
+
+	assert.Empty(t, c.apply(chatMessage("m1", "m0").Reply("cero")).Replaces())
+}
@@ -0,0 +1,332 @@
+package gofra
+
+import (
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/crypto"
+	"mellium.im/xmpp/disco"
+	"mellium.im/xmpp/disco/info"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	// DiscoInfoNS is the namespace for XEP-0030 disco#info queries.
+	DiscoInfoNS = "http://jabber.org/protocol/disco#info"
+
+	// DiscoItemsNS is the namespace for XEP-0030 disco#items queries.
+	DiscoItemsNS = "http://jabber.org/protocol/disco#items"
+
+	// CapsNS is the namespace for XEP-0115 Entity Capabilities.
+	CapsNS = "http://jabber.org/protocol/caps"
+
+	// CapsNode identifies Gofra in the entity capabilities it advertises.
+	CapsNode = "https://github.com/XaviFP/gofra"
+)
+
+// DiscoNode is a node of the bot that can be queried with disco#info and
+// disco#items, besides the bot itself.
+type DiscoNode struct {
+	// Name of the node. Nodes with a name are listed in the items of the bot.
+	Name       string
+	Identities []Identity
+	Features   []string
+
+	// Items returns the items of the node for the JID querying it, given the
+	// JID of the bot it was queried on, or nil if the node has none.
+	Items func(bot, requester jid.JID) []Item
+}
+
+// Disco is the registry of what the bot advertises through XEP-0030 Service
+// Discovery. Plugins declare the features and identities of the bot, and the
+// nodes they serve, and the engine answers disco#info and disco#items queries
+// from it. The root features and identities are also advertised in every
+// presence the engine sends, as a XEP-0115 caps hash.
+type Disco struct {
+	mu         sync.RWMutex
+	identities []Identity
+	features   []string
+	nodes      map[string]DiscoNode
+	ver        string
+
+	// changed is called when the root identities or features change.
+	changed func()
+}
+
+// NewDisco returns a registry advertising the bot as an automated client,
+// supporting service discovery and entity capabilities.
+func NewDisco() *Disco {
+	return &Disco{
+		identities: []Identity{{Category: "client", Type: "bot", Name: "Gofra"}},
+		features:   []string{DiscoInfoNS, DiscoItemsNS, CapsNS},
+		nodes:      make(map[string]DiscoNode),
+	}
+}
+
+// AddFeature advertises features of the bot. Features already advertised are
+// ignored.
+func (d *Disco) AddFeature(features ...string) {
+	d.mu.Lock()
+
+	added := false
+	for _, f := range features {
+		if !containsString(d.features, f) {
+			d.features = append(d.features, f)
+			added = true
+		}
+	}
+
+	d.mu.Unlock()
+
+	if added {
+		d.notify()
+	}
+}
+
+// RemoveFeature stops advertising features of the bot.
+func (d *Disco) RemoveFeature(features ...string) {
+	d.mu.Lock()
+
+	kept := d.features[:0]
+	for _, f := range d.features {
+		if !containsString(features, f) {
+			kept = append(kept, f)
+		}
+	}
+
+	removed := len(kept) != len(d.features)
+	d.features = kept
+
+	d.mu.Unlock()
+
+	if removed {
+		d.notify()
+	}
+}
+
+// AddIdentity advertises an identity of the bot, besides the client/bot one.
+func (d *Disco) AddIdentity(identity Identity) {
+	d.mu.Lock()
+
+	for _, i := range d.identities {
+		if i == identity {
+			d.mu.Unlock()
+
+			return
+		}
+	}
+
+	d.identities = append(d.identities, identity)
+
+	d.mu.Unlock()
+
+	d.notify()
+}
+
+// SetNode adds a node, or replaces the one with the same name.
+func (d *Disco) SetNode(node string, n DiscoNode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nodes[node] = n
+}
+
+// RemoveNode removes a node added with SetNode.
+func (d *Disco) RemoveNode(node string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.nodes, node)
+}
+
+// Features returns the features of the bot.
+func (d *Disco) Features() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]string{}, d.features...)
+}
+
+// Info returns the answer to a disco#info query on a node, or false if there
+// is no such node. The empty node, and the one advertised in the caps hash,
+// are the bot itself.
+func (d *Disco) Info(node string) (*Query, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	q := &Query{XMLNS: DiscoInfoNS, Node: node}
+
+	if node == "" || strings.HasPrefix(node, CapsNode+"#") {
+		q.Identities = append(q.Identities, d.identities...)
+		for _, f := range d.features {
+			q.Features = append(q.Features, Feature{Var: f})
+		}
+
+		return q, true
+	}
+
+	n, ok := d.nodes[node]
+	if !ok {
+		return nil, false
+	}
+
+	q.Identities = append(q.Identities, n.Identities...)
+	for _, f := range n.Features {
+		q.Features = append(q.Features, Feature{Var: f})
+	}
+
+	return q, true
+}
+
+// Items returns the answer to a disco#items query on a node, sent by
+// requester to the bot, or false if there is no such node.
+func (d *Disco) Items(node string, bot, requester jid.JID) (*Query, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	q := &Query{XMLNS: DiscoItemsNS, Node: node}
+
+	if node == "" {
+		for name, n := range d.nodes {
+			if n.Name != "" {
+				q.Items = append(q.Items, Item{JID: bot, Node: name, Name: n.Name})
+			}
+		}
+
+		sort.Slice(q.Items, func(i, j int) bool {
+			return q.Items[i].Node < q.Items[j].Node
+		})
+
+		return q, true
+	}
+
+	n, ok := d.nodes[node]
+	if !ok {
+		return nil, false
+	}
+
+	if n.Items != nil {
+		q.Items = n.Items(bot, requester)
+	}
+
+	return q, true
+}
+
+// Caps returns the XEP-0115 entity capabilities of the bot.
+func (d *Disco) Caps() disco.Caps {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ver == "" {
+		var i disco.Info
+		for _, identity := range d.identities {
+			i.Identity = append(i.Identity, info.Identity{
+				Category: identity.Category,
+				Type:     identity.Type,
+				Name:     identity.Name,
+			})
+		}
+
+		for _, f := range d.features {
+			i.Features = append(i.Features, info.Feature{Var: f})
+		}
+
+		d.ver = i.Hash(sha1.New())
+	}
+
+	return disco.Caps{Hash: crypto.SHA1, Node: CapsNode, Ver: d.ver}
+}
+
+func (d *Disco) notify() {
+	d.mu.Lock()
+	d.ver = ""
+	changed := d.changed
+	d.mu.Unlock()
+
+	if changed != nil {
+		changed()
+	}
+}
+
+// discoInfoRequest queries the features of an entity, or of one of its nodes.
+type discoInfoRequest struct {
+	XMLName xml.Name `xml:"http://jabber.org/protocol/disco#info query"`
+	Node    string   `xml:"node,attr,omitempty"`
+}
+
+// discoItemsRequest queries the items of an entity.
+type discoItemsRequest struct {
+	XMLName xml.Name `xml:"http://jabber.org/protocol/disco#items query"`
+}
+
+// discoInfoResult is a disco#info response, with its XEP-0128 extended forms.
+type discoInfoResult struct {
+	Identities []Identity `xml:"identity"`
+	Features   []Feature  `xml:"feature"`
+	Forms      []XData    `xml:"jabber:x:data x"`
+}
+
+func (r discoInfoResult) features() []string {
+	features := make([]string, len(r.Features))
+	for i, f := range r.Features {
+		features[i] = f.Var
+	}
+
+	return features
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// discoHandler answers the disco#info and disco#items queries sent to the bot
+// from the registry.
+type discoHandler struct {
+	disco  *Disco
+	logger Logger
+}
+
+func (h discoHandler) HandleIQ(iq stanza.IQ, t xmlstream.TokenReadEncoder, start *xml.StartElement) error {
+	var node string
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "node" {
+			node = attr.Value
+		}
+	}
+
+	gIQ := IQ{IQ: iq}
+
+	var q *Query
+	var ok bool
+	switch start.Name.Space {
+	case DiscoInfoNS:
+		q, ok = h.disco.Info(node)
+	case DiscoItemsNS:
+		q, ok = h.disco.Items(node, iq.To, iq.From)
+	}
+
+	var response interface{} = NewItemNotFoundError(gIQ)
+	if ok {
+		reply := gIQ.Reply()
+		reply.Query = q
+		response = reply
+	}
+
+	if err := encodeTokens(t, response); err != nil {
+		h.logger.Error(fmt.Sprintf("Error answering %s query: %v", start.Name.Space, err))
+	}
+
+	return nil
+}
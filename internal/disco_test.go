@@ -0,0 +1,96 @@
+package gofra
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+)
+
+func TestDisco_Caps(t *testing.T) {
+	// Simple generation example of XEP-0115
+	d := &Disco{
+		identities: []Identity{{Category: "client", Type: "pc", Name: "Exodus 0.9.1"}},
+		features: []string{
+			DiscoInfoNS,
+			DiscoItemsNS,
+			"http://jabber.org/protocol/muc",
+			CapsNS,
+		},
+		nodes: make(map[string]DiscoNode),
+	}
+
+	caps := d.Caps()
+	assert.Equal(t, "QgayPKawpkPSDYmwT/WM94uAlu0=", caps.Ver)
+	assert.Equal(t, CapsNode, caps.Node)
+
+	d.AddFeature("urn:xmpp:ping")
+	assert.NotEqual(t, "QgayPKawpkPSDYmwT/WM94uAlu0=", d.Caps().Ver)
+}
+
+func TestDisco_ChangedOnlyOnNewFeatures(t *testing.T) {
+	d := NewDisco()
+
+	changes := 0
+	d.changed = func() { changes++ }
+
+	d.AddFeature(DiscoInfoNS)
+	assert.Equal(t, 0, changes)
+
+	d.AddFeature("urn:xmpp:ping")
+	d.RemoveFeature("urn:xmpp:ping")
+	d.RemoveFeature("urn:xmpp:ping")
+	assert.Equal(t, 2, changes)
+}
+
+func TestDisco_Info(t *testing.T) {
+	d := NewDisco()
+	d.AddFeature("urn:xmpp:ping")
+	d.SetNode("greet", DiscoNode{
+		Identities: []Identity{{Name: "Greet", Category: "automation", Type: "command-node"}},
+		Features:   []string{CommandsNS},
+	})
+
+	q, ok := d.Info("")
+	assert.True(t, ok)
+	assert.Equal(t, []Identity{{Category: "client", Type: "bot", Name: "Gofra"}}, q.Identities)
+	assert.Contains(t, q.Features, Feature{Var: "urn:xmpp:ping"})
+
+	q, ok = d.Info(CapsNode + "#" + d.Caps().Ver)
+	assert.True(t, ok)
+	assert.Contains(t, q.Features, Feature{Var: "urn:xmpp:ping"})
+
+	q, ok = d.Info("greet")
+	assert.True(t, ok)
+	assert.Equal(t, "greet", q.Node)
+	assert.Equal(t, []Feature{{Var: CommandsNS}}, q.Features)
+
+	d.RemoveNode("greet")
+	_, ok = d.Info("greet")
+	assert.False(t, ok)
+}
+
+func TestDisco_Items(t *testing.T) {
+	bot := jid.MustParse("gofra@example.com/bot")
+	alice := jid.MustParse("alice@example.com/phone")
+
+	d := NewDisco()
+	d.SetNode("lists", DiscoNode{
+		Name: "Lists",
+		Items: func(bot, requester jid.JID) []Item {
+			return []Item{{JID: bot, Node: "lists/" + requester.Localpart()}}
+		},
+	})
+	d.SetNode("hidden", DiscoNode{})
+
+	q, ok := d.Items("", bot, alice)
+	assert.True(t, ok)
+	assert.Equal(t, []Item{{JID: bot, Node: "lists", Name: "Lists"}}, q.Items)
+
+	q, ok = d.Items("lists", bot, alice)
+	assert.True(t, ok)
+	assert.Equal(t, []Item{{JID: bot, Node: "lists/alice"}}, q.Items)
+
+	_, ok = d.Items("missing", bot, alice)
+	assert.False(t, ok)
+}
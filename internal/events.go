@@ -1,6 +1,7 @@
 package gofra
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"sort"
@@ -89,6 +90,11 @@ func (em EventManager) Publish(event Event) *Reply {
 	return reply
 }
 
+// HasHandlers reports whether any handler is subscribed to the event.
+func (em EventManager) HasHandlers(eventName string) bool {
+	return len(em.handlers[eventName]) > 0
+}
+
 func (em EventManager) SetPriority(eventName, pluginName string, priority int) error {
 	var priorityChanged, pluginFound bool
 
@@ -130,10 +136,13 @@ func (em EventManager) sort(eventName string) {
 }
 
 type Event struct {
-	Name        string
-	MB          MessageBody
-	Payload     map[string]interface{}
-	iqEncoder   xmlstream.TokenWriter // For IQ responses, write here instead of session
+	Name      string
+	Account   string // Bare JID of the account the event was published on
+	MB        MessageBody
+	Payload   map[string]interface{}
+	IsHistory bool                  // Message replayed from the history of a room
+	IsSelf    bool                  // Message of the bot echoed by a room
+	iqEncoder xmlstream.TokenWriter // For IQ responses, write here instead of session
 }
 
 func (e *Event) SetStanza(stanza interface{}) {
@@ -219,6 +228,31 @@ func (r *Reply) GetAnswer() string {
 	return strAnswer
 }
 
+// ErrNotHandled is returned by Reply.Err when no plugin answered an event.
+var ErrNotHandled = errors.New("event not handled")
+
+// SetError reports the request made by publishing an event failed. A nil error
+// reports it succeeded.
+func (r *Reply) SetError(err error) {
+	if r.Payload == nil {
+		r.Payload = make(map[string]interface{})
+	}
+
+	r.Payload["error"] = err
+}
+
+// Err returns the error a request made by publishing an event failed with, or
+// ErrNotHandled if no plugin answered it.
+func (r *Reply) Err() error {
+	if r == nil {
+		return ErrNotHandled
+	}
+
+	err, _ := r.Payload["error"].(error)
+
+	return err
+}
+
 func runHandler(h EventHandler, e Event) *Reply {
 	defer func() {
 		if err := recover(); err != nil {
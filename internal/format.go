@@ -0,0 +1,399 @@
+package gofra
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// StylingNS is the namespace for XEP-0393 Message Styling.
+	StylingNS = "urn:xmpp:styling:0"
+
+	// XHTMLIMNS is the namespace for XEP-0071 XHTML-IM.
+	XHTMLIMNS = "http://jabber.org/protocol/xhtml-im"
+)
+
+// Style of a span of text. Styles can be combined, e.g. StyleBold|StyleItalic.
+type Style int
+
+const (
+	StyleBold Style = 1 << iota
+	StyleItalic
+	StyleStrike
+	// StyleCode spans are monospaced and never combined with other styles.
+	StyleCode
+)
+
+// Span is a run of text with the same style.
+type Span struct {
+	Text  string
+	Style Style
+}
+
+// Plain returns a span of unstyled text.
+func Plain(text string) Span {
+	return Span{Text: text}
+}
+
+// Bold returns a span of bold text.
+func Bold(text string) Span {
+	return Span{Text: text, Style: StyleBold}
+}
+
+// Italic returns a span of emphasized text.
+func Italic(text string) Span {
+	return Span{Text: text, Style: StyleItalic}
+}
+
+// Strike returns a span of struck through text.
+func Strike(text string) Span {
+	return Span{Text: text, Style: StyleStrike}
+}
+
+// Code returns a span of monospaced text.
+func Code(text string) Span {
+	return Span{Text: text, Style: StyleCode}
+}
+
+// Line is a line of text made of spans.
+type Line []Span
+
+// Lines returns a line of unstyled text for every string.
+func Lines(texts ...string) []Line {
+	lines := make([]Line, len(texts))
+	for i, text := range texts {
+		lines[i] = Line{Plain(text)}
+	}
+
+	return lines
+}
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	listBlock
+	orderedListBlock
+	quoteBlock
+	codeBlock
+	tableBlock
+)
+
+type block struct {
+	kind  blockKind
+	lines []Line
+	// First number of ordered lists
+	start int
+	// Code blocks and tables
+	text   string
+	header []string
+	rows   [][]string
+}
+
+// Formatted is a message built from blocks of styled text, one after the
+// other. It is rendered as XEP-0393 message styling in the body, as plain text
+// for clients not supporting it, and optionally as XHTML-IM:
+//
+//	f := gofra.NewFormatted().
+//		Paragraph(gofra.Bold("groceries"), gofra.Plain(":")).
+//		OrderedList(1, gofra.Lines("oat milk", "bread")...)
+//	p.g.SendStanza(e.MB.FormattedReply(f))
+//
+// Styled spans must start and end next to whitespace or the edges of the
+// line, as XEP-0393 clients do not style them otherwise.
+type Formatted struct {
+	blocks []block
+}
+
+// NewFormatted returns an empty formatted message.
+func NewFormatted() *Formatted {
+	return &Formatted{}
+}
+
+// Paragraph adds a line of text. No spans add an empty line.
+func (f *Formatted) Paragraph(spans ...Span) *Formatted {
+	f.blocks = append(f.blocks, block{kind: paragraphBlock, lines: []Line{spans}})
+
+	return f
+}
+
+// List adds a bulleted list.
+func (f *Formatted) List(items ...Line) *Formatted {
+	f.blocks = append(f.blocks, block{kind: listBlock, lines: items})
+
+	return f
+}
+
+// OrderedList adds a list numbered from start.
+func (f *Formatted) OrderedList(start int, items ...Line) *Formatted {
+	f.blocks = append(f.blocks, block{kind: orderedListBlock, lines: items, start: start})
+
+	return f
+}
+
+// Quote adds quoted lines.
+func (f *Formatted) Quote(lines ...Line) *Formatted {
+	f.blocks = append(f.blocks, block{kind: quoteBlock, lines: lines})
+
+	return f
+}
+
+// CodeBlock adds monospaced, unstyled text.
+func (f *Formatted) CodeBlock(text string) *Formatted {
+	f.blocks = append(f.blocks, block{kind: codeBlock, text: strings.TrimSuffix(text, "\n")})
+
+	return f
+}
+
+// Table adds a table with a header row, monospaced for its columns to line up.
+func (f *Formatted) Table(header []string, rows ...[]string) *Formatted {
+	f.blocks = append(f.blocks, block{kind: tableBlock, header: header, rows: rows})
+
+	return f
+}
+
+// Styled renders the message with XEP-0393 message styling.
+func (f *Formatted) Styled() string {
+	return f.render(true)
+}
+
+// Plain renders the message as plain text, without styling directives.
+func (f *Formatted) Plain() string {
+	return f.render(false)
+}
+
+// String renders the message with XEP-0393 message styling.
+func (f *Formatted) String() string {
+	return f.Styled()
+}
+
+func (f *Formatted) render(styled bool) string {
+	var lines []string
+	for _, b := range f.blocks {
+		switch b.kind {
+		case paragraphBlock:
+			lines = append(lines, renderLine(b.lines[0], styled))
+		case listBlock:
+			for _, item := range b.lines {
+				lines = append(lines, "• "+renderLine(item, styled))
+			}
+		case orderedListBlock:
+			for i, item := range b.lines {
+				lines = append(lines, fmt.Sprintf("%d. %s", b.start+i, renderLine(item, styled)))
+			}
+		case quoteBlock:
+			for _, line := range b.lines {
+				lines = append(lines, "> "+renderLine(line, styled))
+			}
+		case codeBlock, tableBlock:
+			text := b.text
+			if b.kind == tableBlock {
+				text = renderTable(b.header, b.rows)
+			}
+
+			if styled {
+				lines = append(lines, "```", text, "```")
+			} else {
+				lines = append(lines, text)
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// renderLine renders the spans of a line, leaving the whitespace around styled
+// spans out of their directives.
+func renderLine(line Line, styled bool) string {
+	var b strings.Builder
+	for _, span := range line {
+		text := strings.TrimSpace(span.Text)
+		if !styled || span.Style == 0 || text == "" {
+			b.WriteString(span.Text)
+			continue
+		}
+
+		open, close := directives(span.Style)
+		start := strings.Index(span.Text, text)
+		b.WriteString(span.Text[:start] + open + text + close + span.Text[start+len(text):])
+	}
+
+	return b.String()
+}
+
+func directives(style Style) (open, close string) {
+	if style&StyleCode != 0 {
+		return "`", "`"
+	}
+
+	for _, d := range []struct {
+		style     Style
+		directive string
+	}{{StyleBold, "*"}, {StyleItalic, "_"}, {StyleStrike, "~"}} {
+		if style&d.style != 0 {
+			open += d.directive
+			close = d.directive + close
+		}
+	}
+
+	return open, close
+}
+
+// renderTable lines up the columns of a table, separating the header from the
+// rows with a line.
+func renderTable(header []string, rows [][]string) string {
+	all := append([][]string{header}, rows...)
+
+	var widths []int
+	for _, row := range all {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var lines []string
+	for r, row := range all {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		}
+		lines = append(lines, strings.TrimRightFunc(strings.Join(cells, "  "), unicode.IsSpace))
+
+		if r == 0 && len(rows) > 0 {
+			rule := make([]string, len(widths))
+			for i, w := range widths {
+				rule[i] = strings.Repeat("-", w)
+			}
+			lines = append(lines, strings.Join(rule, "  "))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// XHTML is the XEP-0071 XHTML-IM version of a message body.
+type XHTML struct {
+	Body XHTMLBody `xml:"http://www.w3.org/1999/xhtml body"`
+}
+
+// XHTMLBody is the content of an XHTML-IM body, as raw XHTML.
+type XHTMLBody struct {
+	Inner string `xml:",innerxml"`
+}
+
+// XHTML renders the message as XHTML-IM. Tables are preformatted text, as
+// XHTML-IM has no tables.
+func (f *Formatted) XHTML() *XHTML {
+	var b bytes.Buffer
+	for _, bl := range f.blocks {
+		switch bl.kind {
+		case paragraphBlock:
+			b.WriteString("<p>" + xhtmlLine(bl.lines[0]) + "</p>")
+		case listBlock, orderedListBlock:
+			// XHTML-IM lists have no start attribute
+			if bl.kind == orderedListBlock && bl.start != 1 {
+				lines := make([]string, len(bl.lines))
+				for i, item := range bl.lines {
+					lines[i] = fmt.Sprintf("%d. %s", bl.start+i, xhtmlLine(item))
+				}
+				b.WriteString("<p>" + strings.Join(lines, "<br/>") + "</p>")
+				continue
+			}
+
+			tag := "ul"
+			if bl.kind == orderedListBlock {
+				tag = "ol"
+			}
+			b.WriteString("<" + tag + ">")
+			for _, item := range bl.lines {
+				b.WriteString("<li>" + xhtmlLine(item) + "</li>")
+			}
+			b.WriteString("</" + tag + ">")
+		case quoteBlock:
+			lines := make([]string, len(bl.lines))
+			for i, line := range bl.lines {
+				lines[i] = xhtmlLine(line)
+			}
+			b.WriteString("<blockquote>" + strings.Join(lines, "<br/>") + "</blockquote>")
+		case codeBlock:
+			b.WriteString("<pre>" + escapeXML(bl.text) + "</pre>")
+		case tableBlock:
+			b.WriteString("<pre>" + escapeXML(renderTable(bl.header, bl.rows)) + "</pre>")
+		}
+	}
+
+	return &XHTML{Body: XHTMLBody{Inner: b.String()}}
+}
+
+func xhtmlLine(line Line) string {
+	var b strings.Builder
+	for _, span := range line {
+		text := escapeXML(span.Text)
+		if span.Style&StyleCode != 0 {
+			b.WriteString("<code>" + text + "</code>")
+			continue
+		}
+		if span.Style&StyleStrike != 0 {
+			text = `<span style="text-decoration: line-through">` + text + "</span>"
+		}
+		if span.Style&StyleItalic != 0 {
+			text = "<em>" + text + "</em>"
+		}
+		if span.Style&StyleBold != 0 {
+			text = "<strong>" + text + "</strong>"
+		}
+		b.WriteString(text)
+	}
+
+	return b.String()
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
+
+// WithFormat returns mb with f as its body.
+func (mb MessageBody) WithFormat(f *Formatted) MessageBody {
+	mb.Body = f.Styled()
+	mb.formatted = f
+
+	return mb
+}
+
+// FormattedReply returns a message answering mb with f.
+func (mb MessageBody) FormattedReply(f *Formatted) MessageBody {
+	return mb.Reply("").WithFormat(f)
+}
+
+// format renders a formatted message for its recipient: as plain text when it
+// is known not to support message styling or the configuration asks for it,
+// and with XHTML-IM when enabled and not known to be unsupported.
+func (g *Gofra) format(mb MessageBody) MessageBody {
+	if mb.formatted == nil {
+		return mb
+	}
+
+	if styling, known := g.caps.supports(mb.To, StylingNS); g.config.Messages.Formatting == "plain" || known && !styling {
+		mb.Body = mb.formatted.Plain()
+	}
+
+	if xhtml, known := g.caps.supports(mb.To, XHTMLIMNS); g.config.Messages.XHTML && (xhtml || !known) {
+		mb.HTML = mb.formatted.XHTML()
+	}
+
+	mb.formatted = nil
+
+	return mb
+}
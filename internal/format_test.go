@@ -0,0 +1,99 @@
+package gofra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func groceries() *gofra.Formatted {
+	return gofra.NewFormatted().
+		Paragraph(gofra.Bold("groceries"), gofra.Plain(" for "), gofra.Italic("Saturday ")).
+		OrderedList(0, gofra.Line{gofra.Plain("oat milk")}, gofra.Line{gofra.Strike("bread")}).
+		Quote(gofra.Line{gofra.Plain("use "), gofra.Code("!list add")}).
+		Table([]string{"item", "price"}, []string{"oat milk", "1.20"}, []string{"bread", "0.90"})
+}
+
+func TestFormatted_Styled(t *testing.T) {
+	assert.Equal(t, "*groceries* for _Saturday_ \n"+
+		"0. oat milk\n"+
+		"1. ~bread~\n"+
+		"> use `!list add`\n"+
+		"```\n"+
+		"item      price\n"+
+		"--------  -----\n"+
+		"oat milk  1.20\n"+
+		"bread     0.90\n"+
+		"```", groceries().Styled())
+}
+
+func TestFormatted_Plain(t *testing.T) {
+	assert.Equal(t, "groceries for Saturday \n"+
+		"0. oat milk\n"+
+		"1. bread\n"+
+		"> use !list add\n"+
+		"item      price\n"+
+		"--------  -----\n"+
+		"oat milk  1.20\n"+
+		"bread     0.90", groceries().Plain())
+
+	assert.Equal(t, "• a\n• b\n\n```\nx := 1\n```", gofra.NewFormatted().
+		List(gofra.Lines("a", "b")...).
+		Paragraph().
+		CodeBlock("x := 1\n").
+		Styled())
+}
+
+func TestFormatted_XHTML(t *testing.T) {
+	f := gofra.NewFormatted().
+		Paragraph(gofra.Span{Text: "a < b", Style: gofra.StyleBold | gofra.StyleItalic}).
+		OrderedList(1, gofra.Lines("one", "two")...).
+		List(gofra.Line{gofra.Strike("done")})
+
+	assert.Equal(t, "<p><strong><em>a &lt; b</em></strong></p>"+
+		"<ol><li>one</li><li>two</li></ol>"+
+		`<ul><li><span style="text-decoration: line-through">done</span></li></ul>`, f.XHTML().Body.Inner)
+
+	// Lists not starting at one keep their numbers
+	f = gofra.NewFormatted().OrderedList(0, gofra.Lines("zero", "one")...)
+	assert.Equal(t, "<p>0. zero<br/>1. one</p>", f.XHTML().Body.Inner)
+}
+
+func TestFormatted_PerClient(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.Messages.XHTML = true
+	}))
+	h.Server.HandleIQTo("alice@example.com/phone", gofra.DiscoInfoNS, "query", func(iq gofratest.Stanza) (string, error) {
+		return `<query xmlns="` + gofra.DiscoInfoNS + `" node="https://example.com/client#abc"><feature var="` + gofra.XHTMLIMNS + `"/></query>`, nil
+	})
+	h.Start()
+
+	f := gofra.NewFormatted().Paragraph(gofra.Bold("done"))
+	message := func(to string) gofra.MessageBody {
+		return gofra.MessageBody{Message: stanza.Message{Type: stanza.ChatMessage, To: jid.MustParse(to)}}.WithFormat(f)
+	}
+
+	// Clients not known to support styling get it
+	assert.NoError(t, h.Gofra.SendStanza(message("bob@example.com/laptop")))
+	mb := h.ExpectMessage("bob@example.com/laptop", `^\*done\*$`)
+	assert.Equal(t, "<p><strong>done</strong></p>", mb.HTML.Body.Inner)
+
+	// Alice's client supports XHTML-IM but not message styling
+	h.Presence("alice@example.com/phone", "", `<c xmlns="http://jabber.org/protocol/caps" hash="sha-1" node="https://example.com/client" ver="abc"/>`)
+	h.ExpectStanza("disco#info query for the client", func(st gofratest.Stanza) bool {
+		return st.Attr("to") == "alice@example.com/phone" && st.Child().Space == gofra.DiscoInfoNS
+	})
+
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, h.Gofra.SendStanza(message("alice@example.com/phone")))
+		mb, _ := h.NextMessage("alice@example.com/phone")
+
+		return mb.Body == "done" && mb.HTML != nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,474 @@
+package gofra
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"mellium.im/xmpp/jid"
+)
+
+const (
+	// XDataNS is the namespace for XEP-0004 Data Forms.
+	XDataNS = "jabber:x:data"
+
+	// XDataValidateNS is the namespace for XEP-0122 Data Forms Validation.
+	XDataValidateNS = "http://jabber.org/protocol/xdata-validate"
+
+	// MediaElementNS is the namespace for XEP-0221 Data Forms Media Element.
+	MediaElementNS = "urn:xmpp:media-element"
+)
+
+// Types of data forms.
+const (
+	FormTypeForm   = "form"
+	FormTypeSubmit = "submit"
+	FormTypeCancel = "cancel"
+	FormTypeResult = "result"
+)
+
+// Types of data form fields.
+const (
+	FieldBoolean     = "boolean"
+	FieldFixed       = "fixed"
+	FieldHidden      = "hidden"
+	FieldJIDMulti    = "jid-multi"
+	FieldJIDSingle   = "jid-single"
+	FieldListMulti   = "list-multi"
+	FieldListSingle  = "list-single"
+	FieldTextMulti   = "text-multi"
+	FieldTextPrivate = "text-private"
+	FieldTextSingle  = "text-single"
+)
+
+// XData represents an XEP-0004 Data Form. Result forms may hold a table, the
+// columns of which are the Reported fields and the rows the Items.
+type XData struct {
+	XMLName      xml.Name       `xml:"jabber:x:data x"`
+	Type         string         `xml:"type,attr"`
+	Title        string         `xml:"title,omitempty"`
+	Instructions string         `xml:"instructions,omitempty"`
+	Fields       []XDataField   `xml:"field,omitempty"`
+	Reported     *XDataReported `xml:"reported,omitempty"`
+	Items        []XDataItem    `xml:"item,omitempty"`
+}
+
+// XDataReported holds the columns of the table of a result form.
+type XDataReported struct {
+	Fields []XDataField `xml:"field"`
+}
+
+// XDataItem is a row of the table of a result form, with a field for every
+// column.
+type XDataItem struct {
+	Fields []XDataField `xml:"field"`
+}
+
+// XDataField represents a field in a data form.
+type XDataField struct {
+	Var      string         `xml:"var,attr,omitempty"`
+	Type     string         `xml:"type,attr,omitempty"`
+	Label    string         `xml:"label,attr,omitempty"`
+	Desc     string         `xml:"desc,omitempty"`
+	Required *struct{}      `xml:"required,omitempty"`
+	Values   []string       `xml:"value,omitempty"`
+	Options  []XDataOption  `xml:"option,omitempty"`
+	Media    *XDataMedia    `xml:"urn:xmpp:media-element media,omitempty"`
+	Validate *XDataValidate `xml:"http://jabber.org/protocol/xdata-validate validate,omitempty"`
+}
+
+// Value returns the first value or empty string for backwards compatibility.
+func (f XDataField) Value() string {
+	if len(f.Values) > 0 {
+		return f.Values[0]
+	}
+	return ""
+}
+
+// IsRequired reports whether the field must be filled in.
+func (f XDataField) IsRequired() bool {
+	return f.Required != nil
+}
+
+// XDataOption represents an option in a list field.
+type XDataOption struct {
+	Label string `xml:"label,attr,omitempty"`
+	Value string `xml:"value"`
+}
+
+// XDataMedia is media shown along a field, like a CAPTCHA image (XEP-0221).
+type XDataMedia struct {
+	Height int        `xml:"height,attr,omitempty"`
+	Width  int        `xml:"width,attr,omitempty"`
+	URIs   []XDataURI `xml:"uri"`
+}
+
+// XDataURI is a location of the media of a field, of the given MIME type.
+type XDataURI struct {
+	Type string `xml:"type,attr"`
+	URI  string `xml:",chardata"`
+}
+
+// XDataValidate constrains the values of a field (XEP-0122). Datatype is an
+// XML Schema datatype, xs:string when empty.
+type XDataValidate struct {
+	Datatype  string          `xml:"datatype,attr,omitempty"`
+	Basic     *struct{}       `xml:"basic,omitempty"`
+	Open      *struct{}       `xml:"open,omitempty"`
+	Range     *XDataRange     `xml:"range,omitempty"`
+	Regex     string          `xml:"regex,omitempty"`
+	ListRange *XDataListRange `xml:"list-range,omitempty"`
+}
+
+// XDataRange bounds the values of a field, compared as its datatype.
+type XDataRange struct {
+	Min string `xml:"min,attr,omitempty"`
+	Max string `xml:"max,attr,omitempty"`
+}
+
+// XDataListRange bounds how many values list-multi fields take.
+type XDataListRange struct {
+	Min int `xml:"min,attr,omitempty"`
+	Max int `xml:"max,attr,omitempty"`
+}
+
+// Field returns the field of the form with the given var.
+func (f *XData) Field(name string) (*XDataField, bool) {
+	for i := range f.Fields {
+		if f.Fields[i].Var == name {
+			return &f.Fields[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Values returns the values of the fields of the form, by var.
+func (f *XData) Values() FormValues {
+	values := make(FormValues, len(f.Fields))
+	for _, field := range f.Fields {
+		if field.Var != "" {
+			values[field.Var] = field.Values
+		}
+	}
+
+	return values
+}
+
+// Fill returns a copy of the form with the given values.
+func (f *XData) Fill(values FormValues) *XData {
+	filled := *f
+	filled.Fields = make([]XDataField, len(f.Fields))
+	copy(filled.Fields, f.Fields)
+	for i, field := range filled.Fields {
+		if v, ok := values[field.Var]; ok && field.Type != FieldFixed {
+			filled.Fields[i].Values = v
+		}
+	}
+
+	return &filled
+}
+
+// FieldError is a value submitted for a field failing the validation of the
+// form.
+type FieldError struct {
+	Var    string
+	Label  string
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	name := e.Label
+	if name == "" {
+		name = e.Var
+	}
+
+	return fmt.Sprintf("%s: %s", name, e.Reason)
+}
+
+// Validate checks the values submitted against the fields of the form: the
+// required ones, how many values each takes, the options of list fields, JIDs
+// and booleans, and the datatypes, ranges and regular expressions of their
+// XEP-0122 validation. It returns the errors of the fields failing it.
+func (f *XData) Validate(values FormValues) []FieldError {
+	var errs []FieldError
+	for _, field := range f.Fields {
+		if field.Var == "" || field.Type == FieldFixed || field.Type == FieldHidden {
+			continue
+		}
+
+		if reason := validateField(field, nonEmpty(values[field.Var])); reason != "" {
+			errs = append(errs, FieldError{Var: field.Var, Label: field.Label, Reason: reason})
+		}
+	}
+
+	return errs
+}
+
+func validateField(field XDataField, values []string) string {
+	if len(values) == 0 {
+		if field.IsRequired() {
+			return "a value is required"
+		}
+
+		return ""
+	}
+
+	multi := field.Type == FieldListMulti || field.Type == FieldJIDMulti || field.Type == FieldTextMulti
+	if !multi && len(values) > 1 {
+		return "only one value is allowed"
+	}
+
+	v := field.Validate
+	if field.Type == FieldListMulti && v != nil && v.ListRange != nil {
+		if v.ListRange.Min > 0 && len(values) < v.ListRange.Min {
+			return fmt.Sprintf("at least %d values are required", v.ListRange.Min)
+		}
+		if v.ListRange.Max > 0 && len(values) > v.ListRange.Max {
+			return fmt.Sprintf("at most %d values are allowed", v.ListRange.Max)
+		}
+	}
+
+	for _, value := range values {
+		if reason := validateValue(field, value); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+func validateValue(field XDataField, value string) string {
+	switch field.Type {
+	case FieldBoolean:
+		if _, err := parseBool(value); err != nil {
+			return "not a boolean"
+		}
+	case FieldJIDSingle, FieldJIDMulti:
+		if _, err := jid.Parse(value); err != nil {
+			return fmt.Sprintf("%q is not a valid JID", value)
+		}
+	case FieldListSingle, FieldListMulti:
+		open := field.Validate != nil && field.Validate.Open != nil
+		if !open && len(field.Options) > 0 && !hasOption(field.Options, value) {
+			return fmt.Sprintf("%q is not one of the options", value)
+		}
+	}
+
+	v := field.Validate
+	if v == nil {
+		return ""
+	}
+
+	n, err := parseDatatype(v.Datatype, value)
+	if err != nil {
+		return fmt.Sprintf("%q is not a valid %s", value, v.Datatype)
+	}
+
+	if v.Range != nil && n != nil {
+		if min, err := parseDatatype(v.Datatype, v.Range.Min); v.Range.Min != "" && err == nil && min != nil && n.Cmp(min) < 0 {
+			return fmt.Sprintf("%s is less than %s", value, v.Range.Min)
+		}
+		if max, err := parseDatatype(v.Datatype, v.Range.Max); v.Range.Max != "" && err == nil && max != nil && n.Cmp(max) > 0 {
+			return fmt.Sprintf("%s is greater than %s", value, v.Range.Max)
+		}
+	}
+
+	if v.Regex != "" {
+		// Values can't be told valid against a broken regular expression
+		re, err := regexp.Compile("^(?:" + v.Regex + ")$")
+		if err != nil {
+			return fmt.Sprintf("%s is not a valid regular expression", v.Regex)
+		}
+		if !re.MatchString(value) {
+			return fmt.Sprintf("%q does not match %s", value, v.Regex)
+		}
+	}
+
+	return ""
+}
+
+// Time layouts of the XML Schema datatypes.
+var datatypeLayouts = map[string]string{
+	"xs:date":     "2006-01-02",
+	"xs:dateTime": time.RFC3339,
+	"xs:time":     "15:04:05",
+}
+
+// parseDatatype checks value is of the XML Schema datatype, and returns it as
+// a number to compare with the bounds of ranges if it is ordered. Unknown
+// datatypes accept any value.
+func parseDatatype(datatype, value string) (*big.Float, error) {
+	switch datatype {
+	case "xs:byte", "xs:short", "xs:int", "xs:integer", "xs:long",
+		"xs:nonNegativeInteger", "xs:positiveInteger", "xs:negativeInteger", "xs:nonPositiveInteger":
+		i, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q", datatype, value)
+		}
+		if !integerInRange(datatype, i) {
+			return nil, fmt.Errorf("%s %q out of range", datatype, value)
+		}
+
+		return new(big.Float).SetInt(i), nil
+	case "xs:decimal", "xs:double", "xs:float":
+		f, _, err := big.ParseFloat(value, 10, 64, big.ToNearestEven)
+
+		return f, err
+	case "xs:boolean":
+		_, err := parseBool(value)
+
+		return nil, err
+	case "xs:anyURI":
+		_, err := url.Parse(value)
+
+		return nil, err
+	case "xs:language":
+		if value == "" || strings.ContainsAny(value, " \t\n") {
+			return nil, fmt.Errorf("invalid language %q", value)
+		}
+
+		return nil, nil
+	}
+
+	if layout, ok := datatypeLayouts[datatype]; ok {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return nil, err
+		}
+
+		return new(big.Float).SetInt64(t.UnixNano()), nil
+	}
+
+	return nil, nil
+}
+
+// Bounds of the bounded integer datatypes.
+var integerBounds = map[string][2]int64{
+	"xs:byte":  {-1 << 7, 1<<7 - 1},
+	"xs:short": {-1 << 15, 1<<15 - 1},
+	"xs:int":   {-1 << 31, 1<<31 - 1},
+	"xs:long":  {-1 << 63, 1<<63 - 1},
+}
+
+func integerInRange(datatype string, i *big.Int) bool {
+	switch datatype {
+	case "xs:nonNegativeInteger":
+		return i.Sign() >= 0
+	case "xs:positiveInteger":
+		return i.Sign() > 0
+	case "xs:negativeInteger":
+		return i.Sign() < 0
+	case "xs:nonPositiveInteger":
+		return i.Sign() <= 0
+	}
+
+	bounds, ok := integerBounds[datatype]
+
+	return !ok || (i.IsInt64() && i.Int64() >= bounds[0] && i.Int64() <= bounds[1])
+}
+
+func hasOption(options []XDataOption, value string) bool {
+	for _, option := range options {
+		if option.Value == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nonEmpty(values []string) []string {
+	var filled []string
+	for _, v := range values {
+		if v != "" {
+			filled = append(filled, v)
+		}
+	}
+
+	return filled
+}
+
+// parseBool parses the values of boolean fields, which are 0, 1, false or
+// true.
+func parseBool(value string) (bool, error) {
+	switch value {
+	case "1", "true":
+		return true, nil
+	case "0", "false":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+// FormValues are the values of the fields of a submitted form, by var.
+type FormValues map[string][]string
+
+// Has reports whether the field was submitted with a value.
+func (v FormValues) Has(name string) bool {
+	return len(nonEmpty(v[name])) > 0
+}
+
+// Get returns the first value of the field, empty if it has none.
+func (v FormValues) Get(name string) string {
+	if len(v[name]) == 0 {
+		return ""
+	}
+
+	return v[name][0]
+}
+
+// Strings returns the values of the field, the lines of text-multi fields or
+// the options selected in list-multi ones.
+func (v FormValues) Strings(name string) []string {
+	return nonEmpty(v[name])
+}
+
+// Bool returns the value of a boolean field, false if it has none.
+func (v FormValues) Bool(name string) (bool, error) {
+	if !v.Has(name) {
+		return false, nil
+	}
+
+	return parseBool(v.Get(name))
+}
+
+// Int returns the value of the field as an integer.
+func (v FormValues) Int(name string) (int64, error) {
+	return strconv.ParseInt(v.Get(name), 10, 64)
+}
+
+// Float returns the value of the field as a decimal number.
+func (v FormValues) Float(name string) (float64, error) {
+	return strconv.ParseFloat(v.Get(name), 64)
+}
+
+// Time returns the value of the field as an xs:dateTime.
+func (v FormValues) Time(name string) (time.Time, error) {
+	return time.Parse(time.RFC3339, v.Get(name))
+}
+
+// JID returns the value of a jid-single field.
+func (v FormValues) JID(name string) (jid.JID, error) {
+	return jid.Parse(v.Get(name))
+}
+
+// JIDs returns the values of a jid-multi field.
+func (v FormValues) JIDs(name string) ([]jid.JID, error) {
+	var jids []jid.JID
+	for _, value := range v.Strings(name) {
+		j, err := jid.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		jids = append(jids, j)
+	}
+
+	return jids, nil
+}
@@ -0,0 +1,150 @@
+package gofra_test
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+)
+
+func TestXData_Validate(t *testing.T) {
+	form := gofra.NewFormBuilder(gofra.FormTypeForm, "Poll").
+		AddField("FORM_TYPE", gofra.FieldHidden, "", "urn:example:poll").
+		AddField("question", gofra.FieldTextSingle, "Question", "").Required().
+		AddField("votes", gofra.FieldTextSingle, "Votes", "").Datatype("xs:positiveInteger").Range("", "10").
+		AddField("ends", gofra.FieldTextSingle, "Ends", "").Datatype("xs:date").Range("2024-01-01", "").
+		AddField("code", gofra.FieldTextSingle, "", "").Regex("[A-Z]{3}").
+		AddFieldWithOptions("kind", gofra.FieldListSingle, "Kind", "", []gofra.XDataOption{{Value: "yes-no"}, {Value: "multi"}}).
+		AddFieldWithMultipleValues("tags", gofra.FieldListMulti, "Tags", nil, []gofra.XDataOption{{Value: "a"}, {Value: "b"}}).
+		Validate(gofra.XDataValidate{Open: &struct{}{}, ListRange: &gofra.XDataListRange{Max: 2}}).
+		AddField("owner", gofra.FieldJIDSingle, "Owner", "").
+		AddField("anonymous", gofra.FieldBoolean, "Anonymous", "").
+		Build()
+
+	valid := gofra.FormValues{
+		"question":  {"Lunch?"},
+		"votes":     {"3"},
+		"ends":      {"2024-02-01"},
+		"code":      {"ABC"},
+		"kind":      {"multi"},
+		"tags":      {"a", "custom"},
+		"owner":     {"alice@example.com"},
+		"anonymous": {"true"},
+	}
+	assert.Empty(t, form.Validate(valid))
+
+	errs := form.Validate(gofra.FormValues{
+		"votes":     {"0"},
+		"ends":      {"2023-12-31"},
+		"code":      {"ABCD"},
+		"kind":      {"other"},
+		"tags":      {"a", "b", "c"},
+		"owner":     {"@example.com"},
+		"anonymous": {"yes"},
+	})
+	var vars []string
+	for _, err := range errs {
+		vars = append(vars, err.Var)
+	}
+	assert.Equal(t, []string{"question", "votes", "ends", "code", "kind", "tags", "owner", "anonymous"}, vars)
+	assert.Equal(t, "Question: a value is required", errs[0].Error())
+	assert.Equal(t, "code: \"ABCD\" does not match [A-Z]{3}", errs[3].Error())
+
+	assert.Len(t, form.Validate(gofra.FormValues{"question": {"Lunch?"}, "votes": {"11"}}), 1)
+	assert.Len(t, form.Validate(gofra.FormValues{"question": {"Lunch?", "Dinner?"}}), 1)
+}
+
+func TestFormBuilder_InvalidRegex(t *testing.T) {
+	b := gofra.NewFormBuilder(gofra.FormTypeForm, "Poll").
+		AddField("code", gofra.FieldTextSingle, "", "").Regex("[A-Z")
+	form := b.Build()
+
+	if assert.Error(t, b.Err()) {
+		assert.Contains(t, b.Err().Error(), "invalid regex of field code")
+	}
+
+	// No value passes it
+	errs := form.Validate(gofra.FormValues{"code": {"A"}})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "code: [A-Z is not a valid regular expression", errs[0].Error())
+	}
+
+	assert.NoError(t, gofra.NewFormBuilder(gofra.FormTypeForm, "Poll").
+		AddField("code", gofra.FieldTextSingle, "", "").Regex("[A-Z]{3}").Err())
+}
+
+func TestFormValues(t *testing.T) {
+	values := gofra.FormValues{
+		"count":   {"42"},
+		"ratio":   {"0.5"},
+		"enabled": {"1"},
+		"at":      {"2024-01-02T15:04:05Z"},
+		"owner":   {"alice@example.com"},
+		"members": {"bob@example.com", "", "carol@example.com"},
+	}
+
+	assert.True(t, values.Has("count"))
+	assert.False(t, values.Has("missing"))
+	assert.Equal(t, "", values.Get("missing"))
+	assert.Equal(t, []string{"bob@example.com", "carol@example.com"}, values.Strings("members"))
+
+	count, err := values.Int("count")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), count)
+	ratio, err := values.Float("ratio")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, ratio)
+	enabled, err := values.Bool("enabled")
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+	disabled, err := values.Bool("missing")
+	assert.NoError(t, err)
+	assert.False(t, disabled)
+	at, err := values.Time("at")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), at.UTC())
+	owner, err := values.JID("owner")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@example.com", owner.String())
+	members, err := values.JIDs("members")
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+}
+
+func TestXData_Result(t *testing.T) {
+	form := gofra.NewFormBuilder(gofra.FormTypeResult, "Lists").
+		Reported(
+			gofra.XDataField{Var: "name", Label: "Name"},
+			gofra.XDataField{Var: "items", Label: "Items"},
+		).
+		AddItem("groceries", "3").
+		AddItem("chores").
+		Build()
+
+	out, err := xml.Marshal(form)
+	assert.NoError(t, err)
+	assert.Equal(t, `<x xmlns="jabber:x:data" type="result"><title>Lists</title>`+
+		`<reported><field var="name" label="Name"></field><field var="items" label="Items"></field></reported>`+
+		`<item><field var="name"><value>groceries</value></field><field var="items"><value>3</value></field></item>`+
+		`<item><field var="name"><value>chores</value></field><field var="items"></field></item></x>`, string(out))
+
+	var decoded gofra.XData
+	assert.NoError(t, xml.Unmarshal(out, &decoded))
+	assert.Equal(t, form.Reported, decoded.Reported)
+	assert.Equal(t, form.Items, decoded.Items)
+}
+
+func TestXData_Media(t *testing.T) {
+	form := gofra.NewFormBuilder(gofra.FormTypeForm, "").
+		AddField("ocr", gofra.FieldTextSingle, "Enter the text", "").Required().Desc("Shown in the image").
+		Media(gofra.XDataMedia{Height: 80, Width: 290, URIs: []gofra.XDataURI{{Type: "image/png", URI: "cid:captcha@example.com"}}}).
+		Build()
+
+	out, err := xml.Marshal(form)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `<field var="ocr" type="text-single" label="Enter the text"><desc>Shown in the image</desc><required></required>`+
+		`<media xmlns="urn:xmpp:media-element" height="80" width="290"><uri type="image/png">cid:captcha@example.com</uri></media></field>`)
+}
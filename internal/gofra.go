@@ -8,40 +8,87 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
 
 	"mellium.im/sasl"
+	"mellium.im/xmlstream"
 	"mellium.im/xmpp"
 	"mellium.im/xmpp/dial"
 	"mellium.im/xmpp/jid"
 	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/ping"
 	"mellium.im/xmpp/stanza"
+	"mellium.im/xmpp/websocket"
 )
 
-var mucNicks map[string]string
-
 // Interface providing plugins the needed tools to interact with the engine
-// and/or other plugins
+// and/or other plugins. It is implemented by Gofra, and by gofratest.API for
+// unit tests.
 type API interface {
+	Logger() Logger
+	Context() context.Context
+	Account() string
+	Clock() Clock
+	Disco() *Disco
+	Roster() *Roster
+	Receipts() *Receipts
+	PubSub() *PubSub
+	GetPlugins() Plugins
 	SendMessage(to, message string, msgType stanza.MessageType) error
+	SendStanza(stanza interface{}) error
+	SendMore(mb MessageBody) (bool, error)
+	React(mb MessageBody, reactions ...string) error
+	SendReply(mb MessageBody, body string) error
+	SendFile(to, name string, r io.Reader, contentType string) error
+	SendIQResponse(e Event, response interface{}) error
+	SendIQ(ctx context.Context, to jid.JID, typ stanza.IQType, payload interface{}) (IQResponse, error)
+	Ping(ctx context.Context, to jid.JID) error
+	SetMUCNick(room, nick string)
+	QueryArchive(ctx context.Context, archive jid.JID, q ArchiveQuery) (ArchivePage, error)
 	Subscribe(eventName, pluginName string, handler Handler, priority int)
 	SubscribeChain(eventName, pluginName string, handler ChainHandler, priority int)
-	Publish(event Event) Reply
+	Publish(event Event) *Reply
+	HasSubscribers(eventName string) bool
 	SetPriority(eventName, pluginName string, priority int) error
-	SendStanza(stanza interface{}) error
-	SendIQResponse(e Event, response interface{}) error
 	AddMuxOption(o mux.Option)
 	AddMuxOptions(opts []mux.Option)
+	OutboundStats() OutboundStats
 }
+
 type Gofra struct {
 	config       Config
 	em           EventManager
 	plugins      Plugins
 	Client       *xmpp.Session
-	Context      context.Context
-	Logger       Logger
+	ctx          context.Context
+	logger       Logger
 	serveMux     *mux.ServeMux
 	serveMuxOpts []mux.Option
 	initialized  bool
+	xmlIn        io.Writer
+	xmlOut       io.Writer
+	shaper       *shaper
+	policy       *messagePolicy
+	corrections  *corrections
+	iqs          *iqTracker
+	uploader     *uploader
+	archives     *archives
+	caps         *peerCaps
+	account      string
+	added        []Plugin
+	tracers      []func(Event)
+	clock        Clock
+	disco        *Disco
+	roster       *Roster
+	receipts     *Receipts
+	pubsub       *PubSub
+	online       atomic.Bool
+
+	// Nicknames of the bot by MUC
+	mucNicksMu sync.RWMutex
+	mucNicks   map[string]string
 }
 
 func NewGofra(ctx context.Context, config Config) *Gofra {
@@ -53,20 +100,58 @@ func NewGofra(ctx context.Context, config Config) *Gofra {
 		log.Fatal(err.Error())
 	}
 
+	return newGofra(ctx, config, c, xmlIn, xmlOut, logger)
+}
+
+// NewGofraWithSession creates an engine on top of an already established
+// session instead of dialing the configured server, e.g. an in-memory one
+// for tests. Reconnecting is not supported on such sessions.
+func NewGofraWithSession(ctx context.Context, config Config, session *xmpp.Session) *Gofra {
+	config.Keepalive.Reconnect = false
+	xmlIn, xmlOut := getStreamLoggers(config.LogXML)
+
+	return newGofra(ctx, config, session, xmlIn, xmlOut, NewLogger(config.Debug))
+}
+
+func newGofra(ctx context.Context, config Config, c *xmpp.Session, xmlIn, xmlOut io.Writer, logger Logger) *Gofra {
 	gofra := &Gofra{
-		config:  config,
-		em:      NewEventManager(logger),
-		plugins: NewPlugins(config),
-		Client:  c,
-		Context: ctx,
-		Logger:  logger,
+		config:      config,
+		em:          NewEventManager(logger),
+		plugins:     NewPlugins(config),
+		Client:      c,
+		ctx:         ctx,
+		logger:      logger,
+		xmlIn:       xmlIn,
+		xmlOut:      xmlOut,
+		policy:      newMessagePolicy(config.Messages),
+		corrections: newCorrections(),
+		iqs:         newIQTracker(),
+		clock:       SystemClock,
+		disco:       NewDisco(),
+		account:     c.LocalAddr().Bare().String(),
+		mucNicks:    make(map[string]string),
 	}
 
+	// The engine answers pings and receipt requests itself, and publishes the
+	// chat states received
+	gofra.disco.AddFeature(ping.NS, ChatStatesNS, ReceiptsNS, MarkersNS, CorrectNS, ReactionsNS, ReplyNS, OOBNS)
+	gofra.disco.changed = gofra.presenceChanged
+	gofra.roster = NewRoster(config.Roster, gofra)
+	gofra.receipts = NewReceipts(gofra)
+	gofra.uploader = newUploader(gofra)
+	gofra.archives = newArchives(gofra)
+	gofra.pubsub = NewPubSub(gofra)
+	gofra.caps = newPeerCaps(gofra, logger)
+
 	stanzaHandler := stanzaHandler{
 		logger: logger,
 		publish: func(e Event) {
 			gofra.Publish(e)
 		},
+		presence: gofra.roster.updatePresence,
+		caps:     gofra.caps.update,
+		self:     gofra.isSelf,
+		last:     &lastPresence{},
 	}
 
 	gofra.serveMuxOpts = []mux.Option{
@@ -76,11 +161,27 @@ func NewGofra(ctx context.Context, config Config) *Gofra {
 		mux.Message(stanza.GroupChatMessage, xml.Name{Space: "jabber:client", Local: "body"}, stanzaHandler),
 		mux.IQ(stanza.GetIQ, xml.Name{}, stanzaHandler),
 		mux.IQ(stanza.SetIQ, xml.Name{}, stanzaHandler),
+		mux.IQ(stanza.GetIQ, xml.Name{Space: DiscoInfoNS, Local: "query"}, discoHandler{disco: gofra.disco, logger: logger}),
+		mux.IQ(stanza.GetIQ, xml.Name{Space: DiscoItemsNS, Local: "query"}, discoHandler{disco: gofra.disco, logger: logger}),
+		ping.Handle(),
+	}
+	gofra.serveMuxOpts = append(gofra.serveMuxOpts, gofra.roster.muxOptions()...)
+	gofra.serveMuxOpts = append(gofra.serveMuxOpts, gofra.iqs.muxOptions()...)
+	gofra.serveMuxOpts = append(gofra.serveMuxOpts, gofra.archives.muxOptions()...)
+	gofra.serveMuxOpts = append(gofra.serveMuxOpts, chatStateHandler{logger: logger, publish: stanzaHandler.publish, self: gofra.isSelf}.muxOptions()...)
+	gofra.serveMuxOpts = append(gofra.serveMuxOpts, reactionsHandler{logger: logger, publish: stanzaHandler.publish, self: gofra.isSelf}.muxOptions()...)
+	gofra.serveMuxOpts = append(gofra.serveMuxOpts, pubsubHandler{logger: logger, account: gofra.Account, events: &eventQueue{publish: stanzaHandler.publish}}.muxOptions()...)
+	gofra.serveMuxOpts = append(gofra.serveMuxOpts, receiptsHandler{receipts: gofra.receipts, g: gofra, logger: logger}.muxOptions()...)
+
+	if config.RateLimit.Rate > 0 || config.RateLimit.GlobalRate > 0 {
+		gofra.shaper = newShaper(config.RateLimit, func(s interface{}) error {
+			return gofra.Client.Encode(ctx, s)
+		})
+		go gofra.shaper.run(ctx)
 	}
 
-	mucNicks = make(map[string]string)
 	for _, muc := range config.MUCs {
-		mucNicks[muc.Jid] = muc.Nick
+		gofra.SetMUCNick(muc.Jid, muc.Nick)
 	}
 
 	return gofra
@@ -101,11 +202,73 @@ func (g *Gofra) SendMessage(to, body string, msgType stanza.MessageType) error {
 		Body: body,
 	}
 
-	return g.Client.Encode(g.Context, msg)
+	return g.SendStanza(msg)
 }
 
+// SendStanza writes a stanza to the session. When outbound rate limiting is
+// enabled it blocks until the shaper lets the stanza through, or returns
+// ErrOutboundQueueFull if it had to be dropped.
+//
+// Formatted messages are rendered for their recipient, message bodies longer
+// than the configured maximum length are split, and replies to corrected
+// messages correct the previous replies.
 func (g *Gofra) SendStanza(s interface{}) error {
-	return g.Client.Encode(g.Context, s)
+	mb, ok := s.(MessageBody)
+	if !ok {
+		return g.send(s)
+	}
+
+	return g.sendParts(g.policy.apply(g.corrections.apply(g.format(mb))))
+}
+
+// SendMore sends the next parts of a split message that were held back for the
+// conversation mb was received from. It returns false if there were none.
+func (g *Gofra) SendMore(mb MessageBody) (bool, error) {
+	parts := g.policy.more(mb.Reply(""))
+	if len(parts) == 0 {
+		return false, nil
+	}
+
+	return true, g.sendParts(parts)
+}
+
+// React reacts to mb with the given emojis, replacing any previous reaction of
+// the bot to it. No emojis removes them.
+func (g *Gofra) React(mb MessageBody, reactions ...string) error {
+	return g.SendStanza(mb.Reaction(reactions...))
+}
+
+// SendReply answers mb with a reply referencing it.
+func (g *Gofra) SendReply(mb MessageBody, body string) error {
+	return g.SendStanza(mb.QuotedReply(body))
+}
+
+func (g *Gofra) sendParts(parts []MessageBody) error {
+	for _, part := range parts {
+		if err := g.send(part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Gofra) send(s interface{}) error {
+	if g.shaper != nil {
+		return g.shaper.Send(g.ctx, s)
+	}
+
+	return g.Client.Encode(g.ctx, s)
+}
+
+// OutboundStats returns the outbound shaper counters. They are all zero when
+// rate limiting is disabled.
+func (g *Gofra) OutboundStats() OutboundStats {
+	if g.shaper == nil {
+		return OutboundStats{}
+	}
+
+	return g.shaper.Stats()
 }
 
 // SendIQResponse writes an IQ response using the encoder from the event.
@@ -125,15 +288,27 @@ func (g *Gofra) SendStanza(s interface{}) error {
 //
 // Use SendStanza for: messages, presence, and IQs you initiate.
 // Use SendIQResponse for: responses to incoming IQs (e.g., ad-hoc commands).
+//
+// IQ responses are never delayed by the outbound shaper.
 func (g *Gofra) SendIQResponse(e Event, response interface{}) error {
+	if g.shaper != nil {
+		g.shaper.bypassed()
+	}
+
 	enc := e.GetIQEncoder()
 	if enc == nil {
 		// Fallback to session if no encoder (shouldn't happen for IQs)
-		return g.Client.Encode(g.Context, response)
+		return g.Client.Encode(g.ctx, response)
 	}
 
+	return encodeTokens(enc, response)
+}
+
+// encodeTokens marshals v and writes it token by token, so that the session
+// sees the IQ response being written.
+func encodeTokens(enc xmlstream.TokenWriter, v interface{}) error {
 	// Marshal the response to XML and write tokens to the encoder
-	data, err := xml.Marshal(response)
+	data, err := xml.Marshal(v)
 	if err != nil {
 		return fmt.Errorf("error marshaling response: %w", err)
 	}
@@ -166,21 +341,85 @@ event values are received through the event pointer argument where changes are e
 to be performed in order for the following chained handlers to recieve them.
 */
 func (g *Gofra) Subscribe(eventName, pluginName string, handler Handler, priority int) {
-	g.Logger.Debug("Plugin " + pluginName + " subscribed handler to event " + eventName)
+	g.logger.Debug("Plugin " + pluginName + " subscribed handler to event " + eventName)
 	g.em.Subscribe(eventName, pluginName, handler, nil, priority)
 }
 
 // Subscribes a chained event listener to an event
 func (g *Gofra) SubscribeChain(eventName, pluginName string, handler ChainHandler, priority int) {
-	g.Logger.Debug("Plugin " + pluginName + " subscribed chained handler to event " + eventName)
+	g.logger.Debug("Plugin " + pluginName + " subscribed chained handler to event " + eventName)
 	g.em.Subscribe(eventName, pluginName, nil, handler, priority)
 }
 
-// Publish executes all event handlers subscribed to a particular event
+// HasSubscribers reports whether any plugin handles the event.
+func (g *Gofra) HasSubscribers(eventName string) bool {
+	return g.em.HasHandlers(eventName)
+}
+
+// Publish executes all event handlers subscribed to a particular event.
+// Events are tagged with the account they are published on.
 func (g *Gofra) Publish(event Event) *Reply {
+	if event.Account == "" {
+		event.Account = g.account
+	}
+
+	for _, trace := range g.tracers {
+		trace(event)
+	}
+
 	return g.em.Publish(event)
 }
 
+// Trace registers a function called with every event published, before its
+// handlers run. It must be called before Init.
+func (g *Gofra) Trace(f func(Event)) {
+	g.tracers = append(g.tracers, f)
+}
+
+// Account returns the bare JID of the account this engine is connected as.
+func (g *Gofra) Account() string {
+	return g.account
+}
+
+func (g *Gofra) Logger() Logger {
+	return g.logger
+}
+
+func (g *Gofra) Context() context.Context {
+	return g.ctx
+}
+
+// Clock returns the clock plugins should tell the time with.
+func (g *Gofra) Clock() Clock {
+	return g.clock
+}
+
+// SetClock replaces the clock given to plugins, e.g. with a fake one in tests.
+// It must be called before Init.
+func (g *Gofra) SetClock(c Clock) {
+	g.clock = c
+}
+
+// Disco returns the registry of the features, identities and nodes the bot
+// advertises through service discovery and entity capabilities.
+func (g *Gofra) Disco() *Disco {
+	return g.disco
+}
+
+// Roster returns the contacts of the bot and their presence.
+func (g *Gofra) Roster() *Roster {
+	return g.roster
+}
+
+// Receipts returns the tracker of messages sent asking for delivery receipts.
+func (g *Gofra) Receipts() *Receipts {
+	return g.receipts
+}
+
+func (g *Gofra) PubSub() *PubSub {
+	return g.pubsub
+}
+
 func (g *Gofra) SetPriority(eventName, pluginName string, priority int) error {
 	return g.em.SetPriority(eventName, pluginName, priority)
 }
@@ -206,6 +445,10 @@ func (g *Gofra) Init() error {
 		return err
 	}
 
+	for _, plugin := range g.added {
+		g.plugins.add(plugin, g.config, g)
+	}
+
 	// Initialize stanza multiplexer after registering all plugin-specific routes
 	g.serveMux = mux.New("jabber:client", g.serveMuxOpts...)
 
@@ -214,28 +457,134 @@ func (g *Gofra) Init() error {
 	return nil
 }
 
+// AddPlugin registers a plugin instance to be initialized as is along with the
+// ones found in PluginPaths. It has no effect once Init has been called.
+func (g *Gofra) AddPlugin(p Plugin) {
+	g.added = append(g.added, p)
+}
+
 func (g *Gofra) GetPlugins() Plugins {
 	return g.plugins
 }
 
+// Connect serves the session until the engine's context is done. If the
+// connection is lost and reconnection is enabled, a new session is dialed and
+// served again.
 func (g *Gofra) Connect() error {
+	for {
+		err := g.serve()
+		if g.ctx.Err() != nil {
+			return nil
+		}
+
+		g.logger.Warn(fmt.Sprintf("Connection lost: %v", err))
+		g.Publish(Event{Name: "disconnected", Payload: map[string]interface{}{"error": err}})
+
+		if err := g.Client.Conn().Close(); err != nil {
+			g.logger.Debug(fmt.Sprintf("Error closing lost connection: %q", err))
+		}
+
+		if !g.config.Keepalive.Reconnect {
+			return err
+		}
+
+		if err := g.reconnect(); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *Gofra) serve() error {
 	// Send initial presence
-	err := g.Client.Send(g.Context, stanza.Presence{Type: stanza.AvailablePresence}.Wrap(nil))
-	if err != nil {
+	if err := g.sendPresence(); err != nil {
 		return fmt.Errorf("error sending initial presence: %w", err)
 	}
 
+	g.online.Store(true)
+	defer g.online.Store(false)
+
+	// Contacts send their presence again after reconnecting
+	defer g.roster.forgetPresences()
+
+	ctx, cancel := context.WithCancel(g.ctx)
+	defer cancel()
+
+	g.startKeepalive(ctx)
+
+	if err := g.roster.load(); err != nil {
+		g.logger.Error(fmt.Sprintf("Error fetching roster: %q", err))
+	}
+
 	g.Publish(Event{Name: "connected"})
 
 	return g.Client.Serve(xmpp.HandlerFunc(g.serveMux.HandleXMPP))
 }
 
+// sendPresence sends the available presence of the bot, advertising its
+// current entity capabilities.
+func (g *Gofra) sendPresence() error {
+	presence := stanza.Presence{Type: stanza.AvailablePresence}
+
+	return g.Client.Send(g.ctx, presence.Wrap(g.disco.Caps().TokenReader()))
+}
+
+// presenceChanged sends the presence of the bot again when its capabilities
+// change while it is online, so that contacts see the new ones.
+func (g *Gofra) presenceChanged() {
+	if !g.online.Load() {
+		return
+	}
+
+	if err := g.sendPresence(); err != nil {
+		g.logger.Error(fmt.Sprintf("Error sending presence: %q", err))
+	}
+}
+
 func newXmppClient(ctx context.Context, config Config, xmlIn, xmlOut io.Writer, logger Logger) (*xmpp.Session, error) {
 	j, err := jid.Parse(config.Jid)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing address %q: %w", config.Jid, err)
 	}
 
+	streamConfig := func(features ...xmpp.StreamFeature) func(*xmpp.Session, *xmpp.StreamConfig) xmpp.StreamConfig {
+		features = append(features,
+			xmpp.BindResource(),
+			xmpp.SASL("", config.Password, sasl.ScramSha1Plus, sasl.ScramSha1, sasl.Plain),
+		)
+
+		return func(*xmpp.Session, *xmpp.StreamConfig) xmpp.StreamConfig {
+			return xmpp.StreamConfig{
+				Lang:     "en",
+				Features: features,
+				TeeIn:    xmlIn,
+				TeeOut:   xmlOut,
+			}
+		}
+	}
+
+	if config.WebSocket.Enabled {
+		conn, err := dialWebSocket(ctx, config.WebSocket, j, http.DefaultClient)
+		if err != nil {
+			return nil, fmt.Errorf("error dialing websocket: %w", err)
+		}
+
+		logger.Debug(fmt.Sprintf("Connected to websocket %s", conn.RemoteAddr()))
+
+		// RFC 7395 does not support StartTLS, the connection is secure if the
+		// WebSocket is.
+		var mask xmpp.SessionState
+		if isSecureWebSocket(conn, config.WebSocket) {
+			mask |= xmpp.Secure
+		}
+
+		s, err := xmpp.NewSession(ctx, j.Domain(), j, conn, mask, websocket.Negotiator(streamConfig()))
+		if err != nil {
+			return nil, fmt.Errorf("error establishing a session: %w", err)
+		}
+
+		return s, nil
+	}
+
 	var d dial.Dialer
 	if config.SkipSRV {
 		d.NoLookup = true
@@ -246,21 +595,12 @@ func newXmppClient(ctx context.Context, config Config, xmlIn, xmlOut io.Writer,
 		return nil, fmt.Errorf("error dialing sesion: %w", err)
 	}
 
-	s, err := xmpp.NewSession(ctx, j.Domain(), j, conn, 0, xmpp.NewNegotiator(func(*xmpp.Session, *xmpp.StreamConfig) xmpp.StreamConfig {
-		return xmpp.StreamConfig{
-			Lang: "en",
-			Features: []xmpp.StreamFeature{
-				xmpp.BindResource(),
-				xmpp.StartTLS(&tls.Config{
-					ServerName: j.Domain().String(),
-					MinVersion: tls.VersionTLS12,
-				}),
-				xmpp.SASL("", config.Password, sasl.ScramSha1Plus, sasl.ScramSha1, sasl.Plain),
-			},
-			TeeIn:  xmlIn,
-			TeeOut: xmlOut,
-		}
-	}))
+	s, err := xmpp.NewSession(ctx, j.Domain(), j, conn, 0, xmpp.NewNegotiator(streamConfig(
+		xmpp.StartTLS(&tls.Config{
+			ServerName: j.Domain().String(),
+			MinVersion: tls.VersionTLS12,
+		}),
+	)))
 	if err != nil {
 		return nil, fmt.Errorf("error establishing a session: %w", err)
 	}
@@ -0,0 +1,353 @@
+package gofratest
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"sync"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+)
+
+// File is a file sent through API.
+type File struct {
+	To          string
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Subscription is a handler subscribed through API.
+type Subscription struct {
+	Event    string
+	Plugin   string
+	Priority int
+	Chain    bool
+}
+
+// API is a recording implementation of gofra.API to unit test plugin handlers
+// in isolation, without an engine or a server. Events published through it
+// are dispatched to the handlers subscribed to it, as the engine does, and
+// everything sent is recorded instead.
+type API struct {
+	// Plugins is returned by GetPlugins.
+	Plugins gofra.Plugins
+	// IQHandler answers the IQs sent with SendIQ, which fail with
+	// gofra.ErrNotConnected when it is nil.
+	IQHandler func(to jid.JID, typ stanza.IQType, payload interface{}) (gofra.IQResponse, error)
+	// ArchiveHandler answers the queries sent with QueryArchive, which fail
+	// with gofra.ErrNotConnected when it is nil.
+	ArchiveHandler func(archive jid.JID, q gofra.ArchiveQuery) (gofra.ArchivePage, error)
+
+	account  string
+	ctx      context.Context
+	logger   gofra.Logger
+	em       gofra.EventManager
+	clock    gofra.Clock
+	disco    *gofra.Disco
+	roster   *gofra.Roster
+	receipts *gofra.Receipts
+	pubsub   *gofra.PubSub
+
+	mu            sync.Mutex
+	sent          []interface{}
+	iqResponses   []interface{}
+	published     []gofra.Event
+	subscriptions []Subscription
+	muxOptions    []mux.Option
+	mucNicks      map[string]string
+}
+
+var _ gofra.API = (*API)(nil)
+
+// NewAPI returns a recording API for the given account.
+func NewAPI(account string) *API {
+	logger := gofra.NewLogger(false)
+
+	a := &API{
+		Plugins: make(gofra.Plugins),
+		account: account,
+		ctx:     context.Background(),
+		logger:  logger,
+		em:      gofra.NewEventManager(logger),
+		clock:   gofra.SystemClock,
+		disco:   gofra.NewDisco(),
+	}
+	a.roster = gofra.NewRoster(gofra.RosterConfig{}, a)
+	a.receipts = gofra.NewReceipts(a)
+	a.pubsub = gofra.NewPubSub(a)
+
+	return a
+}
+
+func (a *API) Logger() gofra.Logger {
+	return a.logger
+}
+
+func (a *API) Context() context.Context {
+	return a.ctx
+}
+
+// Ping sends a ping through SendIQ.
+func (a *API) Ping(ctx context.Context, to jid.JID) error {
+	_, err := a.SendIQ(ctx, to, stanza.GetIQ, pingRequest{})
+
+	return err
+}
+
+type pingRequest struct {
+	XMLName xml.Name `xml:"urn:xmpp:ping ping"`
+}
+
+func (a *API) Account() string {
+	return a.account
+}
+
+func (a *API) Clock() gofra.Clock {
+	return a.clock
+}
+
+// SetClock replaces the clock given to plugins, e.g. with a FakeClock.
+func (a *API) SetClock(c gofra.Clock) {
+	a.clock = c
+}
+
+func (a *API) Disco() *gofra.Disco {
+	return a.disco
+}
+
+// Roster returns an empty roster, as there is no server behind API to fetch
+// it from. Subscription requests are left unanswered.
+func (a *API) Roster() *gofra.Roster {
+	return a.roster
+}
+
+// Receipts returns a tracker recording the messages it sends. As there is no
+// server behind API, they stay sent.
+func (a *API) Receipts() *gofra.Receipts {
+	return a.receipts
+}
+
+// PubSub returns a PubSub client sending its requests through SendIQ.
+func (a *API) PubSub() *gofra.PubSub {
+	return a.pubsub
+}
+
+func (a *API) GetPlugins() gofra.Plugins {
+	return a.Plugins
+}
+
+func (a *API) SendMessage(to, body string, msgType stanza.MessageType) error {
+	j, err := jid.Parse(to)
+	if err != nil {
+		return err
+	}
+
+	return a.SendStanza(gofra.MessageBody{
+		Message: stanza.Message{Type: msgType, To: j.Bare()},
+		Body:    body,
+	})
+}
+
+func (a *API) SendStanza(s interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sent = append(a.sent, s)
+
+	return nil
+}
+
+func (a *API) React(mb gofra.MessageBody, reactions ...string) error {
+	return a.SendStanza(mb.Reaction(reactions...))
+}
+
+func (a *API) SendReply(mb gofra.MessageBody, body string) error {
+	return a.SendStanza(mb.QuotedReply(body))
+}
+
+// SendFile records the file instead of uploading it.
+func (a *API) SendFile(to, name string, r io.Reader, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return a.SendStanza(File{To: to, Name: name, ContentType: contentType, Data: data})
+}
+
+// SendMore reports there is nothing held back, as API never splits messages.
+func (a *API) SendMore(mb gofra.MessageBody) (bool, error) {
+	return false, nil
+}
+
+func (a *API) SendIQResponse(e gofra.Event, response interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.iqResponses = append(a.iqResponses, response)
+
+	return nil
+}
+
+// SendIQ records the IQ and returns the response of IQHandler.
+func (a *API) SendIQ(ctx context.Context, to jid.JID, typ stanza.IQType, payload interface{}) (gofra.IQResponse, error) {
+	a.mu.Lock()
+	a.sent = append(a.sent, payload)
+	a.mu.Unlock()
+
+	if a.IQHandler == nil {
+		return gofra.IQResponse{}, gofra.ErrNotConnected
+	}
+
+	return a.IQHandler(to, typ, payload)
+}
+
+// QueryArchive returns the page of ArchiveHandler.
+func (a *API) QueryArchive(ctx context.Context, archive jid.JID, q gofra.ArchiveQuery) (gofra.ArchivePage, error) {
+	if a.ArchiveHandler == nil {
+		return gofra.ArchivePage{}, gofra.ErrNotConnected
+	}
+
+	return a.ArchiveHandler(archive, q)
+}
+
+// SetMUCNick records the nickname of the bot in the room.
+func (a *API) SetMUCNick(room, nick string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.mucNicks == nil {
+		a.mucNicks = make(map[string]string)
+	}
+	a.mucNicks[room] = nick
+}
+
+// MUCNick returns the nickname of the bot in the room set with SetMUCNick.
+func (a *API) MUCNick(room string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.mucNicks[room]
+}
+
+func (a *API) Subscribe(eventName, pluginName string, handler gofra.Handler, priority int) {
+	a.subscribed(Subscription{Event: eventName, Plugin: pluginName, Priority: priority})
+	a.em.Subscribe(eventName, pluginName, handler, nil, priority)
+}
+
+func (a *API) SubscribeChain(eventName, pluginName string, handler gofra.ChainHandler, priority int) {
+	a.subscribed(Subscription{Event: eventName, Plugin: pluginName, Priority: priority, Chain: true})
+	a.em.Subscribe(eventName, pluginName, nil, handler, priority)
+}
+
+func (a *API) subscribed(s Subscription) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.subscriptions = append(a.subscriptions, s)
+}
+
+// Publish records the event and runs the handlers subscribed to it.
+func (a *API) Publish(event gofra.Event) *gofra.Reply {
+	if event.Account == "" {
+		event.Account = a.account
+	}
+
+	a.mu.Lock()
+	a.published = append(a.published, event)
+	a.mu.Unlock()
+
+	return a.em.Publish(event)
+}
+
+func (a *API) HasSubscribers(eventName string) bool {
+	return a.em.HasHandlers(eventName)
+}
+
+func (a *API) SetPriority(eventName, pluginName string, priority int) error {
+	return a.em.SetPriority(eventName, pluginName, priority)
+}
+
+func (a *API) AddMuxOption(o mux.Option) {
+	a.AddMuxOptions([]mux.Option{o})
+}
+
+func (a *API) AddMuxOptions(opts []mux.Option) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.muxOptions = append(a.muxOptions, opts...)
+}
+
+func (a *API) OutboundStats() gofra.OutboundStats {
+	return gofra.OutboundStats{}
+}
+
+// Sent returns every stanza sent so far, in order.
+func (a *API) Sent() []interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]interface{}{}, a.sent...)
+}
+
+// Messages returns the messages among the stanzas sent so far.
+func (a *API) Messages() []gofra.MessageBody {
+	var messages []gofra.MessageBody
+	for _, s := range a.Sent() {
+		if mb, ok := s.(gofra.MessageBody); ok {
+			messages = append(messages, mb)
+		}
+	}
+
+	return messages
+}
+
+// IQResponses returns every response sent to an incoming IQ so far.
+func (a *API) IQResponses() []interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]interface{}{}, a.iqResponses...)
+}
+
+// Published returns every event published so far, including the ones
+// published by the handlers themselves.
+func (a *API) Published() []gofra.Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]gofra.Event{}, a.published...)
+}
+
+// Subscriptions returns every handler subscribed so far.
+func (a *API) Subscriptions() []Subscription {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]Subscription{}, a.subscriptions...)
+}
+
+// MuxOptions returns the mux options added so far.
+func (a *API) MuxOptions() []mux.Option {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]mux.Option{}, a.muxOptions...)
+}
+
+// Reset forgets the stanzas and events recorded so far. Subscriptions and mux
+// options are kept.
+func (a *API) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sent = nil
+	a.iqResponses = nil
+	a.published = nil
+}
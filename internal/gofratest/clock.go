@@ -0,0 +1,82 @@
+package gofratest
+
+import (
+	"sync"
+	"time"
+)
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// FakeClock is a gofra.Clock whose time only moves when told to.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+// NewFakeClock returns a clock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.at(c.now.Add(d))
+}
+
+func (c *FakeClock) At(t time.Time) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.at(t)
+}
+
+func (c *FakeClock) at(t time.Time) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	if !t.After(c.now) {
+		ch <- c.now
+
+		return ch
+	}
+
+	c.waiters = append(c.waiters, waiter{at: t, c: ch})
+
+	return ch
+}
+
+// Advance moves the time forward, firing the timers due by then.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the time to now, firing the timers due by then.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(now) {
+			pending = append(pending, w)
+
+			continue
+		}
+
+		w.c <- now
+	}
+	c.waiters = pending
+}
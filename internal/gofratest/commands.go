@@ -0,0 +1,75 @@
+package gofratest
+
+import (
+	"strings"
+
+	gofra "github.com/XaviFP/gofra/internal"
+)
+
+type commands struct {
+	g          gofra.API
+	char       string
+	chatStates gofra.ChatStatesConfig
+}
+
+// Commands returns a stand-in for the bundled Commands plugin, which cannot be
+// imported from tests as it is a main package. Like it, it publishes a
+// "command/<name>" event for every message starting with char, telling the
+// conversation the bot is typing while a plugin handles it.
+func Commands(char string) gofra.Plugin {
+	return &commands{char: char}
+}
+
+func (c *commands) Name() string {
+	return "Commands"
+}
+
+func (c *commands) Description() string {
+	return "Test stand-in for the Commands plugin"
+}
+
+func (c *commands) Help() string {
+	return ""
+}
+
+func (c *commands) Init(config gofra.Config, g gofra.API) {
+	c.g = g
+	c.chatStates = config.ChatStates
+
+	g.Subscribe("messageReceived", c.Name(), c.handleMessage, 1)
+	g.Subscribe("command/getCommandChar", c.Name(), c.getCommandChar, 0)
+}
+
+func (c *commands) getCommandChar(e gofra.Event) *gofra.Reply {
+	reply := &gofra.Reply{}
+	reply.SetAnswer(c.char)
+
+	return reply
+}
+
+func (c *commands) handleMessage(e gofra.Event) *gofra.Reply {
+	// Like the Commands plugin, commands in the history of rooms and echoes
+	// of the bot are not run
+	if e.IsHistory || e.IsSelf {
+		return nil
+	}
+
+	if !strings.HasPrefix(e.MB.Body, c.char) {
+		return nil
+	}
+
+	event := gofra.Event{
+		Name:    "command/" + strings.Fields(e.MB.Body)[0][len(c.char):],
+		MB:      e.MB,
+		Payload: e.Payload,
+	}
+
+	// Only commands some plugin handles make the bot type
+	if !c.g.HasSubscribers(event.Name) {
+		return c.g.Publish(event)
+	}
+	done := gofra.Typing(c.g, e.MB, c.chatStates)
+	defer done()
+
+	return c.g.Publish(event)
+}
@@ -0,0 +1,431 @@
+/*
+Package gofratest runs a Gofra engine against an in-memory XMPP server so that
+plugins can be tested end to end, without network access:
+
+	h := gofratest.New(t, gofratest.WithRoom("room@muc.example.com", "alice"))
+	h.Start(&plugin{}, gofratest.Commands("!"))
+
+	id := h.Say("room@muc.example.com/alice", "!list new groceries")
+	h.ExpectReaction("room@muc.example.com", id)
+*/
+package gofratest
+
+import (
+	"context"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+)
+
+// DefaultTimeout is how long expectations wait for the bot by default.
+const DefaultTimeout = 2 * time.Second
+
+const resource = "gofratest"
+
+// Harness connects a Gofra engine to an in-memory server and drives
+// conversations with it.
+type Harness struct {
+	Server  *Server
+	Gofra   *gofra.Gofra
+	Config  gofra.Config
+	Timeout time.Duration
+	// Clock is given to plugins, the system clock unless WithClock is used
+	Clock gofra.Clock
+	// Upload is the HTTP upload service of the server, if WithUpload is used
+	Upload *UploadService
+
+	t      testing.TB
+	bot    jid.JID
+	rooms  []serverRoom
+	upload *int64
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	consumed map[int]bool
+}
+
+// serverRoom is a MUC room created on the server.
+type serverRoom struct {
+	jid       string
+	occupants []string
+}
+
+// Option configures a Harness.
+type Option func(*Harness)
+
+// WithConfig changes the configuration the engine is started with.
+func WithConfig(f func(*gofra.Config)) Option {
+	return func(h *Harness) {
+		f(&h.Config)
+	}
+}
+
+// WithClock gives plugins the clock, usually a FakeClock, instead of the
+// system one.
+func WithClock(c gofra.Clock) Option {
+	return func(h *Harness) {
+		h.Clock = c
+	}
+}
+
+// WithRoom creates a MUC room on the server, with the given occupants, and
+// adds it to the engine configuration.
+func WithRoom(room string, occupants ...string) Option {
+	return func(h *Harness) {
+		h.rooms = append(h.rooms, serverRoom{jid: room, occupants: occupants})
+	}
+}
+
+// WithUpload gives the server an HTTP upload service, at upload.example.com,
+// accepting files up to maxSize bytes, or of any size if it is 0.
+func WithUpload(maxSize int64) Option {
+	return func(h *Harness) {
+		h.upload = &maxSize
+	}
+}
+
+// New creates a harness for the test. The engine is not started until Start is
+// called, and everything is torn down when the test ends.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+
+	h := &Harness{
+		Config: gofra.Config{
+			Jid:     "gofra@example.com",
+			Nick:    "Gofra",
+			DataDir: t.TempDir(),
+		},
+		Timeout:  DefaultTimeout,
+		Clock:    gofra.SystemClock,
+		t:        t,
+		consumed: make(map[int]bool),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	bot, err := jid.Parse(h.Config.Jid + "/" + resource)
+	if err != nil {
+		t.Fatalf("invalid bot JID: %v", err)
+	}
+
+	h.bot = bot
+	h.Server = NewServer(bot)
+	for _, r := range h.rooms {
+		h.Server.AddRoom(r.jid, r.occupants...)
+		h.Config.MUCs = append(h.Config.MUCs, gofra.MUCConfig{Jid: r.jid, Nick: h.Config.Nick})
+	}
+	if h.upload != nil {
+		h.Upload = NewUploadService(h.Server, "upload.example.com", *h.upload)
+	}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	go h.Server.Serve()
+	t.Cleanup(h.close)
+
+	return h
+}
+
+// Start initializes the given plugins and connects the engine to the server.
+func (h *Harness) Start(plugins ...gofra.Plugin) {
+	h.t.Helper()
+
+	session, err := h.Server.Session(h.ctx)
+	if err != nil {
+		h.t.Fatalf("error creating session: %v", err)
+	}
+
+	h.Gofra = gofra.NewGofraWithSession(h.ctx, h.Config, session)
+	h.Gofra.SetClock(h.Clock)
+	for _, p := range plugins {
+		h.Gofra.AddPlugin(p)
+	}
+
+	if err := h.Gofra.Init(); err != nil {
+		h.t.Fatalf("error initializing engine: %v", err)
+	}
+
+	go func() {
+		if err := h.Gofra.Connect(); err != nil && h.ctx.Err() == nil {
+			h.t.Logf("engine disconnected: %v", err)
+		}
+	}()
+}
+
+func (h *Harness) close() {
+	h.cancel()
+	h.Server.Close()
+	if h.Upload != nil {
+		h.Upload.Close()
+	}
+}
+
+// Bot returns the full JID the engine is connected as.
+func (h *Harness) Bot() jid.JID {
+	return h.bot
+}
+
+// Say sends a message to the bot. Messages from an occupant of one of the
+// server's rooms (room@service/nick) are groupchat messages, any other are
+// chat messages. It returns the ID of the message.
+func (h *Harness) Say(from, body string) string {
+	h.t.Helper()
+
+	return h.Server.Message(h.sender(from), body)
+}
+
+// Correct sends the bot a correction of the message with the given ID, as
+// clients do when fixing a typo, and returns the ID of the correction.
+func (h *Harness) Correct(from, replaces, body string) string {
+	h.t.Helper()
+
+	return h.Server.Correct(h.sender(from), replaces, body)
+}
+
+func (h *Harness) sender(from string) jid.JID {
+	h.t.Helper()
+
+	j, err := jid.Parse(from)
+	if err != nil {
+		h.t.Fatalf("invalid sender %q: %v", from, err)
+	}
+
+	return j
+}
+
+// Join announces a new occupant in a room.
+func (h *Harness) Join(room, nick string) {
+	h.Server.Join(room, nick)
+}
+
+// Leave announces an occupant left a room.
+func (h *Harness) Leave(room, nick string) {
+	h.Server.Leave(room, nick)
+}
+
+// Presence sends a presence of the given type, available if empty, with the
+// raw XML payload to the bot.
+func (h *Harness) Presence(from string, typ stanza.PresenceType, payload string) {
+	h.Server.Presence(from, typ, payload)
+}
+
+// SendIQ sends an IQ with the given raw XML payload to the bot and returns its
+// response.
+func (h *Harness) SendIQ(from string, typ stanza.IQType, payload string) Stanza {
+	h.t.Helper()
+
+	select {
+	case response := <-h.Server.Request(from, typ, payload):
+		return response
+	case <-time.After(h.Timeout):
+		h.t.Fatalf("no response to IQ %s from %s within %s", payload, from, h.Timeout)
+	}
+
+	return Stanza{}
+}
+
+// ExpectMessage waits for the bot to send a message to the given address whose
+// body matches pattern, and returns it. A bare address also matches messages
+// sent to any of its resources. Every message is only matched once.
+func (h *Harness) ExpectMessage(to, pattern string) gofra.MessageBody {
+	h.t.Helper()
+
+	mb, ok := h.waitMessage(to, regexp.MustCompile(pattern))
+	if !ok {
+		h.t.Fatalf("no message to %s matching %q within %s, got:\n%s", to, pattern, h.Timeout, h.pendingMessages(to))
+	}
+
+	return mb
+}
+
+// NextMessage waits for the next message with a body the bot sends to the
+// given address, in the order they were sent, and returns it. It returns false
+// if there was none within Timeout.
+func (h *Harness) NextMessage(to string) (gofra.MessageBody, bool) {
+	return h.waitMessage(to, anyBody)
+}
+
+var anyBody = regexp.MustCompile(`(?s).`)
+
+// waitMessage waits for the first message to the given address whose body
+// matches re.
+func (h *Harness) waitMessage(to string, re *regexp.Regexp) (gofra.MessageBody, bool) {
+	timeout := time.After(h.Timeout)
+
+	for {
+		sent := h.Server.WaitSent()
+
+		if mb, ok := h.takeMessage(to, re); ok {
+			return mb, true
+		}
+
+		select {
+		case <-sent:
+		case <-timeout:
+			return gofra.MessageBody{}, false
+		}
+	}
+}
+
+// ExpectStanza waits for the bot to send a stanza for which match returns true,
+// and returns it. Every stanza is only matched once; the description is used
+// in the failure message.
+func (h *Harness) ExpectStanza(description string, match func(Stanza) bool) Stanza {
+	h.t.Helper()
+
+	timeout := time.After(h.Timeout)
+
+	for {
+		sent := h.Server.WaitSent()
+
+		if st, ok := h.take(match); ok {
+			return st
+		}
+
+		select {
+		case <-sent:
+		case <-timeout:
+			h.t.Fatalf("no %s sent within %s", description, h.Timeout)
+
+			return Stanza{}
+		}
+	}
+}
+
+// ExpectPresence waits for the bot to send a presence of the given type,
+// available if empty, to the given address and returns it.
+func (h *Harness) ExpectPresence(to string, typ stanza.PresenceType) Stanza {
+	h.t.Helper()
+
+	return h.ExpectStanza("presence of type "+string(typ)+" to "+to, func(st Stanza) bool {
+		return st.XMLName.Local == "presence" && st.Attr("to") == to && st.Attr("type") == string(typ)
+	})
+}
+
+// ExpectReaction waits for the bot to react to the message with the given ID,
+// sent to the given address, and returns the reactions.
+func (h *Harness) ExpectReaction(to, id string) []string {
+	h.t.Helper()
+
+	reactions, ok := h.waitReaction(to, id)
+	if !ok {
+		h.t.Fatalf("no reaction to message %s sent to %s within %s", id, to, h.Timeout)
+	}
+
+	return reactions
+}
+
+func (h *Harness) waitReaction(to, id string) ([]string, bool) {
+	timeout := time.After(h.Timeout)
+
+	for {
+		sent := h.Server.WaitSent()
+
+		var msg gofra.ReactionMessage
+		_, ok := h.take(func(st Stanza) bool {
+			msg = gofra.ReactionMessage{}
+
+			return isMessageTo(st, to) && st.Child() == reactionsName && st.Decode(&msg) == nil && msg.Reactions.ID == id
+		})
+		if ok {
+			return msg.Reactions.Reactions, true
+		}
+
+		select {
+		case <-sent:
+		case <-timeout:
+			return nil, false
+		}
+	}
+}
+
+var reactionsName = xml.Name{Space: gofra.ReactionsNS, Local: "reactions"}
+
+// ExpectNoMessage checks the bot does not send any message with a body to the
+// given address within d, besides the ones already matched.
+func (h *Harness) ExpectNoMessage(to string, d time.Duration) {
+	h.t.Helper()
+
+	time.Sleep(d)
+
+	if pending := h.pendingMessages(to); pending != "" {
+		h.t.Fatalf("unexpected messages to %s:\n%s", to, pending)
+	}
+}
+
+func (h *Harness) takeMessage(to string, re *regexp.Regexp) (gofra.MessageBody, bool) {
+	var mb gofra.MessageBody
+	_, ok := h.take(func(st Stanza) bool {
+		mb = gofra.MessageBody{}
+
+		return isMessageTo(st, to) && st.Decode(&mb) == nil && re.MatchString(mb.Body)
+	})
+
+	return mb, ok
+}
+
+// take returns the first stanza sent and not matched yet for which match
+// returns true.
+func (h *Harness) take(match func(Stanza) bool) (Stanza, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, st := range h.Server.Sent() {
+		if h.consumed[i] || !match(st) {
+			continue
+		}
+
+		h.consumed[i] = true
+
+		return st, true
+	}
+
+	return Stanza{}, false
+}
+
+func (h *Harness) pendingMessages(to string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var pending []string
+	for i, st := range h.Server.Sent() {
+		if !h.consumed[i] && isMessageTo(st, to) && hasBody(st) {
+			pending = append(pending, st.String())
+		}
+	}
+
+	return strings.Join(pending, "\n")
+}
+
+// hasBody reports whether a message has a body, as opposed to only carrying
+// e.g. a chat state.
+func hasBody(st Stanza) bool {
+	var mb gofra.MessageBody
+
+	return st.Decode(&mb) == nil && mb.Body != ""
+}
+
+func isMessageTo(st Stanza, to string) bool {
+	if st.XMLName.Local != "message" {
+		return false
+	}
+
+	addr := st.Attr("to")
+	if addr == to {
+		return true
+	}
+
+	j, err := jid.Parse(addr)
+
+	return err == nil && !strings.Contains(to, "/") && j.Bare().String() == to
+}
@@ -0,0 +1,60 @@
+package gofratest
+
+import (
+	"testing"
+	"time"
+
+	gofra "github.com/XaviFP/gofra/internal"
+)
+
+// Recorder is a plugin recording the events it is subscribed to, to wait for
+// the events the engine and the plugins under test publish.
+type Recorder struct {
+	names  []string
+	events chan gofra.Event
+}
+
+// NewRecorder returns a Recorder subscribed to the given events.
+func NewRecorder(names ...string) *Recorder {
+	return &Recorder{names: names, events: make(chan gofra.Event, 20)}
+}
+
+func (r *Recorder) Name() string        { return "Recorder" }
+func (r *Recorder) Description() string { return "" }
+func (r *Recorder) Help() string        { return "" }
+
+func (r *Recorder) Init(config gofra.Config, g gofra.API) {
+	for _, name := range r.names {
+		g.Subscribe(name, r.Name(), func(e gofra.Event) *gofra.Reply {
+			r.events <- e
+
+			return nil
+		}, 0)
+	}
+}
+
+// Next waits for the next event recorded, in the order they were published,
+// and fails the test if none is within a second.
+func (r *Recorder) Next(t testing.TB) gofra.Event {
+	t.Helper()
+
+	select {
+	case e := <-r.events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("none of %v published", r.names)
+	}
+
+	return gofra.Event{}
+}
+
+// ExpectNone fails the test if any event is recorded within d.
+func (r *Recorder) ExpectNone(t testing.TB, d time.Duration) {
+	t.Helper()
+
+	select {
+	case e := <-r.events:
+		t.Errorf("unexpected %s of %s", e.Name, e.MB.ID)
+	case <-time.After(d):
+	}
+}
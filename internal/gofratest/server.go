@@ -0,0 +1,14 @@
+package gofratest
+
+import "github.com/XaviFP/gofra/internal/memserver"
+
+// The in-memory server the harness connects the engine to.
+type (
+	Server     = memserver.Server
+	Stanza     = memserver.Stanza
+	IQHandler  = memserver.IQHandler
+	RosterItem = memserver.RosterItem
+)
+
+// NewServer creates a server for the bot's full JID.
+var NewServer = memserver.NewServer
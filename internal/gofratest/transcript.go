@@ -0,0 +1,326 @@
+package gofratest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"mellium.im/xmpp/jid"
+
+	gofra "github.com/XaviFP/gofra/internal"
+)
+
+// DefaultTranscriptTime is the time the fake clock of a transcript starts at,
+// unless set with the time directive.
+var DefaultTranscriptTime = time.Date(2022, time.January, 26, 8, 28, 17, 0, time.UTC)
+
+// Transcript is a scripted conversation with the bot, written as plain text:
+//
+//	# Lines starting with # are comments
+//	~ room room@muc.example.com alice
+//	> alice: !list new groceries
+//	< Gofra reacts: ✅
+//	> alice: !dice 2d6
+//	< Gofra: 2d6: {{[1-6]}}, {{[1-6]}}
+//
+// Lines starting with ">" are messages a participant sends to the bot, and
+// lines starting with "<" the messages the bot is expected to answer with, in
+// order, or the reactions to the last message sent to it. Messages spanning
+// several lines continue on lines indented by two spaces. Parts of the answers
+// that vary between runs are matched with the regular expressions between
+// double braces.
+//
+// Participants are occupants of the room when there is one, or users of
+// example.com otherwise, unless given as a full JID. The bot answers in the
+// conversation of the last message sent to it.
+//
+// Lines starting with "~" are directives:
+//
+//	~ room <jid> [occupant...]  talk in a MUC room, must come first
+//	~ time <RFC 3339 time>      set the fake clock plugins are given
+//	~ advance <duration>        move the fake clock forward
+//	~ join <nick>               an occupant joins the room
+//	~ leave <nick>              an occupant leaves the room
+type Transcript struct {
+	Name string
+
+	room      string
+	occupants []string
+	steps     []step
+}
+
+type step struct {
+	line     int
+	kind     string
+	who      string
+	text     string
+	reaction bool
+}
+
+// LoadTranscript reads a transcript from a file.
+func LoadTranscript(path string) (*Transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseTranscript(filepath.Base(path), f)
+}
+
+// ParseTranscript reads a transcript. The name identifies it in errors.
+func ParseTranscript(name string, r io.Reader) (*Transcript, error) {
+	tr := &Transcript{Name: name}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t")
+
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+		case strings.HasPrefix(text, "  "):
+			if len(tr.steps) == 0 || tr.steps[len(tr.steps)-1].kind == "~" {
+				return nil, fmt.Errorf("%s:%d: continuation line without a message", name, line)
+			}
+
+			tr.steps[len(tr.steps)-1].text += "\n" + text[2:]
+		case strings.HasPrefix(text, ">"), strings.HasPrefix(text, "<"):
+			who, body, found := strings.Cut(text[1:], ":")
+			if !found {
+				return nil, fmt.Errorf("%s:%d: message without a participant", name, line)
+			}
+
+			s := step{line: line, kind: text[:1], who: strings.TrimSpace(who), text: strings.TrimPrefix(body, " ")}
+			if s.kind == "<" && strings.HasSuffix(s.who, " reacts") {
+				s.who, s.reaction = strings.TrimSuffix(s.who, " reacts"), true
+			}
+
+			tr.steps = append(tr.steps, s)
+		case strings.HasPrefix(text, "~"):
+			if err := tr.addDirective(line, strings.Fields(text[1:])); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: unexpected line %q", name, line, text)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range tr.steps {
+		if _, err := bodyPattern(s.text); s.kind == "<" && err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, s.line, err)
+		}
+	}
+
+	return tr, nil
+}
+
+func (tr *Transcript) addDirective(line int, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("empty directive")
+	}
+
+	switch args[0] {
+	case "room":
+		if len(tr.steps) > 0 || len(args) < 2 {
+			return fmt.Errorf("room must come first and name the room")
+		}
+
+		tr.room, tr.occupants = args[1], args[2:]
+
+		return nil
+	case "time":
+		if len(args) != 2 {
+			return fmt.Errorf("time needs an RFC 3339 time")
+		}
+
+		if _, err := time.Parse(time.RFC3339, args[1]); err != nil {
+			return err
+		}
+	case "advance":
+		if len(args) != 2 {
+			return fmt.Errorf("advance needs a duration")
+		}
+
+		if _, err := time.ParseDuration(args[1]); err != nil {
+			return err
+		}
+	case "join", "leave":
+		if len(args) != 2 || tr.room == "" {
+			return fmt.Errorf("%s needs a nick and a room", args[0])
+		}
+	default:
+		return fmt.Errorf("unknown directive %q", args[0])
+	}
+
+	tr.steps = append(tr.steps, step{line: line, kind: "~", who: args[0], text: args[1]})
+
+	return nil
+}
+
+// Run replays the transcript against the given plugins, started on a new
+// harness with a fake clock, and reports the answers of the bot that differ
+// from the expected ones.
+func (tr *Transcript) Run(t testing.TB, plugins ...gofra.Plugin) {
+	t.Helper()
+
+	clock := NewFakeClock(DefaultTranscriptTime)
+	opts := []Option{WithClock(clock)}
+	if tr.room != "" {
+		opts = append(opts, WithRoom(tr.room, tr.occupants...))
+	}
+
+	h := New(t, opts...)
+	h.Start(plugins...)
+
+	var diff []string
+	conversations := make(map[string]bool)
+	conversation := tr.room
+	var lastID string
+
+	for _, s := range tr.steps {
+		switch s.kind {
+		case ">":
+			from := tr.participant(s.who)
+			lastID = h.Say(from.String(), s.text)
+
+			conversation = from.Bare().String()
+			conversations[conversation] = true
+		case "<":
+			if s.reaction {
+				expected := "< " + s.who + " reacts: " + s.text
+
+				reactions, ok := h.waitReaction(conversation, lastID)
+				if !ok {
+					diff = append(diff, fmt.Sprintf("%s:%d\n- %s\n+ (no reaction to the message to %s within %s)", tr.Name, s.line, expected, conversation, h.Timeout))
+				} else if got := strings.Join(reactions, " "); s.who != h.Config.Nick || got != s.text {
+					diff = append(diff, fmt.Sprintf("%s:%d\n- %s\n+ < %s reacts: %s", tr.Name, s.line, expected, h.Config.Nick, got))
+				}
+
+				continue
+			}
+
+			expected := "< " + s.who + ": " + indent(s.text)
+
+			mb, ok := h.NextMessage(conversation)
+			if !ok {
+				diff = append(diff, fmt.Sprintf("%s:%d\n- %s\n+ (no message to %s within %s)", tr.Name, s.line, expected, conversation, h.Timeout))
+
+				continue
+			}
+
+			body := normalizeBody(mb.Body)
+			pattern, _ := bodyPattern(s.text)
+			if s.who != h.Config.Nick || !pattern.MatchString(body) {
+				diff = append(diff, fmt.Sprintf("%s:%d\n- %s\n+ < %s: %s", tr.Name, s.line, expected, h.Config.Nick, indent(body)))
+			}
+		case "~":
+			tr.runDirective(h, clock, s)
+		}
+	}
+
+	for conversation := range conversations {
+		if pending := h.pendingMessages(conversation); pending != "" {
+			diff = append(diff, fmt.Sprintf("%s: unexpected messages to %s:\n+ %s", tr.Name, conversation, pending))
+		}
+	}
+
+	if len(diff) > 0 {
+		t.Errorf("bot answers differ from transcript %s:\n%s", tr.Name, strings.Join(diff, "\n"))
+	}
+}
+
+func (tr *Transcript) runDirective(h *Harness, clock *FakeClock, s step) {
+	switch s.who {
+	case "time":
+		now, _ := time.Parse(time.RFC3339, s.text)
+		clock.Set(now)
+	case "advance":
+		d, _ := time.ParseDuration(s.text)
+		clock.Advance(d)
+	case "join":
+		h.Join(tr.room, s.text)
+	case "leave":
+		h.Leave(tr.room, s.text)
+	}
+}
+
+func (tr *Transcript) participant(who string) jid.JID {
+	if strings.Contains(who, "@") {
+		return jid.MustParse(who)
+	}
+
+	if tr.room != "" {
+		return jid.MustParse(tr.room + "/" + who)
+	}
+
+	return jid.MustParse(who + "@example.com/chat")
+}
+
+// RunTranscripts runs every transcript file matching pattern as a subtest,
+// each against a new set of plugins.
+func RunTranscripts(t *testing.T, pattern string, plugins func() []gofra.Plugin) {
+	t.Helper()
+
+	files, err := filepath.Glob(pattern)
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no transcripts matching %s: %v", pattern, err)
+	}
+
+	for _, file := range files {
+		file := file
+
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			tr, err := LoadTranscript(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tr.Run(t, plugins()...)
+		})
+	}
+}
+
+var placeholder = regexp.MustCompile(`{{(.*?)}}`)
+
+// bodyPattern turns an expected body into a regular expression, matching the
+// text literally but for the placeholders.
+func bodyPattern(expected string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`^`)
+
+	last := 0
+	for _, m := range placeholder.FindAllStringSubmatchIndex(expected, -1) {
+		b.WriteString(regexp.QuoteMeta(expected[last:m[0]]))
+		b.WriteString(`(?:` + expected[m[2]:m[3]] + `)`)
+		last = m[1]
+	}
+
+	b.WriteString(regexp.QuoteMeta(expected[last:]) + `$`)
+
+	return regexp.Compile(b.String())
+}
+
+// normalizeBody drops the trailing whitespace of every line of a body and
+// trailing empty lines, as transcripts do not keep them.
+func normalizeBody(body string) string {
+	lines := strings.Split(body, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+func indent(body string) string {
+	return strings.ReplaceAll(body, "\n", "\n  ")
+}
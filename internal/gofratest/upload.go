@@ -0,0 +1,177 @@
+package gofratest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	nsUpload     = "urn:xmpp:http:upload:0"
+	nsDiscoInf   = "http://jabber.org/protocol/disco#info"
+	nsDiscoItems = "http://jabber.org/protocol/disco#items"
+)
+
+// UploadedFile is a file the bot uploaded to an UploadService.
+type UploadedFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
+	// URL the file is downloaded from
+	URL string
+}
+
+// UploadService is an in-memory stand-in for an XEP-0363 HTTP upload
+// component of the server. It hands out slots to the bot and serves them over
+// a local HTTP server.
+type UploadService struct {
+	// JID is the address the service is discovered at.
+	JID string
+	// MaxSize is the largest file accepted, in bytes, or 0 for no limit.
+	MaxSize int64
+
+	http *httptest.Server
+
+	mu    sync.Mutex
+	slots map[string]uploadSlot
+	files []UploadedFile
+	next  int
+}
+
+type uploadSlot struct {
+	name  string
+	size  int64
+	token string
+}
+
+// NewUploadService starts an upload service on a local HTTP server, and makes
+// the server advertise it among its items.
+func NewUploadService(s *Server, serviceJID string, maxSize int64) *UploadService {
+	u := &UploadService{
+		JID:     serviceJID,
+		MaxSize: maxSize,
+		slots:   make(map[string]uploadSlot),
+	}
+	u.http = httptest.NewServer(http.HandlerFunc(u.serveHTTP))
+
+	domain := s.Bot().Domain().String()
+	s.HandleIQTo(domain, nsDiscoItems, "query", func(Stanza) (string, error) {
+		return fmt.Sprintf(`<query xmlns=%q><item jid=%q name="HTTP upload"/></query>`, nsDiscoItems, u.JID), nil
+	})
+	s.HandleIQTo(u.JID, nsDiscoInf, "query", func(Stanza) (string, error) {
+		return u.info(), nil
+	})
+	s.HandleIQTo(u.JID, nsUpload, "request", u.slot)
+
+	return u
+}
+
+// Files returns the files uploaded so far, in order.
+func (u *UploadService) Files() []UploadedFile {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return append([]UploadedFile{}, u.files...)
+}
+
+// Close stops the HTTP server.
+func (u *UploadService) Close() {
+	u.http.Close()
+}
+
+func (u *UploadService) info() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<query xmlns=%q><identity category="store" type="file" name="HTTP upload"/><feature var=%q/>`, nsDiscoInf, nsUpload)
+	if u.MaxSize > 0 {
+		fmt.Fprintf(&b, `<x xmlns="jabber:x:data" type="result"><field var="FORM_TYPE" type="hidden"><value>%s</value></field><field var="max-file-size"><value>%d</value></field></x>`, nsUpload, u.MaxSize)
+	}
+	b.WriteString(`</query>`)
+
+	return b.String()
+}
+
+func (u *UploadService) slot(iq Stanza) (string, error) {
+	var request struct {
+		Request struct {
+			Filename    string `xml:"filename,attr"`
+			Size        int64  `xml:"size,attr"`
+			ContentType string `xml:"content-type,attr"`
+		} `xml:"urn:xmpp:http:upload:0 request"`
+	}
+	if err := iq.Decode(&request); err != nil || request.Request.Filename == "" {
+		return "", stanza.Error{Type: stanza.Modify, Condition: stanza.BadRequest}
+	}
+
+	r := request.Request
+	if u.MaxSize > 0 && r.Size > u.MaxSize {
+		return "", stanza.Error{
+			Type:      stanza.Modify,
+			Condition: stanza.NotAcceptable,
+			Text:      map[string]string{"": fmt.Sprintf("File too large. The maximum file size is %d bytes", u.MaxSize)},
+		}
+	}
+
+	u.mu.Lock()
+	u.next++
+	id := strconv.Itoa(u.next)
+	token := "token-" + id
+	u.slots[id] = uploadSlot{name: r.Filename, size: r.Size, token: token}
+	u.mu.Unlock()
+
+	slotURL := u.http.URL + "/" + id + "/" + url.PathEscape(r.Filename)
+
+	return fmt.Sprintf(`<slot xmlns=%q><put url=%q><header name="Authorization">%s</header></put><get url=%q/></slot>`, nsUpload, slotURL, token, slotURL), nil
+}
+
+func (u *UploadService) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	id, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	switch r.Method {
+	case http.MethodPut:
+		u.mu.Lock()
+		slot, ok := u.slots[id]
+		delete(u.slots, id)
+		u.mu.Unlock()
+
+		if !ok || r.Header.Get("Authorization") != slot.token {
+			http.Error(w, "no such slot", http.StatusForbidden)
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(data)) != slot.size {
+			http.Error(w, "size mismatch", http.StatusBadRequest)
+			return
+		}
+
+		u.mu.Lock()
+		u.files = append(u.files, UploadedFile{
+			Name:        slot.name,
+			ContentType: r.Header.Get("Content-Type"),
+			Data:        data,
+			URL:         u.http.URL + r.URL.EscapedPath(),
+		})
+		u.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		for _, f := range u.Files() {
+			if f.URL == u.http.URL+r.URL.EscapedPath() {
+				w.Header().Set("Content-Type", f.ContentType)
+				w.Write(f.Data)
+				return
+			}
+		}
+
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
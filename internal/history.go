@@ -0,0 +1,49 @@
+package gofra
+
+import (
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+// DelayNS is the namespace for XEP-0203 Delayed Delivery.
+const DelayNS = "urn:xmpp:delay"
+
+// Delay marks a message as sent at Stamp, before it was delivered. Rooms mark
+// so the history they send on joining them.
+type Delay struct {
+	From  string    `xml:"from,attr,omitempty"`
+	Stamp time.Time `xml:"stamp,attr"`
+}
+
+// IsHistory reports whether the message is part of the history a room sent on
+// joining it.
+func (mb MessageBody) IsHistory() bool {
+	return mb.Type == stanza.GroupChatMessage && mb.Delay != nil
+}
+
+// SetMUCNick records the nickname of the bot in the room, to address its
+// replies and recognize its own messages.
+func (g *Gofra) SetMUCNick(room, nick string) {
+	g.mucNicksMu.Lock()
+	defer g.mucNicksMu.Unlock()
+
+	g.mucNicks[room] = nick
+}
+
+// mucNick returns the nickname of the bot in the room, empty if unknown.
+func (g *Gofra) mucNick(room string) string {
+	g.mucNicksMu.RLock()
+	defer g.mucNicksMu.RUnlock()
+
+	return g.mucNicks[room]
+}
+
+// isSelf reports whether the message from a room was sent by the bot. No
+// message is from the bot in rooms it is not known to be in.
+func (g *Gofra) isSelf(from jid.JID) bool {
+	nick := g.mucNick(from.Bare().String())
+
+	return nick != "" && from.Resourcepart() == nick
+}
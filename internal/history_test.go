@@ -0,0 +1,62 @@
+package gofra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestHistory(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom("room@muc.example.com", "alice"))
+	r := gofratest.NewRecorder("messageReceived", "command/ping")
+	h.Start(gofratest.Commands("!"), r)
+
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" id="old" from="room@muc.example.com/alice" to="gofra@example.com/gofratest"><body>!ping</body>` +
+		`<delay xmlns="urn:xmpp:delay" from="room@muc.example.com" stamp="2024-01-02T15:04:05Z"/></message>`)
+	e := r.Next(t)
+	assert.Equal(t, "messageReceived", e.Name)
+	assert.True(t, e.IsHistory)
+	assert.False(t, e.IsSelf)
+	assert.Equal(t, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), e.MB.Delay.Stamp)
+
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" id="echo" from="room@muc.example.com/Gofra" to="gofra@example.com/gofratest"><body>!ping</body></message>`)
+	e = r.Next(t)
+	assert.False(t, e.IsHistory)
+	assert.True(t, e.IsSelf)
+
+	// Only live commands of others are run
+	id := h.Say("room@muc.example.com/alice", "!ping")
+	events := map[string]gofra.Event{}
+	for i := 0; i < 2; i++ {
+		e := r.Next(t)
+		events[e.Name] = e
+	}
+	assert.Equal(t, id, events["command/ping"].MB.ID)
+	assert.False(t, events["messageReceived"].IsHistory)
+	assert.False(t, events["messageReceived"].IsSelf)
+
+	r.ExpectNone(t, 100*time.Millisecond)
+}
+
+func TestHistory_SelfPerAccount(t *testing.T) {
+	first := gofratest.New(t)
+	r1 := gofratest.NewRecorder("messageReceived")
+	first.Start(r1)
+	second := gofratest.New(t)
+	r2 := gofratest.NewRecorder("messageReceived")
+	second.Start(r2)
+
+	// Accounts in the same room know their own nicknames only
+	first.Gofra.SetMUCNick("room@muc.example.com", "first")
+	second.Gofra.SetMUCNick("room@muc.example.com", "second")
+
+	msg := `<message xmlns="jabber:client" type="groupchat" from="room@muc.example.com/first" to="gofra@example.com/gofratest"><body>hi</body></message>`
+	first.Server.Send(msg)
+	second.Server.Send(msg)
+	assert.True(t, r1.Next(t).IsSelf)
+	assert.False(t, r2.Next(t).IsSelf)
+}
@@ -0,0 +1,158 @@
+package gofra
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"sync"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+)
+
+// IQResponse is the result of an IQ sent with SendIQ.
+type IQResponse struct {
+	stanza.IQ
+	// Payload is the raw XML of the child element, if any.
+	Payload []byte
+}
+
+// Decode unmarshals the payload of the response into v.
+func (r IQResponse) Decode(v interface{}) error {
+	if len(r.Payload) == 0 {
+		return fmt.Errorf("empty IQ %s response", r.ID)
+	}
+
+	return xml.Unmarshal(r.Payload, v)
+}
+
+// iqRequest is an IQ sent by SendIQ. The session does not flush stanzas
+// implementing xmlstream.WriterTo, so payloads are plain structs.
+type iqRequest struct {
+	XMLName xml.Name      `xml:"iq"`
+	ID      string        `xml:"id,attr"`
+	To      string        `xml:"to,attr,omitempty"`
+	Type    stanza.IQType `xml:"type,attr"`
+	Payload interface{}
+}
+
+// iqTracker delivers the responses to the IQs sent with SendIQ. The ones
+// sent through the session would race with it when the engine stops.
+type iqTracker struct {
+	mu      sync.Mutex
+	pending map[string]chan IQResponse
+}
+
+func newIQTracker() *iqTracker {
+	return &iqTracker{pending: make(map[string]chan IQResponse)}
+}
+
+func (t *iqTracker) muxOptions() []mux.Option {
+	return []mux.Option{
+		mux.IQ(stanza.ResultIQ, xml.Name{}, t),
+		mux.IQ(stanza.ErrorIQ, xml.Name{}, t),
+	}
+}
+
+func (t *iqTracker) wait(id string) chan IQResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	response := make(chan IQResponse, 1)
+	t.pending[id] = response
+
+	return response
+}
+
+func (t *iqTracker) forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.pending, id)
+}
+
+func (t *iqTracker) HandleIQ(iq stanza.IQ, r xmlstream.TokenReadEncoder, start *xml.StartElement) error {
+	t.mu.Lock()
+	response, ok := t.pending[iq.ID]
+	delete(t.pending, iq.ID)
+	t.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	// Empty results come with a start element without a name
+	var payload bytes.Buffer
+	if start != nil && start.Name.Local != "" {
+		enc := xml.NewEncoder(&payload)
+		if err := enc.EncodeToken(*start); err != nil {
+			return err
+		}
+		if _, err := xmlstream.Copy(enc, xmlstream.Inner(r)); err != nil {
+			return err
+		}
+		if err := enc.EncodeToken(start.End()); err != nil {
+			return err
+		}
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+	}
+
+	response <- IQResponse{IQ: iq, Payload: payload.Bytes()}
+
+	return nil
+}
+
+// SendIQ sends an IQ with the given payload, a struct marshalling to its child
+// element, and waits for the response until ctx is done. The zero JID
+// addresses the account of the bot. Error responses are returned as a
+// stanza.Error.
+func (g *Gofra) SendIQ(ctx context.Context, to jid.JID, typ stanza.IQType, payload interface{}) (IQResponse, error) {
+	id := generateSessionID()
+	response := g.iqs.wait(id)
+	defer g.iqs.forget(id)
+
+	request := iqRequest{ID: id, Type: typ, Payload: payload}
+	if !to.Equal(jid.JID{}) {
+		request.To = to.String()
+	}
+
+	if err := g.SendStanza(request); err != nil {
+		return IQResponse{}, err
+	}
+
+	select {
+	case r := <-response:
+		if r.Type == stanza.ErrorIQ {
+			var stanzaErr stanza.Error
+			if err := r.Decode(&stanzaErr); err != nil {
+				return r, fmt.Errorf("error response to IQ %s: %w", id, err)
+			}
+
+			return r, stanzaErr
+		}
+
+		return r, nil
+	case <-ctx.Done():
+		return IQResponse{}, ctx.Err()
+	case <-g.ctx.Done():
+		return IQResponse{}, g.ctx.Err()
+	}
+}
+
+// pingRequest is the payload of an XEP-0199 ping.
+type pingRequest struct {
+	XMLName xml.Name `xml:"urn:xmpp:ping ping"`
+}
+
+// Ping pings the entity and waits for its answer until ctx is done. Entities
+// not supporting pings answer with a stanza.Error.
+func (g *Gofra) Ping(ctx context.Context, to jid.JID) error {
+	_, err := g.SendIQ(ctx, to, stanza.GetIQ, pingRequest{})
+
+	return err
+}
@@ -0,0 +1,53 @@
+package gofra_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestSendIQ(t *testing.T) {
+	h := gofratest.New(t)
+	h.Server.HandleIQTo("upload.example.com", "urn:example", "echo", func(iq gofratest.Stanza) (string, error) {
+		return `<echo xmlns="urn:example">` + iq.Attr("to") + `</echo>`, nil
+	})
+	h.Server.HandleIQ("urn:example", "ack", func(iq gofratest.Stanza) (string, error) {
+		return "", nil
+	})
+	h.Start()
+
+	type echo struct {
+		XMLName xml.Name `xml:"urn:example echo"`
+		Text    string   `xml:",chardata"`
+	}
+
+	r, err := h.Gofra.SendIQ(context.Background(), jid.MustParse("upload.example.com"), stanza.GetIQ, echo{})
+	if assert.NoError(t, err) {
+		var response echo
+		assert.NoError(t, r.Decode(&response))
+		assert.Equal(t, "upload.example.com", response.Text)
+	}
+
+	// Only the address the handler is set for is answered
+	_, err = h.Gofra.SendIQ(context.Background(), jid.MustParse("example.com"), stanza.GetIQ, echo{})
+	var stanzaErr stanza.Error
+	if assert.True(t, errors.As(err, &stanzaErr)) {
+		assert.Equal(t, stanza.ServiceUnavailable, stanzaErr.Condition)
+	}
+
+	// Empty results have no payload
+	type ack struct {
+		XMLName xml.Name `xml:"urn:example ack"`
+	}
+	r, err = h.Gofra.SendIQ(context.Background(), jid.JID{}, stanza.SetIQ, ack{})
+	if assert.NoError(t, err) {
+		assert.Empty(t, r.Payload)
+	}
+}
@@ -0,0 +1,163 @@
+package gofra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mellium.im/xmpp/ping"
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	defaultPingTimeout     = 10 * time.Second
+	defaultMaxPingFailures = 2
+
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 2 * time.Minute
+)
+
+// keepalive periodically pings and reports the connection as dead once
+// maxFailures consecutive pings went unanswered.
+type keepalive struct {
+	interval    time.Duration
+	timeout     time.Duration
+	maxFailures int
+	failures    int
+
+	ping    func(ctx context.Context) error
+	onAlive func()
+	onDead  func(err error)
+}
+
+func newKeepalive(config KeepaliveConfig) *keepalive {
+	k := &keepalive{
+		interval:    config.Interval,
+		timeout:     config.Timeout,
+		maxFailures: config.MaxFailures,
+		onAlive:     func() {},
+		onDead:      func(error) {},
+	}
+
+	if k.timeout <= 0 {
+		k.timeout = defaultPingTimeout
+	}
+
+	if k.maxFailures <= 0 {
+		k.maxFailures = defaultMaxPingFailures
+	}
+
+	return k
+}
+
+// run pings every interval until ctx is done or the connection is deemed dead.
+func (k *keepalive) run(ctx context.Context) {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !k.check(ctx) {
+				return
+			}
+		}
+	}
+}
+
+// check sends a single ping and returns false once the connection is dead.
+func (k *keepalive) check(ctx context.Context) bool {
+	pingCtx, cancel := context.WithTimeout(ctx, k.timeout)
+	err := k.ping(pingCtx)
+	cancel()
+
+	if err == nil {
+		k.failures = 0
+		k.onAlive()
+
+		return true
+	}
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	k.failures++
+	if k.failures < k.maxFailures {
+		return true
+	}
+
+	k.onDead(err)
+
+	return false
+}
+
+// startKeepalive pings the server for as long as ctx is alive. When the server
+// stops answering the connection is closed so that Serve returns and Connect
+// can reconnect.
+func (g *Gofra) startKeepalive(ctx context.Context) {
+	if g.config.Keepalive.Interval <= 0 {
+		return
+	}
+
+	k := newKeepalive(g.config.Keepalive)
+	k.ping = func(ctx context.Context) error {
+		err := ping.Send(ctx, g.Client, g.Client.LocalAddr().Domain())
+
+		// Any stanza error is an answer, so the server is still there
+		var stanzaErr stanza.Error
+		if errors.As(err, &stanzaErr) {
+			return nil
+		}
+
+		return err
+	}
+	k.onAlive = func() {
+		g.Publish(Event{
+			Name:    "keepalive",
+			Payload: map[string]interface{}{"timeout": k.timeout},
+		})
+	}
+	k.onDead = func(err error) {
+		g.logger.Warn(fmt.Sprintf("Server did not answer %d pings, closing connection: %v", k.maxFailures, err))
+
+		if err := g.Client.Conn().Close(); err != nil {
+			g.logger.Error(fmt.Sprintf("Error closing dead connection: %q", err))
+		}
+	}
+
+	go k.run(ctx)
+}
+
+// reconnect dials a new session with exponential backoff until it succeeds or
+// the engine's context is done.
+func (g *Gofra) reconnect() error {
+	delay := minReconnectDelay
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return g.ctx.Err()
+		case <-time.After(delay):
+		}
+
+		g.logger.Info("Reconnecting…")
+
+		c, err := newXmppClient(g.ctx, g.config, g.xmlIn, g.xmlOut, g.logger)
+		if err == nil {
+			g.Client = c
+
+			return nil
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+
+		g.logger.Error(fmt.Sprintf("Error reconnecting, retrying in %s: %v", delay, err))
+	}
+}
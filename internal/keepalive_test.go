@@ -0,0 +1,53 @@
+package gofra
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepalive_Defaults(t *testing.T) {
+	k := newKeepalive(KeepaliveConfig{})
+
+	assert.Equal(t, defaultPingTimeout, k.timeout)
+	assert.Equal(t, defaultMaxPingFailures, k.maxFailures)
+}
+
+func TestKeepalive_DeadAfterMaxFailures(t *testing.T) {
+	var alive, dead int
+	pingErr := errors.New("ping timed out")
+
+	k := newKeepalive(KeepaliveConfig{MaxFailures: 2})
+	k.onAlive = func() { alive++ }
+	k.onDead = func(err error) {
+		assert.Equal(t, pingErr, err)
+		dead++
+	}
+
+	k.ping = func(ctx context.Context) error { return pingErr }
+	assert.True(t, k.check(context.Background()))
+	assert.Equal(t, 0, dead)
+
+	// A successful ping resets the failure count
+	k.ping = func(ctx context.Context) error { return nil }
+	assert.True(t, k.check(context.Background()))
+	assert.Equal(t, 1, alive)
+
+	k.ping = func(ctx context.Context) error { return pingErr }
+	assert.True(t, k.check(context.Background()))
+	assert.False(t, k.check(context.Background()))
+	assert.Equal(t, 1, dead)
+}
+
+func TestKeepalive_StopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	k := newKeepalive(KeepaliveConfig{MaxFailures: 1})
+	k.ping = func(ctx context.Context) error { return ctx.Err() }
+	k.onDead = func(err error) { t.Fatal("canceled pings must not be reported as a dead connection") }
+
+	assert.False(t, k.check(ctx))
+}
@@ -0,0 +1,259 @@
+package gofra
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"sync"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	// MAMNS is the namespace for XEP-0313 Message Archive Management.
+	MAMNS = "urn:xmpp:mam:2"
+
+	// RSMNS is the namespace for XEP-0059 Result Set Management.
+	RSMNS = "http://jabber.org/protocol/rsm"
+
+	// ForwardNS is the namespace for XEP-0297 Stanza Forwarding.
+	ForwardNS = "urn:xmpp:forward:0"
+
+	// FullTextNS is the namespace for XEP-0431 Full Text Search in MAM.
+	FullTextNS = "urn:xmpp:fulltext:0"
+)
+
+// ArchiveQuery filters the messages of an archive, and pages through them. The
+// zero value asks for the first page of the whole archive.
+type ArchiveQuery struct {
+	// With only matches the messages exchanged with this JID, in the archive
+	// of the account.
+	With jid.JID
+	// Start and End bound the time the messages were sent at.
+	Start time.Time
+	End   time.Time
+	// Text searches the bodies, where the archive supports it.
+	Text string
+
+	// Max is the size of the page, chosen by the archive when zero.
+	Max int
+	// After asks for the page following the message with this archive ID.
+	After string
+	// Before asks for the page preceding the message with this archive ID.
+	Before string
+	// Latest asks for the last page of the archive, when Before is empty.
+	Latest bool
+}
+
+// ArchivedMessage is a message of an archive.
+type ArchivedMessage struct {
+	// ID of the message in the archive, to page from it.
+	ID    string
+	Stamp time.Time
+	MB    MessageBody
+}
+
+// ArchivePage is a page of the messages matching an ArchiveQuery, oldest
+// first.
+type ArchivePage struct {
+	Messages []ArchivedMessage
+	// Archive IDs of the first and last messages of the page.
+	First string
+	Last  string
+	// Count is how many messages match the query, if the archive tells.
+	Count int
+	// Complete is set on the last page in the direction queried.
+	Complete bool
+}
+
+type mamQuery struct {
+	XMLName xml.Name `xml:"urn:xmpp:mam:2 query"`
+	QueryID string   `xml:"queryid,attr"`
+	Form    *XData
+	Set     *rsmSet
+}
+
+type rsmSet struct {
+	XMLName xml.Name `xml:"http://jabber.org/protocol/rsm set"`
+	Max     int      `xml:"max,omitempty"`
+	After   string   `xml:"after,omitempty"`
+	Before  *string  `xml:"before"`
+}
+
+type mamFin struct {
+	XMLName  xml.Name `xml:"urn:xmpp:mam:2 fin"`
+	Complete bool     `xml:"complete,attr"`
+	Set      struct {
+		First string `xml:"first"`
+		Last  string `xml:"last"`
+		Count int    `xml:"count"`
+	} `xml:"http://jabber.org/protocol/rsm set"`
+}
+
+// mamResult is a message of an archive, forwarded by it.
+type mamResult struct {
+	Result struct {
+		QueryID   string `xml:"queryid,attr"`
+		ID        string `xml:"id,attr"`
+		Forwarded struct {
+			Delay   Delay       `xml:"urn:xmpp:delay delay"`
+			Message MessageBody `xml:"message"`
+		} `xml:"urn:xmpp:forward:0 forwarded"`
+	} `xml:"urn:xmpp:mam:2 result"`
+}
+
+// form returns the filters of the query as a data form, or nil without any.
+func (q ArchiveQuery) form() *XData {
+	var fields []XDataField
+	if !q.With.Equal(jid.JID{}) {
+		fields = append(fields, XDataField{Var: "with", Values: []string{q.With.String()}})
+	}
+	if !q.Start.IsZero() {
+		fields = append(fields, XDataField{Var: "start", Values: []string{q.Start.UTC().Format(time.RFC3339)}})
+	}
+	if !q.End.IsZero() {
+		fields = append(fields, XDataField{Var: "end", Values: []string{q.End.UTC().Format(time.RFC3339)}})
+	}
+	if q.Text != "" {
+		fields = append(fields, XDataField{Var: "{" + FullTextNS + "}fulltext", Values: []string{q.Text}})
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return &XData{Type: "submit", Fields: append([]XDataField{
+		{Var: "FORM_TYPE", Type: "hidden", Values: []string{MAMNS}},
+	}, fields...)}
+}
+
+func (q ArchiveQuery) set() *rsmSet {
+	set := &rsmSet{Max: q.Max, After: q.After}
+	if q.Before != "" || q.Latest {
+		before := q.Before
+		set.Before = &before
+	}
+
+	if set.Max == 0 && set.After == "" && set.Before == nil {
+		return nil
+	}
+
+	return set
+}
+
+// archives collects the messages archives send in answer to the queries of
+// QueryArchive, until the IQ result ending them.
+type archives struct {
+	g API
+
+	mu sync.Mutex
+	// Messages received so far, by query ID
+	pending map[string]*archiveQuery
+}
+
+type archiveQuery struct {
+	archive  jid.JID
+	messages []ArchivedMessage
+}
+
+func newArchives(g API) *archives {
+	return &archives{g: g, pending: make(map[string]*archiveQuery)}
+}
+
+func (a *archives) muxOptions() []mux.Option {
+	result := xml.Name{Space: MAMNS, Local: "result"}
+
+	return []mux.Option{
+		mux.Message(stanza.NormalMessage, result, a),
+		mux.Message(stanza.ChatMessage, result, a),
+		mux.Message(stanza.GroupChatMessage, result, a),
+	}
+}
+
+// query sends the query to the archive and returns the messages it answered
+// with. Archives send them before the IQ result, and stanzas are handled in
+// order, so they have all been collected once it returns.
+func (a *archives) query(ctx context.Context, archive jid.JID, q ArchiveQuery) (ArchivePage, error) {
+	id := generateSessionID()
+
+	a.mu.Lock()
+	a.pending[id] = &archiveQuery{archive: archive.Bare()}
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, id)
+		a.mu.Unlock()
+	}()
+
+	r, err := a.g.SendIQ(ctx, archive, stanza.SetIQ, mamQuery{QueryID: id, Form: q.form(), Set: q.set()})
+	if err != nil {
+		return ArchivePage{}, err
+	}
+
+	var fin mamFin
+	if err := r.Decode(&fin); err != nil {
+		return ArchivePage{}, err
+	}
+
+	a.mu.Lock()
+	messages := a.pending[id].messages
+	a.mu.Unlock()
+
+	return ArchivePage{
+		Messages: messages,
+		First:    fin.Set.First,
+		Last:     fin.Set.Last,
+		Count:    fin.Set.Count,
+		Complete: fin.Complete,
+	}, nil
+}
+
+// HandleMessage collects the messages sent by an archive for a query.
+func (a *archives) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEncoder) error {
+	var m mamResult
+	if err := xml.NewTokenDecoder(t).Decode(&m); err != nil && err != io.EOF {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	q, ok := a.pending[m.Result.QueryID]
+	if !ok {
+		return nil
+	}
+
+	// Only the archive queried is trusted, the one of the account being the
+	// account itself
+	from := msg.From.Bare()
+	if !from.Equal(q.archive) && !(q.archive.Equal(jid.JID{}) && (from.Equal(jid.JID{}) || from.String() == a.g.Account())) {
+		return nil
+	}
+
+	mb := m.Result.Forwarded.Message
+	if mb.Delay == nil {
+		delay := m.Result.Forwarded.Delay
+		mb.Delay = &delay
+	}
+
+	q.messages = append(q.messages, ArchivedMessage{
+		ID:    m.Result.ID,
+		Stamp: m.Result.Forwarded.Delay.Stamp,
+		MB:    mb,
+	})
+
+	return nil
+}
+
+// QueryArchive queries the message archive (XEP-0313) of a room, or of the
+// account of the bot with the zero JID, and returns the page of the messages
+// matching q. Later pages are queried with the After of the Last of this one,
+// until it is Complete.
+func (g *Gofra) QueryArchive(ctx context.Context, archive jid.JID, q ArchiveQuery) (ArchivePage, error) {
+	return g.archives.query(ctx, archive, q)
+}
@@ -0,0 +1,87 @@
+package gofra_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func archivedMessage(from, queryID, id, body string) string {
+	return `<message xmlns="jabber:client" from="` + from + `" to="gofra@example.com/gofratest">` +
+		`<result xmlns="urn:xmpp:mam:2" queryid="` + queryID + `" id="` + id + `"><forwarded xmlns="urn:xmpp:forward:0">` +
+		`<delay xmlns="urn:xmpp:delay" stamp="2024-01-02T15:04:05Z"/>` +
+		`<message xmlns="jabber:client" type="groupchat" from="room@muc.example.com/alice"><body>` + body + `</body></message>` +
+		`</forwarded></result></message>`
+}
+
+func TestQueryArchive(t *testing.T) {
+	h := gofratest.New(t)
+	var iq struct {
+		Query struct {
+			QueryID string `xml:"queryid,attr"`
+			Fields  []struct {
+				Var   string `xml:"var,attr"`
+				Value string `xml:"value"`
+			} `xml:"x>field"`
+			Max   int    `xml:"set>max"`
+			After string `xml:"set>after"`
+		} `xml:"urn:xmpp:mam:2 query"`
+	}
+	query := &iq.Query
+	h.Server.HandleIQTo("room@muc.example.com", gofra.MAMNS, "query", func(st gofratest.Stanza) (string, error) {
+		if err := st.Decode(&iq); err != nil {
+			return "", err
+		}
+
+		h.Server.Send(archivedMessage("room@muc.example.com", query.QueryID, "a1", "!ping"))
+		// Only the archive queried is trusted
+		h.Server.Send(archivedMessage("mallory@example.com", query.QueryID, "m1", "!spam"))
+		h.Server.Send(archivedMessage("room@muc.example.com", query.QueryID, "a2", "hello"))
+
+		return `<fin xmlns="urn:xmpp:mam:2" complete="true"><set xmlns="http://jabber.org/protocol/rsm">` +
+			`<first>a1</first><last>a2</last><count>2</count></set></fin>`, nil
+	})
+	h.Start()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	page, err := h.Gofra.QueryArchive(context.Background(), jid.MustParse("room@muc.example.com"), gofra.ArchiveQuery{
+		Start: start,
+		Text:  "ping",
+		Max:   10,
+		After: "a0",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	fields := map[string]string{}
+	for _, f := range query.Fields {
+		fields[f.Var] = f.Value
+	}
+	assert.Equal(t, map[string]string{
+		"FORM_TYPE":                     gofra.MAMNS,
+		"start":                         "2024-01-01T00:00:00Z",
+		"{urn:xmpp:fulltext:0}fulltext": "ping",
+	}, fields)
+	assert.Equal(t, 10, query.Max)
+	assert.Equal(t, "a0", query.After)
+
+	assert.True(t, page.Complete)
+	assert.Equal(t, "a1", page.First)
+	assert.Equal(t, "a2", page.Last)
+	assert.Equal(t, 2, page.Count)
+	if assert.Len(t, page.Messages, 2) {
+		m := page.Messages[0]
+		assert.Equal(t, "a1", m.ID)
+		assert.Equal(t, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), m.Stamp)
+		assert.Equal(t, "room@muc.example.com/alice", m.MB.From.String())
+		assert.Equal(t, "!ping", m.MB.Body)
+		assert.Equal(t, "hello", page.Messages[1].MB.Body)
+	}
+}
@@ -0,0 +1,532 @@
+// Package memserver is an in-memory XMPP server a single bot session connects
+// to, for trying plugins out in the console and testing them.
+package memserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"mellium.im/xmpp"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+	"mellium.im/xmpp/stream"
+)
+
+const (
+	nsClient   = "jabber:client"
+	nsMUCUser  = "http://jabber.org/protocol/muc#user"
+	nsRoster   = "jabber:iq:roster"
+	nsPing     = "urn:xmpp:ping"
+	nsDiscoInf = "http://jabber.org/protocol/disco#info"
+)
+
+// Stanza is a top-level element sent by the bot, as seen by the server.
+type Stanza struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+// Attr returns the value of the attribute with the given local name.
+func (s Stanza) Attr(local string) string {
+	for _, attr := range s.Attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// Child returns the name of the first child element.
+func (s Stanza) Child() xml.Name {
+	d := xml.NewDecoder(bytes.NewReader([]byte(s.Inner)))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.Name{}
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name
+		}
+	}
+}
+
+// String returns the stanza as XML. Attribute namespaces are not preserved.
+func (s Stanza) String() string {
+	var b bytes.Buffer
+	b.WriteString("<" + s.XMLName.Local)
+	for _, attr := range s.Attrs {
+		fmt.Fprintf(&b, " %s=%q", attr.Name.Local, attr.Value)
+	}
+	b.WriteString(">" + s.Inner + "</" + s.XMLName.Local + ">")
+
+	return b.String()
+}
+
+// Decode unmarshals the stanza into v.
+func (s Stanza) Decode(v interface{}) error {
+	return xml.Unmarshal([]byte(s.String()), v)
+}
+
+// IQHandler answers an IQ sent by the bot. The returned payload is wrapped in a
+// result IQ; a stanza.Error is sent back as an error IQ.
+type IQHandler func(iq Stanza) (string, error)
+
+// iqRoute is the address and payload name of the IQs a handler answers. The
+// handlers with no address answer the IQs not routed to any other.
+type iqRoute struct {
+	to      string
+	payload xml.Name
+}
+
+// RosterItem is an entry of the bot's roster.
+type RosterItem struct {
+	JID          string
+	Name         string
+	Subscription string
+}
+
+// Server is an in-memory stand-in for the bot's XMPP server. It records every
+// stanza the bot sends, hosts scripted MUC rooms and answers IQs.
+type Server struct {
+	bot        jid.JID
+	conn       net.Conn
+	clientConn net.Conn
+
+	mu        sync.Mutex
+	rooms     map[string][]string
+	roster    []RosterItem
+	handlers  map[iqRoute]IQHandler
+	pending   map[string]chan Stanza
+	sent      []Stanza
+	delivered chan struct{}
+	observers []func(Stanza)
+
+	out    chan string
+	ids    uint64
+	closed chan struct{}
+}
+
+// NewServer creates a server for the bot's full JID. It is connected to the
+// bot through an in-memory pipe once Serve is called.
+func NewServer(bot jid.JID) *Server {
+	clientConn, conn := net.Pipe()
+
+	s := &Server{
+		bot:        bot,
+		conn:       conn,
+		clientConn: clientConn,
+		rooms:      make(map[string][]string),
+		handlers:   make(map[iqRoute]IQHandler),
+		pending:    make(map[string]chan Stanza),
+		delivered:  make(chan struct{}),
+		out:        make(chan string, 256),
+		closed:     make(chan struct{}),
+	}
+
+	s.HandleIQ(nsPing, "ping", func(Stanza) (string, error) {
+		return "", nil
+	})
+	s.HandleIQ(nsRoster, "query", func(Stanza) (string, error) {
+		return s.rosterPayload(), nil
+	})
+	s.HandleIQ(nsDiscoInf, "query", func(Stanza) (string, error) {
+		return `<query xmlns="` + nsDiscoInf + `"><identity category="server" type="im"/></query>`, nil
+	})
+
+	return s
+}
+
+// Bot returns the full JID of the bot.
+func (s *Server) Bot() jid.JID {
+	return s.bot
+}
+
+// AddRoom creates a MUC room with the given occupants, which are announced to
+// the bot when it joins.
+func (s *Server) AddRoom(room string, occupants ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rooms[room] = append([]string{}, occupants...)
+}
+
+// Occupants returns the nicknames present in a room.
+func (s *Server) Occupants(room string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.rooms[room]...)
+}
+
+// SetRoster replaces the roster returned to the bot.
+func (s *Server) SetRoster(items ...RosterItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roster = items
+}
+
+// HandleIQ sets the responder for IQs sent by the bot whose payload has the
+// given name. IQs without a responder get a service-unavailable error.
+func (s *Server) HandleIQ(space, local string, h IQHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[iqRoute{payload: xml.Name{Space: space, Local: local}}] = h
+}
+
+// HandleIQTo sets the responder for IQs sent by the bot to the given address
+// whose payload has the given name, e.g. a component of the server. It takes
+// precedence over the one set with HandleIQ.
+func (s *Server) HandleIQTo(to, space, local string, h IQHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[iqRoute{to: to, payload: xml.Name{Space: space, Local: local}}] = h
+}
+
+// Observe registers a function called with every stanza the bot sends, before
+// the server handles it.
+func (s *Server) Observe(f func(Stanza)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.observers = append(s.observers, f)
+}
+
+// Session returns a session for the bot on its end of the pipe. The session
+// is ready to use, as the server has no stream negotiation.
+func (s *Server) Session(ctx context.Context) (*xmpp.Session, error) {
+	return xmpp.NewSession(ctx, s.bot.Domain(), s.bot, s.clientConn, xmpp.Ready|xmpp.Secure|xmpp.Authn, noNegotiation)
+}
+
+func noNegotiation(context.Context, *stream.Info, *stream.Info, *xmpp.Session, interface{}) (xmpp.SessionState, io.ReadWriter, interface{}, error) {
+	return xmpp.Ready, nil, nil, nil
+}
+
+// Message sends a message to the bot. Messages from an occupant of one of the
+// rooms (room@service/nick) are groupchat messages, any other are chat
+// messages. It returns the ID of the message.
+func (s *Server) Message(from jid.JID, body string) string {
+	return s.message(from, body, "")
+}
+
+// Correct sends the bot a correction (XEP-0308) of the message with the given
+// ID, and returns the ID of the correction.
+func (s *Server) Correct(from jid.JID, replaces, body string) string {
+	return s.message(from, body, fmt.Sprintf(`<replace xmlns="urn:xmpp:message-correct:0" id=%q/>`, replaces))
+}
+
+func (s *Server) message(from jid.JID, body, payload string) string {
+	typ := stanza.ChatMessage
+	if s.isRoom(from.Bare().String()) && from.Resourcepart() != "" {
+		typ = stanza.GroupChatMessage
+	}
+
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(body))
+
+	id := s.nextID()
+	s.Send(fmt.Sprintf(`<message xmlns=%q type=%q id=%q from=%q to=%q><body>%s</body>%s</message>`,
+		nsClient, typ, id, from, s.bot, escaped.String(), payload))
+
+	return id
+}
+
+// Join announces a new occupant in a room, creating the room if needed.
+func (s *Server) Join(room, nick string) {
+	s.mu.Lock()
+	s.rooms[room] = append(s.rooms[room], nick)
+	s.mu.Unlock()
+
+	s.Send(occupantPresence(room, nick, s.bot.String(), "", false))
+}
+
+// Leave announces an occupant left a room.
+func (s *Server) Leave(room, nick string) {
+	s.mu.Lock()
+	occupants := s.rooms[room][:0]
+	for _, occupant := range s.rooms[room] {
+		if occupant != nick {
+			occupants = append(occupants, occupant)
+		}
+	}
+	s.rooms[room] = occupants
+	s.mu.Unlock()
+
+	s.Send(occupantPresence(room, nick, s.bot.String(), string(stanza.UnavailablePresence), false))
+}
+
+func (s *Server) isRoom(room string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.rooms[room]
+
+	return exists
+}
+
+// Presence sends a presence of the given type, available if empty, with the
+// raw XML payload to the bot.
+func (s *Server) Presence(from string, typ stanza.PresenceType, payload string) {
+	s.Send(presence(from, s.bot.String(), typ, payload))
+}
+
+// Send writes raw XML to the bot.
+func (s *Server) Send(raw string) {
+	select {
+	case s.out <- raw:
+	case <-s.closed:
+	}
+}
+
+// Sent returns every stanza the bot has sent so far.
+func (s *Server) Sent() []Stanza {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Stanza{}, s.sent...)
+}
+
+func (s *Server) nextID() string {
+	return "srv" + strconv.FormatUint(atomic.AddUint64(&s.ids, 1), 10)
+}
+
+// Serve writes queued stanzas to the bot and reads what it sends until the
+// connection is closed. Writes are queued so that handling a stanza never
+// blocks on the bot reading.
+func (s *Server) Serve() {
+	go func() {
+		for {
+			select {
+			case raw := <-s.out:
+				if _, err := io.WriteString(s.conn, raw); err != nil {
+					return
+				}
+			case <-s.closed:
+				return
+			}
+		}
+	}()
+
+	d := xml.NewDecoder(s.conn)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var st Stanza
+		if err := d.DecodeElement(&st, &start); err != nil {
+			return
+		}
+
+		s.receive(st)
+	}
+}
+
+// Close disconnects the bot.
+func (s *Server) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+	s.mu.Unlock()
+
+	s.conn.Close()
+	s.clientConn.Close()
+}
+
+func (s *Server) receive(st Stanza) {
+	s.mu.Lock()
+	s.sent = append(s.sent, st)
+	close(s.delivered)
+	s.delivered = make(chan struct{})
+	observers := s.observers
+	s.mu.Unlock()
+
+	for _, observe := range observers {
+		observe(st)
+	}
+
+	switch st.XMLName.Local {
+	case "presence":
+		s.handlePresence(st)
+	case "iq":
+		s.handleIQ(st)
+	}
+}
+
+// WaitSent returns a channel closed the next time the bot sends a stanza.
+func (s *Server) WaitSent() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delivered
+}
+
+func (s *Server) handlePresence(st Stanza) {
+	to, err := jid.Parse(st.Attr("to"))
+	if err != nil || to.Resourcepart() == "" {
+		return
+	}
+
+	room := to.Bare().String()
+
+	s.mu.Lock()
+	occupants, exists := s.rooms[room]
+	if !exists {
+		s.mu.Unlock()
+		return
+	}
+
+	if st.Attr("type") == string(stanza.UnavailablePresence) {
+		s.mu.Unlock()
+		s.Send(occupantPresence(room, to.Resourcepart(), s.bot.String(), "unavailable", true))
+
+		return
+	}
+
+	occupants = append([]string{}, occupants...)
+	s.mu.Unlock()
+
+	for _, nick := range occupants {
+		s.Send(occupantPresence(room, nick, s.bot.String(), "", false))
+	}
+	s.Send(occupantPresence(room, to.Resourcepart(), s.bot.String(), "", true))
+}
+
+func (s *Server) handleIQ(st Stanza) {
+	id := st.Attr("id")
+	typ := stanza.IQType(st.Attr("type"))
+
+	if typ == stanza.ResultIQ || typ == stanza.ErrorIQ {
+		s.mu.Lock()
+		response, ok := s.pending[id]
+		delete(s.pending, id)
+		s.mu.Unlock()
+
+		if ok {
+			response <- st
+		}
+
+		return
+	}
+
+	to := st.Attr("to")
+	if to == "" {
+		to = s.bot.Domain().String()
+	}
+
+	s.mu.Lock()
+	h, ok := s.handlers[iqRoute{to: to, payload: st.Child()}]
+	if !ok {
+		h, ok = s.handlers[iqRoute{payload: st.Child()}]
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		s.Send(iqError(id, to, s.bot.String(), stanza.Error{Type: stanza.Cancel, Condition: stanza.ServiceUnavailable}))
+
+		return
+	}
+
+	payload, err := h(st)
+	if err != nil {
+		var stanzaErr stanza.Error
+		if !errors.As(err, &stanzaErr) {
+			stanzaErr = stanza.Error{Type: stanza.Wait, Condition: stanza.InternalServerError, Text: map[string]string{"": err.Error()}}
+		}
+
+		s.Send(iqError(id, to, s.bot.String(), stanzaErr))
+
+		return
+	}
+
+	s.Send(fmt.Sprintf(`<iq xmlns=%q type="result" id=%q from=%q to=%q>%s</iq>`, nsClient, id, to, s.bot, payload))
+}
+
+// Request sends an IQ to the bot and returns the channel its response will be
+// delivered on.
+func (s *Server) Request(from string, typ stanza.IQType, payload string) chan Stanza {
+	id := s.nextID()
+	response := make(chan Stanza, 1)
+
+	s.mu.Lock()
+	s.pending[id] = response
+	s.mu.Unlock()
+
+	s.Send(fmt.Sprintf(`<iq xmlns=%q type=%q id=%q from=%q to=%q>%s</iq>`, nsClient, typ, id, from, s.bot, payload))
+
+	return response
+}
+
+func (s *Server) rosterPayload() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b bytes.Buffer
+	b.WriteString(`<query xmlns="` + nsRoster + `">`)
+	for _, item := range s.roster {
+		fmt.Fprintf(&b, `<item jid=%q name=%q subscription=%q/>`, item.JID, item.Name, item.Subscription)
+	}
+	b.WriteString(`</query>`)
+
+	return b.String()
+}
+
+func occupantPresence(room, nick, to, typ string, self bool) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<presence xmlns=%q from="%s/%s" to=%q`, nsClient, room, nick, to)
+	if typ != "" {
+		fmt.Fprintf(&b, ` type=%q`, typ)
+	}
+
+	role := "participant"
+	if typ == string(stanza.UnavailablePresence) {
+		role = "none"
+	}
+
+	fmt.Fprintf(&b, `><x xmlns=%q><item affiliation="member" role=%q/>`, nsMUCUser, role)
+	if self {
+		b.WriteString(`<status code="110"/>`)
+	}
+	b.WriteString(`</x></presence>`)
+
+	return b.String()
+}
+
+func presence(from, to string, typ stanza.PresenceType, payload string) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<presence xmlns=%q from=%q to=%q`, nsClient, from, to)
+	if typ != "" {
+		fmt.Fprintf(&b, ` type=%q`, typ)
+	}
+	b.WriteString(">" + payload + "</presence>")
+
+	return b.String()
+}
+
+func iqError(id, from, to string, e stanza.Error) string {
+	payload, _ := xml.Marshal(e)
+
+	return fmt.Sprintf(`<iq xmlns=%q type="error" id=%q from=%q to=%q>%s</iq>`, nsClient, id, from, to, payload)
+}
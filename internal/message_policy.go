@@ -0,0 +1,185 @@
+package gofra
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	defaultMaxParts           = 3
+	defaultContinuationMarker = "(…)"
+	defaultMoreHint           = "(%d more, send !more to continue)"
+)
+
+// messagePolicy splits message bodies that are too long for their message
+// type. Parts exceeding MaxParts are either sent privately to whoever the
+// message answers or kept until SendMore is called for the same destination.
+type messagePolicy struct {
+	config MessagesConfig
+
+	mu      sync.Mutex
+	pending map[string][]MessageBody
+}
+
+func newMessagePolicy(config MessagesConfig) *messagePolicy {
+	if config.MaxParts <= 0 {
+		config.MaxParts = defaultMaxParts
+	}
+
+	if config.ContinuationMarker == "" {
+		config.ContinuationMarker = defaultContinuationMarker
+	}
+
+	if config.MoreHint == "" {
+		config.MoreHint = defaultMoreHint
+	}
+
+	return &messagePolicy{
+		config:  config,
+		pending: make(map[string][]MessageBody),
+	}
+}
+
+// apply returns the messages to send right away in place of mb.
+func (p *messagePolicy) apply(mb MessageBody) []MessageBody {
+	max := p.config.MaxLength[string(mb.Type)]
+	if max <= 0 || utf8.RuneCountInString(mb.Body) <= max {
+		return []MessageBody{mb}
+	}
+
+	bodies := splitBody(mb.Body, max-utf8.RuneCountInString(p.config.ContinuationMarker)-1)
+	parts := make([]MessageBody, len(bodies))
+	for i, body := range bodies {
+		parts[i] = mb
+		parts[i].Body = body
+		// The XHTML-IM body cannot be split along
+		parts[i].HTML = nil
+		if i > 0 {
+			parts[i].ID = ""
+			parts[i].ReceiptRequest, parts[i].Markable, parts[i].Replace, parts[i].Fallback = nil, nil, nil, nil
+			parts[i].OOB = nil
+		}
+		if i < len(bodies)-1 {
+			parts[i].Body += "\n" + p.config.ContinuationMarker
+		}
+	}
+
+	if len(parts) <= p.config.MaxParts {
+		return parts
+	}
+
+	now, rest := parts[:p.config.MaxParts], parts[p.config.MaxParts:]
+
+	if p.config.RestInPrivate && mb.Type == stanza.GroupChatMessage && mb.requester.Resourcepart() != "" {
+		for i := range rest {
+			rest[i].Type = stanza.ChatMessage
+			rest[i].To = mb.requester
+		}
+
+		return parts
+	}
+
+	p.mu.Lock()
+	p.pending[pendingKey(mb)] = rest
+	p.mu.Unlock()
+
+	return p.withHint(now, len(rest))
+}
+
+// more returns the next parts kept for the destination of mb.
+func (p *messagePolicy) more(mb MessageBody) []MessageBody {
+	key := pendingKey(mb)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rest := p.pending[key]
+	if len(rest) <= p.config.MaxParts {
+		delete(p.pending, key)
+
+		return rest
+	}
+
+	now := rest[:p.config.MaxParts]
+	p.pending[key] = rest[p.config.MaxParts:]
+
+	return p.withHint(now, len(rest)-p.config.MaxParts)
+}
+
+// withHint replaces the continuation marker of the last part with a hint on
+// how to get the remaining ones.
+func (p *messagePolicy) withHint(parts []MessageBody, remaining int) []MessageBody {
+	last := &parts[len(parts)-1]
+	last.Body = strings.TrimSuffix(last.Body, p.config.ContinuationMarker) + fmt.Sprintf(p.config.MoreHint, remaining)
+
+	return parts
+}
+
+func pendingKey(mb MessageBody) string {
+	return string(mb.Type) + " " + mb.To.Bare().String()
+}
+
+// splitBody splits body into parts of at most max characters, preferably on
+// line boundaries, then on spaces.
+func splitBody(body string, max int) []string {
+	if max < 1 {
+		max = 1
+	}
+
+	var parts []string
+	var current strings.Builder
+	currentLen := 0
+
+	flush := func() {
+		if currentLen > 0 {
+			parts = append(parts, strings.TrimRight(current.String(), "\n"))
+		}
+		current.Reset()
+		currentLen = 0
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		lineLen := utf8.RuneCountInString(line)
+
+		if currentLen > 0 && currentLen+1+lineLen > max {
+			flush()
+		}
+
+		for lineLen > max {
+			head, tail := cutLine(line, max)
+			parts = append(parts, head)
+			line, lineLen = tail, utf8.RuneCountInString(tail)
+		}
+
+		if currentLen > 0 {
+			current.WriteString("\n")
+			currentLen++
+		}
+		current.WriteString(line)
+		currentLen += lineLen
+	}
+
+	flush()
+
+	return parts
+}
+
+// cutLine cuts a line at the last space within the first max characters, or
+// at max characters if there is none.
+func cutLine(line string, max int) (string, string) {
+	runes := []rune(line)
+	cut := max
+
+	for i := max; i > 0; i-- {
+		if runes[i] == ' ' {
+			cut = i
+			break
+		}
+	}
+
+	return string(runes[:cut]), strings.TrimLeft(string(runes[cut:]), " ")
+}
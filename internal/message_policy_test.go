@@ -0,0 +1,92 @@
+package gofra
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+func TestSplitBody_OnLineBoundaries(t *testing.T) {
+	parts := splitBody("one\ntwo\nthree\nfour\n", 9)
+
+	assert.Equal(t, []string{"one\ntwo", "three", "four"}, parts)
+}
+
+func TestSplitBody_LongLines(t *testing.T) {
+	parts := splitBody("lorem ipsum dolor sit amet", 11)
+	assert.Equal(t, []string{"lorem ipsum", "dolor sit", "amet"}, parts)
+
+	parts = splitBody("abcdefghij", 4)
+	assert.Equal(t, []string{"abcd", "efgh", "ij"}, parts)
+}
+
+func groupchatReply(body string) MessageBody {
+	incoming := MessageBody{
+		Message: stanza.Message{
+			ID:   "abc",
+			Type: stanza.GroupChatMessage,
+			From: jid.MustParse("room@muc.example.com/alice"),
+			To:   jid.MustParse("bot@example.com/gofra"),
+		},
+	}
+
+	return incoming.Reply(body)
+}
+
+func TestMessagePolicy_ShortBodiesAreUntouched(t *testing.T) {
+	p := newMessagePolicy(MessagesConfig{MaxLength: map[string]int{"groupchat": 100}})
+
+	parts := p.apply(groupchatReply("hello"))
+	assert.Len(t, parts, 1)
+	assert.Equal(t, "hello", parts[0].Body)
+}
+
+func TestMessagePolicy_SplitAndMore(t *testing.T) {
+	p := newMessagePolicy(MessagesConfig{
+		MaxLength:          map[string]int{"groupchat": 10},
+		MaxParts:           2,
+		ContinuationMarker: "…",
+		MoreHint:           "(%d more)",
+	})
+	body := strings.Repeat("12345678\n", 5)
+
+	parts := p.apply(groupchatReply(body))
+	assert.Len(t, parts, 2)
+	assert.Equal(t, "12345678\n…", parts[0].Body)
+	assert.Equal(t, "12345678\n(3 more)", parts[1].Body)
+	assert.Equal(t, "abc", parts[0].ID)
+	assert.Empty(t, parts[1].ID)
+
+	parts = p.more(groupchatReply(""))
+	assert.Len(t, parts, 2)
+	assert.Equal(t, "12345678\n(1 more)", parts[1].Body)
+
+	parts = p.more(groupchatReply(""))
+	assert.Len(t, parts, 1)
+	assert.Equal(t, "12345678", parts[0].Body)
+
+	assert.Empty(t, p.more(groupchatReply("")))
+}
+
+func TestMessagePolicy_RestInPrivate(t *testing.T) {
+	p := newMessagePolicy(MessagesConfig{
+		MaxLength:     map[string]int{"groupchat": 10},
+		MaxParts:      1,
+		RestInPrivate: true,
+	})
+
+	parts := p.apply(groupchatReply(strings.Repeat("12345\n", 3)))
+	assert.Len(t, parts, 3)
+	assert.Equal(t, stanza.GroupChatMessage, parts[0].Type)
+	assert.Equal(t, "room@muc.example.com", parts[0].To.String())
+
+	for _, part := range parts[1:] {
+		assert.Equal(t, stanza.ChatMessage, part.Type)
+		assert.Equal(t, "room@muc.example.com/alice", part.To.String())
+	}
+
+	assert.Empty(t, p.more(groupchatReply("")))
+}
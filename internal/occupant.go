@@ -0,0 +1,32 @@
+package gofra
+
+import "time"
+
+// Occupant is a participant of a MUC room, as tracked by the MUC plugin from
+// the presences of the room and carried by its muc/* events.
+type Occupant struct {
+	Room string
+	Nick string
+	// JID is the real JID of the occupant, only known in non-anonymous rooms
+	// or when the bot moderates the room.
+	JID         string
+	Role        string
+	Affiliation string
+	Joined      time.Time
+	// Codes are the status codes of the last presence of the occupant.
+	Codes []int
+	// Self is set on the occupant of the bot.
+	Self bool
+}
+
+// HasStatus reports whether the last presence of the occupant had the status
+// code.
+func (o Occupant) HasStatus(code int) bool {
+	for _, c := range o.Codes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
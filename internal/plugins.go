@@ -5,6 +5,7 @@ import (
 	"os"
 	"plugin"
 	"strings"
+	"sync"
 )
 
 // Interface to be satisfied by any Gofra plugin
@@ -12,7 +13,7 @@ type Plugin interface {
 	Name() string
 	Description() string
 	Help() string
-	Init(Config, *Gofra)
+	Init(Config, API)
 }
 
 // Interface to be satisfied by plugins that need an execution loop
@@ -21,8 +22,37 @@ type Runnable interface {
 	Run()
 }
 
+// Interface to be satisfied by plugins that can serve several accounts at
+// once. Every account gets its own instance, and therefore its own state.
+// Plugins not implementing it are only loaded for the first account enabling them.
+type Instantiable interface {
+	NewInstance() Plugin
+}
+
 type Plugins map[string]Plugin
 
+// Accounts owning the plugins that cannot be instantiated per account
+var sharedPlugins = struct {
+	sync.Mutex
+	owners map[string]string
+}{owners: make(map[string]string)}
+
+// claimSharedPlugin reports whether a non-instantiable plugin can be loaded
+// for the given account.
+func claimSharedPlugin(name, account string) bool {
+	sharedPlugins.Lock()
+	defer sharedPlugins.Unlock()
+
+	owner, claimed := sharedPlugins.owners[name]
+	if !claimed {
+		sharedPlugins.owners[name] = account
+
+		return true
+	}
+
+	return owner == account
+}
+
 func (p Plugins) Init(config Config, gofra *Gofra) error {
 	return p.loadAll(config, gofra)
 }
@@ -124,21 +154,40 @@ func (p Plugins) load(fileName string, config Config, gofra *Gofra) bool {
 		return false
 	}
 
+	if !config.IsPluginEnabled(plugin.Name()) {
+		log.Printf("plugin %s is not enabled for %s", plugin.Name(), config.Jid)
+
+		return false
+	}
+
+	if instantiable, ok := plugin.(Instantiable); ok {
+		plugin = instantiable.NewInstance()
+	} else if !claimSharedPlugin(plugin.Name(), config.Jid) {
+		log.Printf("plugin %s does not support multiple accounts and is already loaded by another one, skipping it for %s", plugin.Name(), config.Jid)
+
+		return false
+	}
+
+	p.add(plugin, config, gofra)
+
+	return true
+}
+
+// add initializes a plugin instance and runs it if it is Runnable
+func (p Plugins) add(plugin Plugin, config Config, gofra *Gofra) {
 	p[plugin.Name()] = plugin
 
 	InitPlugin(plugin, config, gofra)
 
-	_, ok = plugin.(Runnable)
+	_, ok := plugin.(Runnable)
 	if ok {
 		go RunPlugin(plugin.Name(), plugin.(Runnable))
 	}
-
-	return true
 }
 
 // Improve comment
 // Wrapper to prevent a plugin initialization error from bleeding into the bot engine
-func InitPlugin(plugin Plugin, config Config, gofra *Gofra) {
+func InitPlugin(plugin Plugin, config Config, gofra API) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Printf("init method of plugin %s failed: %s", plugin.Name(), err)
@@ -0,0 +1,388 @@
+package gofra
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"sync"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	// PubSubNS is the namespace for XEP-0060 Publish-Subscribe.
+	PubSubNS = "http://jabber.org/protocol/pubsub"
+
+	// PubSubEventNS is the namespace of the notifications of PubSub nodes.
+	PubSubEventNS = "http://jabber.org/protocol/pubsub#event"
+
+	// PubSubOwnerNS is the namespace of the requests of the owners of PubSub
+	// nodes.
+	PubSubOwnerNS = "http://jabber.org/protocol/pubsub#owner"
+)
+
+// NodeConfig holds the options of a PubSub node, or of a publication, by the
+// var of their form field, like "pubsub#max_items".
+type NodeConfig map[string]string
+
+// form returns the options as a submitted form of type formType, or nil
+// without any.
+func (c NodeConfig) form(formType string) *XData {
+	if len(c) == 0 {
+		return nil
+	}
+
+	vars := make([]string, 0, len(c))
+	for v := range c {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+
+	form := &XData{Type: "submit", Fields: []XDataField{
+		{Var: "FORM_TYPE", Type: "hidden", Values: []string{formType}},
+	}}
+	for _, v := range vars {
+		form.Fields = append(form.Fields, XDataField{Var: v, Values: []string{c[v]}})
+	}
+
+	return form
+}
+
+// PubSubItem is an item of a PubSub node.
+type PubSubItem struct {
+	ID string
+	// Publisher is the JID of the publisher, if the service tells.
+	Publisher string
+	// Payload is the raw XML of the item.
+	Payload []byte
+}
+
+// Decode unmarshals the payload of the item into v.
+func (i PubSubItem) Decode(v interface{}) error {
+	if len(i.Payload) == 0 {
+		return fmt.Errorf("empty PubSub item %s", i.ID)
+	}
+
+	return xml.Unmarshal(i.Payload, v)
+}
+
+type pubsubItem struct {
+	ID        string `xml:"id,attr,omitempty"`
+	Publisher string `xml:"publisher,attr,omitempty"`
+	Payload   []byte `xml:",innerxml"`
+}
+
+func (i pubsubItem) item() PubSubItem {
+	return PubSubItem{ID: i.ID, Publisher: i.Publisher, Payload: bytes.TrimSpace(i.Payload)}
+}
+
+type pubsubNode struct {
+	Node string `xml:"node,attr"`
+}
+
+type pubsubForm struct {
+	Form *XData
+}
+
+type pubsubPublish struct {
+	Node string `xml:"node,attr"`
+	Item struct {
+		ID      string `xml:"id,attr,omitempty"`
+		Payload interface{}
+	} `xml:"item"`
+}
+
+type pubsubRetract struct {
+	Node   string `xml:"node,attr"`
+	Notify bool   `xml:"notify,attr"`
+	Item   struct {
+		ID string `xml:"id,attr"`
+	} `xml:"item"`
+}
+
+type pubsubItems struct {
+	Node     string `xml:"node,attr"`
+	MaxItems int    `xml:"max_items,attr,omitempty"`
+}
+
+type pubsubRequest struct {
+	XMLName     xml.Name            `xml:"http://jabber.org/protocol/pubsub pubsub"`
+	Create      *pubsubNode         `xml:"create"`
+	Configure   *pubsubForm         `xml:"configure"`
+	Publish     *pubsubPublish      `xml:"publish"`
+	Options     *pubsubForm         `xml:"publish-options"`
+	Retract     *pubsubRetract      `xml:"retract"`
+	Subscribe   *pubsubSubscription `xml:"subscribe"`
+	Unsubscribe *pubsubSubscription `xml:"unsubscribe"`
+	Items       *pubsubItems        `xml:"items"`
+}
+
+type pubsubSubscription struct {
+	Node string `xml:"node,attr"`
+	JID  string `xml:"jid,attr"`
+}
+
+type pubsubOwnerRequest struct {
+	XMLName   xml.Name `xml:"http://jabber.org/protocol/pubsub#owner pubsub"`
+	Configure struct {
+		Node string `xml:"node,attr"`
+		Form *XData
+	} `xml:"configure"`
+}
+
+type pubsubResult struct {
+	Publish struct {
+		Item struct {
+			ID string `xml:"id,attr"`
+		} `xml:"item"`
+	} `xml:"publish"`
+	Items struct {
+		Items []pubsubItem `xml:"item"`
+	} `xml:"items"`
+}
+
+// pubsubEvent is a notification of a PubSub node.
+type pubsubEvent struct {
+	Event struct {
+		Items struct {
+			Node    string       `xml:"node,attr"`
+			Items   []pubsubItem `xml:"item"`
+			Retract []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"retract"`
+		} `xml:"items"`
+	} `xml:"http://jabber.org/protocol/pubsub#event event"`
+}
+
+// PubSub manages and publishes to the nodes of publish-subscribe services
+// (XEP-0060), or of the PEP service of the account (XEP-0163) with the zero
+// JID, and subscribes to them. The notifications of the nodes are published
+// as pubsub/item and pubsub/retract events.
+type PubSub struct {
+	g API
+}
+
+// NewPubSub creates a PubSub client sending its requests through g.
+func NewPubSub(g API) *PubSub {
+	return &PubSub{g: g}
+}
+
+// Create creates the node with the given configuration.
+func (p *PubSub) Create(ctx context.Context, service jid.JID, node string, config NodeConfig) error {
+	request := pubsubRequest{Create: &pubsubNode{Node: node}}
+	if form := config.form(PubSubNS + "#node_config"); form != nil {
+		request.Configure = &pubsubForm{Form: form}
+	}
+
+	_, err := p.g.SendIQ(ctx, service, stanza.SetIQ, request)
+
+	return err
+}
+
+// Configure changes the configuration of a node of the bot.
+func (p *PubSub) Configure(ctx context.Context, service jid.JID, node string, config NodeConfig) error {
+	request := pubsubOwnerRequest{}
+	request.Configure.Node = node
+	request.Configure.Form = config.form(PubSubNS + "#node_config")
+
+	_, err := p.g.SendIQ(ctx, service, stanza.SetIQ, request)
+
+	return err
+}
+
+// Publish publishes payload, a struct marshalling to the XML of the item, to
+// the node. The item replaces the one with the same ID, the service choosing
+// one when id is empty, and is returned. Publish options are preconditions
+// on the configuration of the node, which the service creates with them if
+// it does not exist.
+func (p *PubSub) Publish(ctx context.Context, service jid.JID, node, id string, payload interface{}, options NodeConfig) (string, error) {
+	request := pubsubRequest{Publish: &pubsubPublish{Node: node}}
+	request.Publish.Item.ID = id
+	request.Publish.Item.Payload = payload
+	if form := options.form(PubSubNS + "#publish-options"); form != nil {
+		request.Options = &pubsubForm{Form: form}
+	}
+
+	r, err := p.g.SendIQ(ctx, service, stanza.SetIQ, request)
+	if err != nil {
+		return "", err
+	}
+
+	// Services only answer with the ID when they chose it
+	var result pubsubResult
+	if len(r.Payload) > 0 {
+		if err := r.Decode(&result); err != nil {
+			return "", err
+		}
+	}
+	if result.Publish.Item.ID != "" {
+		id = result.Publish.Item.ID
+	}
+
+	return id, nil
+}
+
+// Retract removes the item from the node, notifying the subscribers.
+func (p *PubSub) Retract(ctx context.Context, service jid.JID, node, id string) error {
+	request := pubsubRequest{Retract: &pubsubRetract{Node: node, Notify: true}}
+	request.Retract.Item.ID = id
+
+	_, err := p.g.SendIQ(ctx, service, stanza.SetIQ, request)
+
+	return err
+}
+
+// Subscribe subscribes the account to the notifications of the node.
+func (p *PubSub) Subscribe(ctx context.Context, service jid.JID, node string) error {
+	request := pubsubRequest{Subscribe: &pubsubSubscription{Node: node, JID: p.g.Account()}}
+	_, err := p.g.SendIQ(ctx, service, stanza.SetIQ, request)
+
+	return err
+}
+
+// Unsubscribe unsubscribes the account from the notifications of the node.
+func (p *PubSub) Unsubscribe(ctx context.Context, service jid.JID, node string) error {
+	request := pubsubRequest{Unsubscribe: &pubsubSubscription{Node: node, JID: p.g.Account()}}
+	_, err := p.g.SendIQ(ctx, service, stanza.SetIQ, request)
+
+	return err
+}
+
+// Items returns the items of the node, the max most recent ones unless max is
+// zero.
+func (p *PubSub) Items(ctx context.Context, service jid.JID, node string, max int) ([]PubSubItem, error) {
+	request := pubsubRequest{Items: &pubsubItems{Node: node, MaxItems: max}}
+
+	r, err := p.g.SendIQ(ctx, service, stanza.GetIQ, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var result pubsubResult
+	if err := r.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	items := make([]PubSubItem, 0, len(result.Items.Items))
+	for _, item := range result.Items.Items {
+		items = append(items, item.item())
+	}
+
+	return items, nil
+}
+
+// pubsubHandler publishes the notifications of PubSub nodes, as pubsub/item
+// events for the items published (service, node, id, item) and pubsub/retract
+// ones for the retracted (service, node, id). The service of PEP nodes is the
+// bare JID of their owner.
+type pubsubHandler struct {
+	logger  Logger
+	account func() string
+	events  *eventQueue
+}
+
+func (h pubsubHandler) muxOptions() []mux.Option {
+	event := xml.Name{Space: PubSubEventNS, Local: "event"}
+
+	return []mux.Option{
+		mux.Message(stanza.NormalMessage, event, h),
+		mux.Message(stanza.HeadlineMessage, event, h),
+	}
+}
+
+func (h pubsubHandler) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEncoder) error {
+	// Items keep their raw XML when decoded from bytes only
+	var raw bytes.Buffer
+	enc := xml.NewEncoder(&raw)
+	if _, err := xmlstream.Copy(enc, t); err != nil {
+		h.logger.Error(fmt.Sprintf("Error reading PubSub notification: %q", err))
+
+		return nil
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+
+	var e pubsubEvent
+	if err := xml.Unmarshal(raw.Bytes(), &e); err != nil {
+		h.logger.Error(fmt.Sprintf("Error decoding PubSub notification: %q", err))
+
+		return nil
+	}
+
+	service := msg.From.Bare().String()
+	if msg.From.Equal(jid.JID{}) {
+		service = h.account()
+	}
+	node := e.Event.Items.Node
+
+	var events []Event
+	for _, item := range e.Event.Items.Items {
+		events = append(events, Event{Name: "pubsub/item", Payload: map[string]interface{}{
+			"service": service,
+			"node":    node,
+			"id":      item.ID,
+			"item":    item.item(),
+		}})
+	}
+	for _, retracted := range e.Event.Items.Retract {
+		events = append(events, Event{Name: "pubsub/retract", Payload: map[string]interface{}{
+			"service": service,
+			"node":    node,
+			"id":      retracted.ID,
+		}})
+	}
+
+	for i := range events {
+		events[i].SetStanza(msg)
+	}
+	// In order, across notifications too, as later items replace earlier ones
+	h.events.push(events...)
+
+	return nil
+}
+
+// eventQueue publishes the events pushed one after the other, in order,
+// without holding up the caller.
+type eventQueue struct {
+	publish func(e Event)
+
+	mu      sync.Mutex
+	queue   []Event
+	running bool
+}
+
+func (q *eventQueue) push(events ...Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queue = append(q.queue, events...)
+	if q.running || len(q.queue) == 0 {
+		return
+	}
+	q.running = true
+
+	go q.run()
+}
+
+func (q *eventQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.queue) == 0 {
+			q.running = false
+			q.mu.Unlock()
+
+			return
+		}
+		e := q.queue[0]
+		q.queue = q.queue[1:]
+		q.mu.Unlock()
+
+		q.publish(e)
+	}
+}
@@ -0,0 +1,138 @@
+package gofra_test
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+type alert struct {
+	XMLName xml.Name `xml:"urn:example:alerts alert"`
+	Pair    string   `xml:"pair,attr"`
+	Price   string   `xml:",chardata"`
+}
+
+func TestPubSub_Requests(t *testing.T) {
+	h := gofratest.New(t)
+	service := jid.MustParse("pubsub.example.com")
+	var requests []gofratest.Stanza
+	h.Server.HandleIQTo(service.String(), gofra.PubSubNS, "pubsub", func(iq gofratest.Stanza) (string, error) {
+		requests = append(requests, iq)
+
+		switch {
+		case iq.Attr("type") == "get":
+			return `<pubsub xmlns="` + gofra.PubSubNS + `"><items node="alerts">` +
+				`<item id="i1" publisher="alice@example.com"><alert xmlns="urn:example:alerts" pair="BTCEUR">1000</alert></item>` +
+				`</items></pubsub>`, nil
+		case len(requests) == 2:
+			// The service chooses the ID of items published without one
+			return `<pubsub xmlns="` + gofra.PubSubNS + `"><publish node="alerts"><item id="generated"/></publish></pubsub>`, nil
+		}
+
+		return "", nil
+	})
+	h.Server.HandleIQTo(service.String(), gofra.PubSubOwnerNS, "pubsub", func(iq gofratest.Stanza) (string, error) {
+		requests = append(requests, iq)
+
+		return "", nil
+	})
+	h.Start()
+
+	ctx := context.Background()
+	pubsub := h.Gofra.PubSub()
+
+	assert.NoError(t, pubsub.Create(ctx, service, "alerts", gofra.NodeConfig{"pubsub#max_items": "10"}))
+	id, err := pubsub.Publish(ctx, service, "alerts", "", alert{Pair: "BTCEUR", Price: "1000"}, gofra.NodeConfig{"pubsub#access_model": "open"})
+	assert.NoError(t, err)
+	assert.Equal(t, "generated", id)
+	id, err = pubsub.Publish(ctx, service, "alerts", "i2", alert{Pair: "ETHEUR", Price: "50"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "i2", id)
+	assert.NoError(t, pubsub.Configure(ctx, service, "alerts", gofra.NodeConfig{"pubsub#max_items": "20"}))
+	assert.NoError(t, pubsub.Retract(ctx, service, "alerts", "i2"))
+	assert.NoError(t, pubsub.Subscribe(ctx, service, "alerts"))
+	assert.NoError(t, pubsub.Unsubscribe(ctx, service, "alerts"))
+
+	items, err := pubsub.Items(ctx, service, "alerts", 5)
+	if assert.NoError(t, err) && assert.Len(t, items, 1) {
+		assert.Equal(t, "i1", items[0].ID)
+		assert.Equal(t, "alice@example.com", items[0].Publisher)
+		var a alert
+		assert.NoError(t, items[0].Decode(&a))
+		assert.Equal(t, alert{XMLName: a.XMLName, Pair: "BTCEUR", Price: "1000"}, a)
+	}
+
+	if !assert.Len(t, requests, 8) {
+		return
+	}
+	assert.Contains(t, requests[0].Inner, `<create node="alerts">`)
+	assert.Contains(t, requests[0].Inner, `var="FORM_TYPE"`)
+	assert.Contains(t, requests[0].Inner, gofra.PubSubNS+"#node_config")
+	assert.Contains(t, requests[1].Inner, `<alert xmlns="urn:example:alerts" pair="BTCEUR">1000</alert>`)
+	assert.Contains(t, requests[1].Inner, gofra.PubSubNS+"#publish-options")
+	assert.NotContains(t, requests[2].Inner, "publish-options")
+	assert.Contains(t, requests[2].Inner, `<item id="i2">`)
+	assert.Contains(t, requests[3].Inner, `<configure node="alerts">`)
+	assert.Contains(t, requests[4].Inner, `<retract node="alerts" notify="true"><item id="i2">`)
+	assert.Contains(t, requests[5].Inner, `<subscribe node="alerts" jid="gofra@example.com">`)
+	assert.Contains(t, requests[6].Inner, `<unsubscribe node="alerts" jid="gofra@example.com">`)
+	assert.Contains(t, requests[7].Inner, `<items node="alerts" max_items="5">`)
+}
+
+func TestPubSub_Events(t *testing.T) {
+	h := gofratest.New(t)
+	r := gofratest.NewRecorder("pubsub/item", "pubsub/retract")
+	h.Start(r)
+
+	h.Server.Send(`<message xmlns="jabber:client" type="headline" from="pubsub.example.com" to="gofra@example.com/gofratest">` +
+		`<event xmlns="` + gofra.PubSubEventNS + `"><items node="alerts">` +
+		`<item id="i1"><alert xmlns="urn:example:alerts" pair="BTCEUR">1000</alert></item>` +
+		`<retract id="i0"/></items></event></message>`)
+
+	e := r.Next(t)
+	assert.Equal(t, "pubsub/item", e.Name)
+	assert.Equal(t, "pubsub.example.com", e.Payload["service"])
+	assert.Equal(t, "alerts", e.Payload["node"])
+	assert.Equal(t, "i1", e.Payload["id"])
+	var a alert
+	if item, ok := e.Payload["item"].(gofra.PubSubItem); assert.True(t, ok) {
+		assert.NoError(t, item.Decode(&a))
+		assert.Equal(t, "BTCEUR", a.Pair)
+		assert.Equal(t, "1000", a.Price)
+	}
+
+	e = r.Next(t)
+	assert.Equal(t, "pubsub/retract", e.Name)
+	assert.Equal(t, "i0", e.Payload["id"])
+
+	// Notifications of the PEP nodes of the account have no sender
+	h.Server.Send(`<message xmlns="jabber:client" to="gofra@example.com/gofratest">` +
+		`<event xmlns="` + gofra.PubSubEventNS + `"><items node="urn:example:status"><retract id="current"/></items></event></message>`)
+	e = r.Next(t)
+	assert.Equal(t, "gofra@example.com", e.Payload["service"])
+	assert.Equal(t, "urn:example:status", e.Payload["node"])
+}
+
+func TestPubSub_EventsInOrder(t *testing.T) {
+	h := gofratest.New(t)
+	r := gofratest.NewRecorder("pubsub/item")
+	h.Start(r)
+
+	// Later notifications replace earlier ones, so they are published in
+	// the order they arrive
+	for i := 0; i < 10; i++ {
+		h.Server.Send(fmt.Sprintf(`<message xmlns="jabber:client" type="headline" from="pubsub.example.com" to="gofra@example.com/gofratest">`+
+			`<event xmlns="%s"><items node="alerts"><item id="i%d"><alert xmlns="urn:example:alerts"/></item></items></event></message>`, gofra.PubSubEventNS, i))
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, fmt.Sprintf("i%d", i), r.Next(t).Payload["id"])
+	}
+}
@@ -0,0 +1,171 @@
+package gofra
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	// ReactionsNS is the namespace for XEP-0444 Message Reactions.
+	ReactionsNS = "urn:xmpp:reactions:0"
+
+	// ReplyNS is the namespace for XEP-0461 Message Replies.
+	ReplyNS = "urn:xmpp:reply:0"
+
+	// FallbackNS is the namespace for XEP-0428 Fallback Indication.
+	FallbackNS = "urn:xmpp:fallback:0"
+
+	// StanzaIDNS is the namespace for XEP-0359 Unique and Stable Stanza IDs.
+	StanzaIDNS = "urn:xmpp:sid:0"
+)
+
+// Reactions to the message with ID. An empty list removes the previous ones.
+type Reactions struct {
+	ID        string   `xml:"id,attr"`
+	Reactions []string `xml:"reaction"`
+}
+
+// ReplyTo references the message a reply answers, and its sender.
+type ReplyTo struct {
+	To string `xml:"to,attr,omitempty"`
+	ID string `xml:"id,attr"`
+}
+
+// Fallback marks the part of a body only meant for clients not supporting the
+// specification For, as a range of characters.
+type Fallback struct {
+	For  string        `xml:"for,attr"`
+	Body *FallbackBody `xml:"body"`
+}
+
+// FallbackBody is the range of characters of a body a Fallback applies to.
+type FallbackBody struct {
+	Start int `xml:"start,attr"`
+	End   int `xml:"end,attr"`
+}
+
+// StanzaID is the ID given to a message by the entity it was sent through.
+type StanzaID struct {
+	ID string `xml:"id,attr"`
+	By string `xml:"by,attr"`
+}
+
+// ReactionMessage is a message reacting to another one.
+type ReactionMessage struct {
+	stanza.Message
+	Reactions Reactions `xml:"urn:xmpp:reactions:0 reactions"`
+	// Servers do not archive messages without a body unless told
+	Store struct{} `xml:"urn:xmpp:hints store"`
+}
+
+// ReferenceID returns the ID other messages refer to mb with: the one given by
+// the room in MUCs, when there is one.
+func (mb MessageBody) ReferenceID() string {
+	if mb.Type == stanza.GroupChatMessage && mb.StanzaID != nil && mb.StanzaID.By == mb.From.Bare().String() {
+		return mb.StanzaID.ID
+	}
+
+	return mb.ID
+}
+
+// Reaction returns a message reacting to mb with the given emojis, replacing
+// any previous reaction of the bot to it.
+func (mb MessageBody) Reaction(reactions ...string) ReactionMessage {
+	reply := mb.Reply("")
+
+	msg := ReactionMessage{Message: reply.Message}
+	msg.ID = generateSessionID()
+	msg.Reactions = Reactions{ID: mb.ReferenceID(), Reactions: reactions}
+
+	return msg
+}
+
+// QuotedReply returns a reply to mb referencing it, which clients not
+// supporting replies see after a quote of mb.
+func (mb MessageBody) QuotedReply(body string) MessageBody {
+	reply := mb.Reply(body)
+	reply.ReplyTo = &ReplyTo{To: mb.From.String(), ID: mb.ReferenceID()}
+
+	if quoted := strings.TrimSpace(mb.Body); quoted != "" {
+		quote := "> " + strings.ReplaceAll(quoted, "\n", "\n> ") + "\n"
+		reply.Body = quote + body
+		reply.Fallback = &Fallback{For: ReplyNS, Body: &FallbackBody{End: utf8.RuneCountInString(quote)}}
+	}
+
+	return reply
+}
+
+// withoutFallback returns the body of a message without the part quoting the
+// message it replies to.
+func (mb MessageBody) withoutFallback() string {
+	if mb.Fallback == nil || mb.Fallback.For != ReplyNS || mb.Fallback.Body == nil {
+		return mb.Body
+	}
+
+	body := []rune(mb.Body)
+	start, end := mb.Fallback.Body.Start, mb.Fallback.Body.End
+	if start < 0 || end > len(body) || start > end {
+		return mb.Body
+	}
+
+	return string(body[:start]) + string(body[end:])
+}
+
+// reactionsHandler publishes the reactions received.
+type reactionsHandler struct {
+	logger  Logger
+	publish func(e Event)
+	// self reports whether a message from a room was sent by the bot
+	self func(from jid.JID) bool
+}
+
+func (h reactionsHandler) muxOptions() []mux.Option {
+	name := xml.Name{Space: ReactionsNS, Local: "reactions"}
+
+	return []mux.Option{
+		mux.Message(stanza.ChatMessage, name, h),
+		mux.Message(stanza.GroupChatMessage, name, h),
+	}
+}
+
+func (h reactionsHandler) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEncoder) error {
+	var m struct {
+		MessageBody
+		Reactions Reactions `xml:"urn:xmpp:reactions:0 reactions"`
+	}
+	if err := xml.NewTokenDecoder(t).Decode(&m); err != nil && err != io.EOF {
+		h.logger.Error(fmt.Sprintf("Error decoding message: %q", err))
+
+		return nil
+	}
+
+	// Our own reactions are reflected by the MUC
+	if msg.Type == stanza.GroupChatMessage && h.self(msg.From) {
+		return nil
+	}
+
+	h.logger.Debug(fmt.Sprintf("Reactions %v to %s received from %s", m.Reactions.Reactions, m.Reactions.ID, msg.From))
+
+	e := Event{
+		Name: "message/reaction",
+		MB:   m.MessageBody,
+		Payload: map[string]interface{}{
+			"id":        m.Reactions.ID,
+			"reactions": m.Reactions.Reactions,
+		},
+	}
+
+	e.SetStanza(m.MessageBody)
+
+	go h.publish(e)
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package gofra_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestReactions_Received(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom("room@muc.example.com", "alice"))
+	r := gofratest.NewRecorder("message/reaction")
+	h.Start(r)
+
+	// Our own reactions reflected by the room are ignored
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" from="room@muc.example.com/Gofra" to="gofra@example.com/gofratest"><reactions xmlns="urn:xmpp:reactions:0" id="m1"><reaction>✅</reaction></reactions></message>`)
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" from="room@muc.example.com/alice" to="gofra@example.com/gofratest"><reactions xmlns="urn:xmpp:reactions:0" id="m1"><reaction>👍</reaction><reaction>🎉</reaction></reactions></message>`)
+
+	e := r.Next(t)
+	assert.Equal(t, "room@muc.example.com/alice", e.MB.From.String())
+	assert.Equal(t, "m1", e.Payload["id"])
+	assert.Equal(t, []string{"👍", "🎉"}, e.Payload["reactions"])
+}
+
+func TestReplies_Received(t *testing.T) {
+	h := gofratest.New(t)
+	r := gofratest.NewRecorder("message/reply", "messageReceived")
+	h.Start(r)
+
+	h.Server.Send(`<message xmlns="jabber:client" type="chat" id="m2" from="alice@example.com/phone" to="gofra@example.com/gofratest"><body>&gt; Call the mechanic
+Done!</body><reply xmlns="urn:xmpp:reply:0" to="gofra@example.com/gofratest" id="m1"/><fallback xmlns="urn:xmpp:fallback:0" for="urn:xmpp:reply:0"><body start="0" end="20"/></fallback></message>`)
+
+	events := map[string]gofra.Event{}
+	for i := 0; i < 2; i++ {
+		e := r.Next(t)
+		events[e.Name] = e
+	}
+
+	assert.Equal(t, "m1", events["message/reply"].Payload["id"])
+	assert.Equal(t, "Done!", events["message/reply"].MB.Body)
+	assert.Equal(t, "Done!", events["messageReceived"].MB.Body)
+}
+
+func TestReactions_Send(t *testing.T) {
+	api := gofratest.NewAPI("gofra@example.com")
+
+	incoming := gofra.MessageBody{
+		Message: stanza.Message{
+			ID:   "m1",
+			Type: stanza.GroupChatMessage,
+			From: jid.MustParse("room@muc.example.com/alice"),
+			To:   jid.MustParse("gofra@example.com/gofratest"),
+		},
+		Body:     "Call the mechanic\nplease",
+		StanzaID: &gofra.StanzaID{ID: "archived1", By: "room@muc.example.com"},
+	}
+
+	assert.NoError(t, api.React(incoming, "👍"))
+	assert.NoError(t, api.SendReply(incoming, "On it"))
+
+	sent := api.Sent()
+	assert.Len(t, sent, 2)
+
+	reaction := sent[0].(gofra.ReactionMessage)
+	assert.Equal(t, "room@muc.example.com", reaction.To.String())
+	assert.Equal(t, gofra.Reactions{ID: "archived1", Reactions: []string{"👍"}}, reaction.Reactions)
+
+	reply := sent[1].(gofra.MessageBody)
+	assert.Equal(t, "> Call the mechanic\n> please\nOn it", reply.Body)
+	assert.Equal(t, &gofra.ReplyTo{To: "room@muc.example.com/alice", ID: "archived1"}, reply.ReplyTo)
+	assert.Equal(t, 29, reply.Fallback.Body.End)
+	assert.Nil(t, reply.StanzaID)
+}
@@ -0,0 +1,250 @@
+package gofra
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	// ReceiptsNS is the namespace for XEP-0184 Message Delivery Receipts.
+	ReceiptsNS = "urn:xmpp:receipts"
+
+	// MarkersNS is the namespace for XEP-0333 Chat Markers.
+	MarkersNS = "urn:xmpp:chat-markers:0"
+)
+
+// maxTrackedMessages is how many sent messages Receipts keeps the status of.
+const maxTrackedMessages = 1000
+
+// DeliveryStatus is how far a tracked message got. Statuses only move forward.
+type DeliveryStatus int
+
+const (
+	DeliverySent DeliveryStatus = iota
+	DeliveryDelivered
+	DeliveryDisplayed
+	DeliveryAcknowledged
+)
+
+func (s DeliveryStatus) String() string {
+	switch s {
+	case DeliveryDelivered:
+		return "delivered"
+	case DeliveryDisplayed:
+		return "displayed"
+	case DeliveryAcknowledged:
+		return "acknowledged"
+	}
+
+	return "sent"
+}
+
+// Delivery is the status of a message sent with Receipts.Send.
+type Delivery struct {
+	ID      string
+	To      jid.JID
+	Status  DeliveryStatus
+	Sent    time.Time
+	Updated time.Time
+}
+
+// Receipts sends messages asking for XEP-0184 delivery receipts and XEP-0333
+// chat markers, and tracks their status by message ID. Every time a tracked
+// message moves forward a "receipt/<status>" event is published, with the
+// message "id" and its "delivery" as payload.
+type Receipts struct {
+	g API
+
+	mu         sync.Mutex
+	deliveries map[string]*Delivery
+	order      []string
+}
+
+// NewReceipts creates a tracker sending messages and publishing events
+// through g.
+func NewReceipts(g API) *Receipts {
+	return &Receipts{
+		g:          g,
+		deliveries: make(map[string]*Delivery),
+	}
+}
+
+// Send sends a message asking the recipient to acknowledge it, and returns
+// its ID to look its status up. A new ID is generated if mb has none.
+// Messages to MUCs are sent but not tracked, as receipts are not meant for
+// them. Only the first part of long messages split on sending is tracked.
+func (r *Receipts) Send(mb MessageBody) (string, error) {
+	if mb.ID == "" {
+		mb.ID = generateSessionID()
+	}
+
+	if mb.Type == stanza.GroupChatMessage {
+		return mb.ID, r.g.SendStanza(mb)
+	}
+
+	mb.ReceiptRequest = &struct{}{}
+	mb.Markable = &struct{}{}
+
+	now := r.g.Clock().Now()
+	r.track(&Delivery{ID: mb.ID, To: mb.To, Status: DeliverySent, Sent: now, Updated: now})
+
+	return mb.ID, r.g.SendStanza(mb)
+}
+
+// Status returns the status of a message sent with Send, or false if it is not
+// tracked.
+func (r *Receipts) Status(id string) (Delivery, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.deliveries[id]
+	if !ok {
+		return Delivery{}, false
+	}
+
+	return *d, true
+}
+
+// Forget stops tracking a message.
+func (r *Receipts) Forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.deliveries, id)
+}
+
+func (r *Receipts) track(d *Delivery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deliveries[d.ID] = d
+	r.order = append(r.order, d.ID)
+
+	// Forget the oldest messages, or the ones already forgotten
+	for len(r.order) > maxTrackedMessages {
+		delete(r.deliveries, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// update moves the message with the given ID forward, when acknowledged by its
+// recipient.
+func (r *Receipts) update(id string, from jid.JID, status DeliveryStatus) {
+	r.mu.Lock()
+
+	d, ok := r.deliveries[id]
+	if !ok || !d.To.Bare().Equal(from.Bare()) || d.Status >= status {
+		r.mu.Unlock()
+
+		return
+	}
+
+	d.Status = status
+	d.Updated = r.g.Clock().Now()
+	delivery := *d
+
+	r.mu.Unlock()
+
+	go r.g.Publish(Event{
+		Name: "receipt/" + status.String(),
+		Payload: map[string]interface{}{
+			"id":       id,
+			"delivery": delivery,
+		},
+	})
+}
+
+type receiptMessage struct {
+	stanza.Message
+	Received struct {
+		ID string `xml:"id,attr"`
+	} `xml:"urn:xmpp:receipts received"`
+}
+
+// receiptsHandler answers the receipt requests received, and updates the
+// status of tracked messages with the receipts and markers received. There is
+// a handler for every element handled.
+type receiptsHandler struct {
+	receipts *Receipts
+	g        API
+	logger   Logger
+	name     xml.Name
+}
+
+func (h receiptsHandler) muxOptions() []mux.Option {
+	names := []xml.Name{
+		{Space: ReceiptsNS, Local: "request"},
+		{Space: ReceiptsNS, Local: "received"},
+		{Space: MarkersNS, Local: "received"},
+		{Space: MarkersNS, Local: "displayed"},
+		{Space: MarkersNS, Local: "acknowledged"},
+	}
+
+	var opts []mux.Option
+	for _, name := range names {
+		h.name = name
+		opts = append(opts,
+			mux.Message(stanza.ChatMessage, name, h),
+			mux.Message(stanza.NormalMessage, name, h),
+		)
+	}
+
+	return opts
+}
+
+func (h receiptsHandler) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEncoder) error {
+	var m struct {
+		stanza.Message
+		Elements []struct {
+			XMLName xml.Name
+			ID      string `xml:"id,attr"`
+		} `xml:",any"`
+	}
+	if err := xml.NewTokenDecoder(t).Decode(&m); err != nil && err != io.EOF {
+		h.logger.Error(fmt.Sprintf("Error decoding message: %q", err))
+
+		return nil
+	}
+
+	var id string
+	for _, e := range m.Elements {
+		if e.XMLName == h.name {
+			id = e.ID
+		}
+	}
+
+	switch h.name {
+	case xml.Name{Space: ReceiptsNS, Local: "request"}:
+		// Receipts can only refer to messages with an ID
+		if msg.ID == "" {
+			return nil
+		}
+
+		receipt := receiptMessage{Message: stanza.Message{
+			ID:   generateSessionID(),
+			To:   msg.From,
+			Type: msg.Type,
+		}}
+		receipt.Received.ID = msg.ID
+
+		if err := h.g.SendStanza(receipt); err != nil {
+			h.logger.Error(fmt.Sprintf("Error sending receipt to %s: %v", msg.From, err))
+		}
+	case xml.Name{Space: ReceiptsNS, Local: "received"}, xml.Name{Space: MarkersNS, Local: "received"}:
+		h.receipts.update(id, msg.From, DeliveryDelivered)
+	case xml.Name{Space: MarkersNS, Local: "displayed"}:
+		h.receipts.update(id, msg.From, DeliveryDisplayed)
+	case xml.Name{Space: MarkersNS, Local: "acknowledged"}:
+		h.receipts.update(id, msg.From, DeliveryAcknowledged)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package gofra_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestReceipts_Send(t *testing.T) {
+	h := gofratest.New(t)
+	r := gofratest.NewRecorder("receipt/delivered", "receipt/displayed")
+	h.Start(r)
+	receipts := h.Gofra.Receipts()
+
+	id, err := receipts.Send(gofra.MessageBody{
+		Message: stanza.Message{Type: stanza.ChatMessage, To: jid.MustParse("alice@example.com/phone")},
+		Body:    "Call the mechanic",
+	})
+	assert.NoError(t, err)
+
+	st := h.ExpectStanza("message asking for a receipt", func(st gofratest.Stanza) bool {
+		return st.Attr("id") == id && strings.Contains(st.Inner, `xmlns="urn:xmpp:receipts"`)
+	})
+	assert.Contains(t, st.Inner, `xmlns="urn:xmpp:chat-markers:0"`)
+
+	d, ok := receipts.Status(id)
+	assert.True(t, ok)
+	assert.Equal(t, gofra.DeliverySent, d.Status)
+
+	// Only the recipient can acknowledge it
+	h.Server.Send(`<message xmlns="jabber:client" from="mallory@example.com/x" to="gofra@example.com/gofratest"><received xmlns="urn:xmpp:receipts" id="` + id + `"/></message>`)
+	h.Server.Send(`<message xmlns="jabber:client" from="alice@example.com/phone" to="gofra@example.com/gofratest"><received xmlns="urn:xmpp:receipts" id="` + id + `"/></message>`)
+
+	e := r.Next(t)
+	assert.Equal(t, "receipt/delivered", e.Name)
+	assert.Equal(t, id, e.Payload["id"])
+
+	h.Server.Send(`<message xmlns="jabber:client" type="chat" from="alice@example.com/laptop" to="gofra@example.com/gofratest"><displayed xmlns="urn:xmpp:chat-markers:0" id="` + id + `"/></message>`)
+
+	e = r.Next(t)
+	assert.Equal(t, "receipt/displayed", e.Name)
+	assert.Equal(t, gofra.DeliveryDisplayed, e.Payload["delivery"].(gofra.Delivery).Status)
+
+	d, _ = receipts.Status(id)
+	assert.Equal(t, gofra.DeliveryDisplayed, d.Status)
+
+	// Statuses do not go back
+	h.Server.Send(`<message xmlns="jabber:client" from="alice@example.com/phone" to="gofra@example.com/gofratest"><received xmlns="urn:xmpp:receipts" id="` + id + `"/></message>`)
+	r.ExpectNone(t, 50*time.Millisecond)
+}
+
+func TestReceipts_GroupChatNotTracked(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom("room@muc.example.com", "alice"))
+	h.Start()
+
+	id, err := h.Gofra.Receipts().Send(gofra.MessageBody{
+		Message: stanza.Message{Type: stanza.GroupChatMessage, To: jid.MustParse("room@muc.example.com")},
+		Body:    "Hi",
+	})
+	assert.NoError(t, err)
+
+	st := h.ExpectStanza("message to the room", func(st gofratest.Stanza) bool {
+		return st.Attr("id") == id
+	})
+	assert.NotContains(t, st.Inner, "urn:xmpp:receipts")
+
+	_, ok := h.Gofra.Receipts().Status(id)
+	assert.False(t, ok)
+}
+
+func TestReceipts_AnswerRequest(t *testing.T) {
+	h := gofratest.New(t)
+	h.Start()
+
+	h.Server.Send(`<message xmlns="jabber:client" type="chat" id="m1" from="alice@example.com/phone" to="gofra@example.com/gofratest"><body>Hi</body><request xmlns="urn:xmpp:receipts"/></message>`)
+
+	h.ExpectStanza("receipt", func(st gofratest.Stanza) bool {
+		return st.Attr("to") == "alice@example.com/phone" && strings.Contains(st.Inner, `<received xmlns="urn:xmpp:receipts" id="m1">`)
+	})
+}
+
+func TestReceipts_Reply(t *testing.T) {
+	mb := gofra.MessageBody{ReceiptRequest: &struct{}{}, Markable: &struct{}{}}
+
+	reply := mb.Reply("Hi")
+	assert.Nil(t, reply.ReceiptRequest)
+	assert.Nil(t, reply.Markable)
+}
@@ -0,0 +1,580 @@
+package gofra
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/roster"
+	"mellium.im/xmpp/stanza"
+)
+
+// Subscription request policies
+const (
+	SubscriptionsIgnore    = "ignore"
+	SubscriptionsAccept    = "accept"
+	SubscriptionsAllowlist = "allowlist"
+	SubscriptionsAsk       = "ask"
+)
+
+// Decisions taken on a subscription request, published in the decision
+// payload of roster/subscriptionRequest events.
+const (
+	SubscriptionAccepted = "accepted"
+	SubscriptionDenied   = "denied"
+	SubscriptionPending  = "pending"
+)
+
+// ErrNotConnected is returned by requests needing a connection when there is
+// none.
+var ErrNotConnected = errors.New("not connected")
+
+// RosterItem is a contact in the roster of the bot.
+type RosterItem struct {
+	JID          jid.JID
+	Name         string
+	Subscription string // none, to, from or both
+	Groups       []string
+}
+
+// Presence is the last presence received from a resource of a contact.
+type Presence struct {
+	JID    jid.JID
+	Show   string
+	Status string
+}
+
+// Roster keeps the roster of the bot and the presence of its contacts, and
+// answers subscription requests following the configured policy.
+//
+// Requests are asked to the owner when the policy is "ask": the bot sends them
+// a chat message and the owner answers "approve <jid>" or "deny <jid>", or
+// just "approve" or "deny" when there is a single request pending.
+type Roster struct {
+	config RosterConfig
+	g      API
+
+	mu        sync.RWMutex
+	items     map[string]RosterItem
+	presences map[string]map[string]Presence
+	pending   []string
+	requestID string
+
+	// Presences with several children are handled once per child
+	lastPresence string
+}
+
+var ownerAnswer = regexp.MustCompile(`(?i)^\s*(approve|deny)(?:\s+(\S+))?\s*$`)
+
+// NewRoster creates an empty roster sending stanzas and publishing events
+// through g.
+func NewRoster(config RosterConfig, g API) *Roster {
+	if config.Subscriptions == "" {
+		config.Subscriptions = SubscriptionsIgnore
+	}
+
+	r := &Roster{
+		config:    config,
+		g:         g,
+		items:     make(map[string]RosterItem),
+		presences: make(map[string]map[string]Presence),
+	}
+
+	if config.Owner != "" {
+		g.Subscribe("messageReceived", "Roster", r.handleOwnerMessage, 100)
+	}
+
+	return r
+}
+
+// muxOptions routes roster pushes and subscription presences to the roster.
+func (r *Roster) muxOptions() []mux.Option {
+	return []mux.Option{
+		mux.IQFunc(stanza.SetIQ, xml.Name{Space: roster.NS, Local: "query"}, r.handlePush),
+		mux.IQFunc(stanza.ResultIQ, xml.Name{Space: roster.NS, Local: "query"}, r.handleResult),
+		mux.PresenceFunc(stanza.SubscribePresence, xml.Name{}, r.handleSubscription),
+		mux.PresenceFunc(stanza.SubscribedPresence, xml.Name{}, r.handleSubscription),
+		mux.PresenceFunc(stanza.UnsubscribePresence, xml.Name{}, r.handleSubscription),
+		mux.PresenceFunc(stanza.UnsubscribedPresence, xml.Name{}, r.handleSubscription),
+	}
+}
+
+// Items returns the contacts in the roster, sorted by JID.
+func (r *Roster) Items() []RosterItem {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	items := make([]RosterItem, 0, len(r.items))
+	for _, item := range r.items {
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].JID.String() < items[j].JID.String()
+	})
+
+	return items
+}
+
+// Item returns the roster item of a contact, given their bare or full JID.
+func (r *Roster) Item(j jid.JID) (RosterItem, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	item, ok := r.items[j.Bare().String()]
+
+	return item, ok
+}
+
+// Presences returns the presences of the resources of a contact that are
+// online.
+func (r *Roster) Presences(j jid.JID) []Presence {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var presences []Presence
+	for _, p := range r.presences[j.Bare().String()] {
+		presences = append(presences, p)
+	}
+
+	sort.Slice(presences, func(i, j int) bool {
+		return presences[i].JID.String() < presences[j].JID.String()
+	})
+
+	return presences
+}
+
+// IsOnline reports whether any resource of a contact is online.
+func (r *Roster) IsOnline(j jid.JID) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.presences[j.Bare().String()]) > 0
+}
+
+// Pending returns the subscription requests waiting for the owner.
+func (r *Roster) Pending() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]string{}, r.pending...)
+}
+
+// Approve accepts the subscription request of j, subscribing back to them if
+// configured to.
+func (r *Roster) Approve(j jid.JID) error {
+	r.removePending(j)
+
+	if err := r.sendPresence(j, stanza.SubscribedPresence); err != nil {
+		return err
+	}
+
+	if !r.config.SubscribeBack {
+		return nil
+	}
+
+	if item, ok := r.Item(j); ok && (item.Subscription == "to" || item.Subscription == "both") {
+		return nil
+	}
+
+	return r.Subscribe(j)
+}
+
+// Deny refuses the subscription request of j, or cancels their subscription.
+func (r *Roster) Deny(j jid.JID) error {
+	r.removePending(j)
+
+	return r.sendPresence(j, stanza.UnsubscribedPresence)
+}
+
+// Subscribe asks j for a subscription to their presence.
+func (r *Roster) Subscribe(j jid.JID) error {
+	return r.sendPresence(j, stanza.SubscribePresence)
+}
+
+// Unsubscribe cancels the subscription to the presence of j.
+func (r *Roster) Unsubscribe(j jid.JID) error {
+	return r.sendPresence(j, stanza.UnsubscribePresence)
+}
+
+// Set adds a contact to the roster, or updates their name and groups. The
+// roster is updated once the server pushes the change.
+func (r *Roster) Set(item RosterItem) error {
+	return r.set(roster.Item{
+		JID:   item.JID.Bare(),
+		Name:  item.Name,
+		Group: item.Groups,
+	})
+}
+
+// Remove removes a contact from the roster, cancelling the subscriptions in
+// both directions.
+func (r *Roster) Remove(j jid.JID) error {
+	return r.set(roster.Item{JID: j.Bare(), Subscription: "remove"})
+}
+
+// rosterSet is a roster set of a single item.
+type rosterSet struct {
+	XMLName xml.Name    `xml:"jabber:iq:roster query"`
+	Item    roster.Item `xml:"item"`
+}
+
+func (r *Roster) set(item roster.Item) error {
+	_, err := r.g.SendIQ(r.g.Context(), jid.JID{}, stanza.SetIQ, rosterSet{Item: item})
+
+	return err
+}
+
+// load asks the server for the roster. The cached one is replaced once the
+// answer is handled by handleResult.
+//
+// The answer is not awaited with the session, as it can only be read while
+// serving and waiting on it races with the session being closed.
+func (r *Roster) load() error {
+	id := generateSessionID()
+
+	r.mu.Lock()
+	r.requestID = id
+	r.mu.Unlock()
+
+	return r.g.SendStanza(rosterRequest{ID: id, Type: stanza.GetIQ})
+}
+
+// rosterRequest is a roster get. roster.IQ is not used, as the session does
+// not flush it when encoded.
+type rosterRequest struct {
+	XMLName xml.Name      `xml:"iq"`
+	ID      string        `xml:"id,attr"`
+	Type    stanza.IQType `xml:"type,attr"`
+	Query   struct{}      `xml:"jabber:iq:roster query"`
+}
+
+// handleResult replaces the cached roster with the one the server answered
+// load with, and publishes roster/loaded.
+func (r *Roster) handleResult(iq stanza.IQ, t xmlstream.TokenReadEncoder, start *xml.StartElement) error {
+	r.mu.RLock()
+	requested := iq.ID == r.requestID
+	r.mu.RUnlock()
+
+	if !requested {
+		return nil
+	}
+
+	items := make(map[string]RosterItem)
+
+	d := xml.NewTokenDecoder(xmlstream.Inner(t))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		itemStart, ok := tok.(xml.StartElement)
+		if !ok || itemStart.Name.Local != "item" {
+			continue
+		}
+
+		var ri roster.Item
+		if err := d.DecodeElement(&ri, &itemStart); err != nil {
+			return err
+		}
+
+		item := newRosterItem(ri)
+		items[item.JID.String()] = item
+	}
+
+	r.mu.Lock()
+	r.items = items
+	r.mu.Unlock()
+
+	go r.g.Publish(Event{
+		Name:    "roster/loaded",
+		Payload: map[string]interface{}{"items": r.Items()},
+	})
+
+	return nil
+}
+
+// handlePush updates the roster with the items pushed by the server and
+// publishes roster/updated or roster/removed.
+func (r *Roster) handlePush(iq stanza.IQ, t xmlstream.TokenReadEncoder, start *xml.StartElement) error {
+	// Pushes only come from the server on behalf of the account
+	if !iq.From.Equal(jid.JID{}) && !iq.From.Equal(r.account()) {
+		_, err := xmlstream.Copy(t, iq.Error(stanza.Error{Type: stanza.Cancel, Condition: stanza.Forbidden}))
+
+		return err
+	}
+
+	var push roster.Item
+	if err := xml.NewTokenDecoder(t).Decode(&push); err != nil && err != io.EOF {
+		return err
+	}
+
+	item := newRosterItem(push)
+
+	r.mu.Lock()
+	name := "roster/updated"
+	if item.Subscription == "remove" {
+		name = "roster/removed"
+		delete(r.items, item.JID.String())
+	} else {
+		r.items[item.JID.String()] = item
+	}
+	r.mu.Unlock()
+
+	go r.g.Publish(Event{
+		Name:    name,
+		Payload: map[string]interface{}{"item": item},
+	})
+
+	_, err := xmlstream.Copy(t, iq.Result(nil))
+
+	return err
+}
+
+// handleSubscription handles subscription presences: requests are answered
+// following the configured policy, and the answers of contacts and their
+// cancellations are published.
+func (r *Roster) handleSubscription(p stanza.Presence, _ xmlstream.TokenReadEncoder) error {
+	key := fmt.Sprintf("%s %s %s %s", p.ID, p.From, p.To, p.Type)
+
+	r.mu.Lock()
+	if r.lastPresence == key {
+		r.mu.Unlock()
+
+		return nil
+	}
+	r.lastPresence = key
+	r.mu.Unlock()
+
+	from := p.From.Bare()
+	payload := map[string]interface{}{"jid": from.String()}
+
+	if p.Type != stanza.SubscribePresence {
+		go r.g.Publish(Event{Name: "roster/" + string(p.Type), Payload: payload})
+
+		return nil
+	}
+
+	decision, err := r.decide(from)
+	if err != nil {
+		r.g.Logger().Error(fmt.Sprintf("Error answering subscription request of %s: %q", from, err))
+	}
+
+	if decision != "" {
+		payload["decision"] = decision
+	}
+
+	go r.g.Publish(Event{Name: "roster/subscriptionRequest", Payload: payload})
+
+	return nil
+}
+
+// decide answers a subscription request following the policy. It returns the
+// decision taken, if any.
+func (r *Roster) decide(from jid.JID) (string, error) {
+	if item, ok := r.Item(from); ok && (item.Subscription == "from" || item.Subscription == "both") {
+		return SubscriptionAccepted, r.Approve(from)
+	}
+
+	switch r.config.Subscriptions {
+	case SubscriptionsAccept:
+		return SubscriptionAccepted, r.Approve(from)
+	case SubscriptionsAllowlist:
+		if r.isAllowed(from) {
+			return SubscriptionAccepted, r.Approve(from)
+		}
+
+		return SubscriptionDenied, r.Deny(from)
+	case SubscriptionsAsk:
+		if r.isAllowed(from) {
+			return SubscriptionAccepted, r.Approve(from)
+		}
+
+		return SubscriptionPending, r.ask(from)
+	}
+
+	return "", nil
+}
+
+// isAllowed reports whether j, or its domain, is in the allowlist.
+func (r *Roster) isAllowed(j jid.JID) bool {
+	for _, allowed := range r.config.Allow {
+		if strings.EqualFold(allowed, j.String()) || strings.EqualFold(allowed, j.Domainpart()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ask keeps the request of j pending and asks the owner about it.
+func (r *Roster) ask(j jid.JID) error {
+	if r.config.Owner == "" {
+		return fmt.Errorf("no owner to ask")
+	}
+
+	r.mu.Lock()
+	for _, pending := range r.pending {
+		if pending == j.String() {
+			r.mu.Unlock()
+
+			return nil
+		}
+	}
+	r.pending = append(r.pending, j.String())
+	r.mu.Unlock()
+
+	return r.g.SendMessage(
+		r.config.Owner,
+		fmt.Sprintf("%s wants to see my presence. Answer \"approve %s\" or \"deny %s\".", j, j, j),
+		stanza.ChatMessage,
+	)
+}
+
+// handleOwnerMessage takes the answers of the owner to pending requests.
+func (r *Roster) handleOwnerMessage(e Event) *Reply {
+	if e.MB.Type != stanza.ChatMessage || !strings.EqualFold(e.MB.From.Bare().String(), r.config.Owner) {
+		return nil
+	}
+
+	m := ownerAnswer.FindStringSubmatch(e.MB.Body)
+	if m == nil {
+		return nil
+	}
+
+	pending := r.Pending()
+	target := m[2]
+	if target == "" {
+		if len(pending) != 1 {
+			r.reply(e, fmt.Sprintf("There are %d requests pending, answer with the JID too.", len(pending)))
+
+			return nil
+		}
+
+		target = pending[0]
+	}
+
+	j, err := jid.Parse(target)
+	if err != nil || !containsString(pending, j.Bare().String()) {
+		r.reply(e, fmt.Sprintf("There is no request pending from %s.", target))
+
+		return nil
+	}
+
+	answer := "Approved"
+	if strings.EqualFold(m[1], "approve") {
+		err = r.Approve(j)
+	} else {
+		answer = "Denied"
+		err = r.Deny(j)
+	}
+
+	if err != nil {
+		r.g.Logger().Error(fmt.Sprintf("Error answering subscription request of %s: %q", j, err))
+
+		return nil
+	}
+
+	r.reply(e, fmt.Sprintf("%s %s.", answer, j.Bare()))
+
+	return nil
+}
+
+func (r *Roster) reply(e Event, body string) {
+	if err := r.g.SendStanza(e.MB.Reply(body)); err != nil {
+		r.g.Logger().Error(err.Error())
+	}
+}
+
+// updatePresence tracks the available and unavailable presences of contacts
+// and publishes roster/presence when one changes.
+func (r *Roster) updatePresence(p stanza.Presence, show, status string) {
+	from := p.From.Bare().String()
+	if from == r.account().String() || p.From.Resourcepart() == "" {
+		return
+	}
+
+	presence := Presence{JID: p.From, Show: show, Status: status}
+	available := p.Type == stanza.AvailablePresence
+
+	r.mu.Lock()
+	if available {
+		if r.presences[from] == nil {
+			r.presences[from] = make(map[string]Presence)
+		}
+		r.presences[from][p.From.Resourcepart()] = presence
+	} else {
+		delete(r.presences[from], p.From.Resourcepart())
+		if len(r.presences[from]) == 0 {
+			delete(r.presences, from)
+		}
+	}
+	r.mu.Unlock()
+
+	go r.g.Publish(Event{
+		Name: "roster/presence",
+		Payload: map[string]interface{}{
+			"presence":  presence,
+			"available": available,
+		},
+	})
+}
+
+// forgetPresences drops the presences received, as they are sent again after
+// connecting.
+func (r *Roster) forgetPresences() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.presences = make(map[string]map[string]Presence)
+	r.lastPresence = ""
+}
+
+func (r *Roster) removePending(j jid.JID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, pending := range r.pending {
+		if pending == j.Bare().String() {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+
+			return
+		}
+	}
+}
+
+func (r *Roster) sendPresence(to jid.JID, typ stanza.PresenceType) error {
+	return r.g.SendStanza(stanza.Presence{To: to.Bare(), Type: typ})
+}
+
+func (r *Roster) account() jid.JID {
+	j, _ := jid.Parse(r.g.Account())
+
+	return j
+}
+
+func newRosterItem(item roster.Item) RosterItem {
+	subscription := item.Subscription
+	if subscription == "" {
+		subscription = "none"
+	}
+
+	return RosterItem{
+		JID:          item.JID.Bare(),
+		Name:         item.Name,
+		Subscription: subscription,
+		Groups:       item.Group,
+	}
+}
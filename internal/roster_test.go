@@ -0,0 +1,155 @@
+package gofra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func startRoster(t *testing.T, config gofra.RosterConfig) *gofratest.Harness {
+	h := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.Roster = config
+	}))
+	h.Server.SetRoster(gofratest.RosterItem{JID: "alice@example.com", Name: "Alice", Subscription: "both"})
+	h.Start()
+
+	assert.Eventually(t, func() bool {
+		return len(h.Gofra.Roster().Items()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	return h
+}
+
+func TestRoster_Load(t *testing.T) {
+	h := startRoster(t, gofra.RosterConfig{})
+
+	item, ok := h.Gofra.Roster().Item(jid.MustParse("alice@example.com/phone"))
+	assert.True(t, ok)
+	assert.Equal(t, "Alice", item.Name)
+	assert.Equal(t, "both", item.Subscription)
+}
+
+func TestRoster_Push(t *testing.T) {
+	h := startRoster(t, gofra.RosterConfig{})
+	roster := h.Gofra.Roster()
+
+	h.Server.Send(`<iq xmlns="jabber:client" type="set" id="push1" to="gofra@example.com/gofratest"><query xmlns="jabber:iq:roster"><item jid="bob@example.com" subscription="none"/></query></iq>`)
+	assert.Eventually(t, func() bool {
+		_, ok := roster.Item(jid.MustParse("bob@example.com"))
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	h.Server.Send(`<iq xmlns="jabber:client" type="set" id="push2" to="gofra@example.com/gofratest"><query xmlns="jabber:iq:roster"><item jid="alice@example.com" subscription="remove"/></query></iq>`)
+	assert.Eventually(t, func() bool {
+		_, ok := roster.Item(jid.MustParse("alice@example.com"))
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	// Pushes from anyone else are refused
+	h.Server.Send(`<iq xmlns="jabber:client" type="set" id="push3" from="mallory@example.com/x" to="gofra@example.com/gofratest"><query xmlns="jabber:iq:roster"><item jid="mallory@example.com"/></query></iq>`)
+	h.ExpectStanza("error to the forged push", func(st gofratest.Stanza) bool {
+		return st.Attr("id") == "push3" && st.Attr("type") == "error"
+	})
+	_, ok := roster.Item(jid.MustParse("mallory@example.com"))
+	assert.False(t, ok)
+}
+
+func TestRoster_Presence(t *testing.T) {
+	h := startRoster(t, gofra.RosterConfig{})
+	roster := h.Gofra.Roster()
+	alice := jid.MustParse("alice@example.com")
+
+	h.Presence("alice@example.com/phone", "", `<show>away</show><status>Out for lunch</status>`)
+	assert.Eventually(t, func() bool {
+		return roster.IsOnline(alice)
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []gofra.Presence{{
+		JID:    jid.MustParse("alice@example.com/phone"),
+		Show:   "away",
+		Status: "Out for lunch",
+	}}, roster.Presences(alice))
+
+	h.Presence("alice@example.com/phone", stanza.UnavailablePresence, "")
+	assert.Eventually(t, func() bool {
+		return !roster.IsOnline(alice)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRoster_Subscriptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   gofra.RosterConfig
+		from     string
+		expected stanza.PresenceType
+	}{
+		{"accept", gofra.RosterConfig{Subscriptions: gofra.SubscriptionsAccept}, "bob@example.com", stanza.SubscribedPresence},
+		{"allowed JID", gofra.RosterConfig{Subscriptions: gofra.SubscriptionsAllowlist, Allow: []string{"bob@example.com"}}, "bob@example.com", stanza.SubscribedPresence},
+		{"allowed domain", gofra.RosterConfig{Subscriptions: gofra.SubscriptionsAllowlist, Allow: []string{"example.org"}}, "bob@example.org", stanza.SubscribedPresence},
+		{"not allowed", gofra.RosterConfig{Subscriptions: gofra.SubscriptionsAllowlist, Allow: []string{"example.org"}}, "bob@example.com", stanza.UnsubscribedPresence},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := startRoster(t, tt.config)
+
+			h.Presence(tt.from+"/laptop", stanza.SubscribePresence, `<nick xmlns="http://jabber.org/protocol/nick">Bob</nick>`)
+			h.ExpectPresence(tt.from, tt.expected)
+		})
+	}
+}
+
+func TestRoster_SubscribeBack(t *testing.T) {
+	h := startRoster(t, gofra.RosterConfig{Subscriptions: gofra.SubscriptionsAccept, SubscribeBack: true})
+
+	h.Presence("bob@example.com/laptop", stanza.SubscribePresence, "")
+	h.ExpectPresence("bob@example.com", stanza.SubscribedPresence)
+	h.ExpectPresence("bob@example.com", stanza.SubscribePresence)
+}
+
+func TestRoster_AskOwner(t *testing.T) {
+	h := startRoster(t, gofra.RosterConfig{Subscriptions: gofra.SubscriptionsAsk, Owner: "owner@example.com"})
+
+	h.Presence("bob@example.com/laptop", stanza.SubscribePresence, "")
+	h.ExpectMessage("owner@example.com", `^bob@example.com wants to see my presence`)
+	assert.Equal(t, []string{"bob@example.com"}, h.Gofra.Roster().Pending())
+
+	// Only the owner can answer
+	h.Say("bob@example.com/laptop", "approve")
+	h.ExpectNoMessage("bob@example.com", 50*time.Millisecond)
+
+	h.Say("owner@example.com/phone", "approve")
+	h.ExpectPresence("bob@example.com", stanza.SubscribedPresence)
+	h.ExpectMessage("owner@example.com/phone", `^Approved bob@example.com\.$`)
+	assert.Empty(t, h.Gofra.Roster().Pending())
+
+	h.Say("owner@example.com/phone", "deny carol@example.com")
+	h.ExpectMessage("owner@example.com/phone", `^There is no request pending from carol@example.com\.$`)
+}
+
+func TestRoster_SetRemove(t *testing.T) {
+	h := gofratest.New(t)
+	var sets []gofratest.Stanza
+	h.Server.HandleIQ("jabber:iq:roster", "query", func(iq gofratest.Stanza) (string, error) {
+		if iq.Attr("type") == "set" {
+			sets = append(sets, iq)
+		}
+
+		return "", nil
+	})
+	h.Start()
+
+	roster := h.Gofra.Roster()
+	assert.NoError(t, roster.Set(gofra.RosterItem{JID: jid.MustParse("bob@example.com/phone"), Name: "Bob", Groups: []string{"Friends"}}))
+	assert.NoError(t, roster.Remove(jid.MustParse("bob@example.com")))
+
+	if assert.Len(t, sets, 2) {
+		assert.Contains(t, sets[0].Inner, `<item jid="bob@example.com" name="Bob"><group>Friends</group></item>`)
+		assert.Contains(t, sets[1].Inner, `<item jid="bob@example.com" subscription="remove"></item>`)
+	}
+}
@@ -0,0 +1,339 @@
+package gofra
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOutboundQueueFull is returned when a stanza is dropped because too many
+// stanzas are already waiting to be sent to the same destination.
+var ErrOutboundQueueFull = errors.New("outbound queue full, stanza dropped")
+
+const defaultMaxQueue = 50
+
+// OutboundStats are counters on stanzas going through the outbound shaper.
+type OutboundStats struct {
+	Sent     uint64
+	Bypassed uint64
+	Dropped  uint64
+	Queued   int
+}
+
+// tokenBucket allows bursts of up to capacity stanzas and refills at rate
+// tokens per second. A nil bucket never limits.
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:     rate,
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !now.After(b.last) {
+		return
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// wait returns how long until a token is available.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
+
+func (b *tokenBucket) full(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.refill(now)
+
+	return b.tokens >= b.capacity
+}
+
+type outbound struct {
+	stanza interface{}
+	done   chan error
+}
+
+type destination struct {
+	bucket *tokenBucket
+	queue  []*outbound
+}
+
+// shaper delays outgoing stanzas so that neither a single destination nor the
+// whole connection exceeds the configured rates. IQs and presences go through
+// a priority lane that only honors the global rate, messages are queued per
+// destination and served round-robin.
+type shaper struct {
+	config RateLimitConfig
+
+	mu           sync.Mutex
+	global       *tokenBucket
+	priority     []*outbound
+	destinations map[string]*destination
+	order        []string
+	cursor       int
+	stats        OutboundStats
+
+	wake chan struct{}
+	send func(stanza interface{}) error
+	now  func() time.Time
+}
+
+func newShaper(config RateLimitConfig, send func(stanza interface{}) error) *shaper {
+	if config.MaxQueue <= 0 {
+		config.MaxQueue = defaultMaxQueue
+	}
+
+	return &shaper{
+		config:       config,
+		global:       newTokenBucket(config.GlobalRate, config.GlobalBurst, time.Now()),
+		destinations: make(map[string]*destination),
+		wake:         make(chan struct{}, 1),
+		send:         send,
+		now:          time.Now,
+	}
+}
+
+// Send queues a stanza and blocks until it has been written or dropped.
+func (s *shaper) Send(ctx context.Context, stanza interface{}) error {
+	start, err := peekStanza(stanza)
+	if err != nil {
+		return err
+	}
+
+	o := &outbound{stanza: stanza, done: make(chan error, 1)}
+	if err := s.enqueue(start, o); err != nil {
+		return err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	select {
+	case err := <-o.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *shaper) enqueue(start xml.StartElement, o *outbound) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if start.Name.Local != "message" {
+		s.priority = append(s.priority, o)
+		s.stats.Queued++
+
+		return nil
+	}
+
+	to := attrValue(start, "to")
+	d, exists := s.destinations[to]
+	if !exists {
+		d = &destination{bucket: newTokenBucket(s.config.Rate, s.config.Burst, s.now())}
+		s.destinations[to] = d
+		s.order = append(s.order, to)
+	}
+
+	if len(d.queue) >= s.config.MaxQueue {
+		s.stats.Dropped++
+
+		return ErrOutboundQueueFull
+	}
+
+	d.queue = append(d.queue, o)
+	s.stats.Queued++
+
+	return nil
+}
+
+// next pops the next stanza allowed to be sent. If none is, it returns how long
+// to wait for one, or zero when nothing is queued.
+func (s *shaper) next(now time.Time) (*outbound, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	globalWait := s.global.wait(now)
+
+	if len(s.priority) > 0 {
+		if globalWait > 0 {
+			return nil, globalWait
+		}
+
+		o := s.priority[0]
+		s.priority = s.priority[1:]
+		s.global.take()
+		s.stats.Queued--
+
+		return o, 0
+	}
+
+	var minWait time.Duration
+	for i := 0; i < len(s.order); i++ {
+		index := (s.cursor + i) % len(s.order)
+		d := s.destinations[s.order[index]]
+		if len(d.queue) == 0 {
+			continue
+		}
+
+		wait := d.bucket.wait(now)
+		if wait < globalWait {
+			wait = globalWait
+		}
+
+		if wait == 0 {
+			o := d.queue[0]
+			d.queue = d.queue[1:]
+			d.bucket.take()
+			s.global.take()
+			s.stats.Queued--
+			s.cursor = index + 1
+
+			return o, 0
+		}
+
+		if minWait == 0 || wait < minWait {
+			minWait = wait
+		}
+	}
+
+	s.forgetIdle(now)
+
+	return nil, minWait
+}
+
+// forgetIdle removes destinations with nothing queued and a full bucket.
+func (s *shaper) forgetIdle(now time.Time) {
+	order := s.order[:0]
+	for _, to := range s.order {
+		d := s.destinations[to]
+		if len(d.queue) == 0 && d.bucket.full(now) {
+			delete(s.destinations, to)
+
+			continue
+		}
+
+		order = append(order, to)
+	}
+
+	s.order = order
+	s.cursor = 0
+}
+
+func (s *shaper) run(ctx context.Context) {
+	for {
+		o, wait := s.next(s.now())
+		if o != nil {
+			err := s.send(o.stanza)
+
+			s.mu.Lock()
+			s.stats.Sent++
+			s.mu.Unlock()
+
+			o.done <- err
+
+			continue
+		}
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-timer:
+		}
+	}
+}
+
+func (s *shaper) bypassed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Bypassed++
+}
+
+func (s *shaper) Stats() OutboundStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stats
+}
+
+// peekStanza returns the outermost element of a stanza to be sent.
+func peekStanza(stanza interface{}) (xml.StartElement, error) {
+	data, err := xml.Marshal(stanza)
+	if err != nil {
+		return xml.StartElement{}, err
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+func attrValue(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
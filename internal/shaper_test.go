@@ -0,0 +1,124 @@
+package gofra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+func testMessage(to, body string) MessageBody {
+	return MessageBody{
+		Message: stanza.Message{To: jid.MustParse(to), Type: stanza.GroupChatMessage},
+		Body:    body,
+	}
+}
+
+func enqueue(t *testing.T, s *shaper, st interface{}) error {
+	start, err := peekStanza(st)
+	assert.Nil(t, err)
+
+	return s.enqueue(start, &outbound{stanza: st, done: make(chan error, 1)})
+}
+
+func TestTokenBucket_Wait(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(2, 2, now)
+
+	assert.Zero(t, b.wait(now))
+	b.take()
+	assert.Zero(t, b.wait(now))
+	b.take()
+	assert.Equal(t, 500*time.Millisecond, b.wait(now))
+	assert.Zero(t, b.wait(now.Add(500*time.Millisecond)))
+
+	var unlimited *tokenBucket
+	assert.Nil(t, newTokenBucket(0, 10, now))
+	assert.Zero(t, unlimited.wait(now))
+}
+
+func TestShaper_PerDestinationRoundRobin(t *testing.T) {
+	now := time.Now()
+	s := newShaper(RateLimitConfig{Rate: 1, Burst: 1}, nil)
+	s.now = func() time.Time { return now }
+
+	assert.Nil(t, enqueue(t, s, testMessage("a@muc.example.com", "a1")))
+	assert.Nil(t, enqueue(t, s, testMessage("a@muc.example.com", "a2")))
+	assert.Nil(t, enqueue(t, s, testMessage("b@muc.example.com", "b1")))
+
+	o, _ := s.next(now)
+	assert.Equal(t, "a1", o.stanza.(MessageBody).Body)
+
+	// a@ has to wait for its bucket, b@ is served meanwhile
+	o, _ = s.next(now)
+	assert.Equal(t, "b1", o.stanza.(MessageBody).Body)
+
+	o, wait := s.next(now)
+	assert.Nil(t, o)
+	assert.Equal(t, time.Second, wait)
+
+	o, _ = s.next(now.Add(time.Second))
+	assert.Equal(t, "a2", o.stanza.(MessageBody).Body)
+	assert.Zero(t, s.Stats().Queued)
+}
+
+func TestShaper_PriorityLaneGoesFirst(t *testing.T) {
+	now := time.Now()
+	s := newShaper(RateLimitConfig{Rate: 1, Burst: 1}, nil)
+
+	assert.Nil(t, enqueue(t, s, testMessage("a@example.com", "hello")))
+	assert.Nil(t, enqueue(t, s, stanza.Presence{To: jid.MustParse("a@example.com")}))
+
+	o, _ := s.next(now)
+	_, isPresence := o.stanza.(stanza.Presence)
+	assert.True(t, isPresence)
+
+	o, _ = s.next(now)
+	assert.Equal(t, "hello", o.stanza.(MessageBody).Body)
+}
+
+func TestShaper_GlobalRate(t *testing.T) {
+	now := time.Now()
+	s := newShaper(RateLimitConfig{GlobalRate: 1, GlobalBurst: 1}, nil)
+
+	assert.Nil(t, enqueue(t, s, testMessage("a@example.com", "a")))
+	assert.Nil(t, enqueue(t, s, testMessage("b@example.com", "b")))
+
+	o, _ := s.next(now)
+	assert.NotNil(t, o)
+
+	o, wait := s.next(now)
+	assert.Nil(t, o)
+	assert.Equal(t, time.Second, wait)
+}
+
+func TestShaper_DropsWhenQueueIsFull(t *testing.T) {
+	s := newShaper(RateLimitConfig{Rate: 1, MaxQueue: 2}, nil)
+
+	assert.Nil(t, enqueue(t, s, testMessage("a@example.com", "1")))
+	assert.Nil(t, enqueue(t, s, testMessage("a@example.com", "2")))
+	assert.Equal(t, ErrOutboundQueueFull, enqueue(t, s, testMessage("a@example.com", "3")))
+
+	stats := s.Stats()
+	assert.Equal(t, 2, stats.Queued)
+	assert.Equal(t, uint64(1), stats.Dropped)
+}
+
+func TestShaper_SendWaitsForWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var sent []interface{}
+	s := newShaper(RateLimitConfig{GlobalRate: 1000, GlobalBurst: 10}, func(st interface{}) error {
+		sent = append(sent, st)
+		return nil
+	})
+	go s.run(ctx)
+
+	assert.Nil(t, s.Send(ctx, testMessage("a@example.com", "hi")))
+	assert.Len(t, sent, 1)
+	assert.Equal(t, uint64(1), s.Stats().Sent)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"mellium.im/xmlstream"
 	"mellium.im/xmpp/jid"
@@ -14,32 +15,80 @@ import (
 type MessageBody struct {
 	stanza.Message
 	Body string `xml:"body"`
+
+	// Delivery receipt request (XEP-0184) and chat marker hint (XEP-0333),
+	// set by Receipts.Send
+	ReceiptRequest *struct{} `xml:"urn:xmpp:receipts request"`
+	Markable       *struct{} `xml:"urn:xmpp:chat-markers:0 markable"`
+
+	// Message corrected by this one (XEP-0308)
+	Replace *Replace `xml:"urn:xmpp:message-correct:0 replace"`
+
+	// Message replied to (XEP-0461), and the part of the body quoting it
+	ReplyTo  *ReplyTo  `xml:"urn:xmpp:reply:0 reply"`
+	Fallback *Fallback `xml:"urn:xmpp:fallback:0 fallback"`
+
+	// ID given to the message by the room it was sent to (XEP-0359)
+	StanzaID *StanzaID `xml:"urn:xmpp:sid:0 stanza-id"`
+
+	// File the body links to (XEP-0066)
+	OOB *OOB `xml:"jabber:x:oob x"`
+
+	// XHTML-IM version of the body (XEP-0071)
+	HTML *XHTML `xml:"http://jabber.org/protocol/xhtml-im html"`
+
+	// Time the message was first sent, if delivered later (XEP-0203)
+	Delay *Delay `xml:"urn:xmpp:delay delay"`
+
+	// Sender and ID of the message being replied to
+	requester jid.JID
+	inReplyTo string
+	// ID of the message corrected by the one being replied to
+	correcting string
+	// Model the body was rendered from, rendered again for the recipient
+	formatted *Formatted
+}
+
+// Replaces returns the ID of the message corrected by this one, or an empty
+// string if it is not a correction.
+func (mb MessageBody) Replaces() string {
+	if mb.Replace == nil {
+		return ""
+	}
+
+	return mb.Replace.ID
 }
 
+// Reply returns a message answering mb with body. Replies to a corrected
+// message are sent as corrections of the replies to the original one.
 func (mb MessageBody) Reply(body string) MessageBody {
 	reply := mb
 	reply.Body = body
-
+	reply.requester = mb.From
+	reply.inReplyTo = mb.ID
+	reply.correcting = mb.Replaces()
+	reply.ReceiptRequest, reply.Markable, reply.Replace = nil, nil, nil
+	reply.ReplyTo, reply.Fallback, reply.StanzaID, reply.OOB = nil, nil, nil, nil
+	reply.HTML, reply.formatted, reply.Delay = nil, nil, nil
+
+	// Answers to rooms go to the room itself, from the account the message
+	// was delivered to
+	reply.To, reply.From = mb.From, mb.To
 	if mb.Type == stanza.GroupChatMessage {
-		reply.To, reply.From = mb.From.Bare(), jid.MustParse(
-			fmt.Sprintf(
-				"%s/%s",
-				mb.From.Bare().String(),           // JID
-				mucNicks[mb.From.Bare().String()], // Nickname
-			),
-		)
-
-		return reply
+		reply.To = mb.From.Bare()
 	}
 
-	reply.To, reply.From = mb.From, mb.To
-
 	return reply
 }
 
 type stanzaHandler struct {
-	logger  Logger
-	publish func(e Event)
+	logger   Logger
+	publish  func(e Event)
+	presence func(p stanza.Presence, show, status string)
+	caps     func(from jid.JID, typ stanza.PresenceType, node, ver string)
+	// self reports whether a message from a room was sent by the bot
+	self func(from jid.JID) bool
+	last *lastPresence
 }
 
 func (h stanzaHandler) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEncoder) error {
@@ -59,12 +108,21 @@ func (h stanzaHandler) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEn
 		h.logger.Debug("Message received has no body")
 	}
 
+	// Plugins see what replies say, not the quote of the message replied to
+	mb.Body = mb.withoutFallback()
+
 	h.logger.Debug(fmt.Sprintf("Message received: %v, with body: %q", mb, mb.Body))
 
 	e := Event{
-		Name:    "messageReceived",
-		Payload: make(map[string]interface{}),
-		MB:      mb,
+		Name:      "messageReceived",
+		Payload:   make(map[string]interface{}),
+		MB:        mb,
+		IsHistory: mb.IsHistory(),
+		IsSelf:    mb.Type == stanza.GroupChatMessage && h.self != nil && h.self(mb.From),
+	}
+
+	if id := mb.Replaces(); id != "" {
+		e.Payload["replaces"] = id
 	}
 
 	e.SetStanza(mb)
@@ -73,30 +131,77 @@ func (h stanzaHandler) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEn
 		go h.publish(e)
 	}()
 
+	if mb.ReplyTo != nil {
+		reply := Event{
+			Name:      "message/reply",
+			Payload:   map[string]interface{}{"id": mb.ReplyTo.ID},
+			MB:        mb,
+			IsHistory: e.IsHistory,
+			IsSelf:    e.IsSelf,
+		}
+
+		reply.SetStanza(mb)
+
+		defer func() {
+			go h.publish(reply)
+		}()
+	}
+
 	return nil
 }
 
-// Prevent same presence to be handled more than once.
+// lastPresence prevents the same presence to be handled more than once.
 // Using an empty xml.Name in the handler registration creates a wildcard
 // making the handler run for every inner element in the stanza
-var lastP stanza.Presence
+type lastPresence struct {
+	mu  sync.Mutex
+	key string
+}
+
+func (l *lastPresence) is(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-func isLastPresence(p stanza.Presence) bool {
-	if lastP.From.String() == p.From.String() && lastP.To.String() == p.To.String() && lastP.Type == p.Type {
+	if l.key == key {
 		return true
 	}
 
+	l.key = key
+
 	return false
 }
 
 func (h stanzaHandler) HandlePresence(p stanza.Presence, t xmlstream.TokenReadEncoder) error {
-	if isLastPresence(p) {
+	var pres struct {
+		stanza.Presence
+		Show   string    `xml:"show"`
+		Status string    `xml:"status"`
+		MUC    *struct{} `xml:"http://jabber.org/protocol/muc#user x"`
+		Caps   struct {
+			Node string `xml:"node,attr"`
+			Ver  string `xml:"ver,attr"`
+		} `xml:"http://jabber.org/protocol/caps c"`
+	}
+	if err := xml.NewTokenDecoder(t).Decode(&pres); err != nil && err != io.EOF {
+		h.logger.Error(fmt.Sprintf("Error decoding presence: %q", err))
+	}
+
+	if h.caps != nil {
+		h.caps(p.From, p.Type, pres.Caps.Node, pres.Caps.Ver)
+	}
+
+	// Changes of show and status are new presences
+	if h.last.is(fmt.Sprintf("%s %s %s %s %s", p.From, p.To, p.Type, pres.Show, pres.Status)) {
 		return nil
 	}
 
-	lastP = p
 	h.logger.Debug(fmt.Sprintf("Presence received: %v", p))
 
+	// Occupants of MUCs are not contacts
+	if h.presence != nil && pres.MUC == nil {
+		h.presence(p, pres.Show, pres.Status)
+	}
+
 	e := Event{
 		Name:    "presenceReceived",
 		Payload: make(map[string]interface{}),
@@ -143,13 +248,13 @@ type IQReply struct {
 
 // Query represents a disco#info or disco#items query.
 type Query struct {
-	XMLNS    string    `xml:"xmlns,attr"`
-	Node     string    `xml:"node,attr,omitempty"`
-	Name     string    `xml:"name,omitempty"`
-	Version  string    `xml:"version,omitempty"`
-	Identity *Identity `xml:"identity,omitempty"`
-	Features []Feature `xml:"feature,omitempty"`
-	Items    []Item    `xml:"item,omitempty"`
+	XMLNS      string     `xml:"xmlns,attr"`
+	Node       string     `xml:"node,attr,omitempty"`
+	Name       string     `xml:"name,omitempty"`
+	Version    string     `xml:"version,omitempty"`
+	Identities []Identity `xml:"identity,omitempty"`
+	Features   []Feature  `xml:"feature,omitempty"`
+	Items      []Item     `xml:"item,omitempty"`
 }
 
 // Identity represents a disco#info identity.
@@ -185,7 +290,7 @@ type Command struct {
 
 // Actions represents the available actions in a command.
 type Actions struct {
-	Execute  string `xml:"execute,attr,omitempty"`
+	Execute  string    `xml:"execute,attr,omitempty"`
 	Prev     *struct{} `xml:"prev,omitempty"`
 	Next     *struct{} `xml:"next,omitempty"`
 	Complete *struct{} `xml:"complete,omitempty"`
@@ -197,38 +302,6 @@ type Note struct {
 	Value string `xml:",chardata"`
 }
 
-// XData represents an XEP-0004 Data Form.
-type XData struct {
-	XMLName      xml.Name     `xml:"jabber:x:data x"`
-	Type         string       `xml:"type,attr"`
-	Title        string       `xml:"title,omitempty"`
-	Instructions string       `xml:"instructions,omitempty"`
-	Fields       []XDataField `xml:"field,omitempty"`
-}
-
-// XDataField represents a field in a data form.
-type XDataField struct {
-	Var     string        `xml:"var,attr,omitempty"`
-	Type    string        `xml:"type,attr,omitempty"`
-	Label   string        `xml:"label,attr,omitempty"`
-	Values  []string      `xml:"value,omitempty"`
-	Options []XDataOption `xml:"option,omitempty"`
-}
-
-// Value returns the first value or empty string for backwards compatibility.
-func (f XDataField) Value() string {
-	if len(f.Values) > 0 {
-		return f.Values[0]
-	}
-	return ""
-}
-
-// XDataOption represents an option in a list field.
-type XDataOption struct {
-	Label string `xml:"label,attr,omitempty"`
-	Value string `xml:"value"`
-}
-
 func (h stanzaHandler) HandleIQ(iq stanza.IQ, t xmlstream.TokenReadEncoder, start *xml.StartElement) error {
 	h.logger.Debug(fmt.Sprintf("IQ received: id=%s type=%s child=%s attrs=%v", iq.ID, iq.Type, start.Name.Local, start.Attr))
 
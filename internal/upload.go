@@ -0,0 +1,255 @@
+package gofra
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+)
+
+const (
+	// UploadNS is the namespace for XEP-0363 HTTP File Upload.
+	UploadNS = "urn:xmpp:http:upload:0"
+
+	// OOBNS is the namespace for XEP-0066 Out of Band Data.
+	OOBNS = "jabber:x:oob"
+)
+
+// uploadTimeout bounds the discovery of the upload service, the slot request
+// and the upload of a file.
+const uploadTimeout = time.Minute
+
+// ErrNoUploadService is returned by SendFile when the server offers no HTTP
+// upload service.
+var ErrNoUploadService = errors.New("no HTTP upload service")
+
+// OOB links a message to a file, usually the one at the URL in its body.
+type OOB struct {
+	URL  string `xml:"url"`
+	Desc string `xml:"desc,omitempty"`
+}
+
+// uploadService is the HTTP upload component of the server, and the largest
+// file it accepts, if it says so.
+type uploadService struct {
+	jid     jid.JID
+	maxSize int64
+}
+
+// uploader discovers the upload service of the server once, and uploads files
+// to it.
+type uploader struct {
+	g      API
+	client *http.Client
+
+	mu      sync.Mutex
+	service *uploadService
+}
+
+func newUploader(g API) *uploader {
+	return &uploader{g: g, client: http.DefaultClient}
+}
+
+// slotRequest asks the upload service for the URLs to upload a file to.
+type slotRequest struct {
+	XMLName     xml.Name `xml:"urn:xmpp:http:upload:0 request"`
+	Filename    string   `xml:"filename,attr"`
+	Size        int64    `xml:"size,attr"`
+	ContentType string   `xml:"content-type,attr,omitempty"`
+}
+
+// slot is where a file is uploaded to, and downloaded from.
+type slot struct {
+	Put struct {
+		URL     string `xml:"url,attr"`
+		Headers []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"header"`
+	} `xml:"put"`
+	Get struct {
+		URL string `xml:"url,attr"`
+	} `xml:"get"`
+}
+
+// discover returns the upload service of the server: the domain of the account
+// itself, or one of its items.
+func (u *uploader) discover(ctx context.Context) (*uploadService, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.service != nil {
+		return u.service, nil
+	}
+
+	account, err := jid.Parse(u.g.Account())
+	if err != nil {
+		return nil, err
+	}
+
+	domain := account.Domain()
+	if u.service, err = u.probe(ctx, domain); u.service != nil || err != nil {
+		return u.service, err
+	}
+
+	r, err := u.g.SendIQ(ctx, domain, stanza.GetIQ, discoItemsRequest{})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		return nil, ErrNoUploadService
+	}
+
+	var items Query
+	if err := r.Decode(&items); err != nil {
+		return nil, fmt.Errorf("error decoding the items of %s: %w", domain, err)
+	}
+
+	for _, item := range items.Items {
+		if u.service, err = u.probe(ctx, item.JID); u.service != nil || err != nil {
+			return u.service, err
+		}
+	}
+
+	return nil, ErrNoUploadService
+}
+
+// probe returns the upload service at j, or nil if it is not one. Errors are
+// only returned when ctx is done.
+func (u *uploader) probe(ctx context.Context, j jid.JID) (*uploadService, error) {
+	r, err := u.g.SendIQ(ctx, j, stanza.GetIQ, discoInfoRequest{})
+	if err != nil {
+		return nil, ctx.Err()
+	}
+
+	var info discoInfoResult
+	if err := r.Decode(&info); err != nil || !containsString(info.features(), UploadNS) {
+		return nil, nil
+	}
+
+	return &uploadService{jid: j, maxSize: maxFileSize(info.Forms)}, nil
+}
+
+// maxFileSize returns the largest file size announced in the upload service
+// forms, or 0 if none is.
+func maxFileSize(forms []XData) int64 {
+	for _, form := range forms {
+		var upload bool
+		var size int64
+		for _, field := range form.Fields {
+			switch field.Var {
+			case "FORM_TYPE":
+				upload = field.Value() == UploadNS
+			case "max-file-size":
+				size, _ = strconv.ParseInt(field.Value(), 10, 64)
+			}
+		}
+
+		if upload {
+			return size
+		}
+	}
+
+	return 0
+}
+
+// upload stores the file in a slot of the upload service and returns the URL
+// it can be downloaded from.
+func (u *uploader) upload(ctx context.Context, name string, data []byte, contentType string) (string, error) {
+	service, err := u.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	size := int64(len(data))
+	if service.maxSize > 0 && size > service.maxSize {
+		return "", fmt.Errorf("%s is %d bytes, %s accepts files up to %d", name, size, service.jid, service.maxSize)
+	}
+
+	r, err := u.g.SendIQ(ctx, service.jid, stanza.GetIQ, slotRequest{Filename: name, Size: size, ContentType: contentType})
+	if err != nil {
+		return "", fmt.Errorf("error requesting an upload slot for %s: %w", name, err)
+	}
+
+	var s slot
+	if err := r.Decode(&s); err != nil {
+		return "", fmt.Errorf("error decoding the upload slot for %s: %w", name, err)
+	}
+	if s.Put.URL == "" || s.Get.URL == "" {
+		return "", fmt.Errorf("upload slot for %s without URLs", name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.Put.URL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, h := range s.Put.Headers {
+		// The only headers the service may ask for, which cannot span lines
+		switch header := http.CanonicalHeaderKey(h.Name); header {
+		case "Authorization", "Cookie", "Expires":
+			req.Header.Set(header, strings.NewReplacer("\r", "", "\n", "").Replace(h.Value))
+		}
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error uploading %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("error uploading %s: %s", name, resp.Status)
+	}
+
+	return s.Get.URL, nil
+}
+
+// SendFile uploads the content of r to the HTTP upload service of the server
+// and sends its URL to the given JID, as a link clients can show the file of.
+// MUCs the bot is in get a groupchat message.
+func (g *Gofra) SendFile(to, name string, r io.Reader, contentType string) error {
+	j, err := jid.Parse(to)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(g.ctx, uploadTimeout)
+	defer cancel()
+
+	url, err := g.uploader.upload(ctx, name, data, contentType)
+	if err != nil {
+		return err
+	}
+
+	// Rooms the account is in, joined from the configuration or later on,
+	// get groupchat messages, while their occupants get private ones
+	msgType := stanza.ChatMessage
+	if j.Resourcepart() == "" && g.mucNick(j.String()) != "" {
+		msgType = stanza.GroupChatMessage
+	}
+
+	return g.SendStanza(MessageBody{
+		Message: stanza.Message{Type: msgType, To: j},
+		Body:    url,
+		OOB:     &OOB{URL: url},
+	})
+}
@@ -0,0 +1,76 @@
+package gofra_test
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestSendFile(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithUpload(1024), gofratest.WithRoom("room@muc.example.com", "alice"))
+	h.Start()
+
+	err := h.Gofra.SendFile("alice@example.com", "groceries list.csv", strings.NewReader("item\nmilk\n"), "text/csv")
+	assert.NoError(t, err)
+
+	files := h.Upload.Files()
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	assert.Equal(t, "groceries list.csv", files[0].Name)
+	assert.Equal(t, "text/csv", files[0].ContentType)
+
+	msg := h.ExpectMessage("alice@example.com", "^"+regexp.QuoteMeta(files[0].URL)+"$")
+	assert.Equal(t, stanza.ChatMessage, msg.Type)
+	assert.Equal(t, &gofra.OOB{URL: files[0].URL}, msg.OOB)
+
+	resp, err := http.Get(msg.OOB.URL)
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "item\nmilk\n", string(data))
+	}
+
+	// Rooms get groupchat messages
+	assert.NoError(t, h.Gofra.SendFile("room@muc.example.com", "chart.png", strings.NewReader("png"), "image/png"))
+	msg = h.ExpectMessage("room@muc.example.com", "chart.png$")
+	assert.Equal(t, stanza.GroupChatMessage, msg.Type)
+
+	// Including the ones joined after starting
+	h.Gofra.SetMUCNick("other@muc.example.com", "Gofra")
+	assert.NoError(t, h.Gofra.SendFile("other@muc.example.com", "chart.png", strings.NewReader("png"), "image/png"))
+	msg = h.ExpectMessage("other@muc.example.com", "chart.png$")
+	assert.Equal(t, stanza.GroupChatMessage, msg.Type)
+
+	// Occupants of rooms get private messages
+	assert.NoError(t, h.Gofra.SendFile("room@muc.example.com/alice", "chart.png", strings.NewReader("png"), "image/png"))
+	msg = h.ExpectMessage("room@muc.example.com/alice", "chart.png$")
+	assert.Equal(t, stanza.ChatMessage, msg.Type)
+}
+
+func TestSendFile_TooLarge(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithUpload(4))
+	h.Start()
+
+	err := h.Gofra.SendFile("alice@example.com", "report.txt", strings.NewReader("too long"), "text/plain")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "accepts files up to 4")
+	}
+	assert.Empty(t, h.Upload.Files())
+}
+
+func TestSendFile_NoUploadService(t *testing.T) {
+	h := gofratest.New(t)
+	h.Start()
+
+	err := h.Gofra.SendFile("alice@example.com", "report.txt", strings.NewReader("report"), "text/plain")
+	assert.ErrorIs(t, err, gofra.ErrNoUploadService)
+}
@@ -0,0 +1,53 @@
+package gofra
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	xwebsocket "golang.org/x/net/websocket"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/websocket"
+)
+
+// dialWebSocket connects to the WebSocket endpoint of the account's server
+// (RFC 7395). Without an explicit URL the endpoint is discovered through the
+// host-meta file of the JID's domain (XEP-0156), fetched with client.
+func dialWebSocket(ctx context.Context, config WebSocketConfig, j jid.JID, client *http.Client) (net.Conn, error) {
+	origin := config.Origin
+	if origin == "" {
+		origin = "https://" + j.Domainpart()
+	}
+
+	d := websocket.Dialer{
+		Origin:        origin,
+		InsecureNoTLS: config.Insecure,
+		Client:        client,
+	}
+
+	if config.URL != "" {
+		return d.DialDirect(ctx, config.URL)
+	}
+
+	conn, err := d.Dial(ctx, j)
+	if conn == nil && err == nil {
+		// Every endpoint found was skipped for not using TLS
+		return nil, fmt.Errorf("no secure websocket endpoint found on %s", j.Domainpart())
+	}
+
+	return conn, err
+}
+
+// isSecureWebSocket reports whether the stream negotiated over conn can be
+// considered secure: either the WebSocket runs over TLS or plain WebSockets
+// were explicitly allowed, e.g. behind a TLS terminating proxy on localhost.
+func isSecureWebSocket(conn net.Conn, config WebSocketConfig) bool {
+	if config.Insecure {
+		return true
+	}
+
+	wsConn, ok := conn.(*xwebsocket.Conn)
+
+	return ok && wsConn.Config().Location.Scheme == "wss"
+}
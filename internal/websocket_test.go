@@ -0,0 +1,152 @@
+package gofra
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	xwebsocket "golang.org/x/net/websocket"
+	"mellium.im/xmpp/jid"
+)
+
+// wsStandIn is a local WebSocket endpoint speaking just enough RFC 7395 to
+// check what clients send. It also serves a host-meta file pointing to itself.
+type wsStandIn struct {
+	*httptest.Server
+	origins   chan string
+	protocols chan []string
+	frames    chan string
+}
+
+func newWSStandIn(t *testing.T, replies ...string) *wsStandIn {
+	s := &wsStandIn{
+		origins:   make(chan string, 1),
+		protocols: make(chan []string, 1),
+		frames:    make(chan string, 10),
+	}
+
+	ws := xwebsocket.Server{
+		Handshake: func(config *xwebsocket.Config, r *http.Request) error {
+			s.origins <- r.Header.Get("Origin")
+			s.protocols <- config.Protocol
+			config.Protocol = []string{"xmpp"}
+
+			return nil
+		},
+		Handler: func(conn *xwebsocket.Conn) {
+			defer conn.Close()
+
+			for _, reply := range replies {
+				var frame string
+				if err := xwebsocket.Message.Receive(conn, &frame); err != nil {
+					return
+				}
+				s.frames <- frame
+
+				if err := xwebsocket.Message.Send(conn, reply); err != nil {
+					return
+				}
+			}
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/xmpp-websocket", ws)
+	mux.HandleFunc("/.well-known/host-meta", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">
+  <Link rel="urn:xmpp:alt-connections:websocket" href="%s"/>
+</XRD>`, s.url())
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *wsStandIn) url() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/xmpp-websocket"
+}
+
+// client returns an HTTP client sending every request to the stand-in,
+// whatever the host it is addressed to.
+func (s *wsStandIn) client() *http.Client {
+	target, _ := url.Parse(s.URL)
+
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestDialWebSocket_ExplicitURL(t *testing.T) {
+	s := newWSStandIn(t)
+
+	conn, err := dialWebSocket(context.Background(), WebSocketConfig{URL: s.url()}, jid.MustParse("bot@example.com"), nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, "https://example.com", <-s.origins)
+	assert.Equal(t, []string{"xmpp"}, <-s.protocols)
+	assert.True(t, isSecureWebSocket(conn, WebSocketConfig{Insecure: true}))
+	assert.False(t, isSecureWebSocket(conn, WebSocketConfig{}))
+}
+
+func TestDialWebSocket_HostMeta(t *testing.T) {
+	s := newWSStandIn(t)
+	config := WebSocketConfig{Origin: "https://bots.example.com"}
+
+	// Plain WebSockets are only used when allowed
+	_, err := dialWebSocket(context.Background(), config, jid.MustParse("bot@example.com"), s.client())
+	assert.Error(t, err)
+
+	config.Insecure = true
+	conn, err := dialWebSocket(context.Background(), config, jid.MustParse("bot@example.com"), s.client())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, "https://bots.example.com", <-s.origins)
+}
+
+func TestNewXmppClient_WebSocket(t *testing.T) {
+	s := newWSStandIn(t,
+		`<open xmlns="urn:ietf:params:xml:ns:xmpp-framing" from="example.com" id="1" version="1.0" xml:lang="en"/>`,
+	)
+	config := Config{
+		Jid:       "bot@example.com",
+		WebSocket: WebSocketConfig{Enabled: true, URL: s.url(), Insecure: true},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The stand-in does not offer any feature so negotiation cannot complete
+	_, err := newXmppClient(ctx, config, io.Discard, io.Discard, NewLogger(false))
+	assert.Error(t, err)
+
+	var open struct {
+		XMLName xml.Name
+		To      string `xml:"to,attr"`
+		Version string `xml:"version,attr"`
+	}
+	assert.NoError(t, xml.Unmarshal([]byte(<-s.frames), &open))
+	assert.Equal(t, xml.Name{Space: "urn:ietf:params:xml:ns:xmpp-framing", Local: "open"}, open.XMLName)
+	assert.Equal(t, "example.com", open.To)
+	assert.Equal(t, "1.0", open.Version)
+}
@@ -12,20 +12,24 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/XaviFP/gofra/internal"
 )
 
-var config gofra.Config
-var g *gofra.Gofra
+var (
+	config         gofra.Config
+	configFilePath string
+	consoleMode    bool
+	consoleAs      string
+)
 
 func init() {
-	configFilePathPtr := flag.String("config", "config.yaml", "file path of the config.yml file")
-	flag.Parse()
-
-	loadConfig(*configFilePathPtr)
+	flag.StringVar(&configFilePath, "config", "config.yaml", "file path of the config.yml file")
+	flag.BoolVar(&consoleMode, "console", false, "run against an in-memory server, reading messages to the bot from stdin")
+	flag.StringVar(&consoleAs, "as", "user@localhost/console", "JID messages typed in console mode are sent from")
 }
 
 func loadConfig(configFilePath string) {
@@ -40,6 +44,9 @@ func loadConfig(configFilePath string) {
 }
 
 func main() {
+	flag.Parse()
+	loadConfig(configFilePath)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -55,31 +62,59 @@ func main() {
 		}
 	}()
 
-	g = gofra.NewGofra(ctx, config)
+	if consoleMode {
+		if err := runConsole(ctx, config, consoleAs, os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		return
+	}
+
+	// Accounts are initialized one after the other so that plugins supporting
+	// a single account are deterministically loaded for the first one.
+	var bots []*gofra.Gofra
+	for _, accountConfig := range config.AccountConfigs() {
+		g := gofra.NewGofra(ctx, accountConfig)
 
+		if err := g.Init(); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		bots = append(bots, g)
+	}
+
+	var wg sync.WaitGroup
+	for _, g := range bots {
+		wg.Add(1)
+
+		go func(g *gofra.Gofra) {
+			defer wg.Done()
+
+			run(ctx, g)
+		}(g)
+	}
+
+	wg.Wait()
+}
+
+func run(ctx context.Context, g *gofra.Gofra) {
 	defer func() {
-		g.Logger.Info("Closing conn…")
+		g.Logger().Info("Closing conn…")
 		if err := g.Client.Conn().Close(); err != nil {
-			g.Logger.Error(fmt.Sprintf("Error closing connection: %q", err))
+			g.Logger().Error(fmt.Sprintf("Error closing connection: %q", err))
 		}
 	}()
 
 	go func() {
 		<-ctx.Done()
-		g.Logger.Info("Closing session…")
+		g.Logger().Info("Closing session…")
 
 		if err := g.Client.Close(); err != nil {
-			g.Logger.Error(fmt.Sprintf("Error closing session: %q", err))
+			g.Logger().Error(fmt.Sprintf("Error closing session: %q", err))
 		}
 	}()
 
-	err := g.Init()
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-
-	err = g.Connect()
-	if err != nil {
-		log.Fatal(err.Error())
+	if err := g.Connect(); err != nil {
+		g.Logger().Error(fmt.Sprintf("Connection of %s ended: %v", g.Account(), err))
 	}
 }
@@ -7,85 +7,102 @@ import (
 	"strings"
 
 	gofra "github.com/XaviFP/gofra/internal"
+	"mellium.im/xmpp/jid"
 	"mellium.im/xmpp/stanza"
 )
 
 // Plugin is the exported plugin instance.
 var Plugin plugin
 
-var g *gofra.Gofra
-var registry *gofra.CommandRegistry
+type plugin struct {
+	g        gofra.API
+	registry *gofra.CommandRegistry
+}
 
-type plugin struct{}
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "adhoc"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Provides XEP-0050 Ad-Hoc Commands support"
 }
 
-func (p plugin) Help() string {
+func (p *plugin) Help() string {
 	return "adhoc is a meta-plugin that enables ad-hoc command support for other plugins"
 }
 
-func (p plugin) Init(config gofra.Config, api *gofra.Gofra) {
-	g = api
-	registry = gofra.NewCommandRegistry()
+func (p *plugin) Init(config gofra.Config, api gofra.API) {
+	p.g = api
+	p.registry = gofra.NewCommandRegistry()
+
+	p.g.Disco().AddFeature(gofra.CommandsNS, "jabber:iq:version")
+	p.g.Disco().SetNode(gofra.CommandsNS, gofra.DiscoNode{
+		Name:       "Commands",
+		Identities: []gofra.Identity{{Name: "Commands", Category: "automation", Type: "command-list"}},
+		Items:      p.commandItems,
+	})
 
 	// Subscribe to IQ events
-	g.Subscribe("iqReceived", p.Name(), handleIQ, 1)
+	p.g.Subscribe("iqReceived", p.Name(), p.handleIQ, 1)
 
 	// Subscribe to command registration events from other plugins
-	g.Subscribe("adhoc/register", p.Name(), handleRegister, 0)
-	g.Subscribe("adhoc/unregister", p.Name(), handleUnregister, 0)
+	p.g.Subscribe("adhoc/register", p.Name(), p.handleRegister, 0)
+	p.g.Subscribe("adhoc/unregister", p.Name(), p.handleUnregister, 0)
 }
 
 // handleRegister handles command registration from other plugins.
-func handleRegister(e gofra.Event) *gofra.Reply {
+func (p *plugin) handleRegister(e gofra.Event) *gofra.Reply {
 	cmd, ok := e.Payload["command"].(*gofra.AdHocCommand)
 	if !ok {
-		g.Logger.Error("adhoc: invalid command registration payload")
+		p.g.Logger().Error("adhoc: invalid command registration payload")
 		return nil
 	}
 
-	registry.Register(cmd)
-	g.Logger.Info(fmt.Sprintf("adhoc: registered command '%s'", cmd.Node))
+	p.registry.Register(cmd)
+	p.g.Disco().SetNode(cmd.Node, gofra.DiscoNode{
+		Identities: []gofra.Identity{{Name: cmd.Name, Category: "automation", Type: "command-node"}},
+		Features:   []string{gofra.CommandsNS, "jabber:x:data"},
+	})
+	p.g.Logger().Info(fmt.Sprintf("adhoc: registered command '%s'", cmd.Node))
 
 	return nil
 }
 
 // handleUnregister handles command unregistration.
-func handleUnregister(e gofra.Event) *gofra.Reply {
+func (p *plugin) handleUnregister(e gofra.Event) *gofra.Reply {
 	node, ok := e.Payload["node"].(string)
 	if !ok {
-		g.Logger.Error("adhoc: invalid unregister payload")
+		p.g.Logger().Error("adhoc: invalid unregister payload")
 		return nil
 	}
 
-	registry.Unregister(node)
-	g.Logger.Info(fmt.Sprintf("adhoc: unregistered command '%s'", node))
+	p.registry.Unregister(node)
+	p.g.Disco().RemoveNode(node)
+	p.g.Logger().Info(fmt.Sprintf("adhoc: unregistered command '%s'", node))
 	return nil
 }
 
 // handleIQ routes incoming IQ stanzas to appropriate handlers.
-func handleIQ(e gofra.Event) *gofra.Reply {
-	g.Logger.Debug("adhoc: handleIQ called")
+func (p *plugin) handleIQ(e gofra.Event) *gofra.Reply {
+	p.g.Logger().Debug("adhoc: handleIQ called")
 	iq, err := e.GetIQ()
 	if err != nil {
-		g.Logger.Error(fmt.Sprintf("adhoc: error getting IQ: %v", err))
+		p.g.Logger().Error(fmt.Sprintf("adhoc: error getting IQ: %v", err))
 		return nil
 	}
 
-	g.Logger.Debug(fmt.Sprintf("adhoc: IQ type=%s, Query=%v, Command=%v", iq.Type, iq.Query, iq.Command))
+	p.g.Logger().Debug(fmt.Sprintf("adhoc: IQ type=%s, Query=%v, Command=%v", iq.Type, iq.Query, iq.Command))
 
 	var handled bool
 	switch iq.Type {
 	case stanza.GetIQ:
-		handled = handleIQGet(e, iq)
+		handled = p.handleIQGet(e, iq)
 	case stanza.SetIQ:
-		handled = handleIQSet(e, iq)
+		handled = p.handleIQSet(e, iq)
 	}
 
 	if handled {
@@ -95,28 +112,23 @@ func handleIQ(e gofra.Event) *gofra.Reply {
 	return nil
 }
 
-// handleIQGet handles IQ get requests (disco queries).
+// handleIQGet handles IQ get requests. Disco queries are answered by the
+// engine from the nodes registered in Init and handleRegister.
 // Returns true if the IQ was handled.
-func handleIQGet(e gofra.Event, iq gofra.IQ) bool {
+func (p *plugin) handleIQGet(e gofra.Event, iq gofra.IQ) bool {
 	if iq.Query == nil {
 		return false
 	}
 	switch iq.Query.XMLNS {
 	case "jabber:iq:version":
-		return handleVersion(e, iq)
-
-	case "http://jabber.org/protocol/disco#info":
-		return handleDiscoInfo(e, iq)
-
-	case "http://jabber.org/protocol/disco#items":
-		return handleDiscoItems(e, iq)
+		return p.handleVersion(e, iq)
 	}
 
 	return false
 }
 
 // handleVersion responds to version queries.
-func handleVersion(e gofra.Event, iq gofra.IQ) bool {
+func (p *plugin) handleVersion(e gofra.Event, iq gofra.IQ) bool {
 	reply := iq.Reply()
 	reply.Query = &gofra.Query{
 		XMLNS:   "jabber:iq:version",
@@ -124,81 +136,29 @@ func handleVersion(e gofra.Event, iq gofra.IQ) bool {
 		Version: "1.0.0",
 	}
 
-	if err := g.SendIQResponse(e, reply); err != nil {
-		g.Logger.Error(fmt.Sprintf("adhoc: error sending version reply: %v", err))
+	if err := p.g.SendIQResponse(e, reply); err != nil {
+		p.g.Logger().Error(fmt.Sprintf("adhoc: error sending version reply: %v", err))
 	}
 	return true
 }
 
-// handleDiscoInfo responds to disco#info queries.
-func handleDiscoInfo(e gofra.Event, iq gofra.IQ) bool {
-	reply := iq.Reply()
-	reply.Query = &gofra.Query{
-		XMLNS: "http://jabber.org/protocol/disco#info",
-		Node:  iq.Query.Node,
-	}
-
-	if iq.Query.Node == "" {
-		// Service discovery: advertise commands support
-		reply.Query.Features = []gofra.Feature{
-			{Var: gofra.CommandsNS},
-		}
-	} else {
-		// Info about a specific command
-		cmd, ok := registry.GetCommand(iq.Query.Node)
-		if !ok {
-			if err := g.SendIQResponse(e, gofra.NewItemNotFoundError(iq)); err != nil {
-				g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
-			}
-			return true
-		}
-
-		reply.Query.Identity = &gofra.Identity{
-			Name:     cmd.Name,
-			Category: "automation",
-			Type:     "command-node",
-		}
-		reply.Query.Features = []gofra.Feature{
-			{Var: gofra.CommandsNS},
-			{Var: "jabber:x:data"},
-		}
-	}
-
-	if err := g.SendIQResponse(e, reply); err != nil {
-		g.Logger.Error(fmt.Sprintf("adhoc: error sending disco#info reply: %v", err))
-	}
-	return true
-}
-
-// handleDiscoItems responds to disco#items queries.
-func handleDiscoItems(e gofra.Event, iq gofra.IQ) bool {
-	if iq.Query.Node != gofra.CommandsNS {
-		return false
-	}
-
-	reply := iq.Reply()
-	reply.Query = &gofra.Query{
-		XMLNS: "http://jabber.org/protocol/disco#items",
-		Node:  gofra.CommandsNS,
-	}
-
-	requesterJID := iq.From.Bare().String()
-	for _, cmd := range registry.ListCommandsForJID(requesterJID) {
-		reply.Query.Items = append(reply.Query.Items, gofra.Item{
-			JID:  iq.To,
+// commandItems lists the commands available to the requester in the
+// commands node.
+func (p *plugin) commandItems(bot, requester jid.JID) []gofra.Item {
+	var items []gofra.Item
+	for _, cmd := range p.registry.ListCommandsForJID(requester.Bare().String()) {
+		items = append(items, gofra.Item{
+			JID:  bot,
 			Node: cmd.Node,
 			Name: cmd.Name,
 		})
 	}
 
-	if err := g.SendIQResponse(e, reply); err != nil {
-		g.Logger.Error(fmt.Sprintf("adhoc: error sending disco#items reply: %v", err))
-	}
-	return true
+	return items
 }
 
 // handleIQSet handles IQ set requests (command execution).
-func handleIQSet(e gofra.Event, iq gofra.IQ) bool {
+func (p *plugin) handleIQSet(e gofra.Event, iq gofra.IQ) bool {
 	if iq.Command == nil {
 		return false
 	}
@@ -210,22 +170,22 @@ func handleIQSet(e gofra.Event, iq gofra.IQ) bool {
 
 	// Validate action
 	if !isValidAction(action) {
-		if err := g.SendIQResponse(e, gofra.NewMalformedActionError(iq)); err != nil {
-			g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+		if err := p.g.SendIQResponse(e, gofra.NewMalformedActionError(iq)); err != nil {
+			p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 		}
 		return true
 	}
 
-	// Handle cancel action
-	if action == gofra.ActionCancel {
-		return handleCancel(e, iq)
+	// Handle cancel action, also taken by submitting a cancel form
+	if action == gofra.ActionCancel || (iq.Command.XData != nil && iq.Command.XData.Type == gofra.FormTypeCancel) {
+		return p.handleCancel(e, iq)
 	}
 
 	// Get the command
-	cmd, ok := registry.GetCommand(iq.Command.Node)
+	cmd, ok := p.registry.GetCommand(iq.Command.Node)
 	if !ok {
-		if err := g.SendIQResponse(e, gofra.NewItemNotFoundError(iq)); err != nil {
-			g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+		if err := p.g.SendIQResponse(e, gofra.NewItemNotFoundError(iq)); err != nil {
+			p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 		}
 		return true
 	}
@@ -233,66 +193,84 @@ func handleIQSet(e gofra.Event, iq gofra.IQ) bool {
 	// Get or create session
 	var session *gofra.CommandSession
 	if iq.Command.SessionID != "" {
-		session, ok = registry.GetSession(iq.Command.SessionID)
+		session, ok = p.registry.GetSession(iq.Command.SessionID)
 		if !ok {
-			if err := g.SendIQResponse(e, gofra.NewSessionExpiredError(iq)); err != nil {
-				g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+			if err := p.g.SendIQResponse(e, gofra.NewSessionExpiredError(iq)); err != nil {
+				p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 			}
 			return true
 		}
 
 		// Validate session belongs to this requester and command
 		if session.Requester != iq.From.Bare().String() || session.Node != iq.Command.Node {
-			if err := g.SendIQResponse(e, gofra.NewBadSessionIDError(iq)); err != nil {
-				g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+			if err := p.g.SendIQResponse(e, gofra.NewBadSessionIDError(iq)); err != nil {
+				p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 			}
 			return true
 		}
 
-		registry.RefreshSession(session.ID)
+		p.registry.RefreshSession(session.ID)
 	} else {
 		// New session for execute action
 		if action != gofra.ActionExecute {
-			if err := g.SendIQResponse(e, gofra.NewBadSessionIDError(iq)); err != nil {
-				g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+			if err := p.g.SendIQResponse(e, gofra.NewBadSessionIDError(iq)); err != nil {
+				p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 			}
 			return true
 		}
-		session = registry.CreateSession(iq.Command.Node, iq.From.Bare().String())
+		session = p.registry.CreateSession(iq.Command.Node, iq.From.Bare().String())
 	}
 
-	// Parse form data if present
-	// For single-value fields, store as string
-	// For multi-value fields (list-multi), store as []string in session
+	// Parse form data if present. Handlers get the first value of every
+	// field, the lines of multi-value ones joined, and all of them from the
+	// values of the session.
+	values := gofra.FormValues{}
 	formData := make(map[string]string)
 	if iq.Command.XData != nil {
-		g.Logger.Debug(fmt.Sprintf("adhoc: parsing XData with %d fields", len(iq.Command.XData.Fields)))
-		for _, field := range iq.Command.XData.Fields {
-			g.Logger.Debug(fmt.Sprintf("adhoc: field var=%s type=%s values=%v", field.Var, field.Type, field.Values))
-			if len(field.Values) > 1 {
-				// Multi-value field - store in session directly as slice
-				session.Set(field.Var+"_multi", field.Values)
-				// Also store joined version for backwards compat
-				formData[field.Var] = strings.Join(field.Values, "\n")
-			} else {
-				formData[field.Var] = field.Value()
+		values = iq.Command.XData.Values()
+		for name, v := range values {
+			formData[name] = strings.Join(v, "\n")
+		}
+	}
+	session.SetValues(values)
+
+	// Submissions failing the validation of the form are sent back with
+	// their errors, without reaching the handler
+	if action != gofra.ActionPrev {
+		if last := session.LastResponse(); last != nil && last.Form != nil && last.Form.Type == gofra.FormTypeForm {
+			if errs := last.Form.Validate(values); len(errs) > 0 {
+				resp := *last
+				resp.Form = last.Form.Fill(values)
+				resp.Notes = nil
+				for _, err := range errs {
+					resp.Notes = append(resp.Notes, gofra.NewErrorNote(err.Error()))
+				}
+				p.sendResponse(e, iq, session, &resp)
+
+				return true
 			}
 		}
-	} else {
-		g.Logger.Debug("adhoc: no XData in command")
 	}
 
 	// Execute the command handler
 	resp, err := cmd.Handler(session, action, formData)
 	if err != nil {
-		g.Logger.Error(fmt.Sprintf("adhoc: command handler error: %v", err))
-		if err := g.SendIQResponse(e, gofra.NewBadRequestError(iq, gofra.ErrTypeBadPayload)); err != nil {
-			g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+		p.g.Logger().Error(fmt.Sprintf("adhoc: command handler error: %v", err))
+		if err := p.g.SendIQResponse(e, gofra.NewBadRequestError(iq, gofra.ErrTypeBadPayload)); err != nil {
+			p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 		}
-		registry.DeleteSession(session.ID)
+		p.registry.DeleteSession(session.ID)
 		return true
 	}
+	session.SetLastResponse(resp)
+	p.sendResponse(e, iq, session, resp)
 
+	return true
+}
+
+// sendResponse replies to the command request with the response of the
+// session, ending it unless it is still executing.
+func (p *plugin) sendResponse(e gofra.Event, iq gofra.IQ, session *gofra.CommandSession, resp *gofra.CommandResponse) {
 	// Build response
 	reply := iq.Reply()
 	reply.Command = &gofra.Command{
@@ -302,10 +280,10 @@ func handleIQSet(e gofra.Event, iq gofra.IQ) bool {
 
 	if resp.IsComplete || resp.Status == gofra.StatusCompleted {
 		reply.Command.Status = string(gofra.StatusCompleted)
-		registry.DeleteSession(session.ID)
+		p.registry.DeleteSession(session.ID)
 	} else if resp.Status == gofra.StatusCanceled {
 		reply.Command.Status = string(gofra.StatusCanceled)
-		registry.DeleteSession(session.ID)
+		p.registry.DeleteSession(session.ID)
 	} else {
 		reply.Command.Status = string(gofra.StatusExecuting)
 	}
@@ -314,39 +292,37 @@ func handleIQSet(e gofra.Event, iq gofra.IQ) bool {
 	reply.Command.Notes = resp.Notes
 	reply.Command.XData = resp.Form
 
-	if err := g.SendIQResponse(e, reply); err != nil {
-		g.Logger.Error(fmt.Sprintf("adhoc: error sending command reply: %v", err))
+	if err := p.g.SendIQResponse(e, reply); err != nil {
+		p.g.Logger().Error(fmt.Sprintf("adhoc: error sending command reply: %v", err))
 	}
-
-	return true
 }
 
 // handleCancel handles command cancellation.
-func handleCancel(e gofra.Event, iq gofra.IQ) bool {
+func (p *plugin) handleCancel(e gofra.Event, iq gofra.IQ) bool {
 	if iq.Command.SessionID == "" {
-		if err := g.SendIQResponse(e, gofra.NewBadSessionIDError(iq)); err != nil {
-			g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+		if err := p.g.SendIQResponse(e, gofra.NewBadSessionIDError(iq)); err != nil {
+			p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 		}
 		return true
 	}
 
-	session, ok := registry.GetSession(iq.Command.SessionID)
+	session, ok := p.registry.GetSession(iq.Command.SessionID)
 	if !ok {
-		if err := g.SendIQResponse(e, gofra.NewSessionExpiredError(iq)); err != nil {
-			g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+		if err := p.g.SendIQResponse(e, gofra.NewSessionExpiredError(iq)); err != nil {
+			p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 		}
 		return true
 	}
 
 	// Validate session ownership
 	if session.Requester != iq.From.Bare().String() {
-		if err := g.SendIQResponse(e, gofra.NewForbiddenError(iq)); err != nil {
-			g.Logger.Error(fmt.Sprintf("adhoc: error sending error: %v", err))
+		if err := p.g.SendIQResponse(e, gofra.NewForbiddenError(iq)); err != nil {
+			p.g.Logger().Error(fmt.Sprintf("adhoc: error sending error: %v", err))
 		}
 		return true
 	}
 
-	registry.DeleteSession(session.ID)
+	p.registry.DeleteSession(session.ID)
 
 	reply := iq.Reply()
 	reply.Command = &gofra.Command{
@@ -355,8 +331,8 @@ func handleCancel(e gofra.Event, iq gofra.IQ) bool {
 		Status:    string(gofra.StatusCanceled),
 	}
 
-	if err := g.SendIQResponse(e, reply); err != nil {
-		g.Logger.Error(fmt.Sprintf("adhoc: error sending cancel reply: %v", err))
+	if err := p.g.SendIQResponse(e, reply); err != nil {
+		p.g.Logger().Error(fmt.Sprintf("adhoc: error sending cancel reply: %v", err))
 	}
 
 	return true
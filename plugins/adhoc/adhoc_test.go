@@ -0,0 +1,181 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+const requester = "alice@example.com/laptop"
+
+func startWithCommand(t *testing.T) *gofratest.Harness {
+	h := gofratest.New(t)
+	h.Start(Plugin.NewInstance())
+
+	h.Gofra.Publish(gofra.Event{
+		Name: "adhoc/register",
+		Payload: map[string]interface{}{"command": &gofra.AdHocCommand{
+			Node: "greet",
+			Name: "Greet",
+			Handler: func(session *gofra.CommandSession, action gofra.CommandAction, formData map[string]string) (*gofra.CommandResponse, error) {
+				return &gofra.CommandResponse{
+					Status: gofra.StatusCompleted,
+					Notes:  []gofra.Note{{Type: "info", Value: "Hello " + session.Requester}},
+				}, nil
+			},
+		}},
+	})
+
+	return h
+}
+
+func TestAdHoc_ListCommands(t *testing.T) {
+	h := startWithCommand(t)
+
+	response := h.SendIQ(requester, stanza.GetIQ, `<query xmlns="http://jabber.org/protocol/disco#items" node="http://jabber.org/protocol/commands"/>`)
+
+	var iq gofra.IQ
+	assert.NoError(t, response.Decode(&iq))
+	assert.Equal(t, stanza.ResultIQ, iq.Type)
+	if assert.NotNil(t, iq.Query) && assert.Len(t, iq.Query.Items, 1) {
+		assert.Equal(t, "greet", iq.Query.Items[0].Node)
+		assert.Equal(t, "Greet", iq.Query.Items[0].Name)
+	}
+}
+
+func TestAdHoc_Execute(t *testing.T) {
+	h := startWithCommand(t)
+
+	response := h.SendIQ(requester, stanza.SetIQ, `<command xmlns="http://jabber.org/protocol/commands" node="greet" action="execute"/>`)
+
+	var iq gofra.IQ
+	assert.NoError(t, response.Decode(&iq))
+	assert.Equal(t, stanza.ResultIQ, iq.Type)
+	if assert.NotNil(t, iq.Command) {
+		assert.Equal(t, string(gofra.StatusCompleted), iq.Command.Status)
+		assert.Equal(t, []gofra.Note{{Type: "info", Value: "Hello alice@example.com"}}, iq.Command.Notes)
+	}
+}
+
+func TestAdHoc_UnknownCommand(t *testing.T) {
+	h := startWithCommand(t)
+
+	response := h.SendIQ(requester, stanza.SetIQ, `<command xmlns="http://jabber.org/protocol/commands" node="missing" action="execute"/>`)
+
+	assert.Equal(t, string(stanza.ErrorIQ), response.Attr("type"))
+	assert.Contains(t, response.Inner, "item-not-found")
+}
+
+func TestAdHoc_DiscoInfo(t *testing.T) {
+	h := startWithCommand(t)
+
+	response := h.SendIQ(requester, stanza.GetIQ, `<query xmlns="http://jabber.org/protocol/disco#info"/>`)
+
+	var iq gofra.IQ
+	assert.NoError(t, response.Decode(&iq))
+	if assert.NotNil(t, iq.Query) {
+		assert.Contains(t, iq.Query.Identities, gofra.Identity{Category: "client", Type: "bot", Name: "Gofra"})
+		assert.Contains(t, iq.Query.Features, gofra.Feature{Var: gofra.CommandsNS})
+	}
+
+	response = h.SendIQ(requester, stanza.GetIQ, `<query xmlns="http://jabber.org/protocol/disco#info" node="greet"/>`)
+
+	iq = gofra.IQ{}
+	assert.NoError(t, response.Decode(&iq))
+	if assert.NotNil(t, iq.Query) {
+		assert.Equal(t, []gofra.Identity{{Name: "Greet", Category: "automation", Type: "command-node"}}, iq.Query.Identities)
+	}
+}
+
+func TestAdHoc_CapsInPresence(t *testing.T) {
+	h := startWithCommand(t)
+
+	var presence gofratest.Stanza
+	assert.Eventually(t, func() bool {
+		for _, st := range h.Server.Sent() {
+			if st.XMLName.Local == "presence" {
+				presence = st
+
+				return true
+			}
+		}
+
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Contains(t, presence.Inner, `ver="`+h.Gofra.Disco().Caps().Ver+`"`)
+	assert.Contains(t, presence.Inner, `node="`+gofra.CapsNode+`"`)
+}
+
+func TestAdHoc_Validation(t *testing.T) {
+	h := gofratest.New(t)
+	h.Start(Plugin.NewInstance())
+
+	var calls int
+	var submitted gofra.FormValues
+	h.Gofra.Publish(gofra.Event{
+		Name: "adhoc/register",
+		Payload: map[string]interface{}{"command": &gofra.AdHocCommand{
+			Node: "remind",
+			Name: "Remind",
+			Handler: func(session *gofra.CommandSession, action gofra.CommandAction, formData map[string]string) (*gofra.CommandResponse, error) {
+				calls++
+				if calls == 1 {
+					form := gofra.NewFormBuilder(gofra.FormTypeForm, "Remind").
+						AddField("minutes", gofra.FieldTextSingle, "Minutes", "").Required().Datatype("xs:integer").Range("1", "60").
+						AddFieldWithMultipleValues("who", gofra.FieldJIDMulti, "Who", nil, nil).
+						Build()
+
+					return &gofra.CommandResponse{Status: gofra.StatusExecuting, Actions: gofra.NewActionsComplete(), Form: form}, nil
+				}
+
+				submitted = session.Values()
+
+				return &gofra.CommandResponse{Status: gofra.StatusCompleted}, nil
+			},
+		}},
+	})
+
+	response := h.SendIQ(requester, stanza.SetIQ, `<command xmlns="http://jabber.org/protocol/commands" node="remind" action="execute"/>`)
+	var iq gofra.IQ
+	assert.NoError(t, response.Decode(&iq))
+	if !assert.NotNil(t, iq.Command) {
+		return
+	}
+	session := iq.Command.SessionID
+
+	// Invalid submissions get the form back with their errors
+	response = h.SendIQ(requester, stanza.SetIQ, `<command xmlns="http://jabber.org/protocol/commands" node="remind" sessionid="`+session+`" action="complete">`+
+		`<x xmlns="jabber:x:data" type="submit"><field var="minutes"><value>90</value></field></x></command>`)
+	iq = gofra.IQ{}
+	assert.NoError(t, response.Decode(&iq))
+	assert.Equal(t, 1, calls)
+	if assert.NotNil(t, iq.Command) && assert.NotNil(t, iq.Command.XData) {
+		assert.Equal(t, string(gofra.StatusExecuting), iq.Command.Status)
+		assert.Equal(t, []gofra.Note{gofra.NewErrorNote("Minutes: 90 is greater than 60")}, iq.Command.Notes)
+		assert.Equal(t, []string{"90"}, iq.Command.XData.Fields[0].Values)
+		assert.True(t, iq.Command.XData.Fields[0].IsRequired())
+	}
+
+	// Valid ones reach the handler, with all the values of every field
+	response = h.SendIQ(requester, stanza.SetIQ, `<command xmlns="http://jabber.org/protocol/commands" node="remind" sessionid="`+session+`" action="complete">`+
+		`<x xmlns="jabber:x:data" type="submit"><field var="minutes"><value>15</value></field>`+
+		`<field var="who"><value>bob@example.com</value><value>carol@example.com</value></field></x></command>`)
+	iq = gofra.IQ{}
+	assert.NoError(t, response.Decode(&iq))
+	assert.Equal(t, 2, calls)
+	if assert.NotNil(t, iq.Command) {
+		assert.Equal(t, string(gofra.StatusCompleted), iq.Command.Status)
+	}
+	minutes, err := submitted.Int("minutes")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(15), minutes)
+	who, err := submitted.JIDs("who")
+	assert.NoError(t, err)
+	assert.Len(t, who, 2)
+}
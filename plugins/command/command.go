@@ -12,78 +12,95 @@ import (
 
 var Plugin plugin
 
-var commandChar = "!"
-
-var g *gofra.Gofra
-var c gofra.Config
+const defaultCommandChar = "!"
+
+type plugin struct {
+	g           gofra.API
+	commandChar string
+	chatStates  gofra.ChatStatesConfig
+	// Whether commands in the history sent by rooms on joining them are run
+	runHistory bool
+}
 
-type plugin struct{}
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{commandChar: defaultCommandChar}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "Commands"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Makes it easy to create text-based plugin commands"
 }
 
-func (p plugin) Help() string {
+func (p *plugin) Help() string {
 	return "Commands is a meta-plugin and does not expose user-triggered interaction"
 }
 
-func getCommandChar(e gofra.Event) *gofra.Reply {
+func (p *plugin) getCommandChar(e gofra.Event) *gofra.Reply {
 	reply := &gofra.Reply{}
-	reply.SetAnswer(commandChar)
+	reply.SetAnswer(p.commandChar)
 	return reply
 }
 
-func (p plugin) Init(config gofra.Config, gofra *gofra.Gofra) {
-	c = config
-	g = gofra
+func (p *plugin) Init(config gofra.Config, gofra gofra.API) {
+	p.g = gofra
+	p.chatStates = config.ChatStates
 
-	p.checkConfig(c)
+	p.checkConfig(config)
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"messageReceived",
 		p.Name(),
-		handleMessage,
+		p.handleMessage,
 		1,
 	)
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"command/getCommandChar",
 		p.Name(),
-		getCommandChar,
+		p.getCommandChar,
 		0,
 	)
 }
 
-func (p plugin) checkConfig(config gofra.Config) {
+func (p *plugin) checkConfig(config gofra.Config) {
 	pluginConfig, exists := config.Plugins[p.Name()]
 	if !exists {
-		g.Logger.Warn("No config for plugin Commands")
+		p.g.Logger().Warn("No config for plugin Commands")
 
 		return
 	}
 
+	if runHistory, ok := pluginConfig["runHistory"].(bool); ok {
+		p.runHistory = runHistory
+	}
+
 	char, exists := pluginConfig["commandChar"]
 	cChar, ok := char.(string)
 	if !exists || !ok || cChar == "" {
-		g.Logger.Warn("No config for plugin Commands")
+		p.g.Logger().Warn("No config for plugin Commands")
 
 		return
 	}
 
-	commandChar = cChar
+	p.commandChar = cChar
 }
 
-func handleMessage(e gofra.Event) *gofra.Reply {
-	if e.MB.Body == "" {
+// Corrected messages (XEP-0308) are handled again, with the ID of the message
+// they replace in the "replaces" payload of the command event. The replies to
+// them correct the ones sent to the original command.
+//
+// Commands in the history rooms send on joining them are not run again unless
+// runHistory is set, and the messages of the bot echoed by rooms never are.
+func (p *plugin) handleMessage(e gofra.Event) *gofra.Reply {
+	if e.MB.Body == "" || e.IsSelf || (e.IsHistory && !p.runHistory) {
 		return nil
 	}
 
 	command := ""
-	if !strings.HasPrefix(e.MB.Body, commandChar) {
+	if !strings.HasPrefix(e.MB.Body, p.commandChar) {
 		return nil
 	}
 
@@ -91,10 +108,18 @@ func handleMessage(e gofra.Event) *gofra.Reply {
 	eventName := "command/" + command
 
 	event := gofra.Event{
-		Name:    eventName,
-		MB:      e.MB,
-		Payload: e.Payload,
+		Name:      eventName,
+		MB:        e.MB,
+		Payload:   e.Payload,
+		IsHistory: e.IsHistory,
+	}
+
+	// Tell the conversation the bot is typing while a plugin runs the command
+	if !p.g.HasSubscribers(eventName) {
+		return p.g.Publish(event)
 	}
+	done := gofra.Typing(p.g, e.MB, p.chatStates)
+	defer done()
 
-	return g.Publish(event)
+	return p.g.Publish(event)
 }
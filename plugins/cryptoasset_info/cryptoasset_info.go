@@ -15,40 +15,44 @@ import (
 
 var Plugin plugin
 
-type plugin struct{}
+type plugin struct {
+	g gofra.API
+}
+
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
 const metadataPrefix = "https://api.cryptowat.ch/assets/"
 const metadataSufix = "/metadata"
 const defaultAsset = "btc"
 
-var g *gofra.Gofra
-
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "assetInfo"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Provides a brief description of crypto assets"
 }
 
-func (p plugin) Help() string {
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf("Usage: %sassetinfo btc", commandChar)
 }
 
-func (p plugin) Init(conf gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
+func (p *plugin) Init(conf gofra.Config, gofra gofra.API) {
+	p.g = gofra
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"command/assetinfo",
 		p.Name(),
-		handleAssetInfo,
+		p.handleAssetInfo,
 		0,
 	)
 }
 
-func handleAssetInfo(e gofra.Event) *gofra.Reply {
+func (p *plugin) handleAssetInfo(e gofra.Event) *gofra.Reply {
 	var asset string
 
 	var r *gofra.Reply
@@ -57,8 +61,8 @@ func handleAssetInfo(e gofra.Event) *gofra.Reply {
 
 	switch {
 	case argLength > 1:
-		if err := g.SendStanza(e.MB.Reply("Too many arguments")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Too many arguments")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -70,9 +74,9 @@ func handleAssetInfo(e gofra.Event) *gofra.Reply {
 
 	resp, err := http.Get(metadataPrefix + asset + metadataSufix)
 	if err != nil {
-		g.Logger.Error(err.Error())
-		if err := g.SendStanza(e.MB.Reply(fmt.Sprintf("Could not retrieve asset info: %s", err.Error()))); err != nil {
-			g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(fmt.Sprintf("Could not retrieve asset info: %s", err.Error()))); err != nil {
+			p.g.Logger().Error(err.Error())
 
 		}
 
@@ -82,8 +86,8 @@ func handleAssetInfo(e gofra.Event) *gofra.Reply {
 
 	if resp.StatusCode != http.StatusOK {
 		errMsg := fmt.Sprintf("Could not retrieve asset info. Status code: %d", resp.StatusCode)
-		if err := g.SendStanza(e.MB.Reply(errMsg)); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(errMsg)); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -91,8 +95,8 @@ func handleAssetInfo(e gofra.Event) *gofra.Reply {
 
 	var result map[string]map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		if err := g.SendStanza(e.MB.Reply(fmt.Sprintf("Could not decode response: %s", err.Error()))); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(fmt.Sprintf("Could not decode response: %s", err.Error()))); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -100,8 +104,8 @@ func handleAssetInfo(e gofra.Event) *gofra.Reply {
 
 	payload, ok := result["result"][asset]
 	if !ok {
-		if err := g.SendStanza(e.MB.Reply("Asset not found")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Asset not found")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -110,8 +114,8 @@ func handleAssetInfo(e gofra.Event) *gofra.Reply {
 	assetData := payload.(map[string]interface{})
 	description, ok := assetData["AssetDescription"]
 	if !ok {
-		if err := g.SendStanza(e.MB.Reply("No description for " + asset + " yet")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("No description for " + asset + " yet")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -119,15 +123,15 @@ func handleAssetInfo(e gofra.Event) *gofra.Reply {
 
 	descriptionStr := description.(string)
 	if descriptionStr == "" {
-		if err := g.SendStanza(e.MB.Reply("No description for " + asset + " yet")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("No description for " + asset + " yet")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
 	}
 
-	if err := g.SendStanza(e.MB.Reply(descriptionStr)); err != nil {
-		g.Logger.Error(err.Error())
+	if err := p.g.SendStanza(e.MB.Reply(descriptionStr)); err != nil {
+		p.g.Logger().Error(err.Error())
 	}
 
 	return r
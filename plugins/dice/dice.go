@@ -16,63 +16,75 @@ import (
 
 var Plugin plugin
 
-var g *gofra.Gofra
-var config gofra.Config
-var defaultDiceFaces = 6
-var defaultDiceQuantity = 1
+const (
+	defaultDiceFaces    = 6
+	defaultDiceQuantity = 1
+)
 
 type throw struct {
 	quantity int
 	faces    int
 }
 
-type plugin struct{}
+type plugin struct {
+	g                   gofra.API
+	config              gofra.Config
+	defaultDiceFaces    int
+	defaultDiceQuantity int
+}
+
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{
+		defaultDiceFaces:    defaultDiceFaces,
+		defaultDiceQuantity: defaultDiceQuantity,
+	}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "Dice"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Provides dice throwing results"
 }
 
-func (p plugin) Help() string {
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf("Usage: Format is [number of dice]d[number of faces]\n For example: %sdice -> 1d6: 6, %sdice 3d20 -> 3d20: 17, 6, 16", commandChar, commandChar)
 }
 
-func (p plugin) Init(c gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
-	config = c
+func (p *plugin) Init(c gofra.Config, gofra gofra.API) {
+	p.g = gofra
+	p.config = c
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"command/dice",
 		p.Name(),
-		handleCommand,
+		p.handleCommand,
 		0,
 	)
 
-	df, exists := config.Plugins["Dice"]["faces"].(int)
-	if exists && defaultDiceFaces != df && df >= 2 {
-		defaultDiceFaces = config.Plugins["Dice"]["faces"].(int)
+	df, exists := p.config.Plugins["Dice"]["faces"].(int)
+	if exists && p.defaultDiceFaces != df && df >= 2 {
+		p.defaultDiceFaces = p.config.Plugins["Dice"]["faces"].(int)
 	}
-	dq, exists := config.Plugins["Dice"]["quantity"].(int)
-	if exists && defaultDiceQuantity != dq && dq >= 1 {
-		defaultDiceQuantity = config.Plugins["Dice"]["quantity"].(int)
+	dq, exists := p.config.Plugins["Dice"]["quantity"].(int)
+	if exists && p.defaultDiceQuantity != dq && dq >= 1 {
+		p.defaultDiceQuantity = p.config.Plugins["Dice"]["quantity"].(int)
 	}
 
 }
 
-func handleCommand(e gofra.Event) *gofra.Reply {
-	throws := parseArgs(e.MB.Body)
+func (p *plugin) handleCommand(e gofra.Event) *gofra.Reply {
+	throws := p.parseArgs(e.MB.Body)
 	answer := ""
 	for _, throw := range throws {
 		answer += do(throw) + "\n"
 	}
 
-	if err := g.SendStanza(e.MB.Reply(answer)); err != nil {
-		g.Logger.Error(err.Error())
+	if err := p.g.SendStanza(e.MB.Reply(answer)); err != nil {
+		p.g.Logger().Error(err.Error())
 
 		return nil
 	}
@@ -80,22 +92,22 @@ func handleCommand(e gofra.Event) *gofra.Reply {
 	return nil
 }
 
-func parseArgs(argLine string) []throw {
+func (p *plugin) parseArgs(argLine string) []throw {
 	args := strings.Fields(argLine)[1:]
 
 	if len(args) == 0 {
-		return []throw{{quantity: defaultDiceQuantity, faces: defaultDiceFaces}}
+		return []throw{{quantity: p.defaultDiceQuantity, faces: p.defaultDiceFaces}}
 	}
 
 	throws := []throw{}
 	for _, arg := range args {
 		if arg == "" {
-			throws = append(throws, throw{quantity: defaultDiceQuantity, faces: defaultDiceFaces})
+			throws = append(throws, throw{quantity: p.defaultDiceQuantity, faces: p.defaultDiceFaces})
 		}
 
 		number, err := strconv.Atoi(arg)
 		if err == nil {
-			throws = append(throws, throw{quantity: number, faces: defaultDiceFaces})
+			throws = append(throws, throw{quantity: number, faces: p.defaultDiceFaces})
 
 			continue
 		}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestTranscripts(t *testing.T) {
+	gofratest.RunTranscripts(t, "testdata/*.transcript", func() []gofra.Plugin {
+		return []gofra.Plugin{Plugin.NewInstance(), gofratest.Commands("!")}
+	})
+}
+
+func TestDice_Correction(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom("room@muc.example.com", "alice"))
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	id := h.Say("room@muc.example.com/alice", "!dice 3d2")
+	first := h.ExpectMessage("room@muc.example.com", `^3d2: \d, \d, \d\n$`)
+	assert.Nil(t, first.Replace)
+
+	h.Correct("room@muc.example.com/alice", id, "!dice 3d20")
+	correction := h.ExpectMessage("room@muc.example.com", `^3d20: \d+, \d+, \d+\n$`)
+	assert.Equal(t, first.ID, correction.Replaces())
+	assert.NotEqual(t, first.ID, correction.ID)
+
+	// Corrections refer to the original message
+	h.Correct("room@muc.example.com/alice", id, "!dice 1d20")
+	correction = h.ExpectMessage("room@muc.example.com", `^1d20: \d+\n$`)
+	assert.Equal(t, first.ID, correction.Replaces())
+}
@@ -13,45 +13,49 @@ import (
 
 var Plugin plugin
 
-type plugin struct{}
+type plugin struct {
+	g      gofra.API
+	config gofra.Config
+}
 
-var g *gofra.Gofra
-var config gofra.Config
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "example"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Example plugin"
 }
 
-func (p plugin) Help() string {
+func (p *plugin) Help() string {
 	// if the plugin is a command the following provides information on how to use it
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf("Usage: %sexampleplugin first_argument second_argument ...", commandChar)
 }
 
-func (p plugin) Init(conf gofra.Config, api *gofra.Gofra) {
-	g = api
-	config = conf
+func (p *plugin) Init(conf gofra.Config, api gofra.API) {
+	p.g = api
+	p.config = conf
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"exampleEvent",
 		p.Name(),
-		handleExampleEvent,
+		p.handleExampleEvent,
 		0,
 	)
 }
 
-func handleExampleEvent(e gofra.Event) *gofra.Reply {
+func (p *plugin) handleExampleEvent(e gofra.Event) *gofra.Reply {
 	// do things with e
 	data := e.Payload
 	log.Println(data)
 
 	// maybe trigger another event
-	reply := g.Publish(
+	reply := p.g.Publish(
 		gofra.Event{
 			Name: "newExampleEvent",
 		})
@@ -62,7 +66,7 @@ func handleExampleEvent(e gofra.Event) *gofra.Reply {
 
 	// get reply's content and work with it
 	data = reply.Payload
-	g.Logger.Info(fmt.Sprintf("%v", data))
+	p.g.Logger().Info(fmt.Sprintf("%v", data))
 
 	// return a reply
 	return &gofra.Reply{Payload: data}
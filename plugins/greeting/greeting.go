@@ -13,39 +13,43 @@ import (
 // Plugin is the exported plugin instance.
 var Plugin plugin
 
-var g *gofra.Gofra
+type plugin struct {
+	g gofra.API
+}
 
-type plugin struct{}
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "greeting"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Provides a multi-stage greeting ad-hoc command example"
 }
 
-func (p plugin) Help() string {
+func (p *plugin) Help() string {
 	return "Use the ad-hoc commands interface to send customized greetings"
 }
 
-func (p plugin) Init(config gofra.Config, api *gofra.Gofra) {
-	g = api
+func (p *plugin) Init(config gofra.Config, api gofra.API) {
+	p.g = api
 
 	// Register the greeting command via the adhoc plugin
-	g.Publish(gofra.Event{
+	p.g.Publish(gofra.Event{
 		Name: "adhoc/register",
 		Payload: map[string]interface{}{
 			"command": &gofra.AdHocCommand{
 				Node:    "greeting",
 				Name:    "Send a Greeting",
-				Handler: handleGreeting,
+				Handler: p.handleGreeting,
 			},
 		},
 	})
 
 	// Register a simple single-stage command
-	g.Publish(gofra.Event{
+	p.g.Publish(gofra.Event{
 		Name: "adhoc/register",
 		Payload: map[string]interface{}{
 			"command": &gofra.AdHocCommand{
@@ -67,7 +71,7 @@ func handlePing(session *gofra.CommandSession, action gofra.CommandAction, formD
 }
 
 // handleGreeting is a multi-stage command handler.
-func handleGreeting(session *gofra.CommandSession, action gofra.CommandAction, formData map[string]string) (*gofra.CommandResponse, error) {
+func (p *plugin) handleGreeting(session *gofra.CommandSession, action gofra.CommandAction, formData map[string]string) (*gofra.CommandResponse, error) {
 	// Handle cancel
 	if action == gofra.ActionCancel {
 		return &gofra.CommandResponse{
@@ -94,7 +98,7 @@ func handleGreeting(session *gofra.CommandSession, action gofra.CommandAction, f
 
 	// Handle complete
 	if action == gofra.ActionComplete {
-		return completeGreeting(session, formData)
+		return p.completeGreeting(session, formData)
 	}
 
 	// Determine what to show based on session state
@@ -218,7 +222,7 @@ func showConfirmForm(session *gofra.CommandSession) (*gofra.CommandResponse, err
 }
 
 // completeGreeting sends the greeting and completes the command.
-func completeGreeting(session *gofra.CommandSession, formData map[string]string) (*gofra.CommandResponse, error) {
+func (p *plugin) completeGreeting(session *gofra.CommandSession, formData map[string]string) (*gofra.CommandResponse, error) {
 	greetTypeStr, ok := session.GetStr("greeting_type")
 	if !ok {
 		greetTypeStr = "hello" // default
@@ -239,8 +243,8 @@ func completeGreeting(session *gofra.CommandSession, formData map[string]string)
 	message := buildGreetingMessage(greetTypeStr, customMsgStr)
 
 	// Actually send the message
-	if err := g.SendMessage(recipientJID, message, stanza.ChatMessage); err != nil {
-		g.Logger.Error(fmt.Sprintf("Failed to send greeting: %v", err))
+	if err := p.g.SendMessage(recipientJID, message, stanza.ChatMessage); err != nil {
+		p.g.Logger().Error(fmt.Sprintf("Failed to send greeting: %v", err))
 		return &gofra.CommandResponse{
 			Status:     gofra.StatusCompleted,
 			IsComplete: true,
@@ -250,7 +254,7 @@ func completeGreeting(session *gofra.CommandSession, formData map[string]string)
 		}, nil
 	}
 
-	g.Logger.Info(fmt.Sprintf("Greeting sent to %s: %s", recipientJID, message))
+	p.g.Logger().Info(fmt.Sprintf("Greeting sent to %s: %s", recipientJID, message))
 
 	return &gofra.CommandResponse{
 		Status:     gofra.StatusCompleted,
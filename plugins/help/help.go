@@ -13,8 +13,6 @@ import (
 
 var Plugin plugin
 
-var g *gofra.Gofra
-var config gofra.Config
 var defaultDiceFaces = 6
 var defaultDiceQuantity = 1
 
@@ -23,45 +21,52 @@ type throw struct {
 	faces    int
 }
 
-type plugin struct{}
+type plugin struct {
+	g      gofra.API
+	config gofra.Config
+}
+
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "Help"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Provides help with instructions on how to use other plugins"
 }
 
-func (p plugin) Help() string {
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf("Usage: %shelp [plugin]\nFor a list of plugins invoke without arguments", commandChar)
 }
 
-func (p plugin) Init(c gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
-	config = c
+func (p *plugin) Init(c gofra.Config, gofra gofra.API) {
+	p.g = gofra
+	p.config = c
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"command/help",
 		p.Name(),
-		handleCommand,
+		p.handleCommand,
 		0,
 	)
 }
 
-func handleCommand(e gofra.Event) *gofra.Reply {
+func (p *plugin) handleCommand(e gofra.Event) *gofra.Reply {
 	args := strings.Fields(e.MB.Body)[1:]
 	var answer strings.Builder
-	plugins := g.GetPlugins()
+	plugins := p.g.GetPlugins()
 	// invoked without args provides list of plugins and their description
 	if len(args) == 0 {
 		for name, plugin := range plugins {
 			answer.WriteString(fmt.Sprintf("%s: %s\n", name, plugin.Description()))
 		}
-		if err := g.SendStanza(e.MB.Reply(answer.String())); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(answer.String())); err != nil {
+			p.g.Logger().Error(err.Error())
 
 			return nil
 		}
@@ -77,8 +82,8 @@ func handleCommand(e gofra.Event) *gofra.Reply {
 		answer.WriteString(fmt.Sprintf("%s: %s\n", arg, p.Help()))
 	}
 
-	if err := g.SendStanza(e.MB.Reply(answer.String())); err != nil {
-		g.Logger.Error(err.Error())
+	if err := p.g.SendStanza(e.MB.Reply(answer.String())); err != nil {
+		p.g.Logger().Error(err.Error())
 
 		return nil
 	}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -30,30 +31,37 @@ const (
 	keyListName      = "list_name"
 	keyItems         = "items"
 	keyManageAction  = "manage_action"
-	keySelectedItems = "selected_items_multi"
+	keySelectedItems = "selected_items"
 )
 
+// File the lists are persisted to, within the data directory
+const stateFile = "lists.json"
+
 // Error constants
 var errNotEnoughArguments = errors.New("not enough arguments")
 
 var Plugin plugin
 
-var g *gofra.Gofra
-
-var lists State
+type plugin struct {
+	g       gofra.API
+	dataDir string
+	lists   State
+}
 
-type plugin struct{}
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "List"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Create and manage lists in MUCs"
 }
 
-func (p plugin) Help() string {
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf(`
 	Usage:
@@ -65,36 +73,37 @@ func (p plugin) Help() string {
 	`, commandChar)
 }
 
-func (p plugin) Init(c gofra.Config, api *gofra.Gofra) {
-	g = api
-	g.Subscribe(
+func (p *plugin) Init(c gofra.Config, api gofra.API) {
+	p.g = api
+	p.dataDir = c.DataDir
+	p.g.Subscribe(
 		"command/list",
 		p.Name(),
-		handleList,
+		p.handleList,
 		0,
 	)
 
 	// Register ad-hoc command after all plugins are loaded
-	g.Subscribe(
+	p.g.Subscribe(
 		"initialized",
 		p.Name(),
-		registerAdhocCommand,
+		p.registerAdhocCommand,
 		0,
 	)
 
-	lists = make(State)
+	p.lists = make(State)
 
-	loadState()
+	p.loadState()
 }
 
-func registerAdhocCommand(e gofra.Event) *gofra.Reply {
-	g.Publish(gofra.Event{
+func (p *plugin) registerAdhocCommand(e gofra.Event) *gofra.Reply {
+	p.g.Publish(gofra.Event{
 		Name: "adhoc/register",
 		Payload: map[string]interface{}{
 			"command": &gofra.AdHocCommand{
 				Node:    "list-manager",
 				Name:    "List Manager",
-				Handler: handleListAdhoc,
+				Handler: p.handleListAdhoc,
 			},
 		},
 	})
@@ -143,95 +152,113 @@ func parseCommand(args []string) (command, error) {
 // !list del list_name item_id
 // !list show list_name
 // !list show all
-func handleList(e gofra.Event) *gofra.Reply {
+func (p *plugin) handleList(e gofra.Event) *gofra.Reply {
 	msg := e.MB
 	args := strings.Fields(msg.Body)[1:]
 
 	if len(args) == 0 || args[0] == "" {
-		sendReply(e, "Possible subcommands are: new, add, del, show")
+		p.sendReply(e, "Possible subcommands are: new, add, del, show")
 		return nil
 	}
 
 	cmd, err := parseCommand(args)
 	if err != nil {
-		sendReply(e, err.Error())
+		p.sendReply(e, err.Error())
 	}
 
 	room := msg.From.Bare().String()
 
 	switch cmd.action {
 	case "new":
-		lists.newList(room, cmd.listName)
-		persistState()
-		sendReply(e, "List created")
+		p.lists.newList(room, cmd.listName)
+		p.persistState()
+		p.confirm(e)
 
 	case "add":
-		lists.addItem(room, cmd.listName, cmd.item)
-		persistState()
-		sendReply(e, "Item added")
+		p.lists.addItem(room, cmd.listName, cmd.item)
+		p.persistState()
+		p.confirm(e)
 
 	case "del":
-		lists.delItem(room, cmd.listName, cmd.itemID)
-		persistState()
-		sendReply(e, "Item deleted")
+		p.lists.delItem(room, cmd.listName, cmd.itemID)
+		p.persistState()
+		p.confirm(e)
 
 	case "show":
 		if cmd.listName == "all" {
-			sendReply(e, lists.showAll(room))
+			p.sendFormatted(e, p.lists.showAll(room))
 		} else {
-			sendReply(e, lists.show(room, cmd.listName))
+			p.sendFormatted(e, p.lists.show(room, cmd.listName))
 		}
 	}
 
 	return nil
 }
 
-func sendReply(e gofra.Event, reply string) {
-	if err := g.SendStanza(e.MB.Reply(reply)); err != nil {
-		g.Logger.Error(err.Error())
+// confirm reacts to the command with a check mark
+func (p *plugin) confirm(e gofra.Event) {
+	if err := p.g.React(e.MB, "✅"); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+}
+
+func (p *plugin) sendReply(e gofra.Event, reply string) {
+	if err := p.g.SendStanza(e.MB.Reply(reply)); err != nil {
+		p.g.Logger().Error(err.Error())
 	}
 }
 
-func persistState() {
-	serialized, err := json.MarshalIndent(lists, "", " ")
+func (p *plugin) sendFormatted(e gofra.Event, reply *gofra.Formatted) {
+	if err := p.g.SendStanza(e.MB.FormattedReply(reply)); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+}
+
+func (p *plugin) persistState() {
+	serialized, err := json.MarshalIndent(p.lists, "", " ")
 	if err != nil {
-		g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
 		return
 	}
 
-	file, err := os.Create("/data/lists.json")
+	if err := os.MkdirAll(p.dataDir, 0o755); err != nil {
+		p.g.Logger().Error(err.Error())
+		return
+	}
+
+	file, err := os.Create(filepath.Join(p.dataDir, stateFile))
 	if err != nil {
-		g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
 		return
 	}
 	defer file.Close()
 
 	_, err = file.Write(serialized)
 	if err != nil {
-		g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
 	}
 }
 
-func loadState() {
-	serialized, err := os.ReadFile("/data/lists.json")
+func (p *plugin) loadState() {
+	serialized, err := os.ReadFile(filepath.Join(p.dataDir, stateFile))
 	if err != nil {
-		g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
 		return
 	}
 
 	var state State
 	err = json.Unmarshal(serialized, &state)
 	if err != nil {
-		g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
 		return
 	}
 
-	lists = state
+	p.lists = state
 }
 
 // handleListAdhoc is the ad-hoc command handler for list management.
-func handleListAdhoc(session *gofra.CommandSession, action gofra.CommandAction, formData map[string]string) (*gofra.CommandResponse, error) {
-	g.Logger.Debug(fmt.Sprintf("list-manager: action=%s formData=%v", action, formData))
+func (p *plugin) handleListAdhoc(session *gofra.CommandSession, action gofra.CommandAction, formData map[string]string) (*gofra.CommandResponse, error) {
+	p.g.Logger().Debug(fmt.Sprintf("list-manager: action=%s formData=%v", action, formData))
 
 	// Handle cancel
 	if action == gofra.ActionCancel {
@@ -243,7 +270,7 @@ func handleListAdhoc(session *gofra.CommandSession, action gofra.CommandAction,
 
 	// Handle prev - clear last piece of data and show appropriate form
 	if action == gofra.ActionPrev {
-		return handlePrev(session)
+		return p.handlePrev(session)
 	}
 
 	// Save form data
@@ -259,14 +286,16 @@ func handleListAdhoc(session *gofra.CommandSession, action gofra.CommandAction,
 	if manageAction, ok := formData[keyManageAction]; ok && manageAction != "" {
 		session.Set(keyManageAction, manageAction)
 	}
-	// Note: selected_items_multi is stored directly by adhoc plugin for list-multi fields
+	if selected := session.Values().Strings(keySelectedItems); len(selected) > 0 {
+		session.Set(keySelectedItems, selected)
+	}
 
 	// Determine what to show based on what data we have
-	return determineNextStep(session)
+	return p.determineNextStep(session)
 }
 
 // handlePrev goes back one step by clearing the most recent data.
-func handlePrev(session *gofra.CommandSession) (*gofra.CommandResponse, error) {
+func (p *plugin) handlePrev(session *gofra.CommandSession) (*gofra.CommandResponse, error) {
 	act, hasAction := session.GetStr(keyAction)
 	listName, hasListName := session.GetStr(keyListName)
 	_, hasManageAction := session.GetStr(keyManageAction)
@@ -277,14 +306,14 @@ func handlePrev(session *gofra.CommandSession) (*gofra.CommandResponse, error) {
 		session.Set(keySelectedItems, nil)
 		session.Set(keyManageAction, nil)
 		if hasListName {
-			return buildManageItemsForm(session, listName)
+			return p.buildManageItemsForm(session, listName)
 		}
 	}
 	if hasListName {
 		session.Set(keyListName, nil)
 		session.Set(keyItems, nil)
 		if hasAction {
-			return buildStage1Form(session, act)
+			return p.buildStage1Form(session, act)
 		}
 	}
 	if hasAction {
@@ -295,7 +324,7 @@ func handlePrev(session *gofra.CommandSession) (*gofra.CommandResponse, error) {
 }
 
 // determineNextStep figures out what form/action to show based on session state.
-func determineNextStep(session *gofra.CommandSession) (*gofra.CommandResponse, error) {
+func (p *plugin) determineNextStep(session *gofra.CommandSession) (*gofra.CommandResponse, error) {
 	act, hasAction := session.GetStr(keyAction)
 
 	// No action yet - show action selection
@@ -309,39 +338,40 @@ func determineNextStep(session *gofra.CommandSession) (*gofra.CommandResponse, e
 	switch act {
 	case "new", "show":
 		if hasListName {
-			return executeListAction(session)
+			return p.executeListAction(session)
 		}
-		return buildStage1Form(session, act)
+		return p.buildStage1Form(session, act)
 
 	case "add":
 		_, hasItems := session.GetStr(keyItems)
 		if hasListName && hasItems {
-			return executeListAction(session)
+			return p.executeListAction(session)
 		}
-		return buildStage1Form(session, act)
+		return p.buildStage1Form(session, act)
 
 	case "manage":
 		_, hasManageAction := session.GetStr(keyManageAction)
 		_, hasSelectedItems := session.GetStrSlice(keySelectedItems)
-		g.Logger.Debug(fmt.Sprintf("list-manager manage: hasName=%v hasManageAction=%v hasSelectedItems=%v",
+		p.g.Logger().Debug(fmt.Sprintf("list-manager manage: hasName=%v hasManageAction=%v hasSelectedItems=%v",
 			hasListName, hasManageAction, hasSelectedItems))
-		if hasListName && hasManageAction && hasSelectedItems {
-			return executeListAction(session)
+		// Submitting the items without selecting any completes the command
+		if hasListName && hasManageAction {
+			return p.executeListAction(session)
 		}
 		if hasListName {
-			return buildManageItemsForm(session, listName)
+			return p.buildManageItemsForm(session, listName)
 		}
-		return buildStage1Form(session, act)
+		return p.buildStage1Form(session, act)
 	}
 
 	return buildStage0Form()
 }
 
 // buildManageItemsForm shows all items with checkboxes for multi-select operations.
-func buildManageItemsForm(session *gofra.CommandSession, listName string) (*gofra.CommandResponse, error) {
+func (p *plugin) buildManageItemsForm(session *gofra.CommandSession, listName string) (*gofra.CommandResponse, error) {
 	room := session.Requester
 	var itemOptions []gofra.XDataOption
-	if roomLists, ok := lists[room]; ok {
+	if roomLists, ok := p.lists[room]; ok {
 		if list, ok := roomLists[listName]; ok {
 			for i, item := range list.Items {
 				itemOptions = append(itemOptions, gofra.XDataOption{
@@ -362,7 +392,7 @@ func buildManageItemsForm(session *gofra.CommandSession, listName string) (*gofr
 
 	form := gofra.NewFormBuilder("form", fmt.Sprintf("Manage: %s", listName)).
 		Instructions("Select items and choose an action").
-		AddFieldWithMultipleValues("selected_items", fieldTypeListMulti, "Items", nil, itemOptions).
+		AddFieldWithMultipleValues(keySelectedItems, fieldTypeListMulti, "Items", nil, itemOptions).
 		AddFieldWithOptions(keyManageAction, fieldTypeListSingle, "Action", "done", []gofra.XDataOption{
 			{Label: "✓ Mark as done", Value: "done"},
 			{Label: "✗ Delete selected", Value: "delete"},
@@ -396,12 +426,12 @@ func buildStage0Form() (*gofra.CommandResponse, error) {
 }
 
 // buildStage1Form builds the form for stage 1 based on the action.
-func buildStage1Form(session *gofra.CommandSession, action string) (*gofra.CommandResponse, error) {
+func (p *plugin) buildStage1Form(session *gofra.CommandSession, action string) (*gofra.CommandResponse, error) {
 	room := session.Requester
 
 	// Get available lists for this room
 	var listOptions []gofra.XDataOption
-	if roomLists, ok := lists[room]; ok {
+	if roomLists, ok := p.lists[room]; ok {
 		for name := range roomLists {
 			listOptions = append(listOptions, gofra.XDataOption{Label: name, Value: name})
 		}
@@ -412,6 +442,7 @@ func buildStage1Form(session *gofra.CommandSession, action string) (*gofra.Comma
 		form := gofra.NewFormBuilder("form", "Create New List").
 			Instructions("Enter a name for the new list").
 			AddField(keyListName, fieldTypeTextSingle, "List Name", "").
+			Required().
 			Build()
 
 		return &gofra.CommandResponse{
@@ -482,22 +513,22 @@ func completedResponse(note gofra.Note) (*gofra.CommandResponse, error) {
 }
 
 // executeNewList creates a new list.
-func executeNewList(room, listName string) (*gofra.CommandResponse, error) {
-	lists.newList(room, listName)
-	persistState()
+func (p *plugin) executeNewList(room, listName string) (*gofra.CommandResponse, error) {
+	p.lists.newList(room, listName)
+	p.persistState()
 	return completedResponse(gofra.NewInfoNote(fmt.Sprintf("List '%s' created", listName)))
 }
 
 // executeShowList displays list contents.
-func executeShowList(room, listName string) (*gofra.CommandResponse, error) {
+func (p *plugin) executeShowList(room, listName string) (*gofra.CommandResponse, error) {
 	var content string
 	if listName == "all" {
-		content = lists.showAll(room)
+		content = p.lists.showAll(room).Plain()
 		if content == "" {
 			content = "No lists found"
 		}
 	} else {
-		content = lists.show(room, listName)
+		content = p.lists.show(room, listName).Plain()
 		if content == "" {
 			content = "List is empty"
 		}
@@ -506,7 +537,7 @@ func executeShowList(room, listName string) (*gofra.CommandResponse, error) {
 }
 
 // executeAddItems adds items to a list.
-func executeAddItems(session *gofra.CommandSession, room, listName string) (*gofra.CommandResponse, error) {
+func (p *plugin) executeAddItems(session *gofra.CommandSession, room, listName string) (*gofra.CommandResponse, error) {
 	itemsStr, ok := session.GetStr(keyItems)
 	if !ok {
 		return completedResponse(gofra.NewErrorNote("No items provided"))
@@ -516,11 +547,11 @@ func executeAddItems(session *gofra.CommandSession, room, listName string) (*gof
 	for _, item := range strings.Split(itemsStr, "\n") {
 		item = strings.TrimSpace(item)
 		if item != "" {
-			lists.addItem(room, listName, item)
+			p.lists.addItem(room, listName, item)
 			addedCount++
 		}
 	}
-	persistState()
+	p.persistState()
 
 	if addedCount == 0 {
 		return completedResponse(gofra.NewErrorNote("No items provided"))
@@ -529,7 +560,7 @@ func executeAddItems(session *gofra.CommandSession, room, listName string) (*gof
 }
 
 // executeManageList handles manage actions (mark done/delete).
-func executeManageList(session *gofra.CommandSession, room, listName string) (*gofra.CommandResponse, error) {
+func (p *plugin) executeManageList(session *gofra.CommandSession, room, listName string) (*gofra.CommandResponse, error) {
 	manageAction, ok := session.GetStr(keyManageAction)
 	if !ok {
 		return completedResponse(gofra.NewErrorNote("No manage action selected"))
@@ -544,16 +575,16 @@ func executeManageList(session *gofra.CommandSession, room, listName string) (*g
 	switch manageAction {
 	case "done":
 		for _, idx := range indices {
-			lists.markDone(room, listName, idx)
+			p.lists.markDone(room, listName, idx)
 		}
-		persistState()
+		p.persistState()
 		return completedResponse(gofra.NewInfoNote(fmt.Sprintf("Marked %d item(s) as done in '%s'", len(indices), listName)))
 
 	case "delete":
 		for _, idx := range indices {
-			lists.delItem(room, listName, idx)
+			p.lists.delItem(room, listName, idx)
 		}
-		persistState()
+		p.persistState()
 		return completedResponse(gofra.NewInfoNote(fmt.Sprintf("Deleted %d item(s) from '%s'", len(indices), listName)))
 	}
 
@@ -575,7 +606,7 @@ func parseAndSortIndices(items []string) []int {
 }
 
 // executeListAction performs the selected action.
-func executeListAction(session *gofra.CommandSession) (*gofra.CommandResponse, error) {
+func (p *plugin) executeListAction(session *gofra.CommandSession) (*gofra.CommandResponse, error) {
 	action, ok := session.GetStr(keyAction)
 	if !ok {
 		return completedResponse(gofra.NewErrorNote("No action specified"))
@@ -590,13 +621,13 @@ func executeListAction(session *gofra.CommandSession) (*gofra.CommandResponse, e
 
 	switch action {
 	case "new":
-		return executeNewList(room, listName)
+		return p.executeNewList(room, listName)
 	case "show":
-		return executeShowList(room, listName)
+		return p.executeShowList(room, listName)
 	case "add":
-		return executeAddItems(session, room, listName)
+		return p.executeAddItems(session, room, listName)
 	case "manage":
-		return executeManageList(session, room, listName)
+		return p.executeManageList(session, room, listName)
 	}
 
 	return completedResponse(gofra.NewErrorNote("Unknown action"))
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+const room = "room@muc.example.com"
+
+func TestList(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice"))
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	id := h.Say(room+"/alice", "!list new groceries")
+	assert.Equal(t, []string{"✅"}, h.ExpectReaction(room, id))
+
+	id = h.Say(room+"/alice", "!list add groceries oat milk")
+	h.ExpectReaction(room, id)
+
+	id = h.Say(room+"/alice", "!list add groceries bread")
+	h.ExpectReaction(room, id)
+
+	id = h.Say(room+"/alice", "!list del groceries 0")
+	h.ExpectReaction(room, id)
+
+	h.Say(room+"/alice", "!list show groceries")
+	h.ExpectMessage(room, `^0\. bread$`)
+}
+
+func TestList_PersistsAcrossRestarts(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice"))
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	h.ExpectReaction(room, h.Say(room+"/alice", "!list new todo"))
+	h.ExpectReaction(room, h.Say(room+"/alice", "!list add todo water the plants"))
+
+	restarted := gofratest.New(t, gofratest.WithRoom(room, "alice"), gofratest.WithConfig(func(c *gofra.Config) {
+		c.DataDir = h.Config.DataDir
+	}))
+	restarted.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	restarted.Say(room+"/alice", "!list show todo")
+	restarted.ExpectMessage(room, "water the plants")
+}
+
+func TestList_ManageWithoutSelection(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice"))
+	p := Plugin.NewInstance().(*plugin)
+	h.Start(p, gofratest.Commands("!"))
+
+	h.ExpectReaction(room, h.Say(room+"/alice", "!list new todo"))
+	h.ExpectReaction(room, h.Say(room+"/alice", "!list add todo water the plants"))
+
+	session := &gofra.CommandSession{Requester: room}
+	_, err := p.handleListAdhoc(session, gofra.ActionExecute, nil)
+	assert.NoError(t, err)
+	_, err = p.handleListAdhoc(session, gofra.ActionNext, map[string]string{keyAction: "manage"})
+	assert.NoError(t, err)
+	resp, err := p.handleListAdhoc(session, gofra.ActionNext, map[string]string{keyListName: "todo"})
+	if !assert.NoError(t, err) || !assert.NotNil(t, resp.Form) {
+		return
+	}
+
+	// The items form can be submitted without selecting any, leaving it
+	values := gofra.FormValues{keyManageAction: {"done"}}
+	assert.Empty(t, resp.Form.Validate(values))
+
+	session.SetValues(values)
+	resp, err = p.handleListAdhoc(session, gofra.ActionComplete, map[string]string{keyManageAction: "done"})
+	assert.NoError(t, err)
+	assert.Equal(t, gofra.StatusCompleted, resp.Status)
+	assert.Equal(t, []gofra.Note{gofra.NewInfoNote("No items selected")}, resp.Notes)
+
+	h.Say(room+"/alice", "!list show todo")
+	h.ExpectMessage(room, `^0\. water the plants$`)
+}
+
+func TestTranscripts(t *testing.T) {
+	gofratest.RunTranscripts(t, "testdata/*.transcript", func() []gofra.Plugin {
+		return []gofra.Plugin{Plugin.NewInstance(), gofratest.Commands("!")}
+	})
+}
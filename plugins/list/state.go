@@ -1,8 +1,10 @@
 package main
 
 import (
-	"fmt"
+	"sort"
 	"strings"
+
+	gofra "github.com/XaviFP/gofra/internal"
 )
 
 type List struct {
@@ -28,24 +30,31 @@ func (s State) markDone(room, listName string, id int) {
 	}
 }
 
-func (s State) show(room, listName string) string {
+func (s State) show(room, listName string) *gofra.Formatted {
 	return s[room][listName].show()
 }
 
-func (s State) showAll(room string) string {
-	var result strings.Builder
-	for listName, list := range s[room] {
-		result.WriteString(fmt.Sprintf("📋 %s:\n", listName))
-		if len(list.Items) == 0 {
-			result.WriteString("   (empty)\n")
+func (s State) showAll(room string) *gofra.Formatted {
+	names := make([]string, 0, len(s[room]))
+	for listName := range s[room] {
+		names = append(names, listName)
+	}
+	sort.Strings(names)
+
+	result := gofra.NewFormatted()
+	for i, listName := range names {
+		if i > 0 {
+			result.Paragraph()
+		}
+
+		result.Paragraph(gofra.Plain("📋 "), gofra.Bold(listName), gofra.Plain(":"))
+		if list := s[room][listName]; len(list.Items) == 0 {
+			result.Paragraph(gofra.Italic("(empty)"))
 		} else {
-			for i, item := range list.Items {
-				result.WriteString(fmt.Sprintf("   %d. %s\n", i, item))
-			}
+			list.format(result)
 		}
-		result.WriteString("\n")
 	}
-	return strings.TrimSuffix(result.String(), "\n")
+	return result
 }
 
 func (s State) newList(room, listName string) {
@@ -77,10 +86,23 @@ func (l *List) markDone(id int) {
 	}
 }
 
-func (l *List) show() string {
-	var items strings.Builder
+func (l *List) show() *gofra.Formatted {
+	return l.format(gofra.NewFormatted())
+}
+
+// format adds the items to f, numbered by the IDs they are deleted with.
+func (l *List) format(f *gofra.Formatted) *gofra.Formatted {
+	if len(l.Items) == 0 {
+		return f
+	}
+
+	items := make([]gofra.Line, len(l.Items))
 	for i, item := range l.Items {
-		items.WriteString(fmt.Sprintf("%d. %s\n", i, item))
+		if done := strings.TrimPrefix(item, "✓ "); done != item {
+			items[i] = gofra.Line{gofra.Plain("✓ "), gofra.Strike(done)}
+		} else {
+			items[i] = gofra.Line{gofra.Plain(item)}
+		}
 	}
-	return items.String()
+	return f.OrderedList(0, items...)
 }
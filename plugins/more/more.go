@@ -0,0 +1,65 @@
+/*
+more is a gofra plugin that pages through long replies that were split and held back
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/XaviFP/gofra/internal"
+)
+
+var Plugin plugin
+
+type plugin struct {
+	g gofra.API
+}
+
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
+
+func (p *plugin) Name() string {
+	return "More"
+}
+
+func (p *plugin) Description() string {
+	return "Shows the rest of long replies"
+}
+
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+	commandChar := reply.GetAnswer()
+	return fmt.Sprintf("Usage: %smore\nSends the next part of the last reply that was too long to be sent at once", commandChar)
+}
+
+func (p *plugin) Init(c gofra.Config, gofra gofra.API) {
+	p.g = gofra
+
+	p.g.Subscribe(
+		"command/more",
+		p.Name(),
+		p.more,
+		0,
+	)
+}
+
+func (p *plugin) more(e gofra.Event) *gofra.Reply {
+	sent, err := p.g.SendMore(e.MB)
+	if err != nil {
+		p.g.Logger().Error(err.Error())
+
+		return nil
+	}
+
+	if sent {
+		return nil
+	}
+
+	if err := p.g.SendStanza(e.MB.Reply("Nothing more to show")); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+
+	return nil
+}
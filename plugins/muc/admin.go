@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+
+	"github.com/XaviFP/gofra/internal"
+)
+
+const (
+	nsAdmin      = "http://jabber.org/protocol/muc#admin"
+	nsOwner      = "http://jabber.org/protocol/muc#owner"
+	nsRoomConfig = "http://jabber.org/protocol/muc#roomconfig"
+)
+
+// adminTimeout bounds how long moderation requests wait for the room.
+const adminTimeout = 30 * time.Second
+
+var (
+	roles        = []string{"none", "visitor", "participant", "moderator"}
+	affiliations = []string{"none", "outcast", "member", "admin", "owner"}
+)
+
+type adminItem struct {
+	Nick        string `xml:"nick,attr,omitempty"`
+	JID         string `xml:"jid,attr,omitempty"`
+	Role        string `xml:"role,attr,omitempty"`
+	Affiliation string `xml:"affiliation,attr,omitempty"`
+	Reason      string `xml:"reason,omitempty"`
+}
+
+type adminQuery struct {
+	XMLName xml.Name    `xml:"http://jabber.org/protocol/muc#admin query"`
+	Items   []adminItem `xml:"item"`
+}
+
+type ownerQuery struct {
+	XMLName xml.Name `xml:"http://jabber.org/protocol/muc#owner query"`
+	Form    *gofra.XData
+}
+
+type subjectMessage struct {
+	stanza.Message
+	Subject string `xml:"subject"`
+}
+
+// subjectChange is a subject set by the bot, waiting for the room to
+// broadcast it or to answer with an error.
+type subjectChange struct {
+	room    string
+	subject string
+	result  chan error
+}
+
+// subjects tracks the subject changes waiting for the room, by message ID.
+type subjects struct {
+	mu      sync.Mutex
+	pending map[string]subjectChange
+}
+
+func (s *subjects) wait(id string, change subjectChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending[id] = change
+}
+
+func (s *subjects) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, id)
+}
+
+// HandleMessage completes the subject changes the room broadcast, or failed.
+// Rooms do not always keep the ID of the message, so broadcasts of the same
+// subject to the same room also complete them.
+func (s *subjects) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEncoder) error {
+	var m struct {
+		Subject string       `xml:"subject"`
+		Error   stanza.Error `xml:"error"`
+	}
+	if err := xml.NewTokenDecoder(t).Decode(&m); err != nil && err != io.EOF {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, change := range s.pending {
+		if id != msg.ID && (msg.Type == stanza.ErrorMessage || change.room != msg.From.Bare().String() || change.subject != m.Subject) {
+			continue
+		}
+
+		delete(s.pending, id)
+		if msg.Type == stanza.ErrorMessage {
+			change.result <- m.Error
+		} else {
+			change.result <- nil
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+func (s *subjects) muxOptions() []mux.Option {
+	return []mux.Option{
+		mux.Message(stanza.GroupChatMessage, xml.Name{Space: "jabber:client", Local: "subject"}, s),
+		mux.Message(stanza.ErrorMessage, xml.Name{Space: "jabber:client", Local: "error"}, s),
+	}
+}
+
+// Kick removes the occupant with the given nick from the room.
+func (p *plugin) Kick(room, nick, reason string) error {
+	return p.SetRole(room, nick, "none", reason)
+}
+
+// Ban bans the user with the given JID from the room.
+func (p *plugin) Ban(room, user, reason string) error {
+	return p.SetAffiliation(room, user, "outcast", reason)
+}
+
+// SetRole changes the role of the occupant with the given nick: "participant"
+// grants voice in moderated rooms and "visitor" revokes it.
+func (p *plugin) SetRole(room, nick, role, reason string) error {
+	if !contains(roles, role) {
+		return fmt.Errorf("unknown role %q, it must be one of %s", role, strings.Join(roles, ", "))
+	}
+
+	return p.admin(room, adminItem{Nick: nick, Role: role, Reason: reason})
+}
+
+// SetAffiliation changes the affiliation of the user with the given JID.
+func (p *plugin) SetAffiliation(room, user, affiliation, reason string) error {
+	if !contains(affiliations, affiliation) {
+		return fmt.Errorf("unknown affiliation %q, it must be one of %s", affiliation, strings.Join(affiliations, ", "))
+	}
+
+	j, err := jid.Parse(user)
+	if err != nil {
+		return err
+	}
+
+	return p.admin(room, adminItem{JID: j.Bare().String(), Affiliation: affiliation, Reason: reason})
+}
+
+func (p *plugin) admin(room string, item adminItem) error {
+	r, err := jid.Parse(room)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(p.g.Context(), adminTimeout)
+	defer cancel()
+
+	_, err = p.g.SendIQ(ctx, r.Bare(), stanza.SetIQ, adminQuery{Items: []adminItem{item}})
+
+	return err
+}
+
+// SetSubject changes the subject of the room, once the room broadcasts it.
+func (p *plugin) SetSubject(room, subject string) error {
+	r, err := jid.Parse(room)
+	if err != nil {
+		return err
+	}
+
+	id := fmt.Sprintf("subject-%d", time.Now().UnixNano())
+	result := make(chan error, 1)
+	p.subjects.wait(id, subjectChange{room: r.Bare().String(), subject: subject, result: result})
+	defer p.subjects.forget(id)
+
+	msg := subjectMessage{
+		Message: stanza.Message{ID: id, Type: stanza.GroupChatMessage, To: r.Bare()},
+		Subject: subject,
+	}
+	if err := p.g.SendStanza(msg); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(p.g.Context(), adminTimeout)
+	defer cancel()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RoomConfig returns the configuration form of the room.
+func (p *plugin) RoomConfig(room string) (*gofra.XData, error) {
+	r, err := jid.Parse(room)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(p.g.Context(), adminTimeout)
+	defer cancel()
+
+	response, err := p.g.SendIQ(ctx, r.Bare(), stanza.GetIQ, ownerQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	var q ownerQuery
+	if err := response.Decode(&q); err != nil {
+		return nil, err
+	}
+	if q.Form == nil {
+		return nil, errors.New("the room has no configuration form")
+	}
+
+	return q.Form, nil
+}
+
+// Configure changes the given fields of the room configuration, leaving the
+// others as they are.
+func (p *plugin) Configure(room string, fields map[string][]string) error {
+	form, err := p.RoomConfig(room)
+	if err != nil {
+		return err
+	}
+
+	submit := &gofra.XData{Type: "submit", Fields: []gofra.XDataField{
+		{Var: "FORM_TYPE", Type: "hidden", Values: []string{nsRoomConfig}},
+	}}
+	known := make(map[string]bool, len(form.Fields))
+	for _, field := range form.Fields {
+		known[field.Var] = true
+
+		values, ok := fields[field.Var]
+		if !ok || field.Var == "" || field.Var == "FORM_TYPE" {
+			continue
+		}
+
+		submit.Fields = append(submit.Fields, gofra.XDataField{Var: field.Var, Values: values})
+	}
+
+	for name := range fields {
+		if !known[name] {
+			return fmt.Errorf("the room has no %q setting", name)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(p.g.Context(), adminTimeout)
+	defer cancel()
+
+	_, err = p.g.SendIQ(ctx, jid.MustParse(room).Bare(), stanza.SetIQ, ownerQuery{Form: submit})
+
+	return err
+}
+
+// Moderation requests from other plugins. Every event answers with the error
+// of the request, nil if it succeeded.
+func (p *plugin) subscribeAdmin() {
+	requests := map[string]func(e gofra.Event) (interface{}, error){
+		"muc/kick": func(e gofra.Event) (interface{}, error) {
+			return nil, p.Kick(payload(e, "room"), payload(e, "nick"), payload(e, "reason"))
+		},
+		"muc/ban": func(e gofra.Event) (interface{}, error) {
+			return nil, p.Ban(payload(e, "room"), payload(e, "jid"), payload(e, "reason"))
+		},
+		"muc/setRole": func(e gofra.Event) (interface{}, error) {
+			return nil, p.SetRole(payload(e, "room"), payload(e, "nick"), payload(e, "role"), payload(e, "reason"))
+		},
+		"muc/setAffiliation": func(e gofra.Event) (interface{}, error) {
+			return nil, p.SetAffiliation(payload(e, "room"), payload(e, "jid"), payload(e, "affiliation"), payload(e, "reason"))
+		},
+		"muc/setSubject": func(e gofra.Event) (interface{}, error) {
+			return nil, p.SetSubject(payload(e, "room"), payload(e, "subject"))
+		},
+		"muc/getConfig": func(e gofra.Event) (interface{}, error) {
+			return p.RoomConfig(payload(e, "room"))
+		},
+		"muc/configure": func(e gofra.Event) (interface{}, error) {
+			fields, _ := e.Payload["fields"].(map[string][]string)
+
+			return nil, p.Configure(payload(e, "room"), fields)
+		},
+	}
+
+	for name, request := range requests {
+		request := request
+		p.g.Subscribe(name, p.Name(), func(e gofra.Event) *gofra.Reply {
+			result, err := request(e)
+
+			reply := &gofra.Reply{}
+			reply.SetError(err)
+			if form, ok := result.(*gofra.XData); ok && err == nil {
+				reply.Payload["form"] = form
+			}
+
+			return reply
+		}, 0)
+	}
+}
+
+func payload(e gofra.Event, key string) string {
+	value, _ := e.Payload[key].(string)
+
+	return value
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+const (
+	room  = "room@muc.example.com"
+	owner = "owner@example.com/phone"
+)
+
+// requests records the IQs sent by the bot to a room.
+type requests struct {
+	mu  sync.Mutex
+	iqs []gofratest.Stanza
+}
+
+func (r *requests) handler(response string, err error) gofratest.IQHandler {
+	return func(iq gofratest.Stanza) (string, error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.iqs = append(r.iqs, iq)
+
+		return response, err
+	}
+}
+
+func (r *requests) items(t *testing.T) []adminItem {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var items []adminItem
+	for _, iq := range r.iqs {
+		var q struct {
+			Query adminQuery
+		}
+		assert.NoError(t, iq.Decode(&q))
+		items = append(items, q.Query.Items...)
+	}
+
+	return items
+}
+
+// newHarness creates the room on the server only: moderation does not need
+// the bot to join it.
+func newHarness(t *testing.T) *gofratest.Harness {
+	h := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.Plugins = map[string]map[string]interface{}{
+			"MUC": {"owners": []interface{}{"owner@example.com"}},
+		}
+	}))
+	h.Server.AddRoom(room, "alice")
+
+	return h
+}
+
+func TestModeration_Events(t *testing.T) {
+	h := newHarness(t)
+	admin := &requests{}
+	h.Server.HandleIQTo(room, nsAdmin, "query", admin.handler("", nil))
+	h.Start(Plugin.NewInstance())
+
+	reply := h.Gofra.Publish(gofra.Event{Name: "muc/kick", Payload: map[string]interface{}{
+		"room": room, "nick": "alice", "reason": "Flooding",
+	}})
+	assert.NoError(t, reply.Err())
+
+	reply = h.Gofra.Publish(gofra.Event{Name: "muc/setAffiliation", Payload: map[string]interface{}{
+		"room": room, "jid": "bob@example.com/laptop", "affiliation": "member",
+	}})
+	assert.NoError(t, reply.Err())
+
+	reply = h.Gofra.Publish(gofra.Event{Name: "muc/setRole", Payload: map[string]interface{}{
+		"room": room, "nick": "alice", "role": "janitor",
+	}})
+	assert.Error(t, reply.Err())
+
+	assert.Equal(t, []adminItem{
+		{Nick: "alice", Role: "none", Reason: "Flooding"},
+		{JID: "bob@example.com", Affiliation: "member"},
+	}, admin.items(t))
+}
+
+func TestModeration_Error(t *testing.T) {
+	h := newHarness(t)
+	h.Server.HandleIQTo(room, nsAdmin, "query", (&requests{}).handler("", stanza.Error{Type: stanza.Auth, Condition: stanza.Forbidden}))
+	h.Start(Plugin.NewInstance())
+
+	reply := h.Gofra.Publish(gofra.Event{Name: "muc/ban", Payload: map[string]interface{}{
+		"room": room, "jid": "mallory@example.com",
+	}})
+
+	var stanzaErr stanza.Error
+	if assert.ErrorAs(t, reply.Err(), &stanzaErr) {
+		assert.Equal(t, stanza.Forbidden, stanzaErr.Condition)
+	}
+}
+
+func TestModeration_OwnerCommands(t *testing.T) {
+	h := newHarness(t)
+	admin := &requests{}
+	h.Server.HandleIQTo(room, nsAdmin, "query", admin.handler("", nil))
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	// Only owners are obeyed
+	h.Say("mallory@example.com/phone", "!kick "+room+" alice")
+	h.ExpectNoMessage("mallory@example.com/phone", 0)
+
+	id := h.Say(owner, "!kick "+room+" alice Flooding the room")
+	assert.Equal(t, []string{"✅"}, h.ExpectReaction(owner, id))
+
+	h.ExpectReaction(owner, h.Say(owner, "!devoice "+room+" bob"))
+
+	h.Say(owner, "!affiliation "+room+" bob@example.com")
+	h.ExpectMessage(owner, "^Usage: affiliation room@muc jid")
+
+	assert.Equal(t, []adminItem{
+		{Nick: "alice", Role: "none", Reason: "Flooding the room"},
+		{Nick: "bob", Role: "visitor"},
+	}, admin.items(t))
+}
+
+func TestModeration_NoOwners(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice"))
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	// The names of the commands are left to other plugins
+	for name := range ownerCommands {
+		assert.False(t, h.Gofra.HasSubscribers("command/"+name), name)
+	}
+}
+
+func TestModeration_Subject(t *testing.T) {
+	h := newHarness(t)
+	h.Server.Observe(func(st gofratest.Stanza) {
+		var m subjectMessage
+		if st.XMLName.Local != "message" || st.Decode(&m) != nil || m.Subject == "" {
+			return
+		}
+
+		if strings.Contains(m.Subject, "forbidden") {
+			h.Server.Send(`<message xmlns="jabber:client" type="error" id="` + m.ID + `" from="` + room + `" to="gofra@example.com/gofratest"><error type="auth"><forbidden xmlns="urn:ietf:params:xml:ns:xmpp-stanzas"/></error></message>`)
+			return
+		}
+
+		// Broadcast without the ID of the bot's message
+		h.Server.Send(`<message xmlns="jabber:client" type="groupchat" from="` + room + `/Gofra" to="gofra@example.com/gofratest"><subject>` + m.Subject + `</subject></message>`)
+	})
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	h.ExpectReaction(owner, h.Say(owner, "!subject "+room+" Weekly groceries"))
+
+	h.Say(owner, "!subject "+room+" Something forbidden")
+	h.ExpectMessage(owner, "^Could not subject in "+room+": forbidden$")
+}
+
+func TestModeration_Configure(t *testing.T) {
+	h := newHarness(t)
+	submitted := make(chan gofra.XData, 1)
+	h.Server.HandleIQTo(room, nsOwner, "query", func(iq gofratest.Stanza) (string, error) {
+		if iq.Attr("type") == string(stanza.SetIQ) {
+			var q struct {
+				Query ownerQuery
+			}
+			assert.NoError(t, iq.Decode(&q))
+			submitted <- *q.Query.Form
+
+			return "", nil
+		}
+
+		return `<query xmlns="` + nsOwner + `"><x xmlns="jabber:x:data" type="form">` +
+			`<field var="FORM_TYPE" type="hidden"><value>` + nsRoomConfig + `</value></field>` +
+			`<field var="muc#roomconfig_roomname" type="text-single" label="Name"><value>Room</value></field>` +
+			`<field var="muc#roomconfig_moderatedroom" type="boolean" label="Moderated"><value>0</value></field>` +
+			`</x></query>`, nil
+	})
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	h.Say(owner, "!configure "+room)
+	h.ExpectMessage(owner, `muc#roomconfig_roomname +Room +Name`)
+
+	h.ExpectReaction(owner, h.Say(owner, "!configure "+room+" muc#roomconfig_moderatedroom=1"))
+	form := <-submitted
+	assert.Equal(t, "submit", form.Type)
+	assert.Equal(t, []gofra.XDataField{
+		{Var: "FORM_TYPE", Type: "hidden", Values: []string{nsRoomConfig}},
+		{Var: "muc#roomconfig_moderatedroom", Values: []string{"1"}},
+	}, form.Fields)
+
+	h.Say(owner, "!configure "+room+" persistent=1")
+	h.ExpectMessage(owner, `the room has no "persistent" setting`)
+}
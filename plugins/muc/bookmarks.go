@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	"github.com/XaviFP/gofra/internal"
+)
+
+const nsBookmarks = "urn:xmpp:bookmarks:1"
+
+// bookmarksTimeout bounds the requests to the PEP service of the account.
+const bookmarksTimeout = 30 * time.Second
+
+// conference is the bookmark of a room (XEP-0402), with the JID of the room
+// as the ID of its PEP item.
+type conference struct {
+	XMLName  xml.Name `xml:"urn:xmpp:bookmarks:1 conference"`
+	Name     string   `xml:"name,attr,omitempty"`
+	Autojoin bool     `xml:"autojoin,attr"`
+	Nick     string   `xml:"nick,omitempty"`
+	Password string   `xml:"password,omitempty"`
+}
+
+// bookmarkOptions are the publish options of the bookmarks node, private to
+// the account.
+var bookmarkOptions = gofra.NodeConfig{
+	"pubsub#persist_items":            "true",
+	"pubsub#max_items":                "max",
+	"pubsub#send_last_published_item": "never",
+	"pubsub#access_model":             "whitelist",
+}
+
+// bookmarks keeps the rooms of the bot as PEP bookmarks of its account, so
+// other clients of the account share them, and follows the changes they
+// make.
+type bookmarks struct {
+	p *plugin
+
+	mu sync.Mutex
+	// Bookmarks known, by room
+	known map[string]conference
+	// Changes of the bookmarks to apply, one after the other in the order
+	// they were made
+	changes  []bookmarkChange
+	applying bool
+}
+
+// bookmarkChange is the bookmark of the room with the given ID, nil when it
+// was retracted.
+type bookmarkChange struct {
+	id string
+	c  *conference
+}
+
+func newBookmarks(p *plugin) *bookmarks {
+	return &bookmarks{p: p, known: make(map[string]conference)}
+}
+
+// sync fetches the bookmarks, adds the rooms of the bot missing from them
+// and joins the ones to join automatically.
+func (b *bookmarks) sync() {
+	items, err := b.fetch()
+	if err != nil {
+		b.p.g.Logger().Error(fmt.Sprintf("Error fetching the bookmarks, joining the known rooms: %v", err))
+
+		for _, mc := range b.p.rooms() {
+			b.p.joinMUC(mc)
+		}
+
+		return
+	}
+
+	for _, mc := range b.p.rooms() {
+		if _, bookmarked := items[mc.Jid]; bookmarked {
+			continue
+		}
+
+		if err := b.publish(mc, true); err != nil {
+			b.p.g.Logger().Error(fmt.Sprintf("Error bookmarking %s: %v", mc.Jid, err))
+		}
+		items[mc.Jid] = &conference{Autojoin: true, Nick: mc.Nick, Password: mc.Password}
+	}
+
+	for room, c := range items {
+		b.change(room, c)
+	}
+}
+
+// fetch returns the bookmarks, by room.
+func (b *bookmarks) fetch() (map[string]*conference, error) {
+	ctx, cancel := context.WithTimeout(b.p.g.Context(), bookmarksTimeout)
+	defer cancel()
+
+	items, err := b.p.g.PubSub().Items(ctx, jid.JID{}, nsBookmarks, 0)
+	var stanzaErr stanza.Error
+	if errors.As(err, &stanzaErr) && stanzaErr.Condition == stanza.ItemNotFound {
+		// Nothing bookmarked yet
+		return make(map[string]*conference), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks := make(map[string]*conference, len(items))
+	for _, item := range items {
+		var c conference
+		if err := item.Decode(&c); err != nil {
+			continue
+		}
+		bookmarks[item.ID] = &c
+	}
+
+	return bookmarks, nil
+}
+
+// publish bookmarks the room, keeping the name of its bookmark if any.
+func (b *bookmarks) publish(mc gofra.MUCConfig, autojoin bool) error {
+	b.mu.Lock()
+	c := b.known[mc.Jid]
+	c.Autojoin = autojoin
+	if mc.Nick != "" {
+		c.Nick = mc.Nick
+	}
+	if mc.Password != "" {
+		c.Password = mc.Password
+	}
+	b.known[mc.Jid] = c
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(b.p.g.Context(), bookmarksTimeout)
+	defer cancel()
+
+	_, err := b.p.g.PubSub().Publish(ctx, jid.JID{}, nsBookmarks, mc.Jid, c, bookmarkOptions)
+
+	return err
+}
+
+// handleItem follows the changes of the bookmarks made by other clients of
+// the account, on pubsub/item and pubsub/retract events.
+func (b *bookmarks) handleItem(e gofra.Event) *gofra.Reply {
+	// Only the PEP service of the account is trusted
+	if e.Payload["service"] != b.p.g.Account() || e.Payload["node"] != nsBookmarks {
+		return nil
+	}
+
+	room, _ := e.Payload["id"].(string)
+	item, ok := e.Payload["item"].(gofra.PubSubItem)
+	if !ok {
+		// Retracted
+		b.change(room, nil)
+
+		return nil
+	}
+
+	var c conference
+	if err := item.Decode(&c); err != nil {
+		return nil
+	}
+	b.change(room, &c)
+
+	return nil
+}
+
+// change queues the bookmark to be applied after the changes before it.
+func (b *bookmarks) change(id string, c *conference) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.changes = append(b.changes, bookmarkChange{id: id, c: c})
+	if b.applying {
+		return
+	}
+	b.applying = true
+
+	go b.applyChanges()
+}
+
+func (b *bookmarks) applyChanges() {
+	for {
+		b.mu.Lock()
+		if len(b.changes) == 0 {
+			b.applying = false
+			b.mu.Unlock()
+
+			return
+		}
+		change := b.changes[0]
+		b.changes = b.changes[1:]
+		b.mu.Unlock()
+
+		b.apply(change.id, change.c)
+	}
+}
+
+// apply joins the room of the bookmark if it is to be joined automatically,
+// and leaves it otherwise.
+func (b *bookmarks) apply(id string, c *conference) {
+	room, err := jid.Parse(id)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	if c != nil {
+		b.known[id] = *c
+	} else {
+		delete(b.known, id)
+	}
+	b.mu.Unlock()
+
+	if c == nil || !c.Autojoin {
+		if err := b.p.exit(room.String()); err != nil {
+			b.p.g.Logger().Error(fmt.Sprintf("Error leaving %s: %v", room, err))
+		}
+
+		return
+	}
+
+	mc := gofra.MUCConfig{Jid: room.String(), Nick: c.Nick, Password: c.Password}
+	if err := b.p.enter(mc); err != nil {
+		b.p.g.Logger().Error(fmt.Sprintf("Error joining %s: %v", room, err))
+	}
+}
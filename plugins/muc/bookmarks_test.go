@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/xml"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+// bookmark is a bookmark published to the PEP service.
+type bookmark struct {
+	ID         string      `xml:"id,attr"`
+	Conference *conference `xml:"urn:xmpp:bookmarks:1 conference"`
+}
+
+// pep is the PEP service of the account of the bot, with its bookmarks.
+type pep struct {
+	mu        sync.Mutex
+	items     string
+	published []bookmark
+}
+
+func (s *pep) handle(iq gofratest.Stanza) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if iq.Attr("type") == string(stanza.GetIQ) {
+		return `<pubsub xmlns="` + gofra.PubSubNS + `"><items node="` + nsBookmarks + `">` + s.items + `</items></pubsub>`, nil
+	}
+
+	var q struct {
+		Item bookmark `xml:"http://jabber.org/protocol/pubsub pubsub>publish>item"`
+	}
+	if err := iq.Decode(&q); err != nil {
+		return "", err
+	}
+	item := q.Item
+	if item.Conference != nil {
+		item.Conference.XMLName = xml.Name{}
+	}
+	s.published = append(s.published, item)
+
+	return "", nil
+}
+
+func (s *pep) bookmarks() []bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]bookmark{}, s.published...)
+}
+
+func bookmarksEventMessage(from, items string) string {
+	return `<message xmlns="jabber:client" type="headline" from="` + from + `" to="gofra@example.com/gofratest">` +
+		`<event xmlns="` + gofra.PubSubEventNS + `"><items node="` + nsBookmarks + `">` + items + `</items></event></message>`
+}
+
+func TestBookmarks(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice"), gofratest.WithConfig(func(c *gofra.Config) {
+		c.Plugins = map[string]map[string]interface{}{
+			"MUC": {"owners": []interface{}{"owner@example.com"}, "bookmarks": true},
+		}
+	}))
+	service := &pep{items: `<item id="` + lobby + `"><conference xmlns="` + nsBookmarks + `" name="Lobby" autojoin="true"><nick>Bot</nick></conference></item>` +
+		`<item id="closed@muc.example.com"><conference xmlns="` + nsBookmarks + `" autojoin="false"/></item>`}
+	h.Server.HandleIQ(gofra.PubSubNS, "pubsub", service.handle)
+	h.Server.AddRoom(lobby, "carol")
+	h.Server.AddRoom("new@muc.example.com")
+	p := Plugin.NewInstance().(*plugin)
+	h.Start(p, gofratest.Commands("!"))
+
+	// The configured room is bookmarked, and both are joined
+	h.ExpectPresence(lobby+"/Bot", "")
+	h.ExpectPresence(room+"/Gofra", "")
+	assert.Equal(t, []bookmark{{ID: room, Conference: &conference{Autojoin: true, Nick: "Gofra"}}}, service.bookmarks())
+
+	// Only notifications of the account are followed
+	h.Server.Send(bookmarksEventMessage("mallory@example.com", `<item id="spam@muc.example.com"><conference xmlns="`+nsBookmarks+`" autojoin="true"/></item>`))
+	h.Server.Send(bookmarksEventMessage("gofra@example.com", `<item id="new@muc.example.com"><conference xmlns="`+nsBookmarks+`" autojoin="true"><nick>N</nick></conference></item>`))
+	h.ExpectPresence("new@muc.example.com/N", "")
+	assert.False(t, p.joined("spam@muc.example.com"))
+
+	h.Server.Send(bookmarksEventMessage("gofra@example.com", `<retract id="`+lobby+`"/>`))
+	h.ExpectPresence(lobby+"/Bot", stanza.UnavailablePresence)
+
+	// Rooms left stay bookmarked, but are no longer joined automatically
+	h.ExpectReaction(owner, h.Say(owner, "!leave "+room))
+	bookmarks := service.bookmarks()
+	assert.Equal(t, bookmark{ID: room, Conference: &conference{Autojoin: false, Nick: "Gofra"}}, bookmarks[len(bookmarks)-1])
+}
+
+func TestBookmarks_InOrder(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.Plugins = map[string]map[string]interface{}{
+			"MUC": {"bookmarks": true},
+		}
+	}))
+	h.Server.HandleIQ(gofra.PubSubNS, "pubsub", (&pep{}).handle)
+	h.Server.AddRoom(lobby, "carol")
+	p := Plugin.NewInstance().(*plugin)
+	h.Start(p)
+
+	// A room bookmarked and retracted right away is left once joined
+	h.Server.Send(bookmarksEventMessage("gofra@example.com", `<item id="`+lobby+`"><conference xmlns="`+nsBookmarks+`" autojoin="true"/></item>`))
+	h.Server.Send(bookmarksEventMessage("gofra@example.com", `<retract id="`+lobby+`"/>`))
+
+	h.ExpectPresence(lobby+"/Gofra", "")
+	h.ExpectPresence(lobby+"/Gofra", stanza.UnavailablePresence)
+	assert.False(t, p.joined(lobby))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	"github.com/XaviFP/gofra/internal"
+)
+
+const seenFile = "seen.json"
+
+const (
+	// catchUpPage is how many archived messages are asked for at once.
+	catchUpPage = 50
+	// catchUpTimeout bounds every query to the archive of a room.
+	catchUpTimeout = time.Minute
+	// catchUpFlush is how often the last messages seen are saved.
+	catchUpFlush = time.Minute
+)
+
+// catchUp replays the messages of the rooms configured with mucCatchUp that
+// were sent while the bot was out of them, from their archives (XEP-0313), so
+// that the commands and mentions it missed are handled.
+type catchUp struct {
+	p *plugin
+
+	mu sync.Mutex
+	// Archive ID of the last message seen live, by room
+	seen map[string]string
+	// Set when seen changed since it was last saved
+	dirty bool
+}
+
+func newCatchUp(p *plugin) *catchUp {
+	return &catchUp{p: p, seen: make(map[string]string)}
+}
+
+// enabled reports whether the room, among the ones the bot stays in, is set
+// to be caught up on.
+func (c *catchUp) enabled(room string) bool {
+	mc, ok := c.p.room(room)
+
+	return ok && mc.CatchUp
+}
+
+// since returns the archive ID of the last message seen in the room, empty if
+// none was.
+func (c *catchUp) since(room string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.seen[room]
+}
+
+// record keeps the archive ID, given by the room as the stanza ID of its
+// messages, of the last message received live from a room caught up on.
+func (c *catchUp) record(e gofra.Event) *gofra.Reply {
+	if e.MB.Type != stanza.GroupChatMessage || e.IsHistory || e.MB.StanzaID == nil {
+		return nil
+	}
+	if archived, _ := e.Payload["archived"].(bool); archived {
+		return nil
+	}
+
+	room := e.MB.From.Bare().String()
+	if e.MB.StanzaID.By != room || !c.enabled(room) {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen[room] == e.MB.StanzaID.ID {
+		return nil
+	}
+	c.seen[room] = e.MB.StanzaID.ID
+	c.dirty = true
+
+	return nil
+}
+
+// run publishes the messages archived by the room after the one with the
+// since ID and before until, as messageReceived events with the "archived"
+// payload set, then a muc/caughtUp event. Nothing is known to be missed from
+// a room never seen before.
+func (c *catchUp) run(room, since string, until time.Time) {
+	if since == "" {
+		return
+	}
+
+	archive, err := jid.Parse(room)
+	if err != nil {
+		return
+	}
+
+	q := gofra.ArchiveQuery{After: since, End: until, Max: catchUpPage}
+	replayed := 0
+	for {
+		ctx, cancel := context.WithTimeout(c.p.g.Context(), catchUpTimeout)
+		page, err := c.p.g.QueryArchive(ctx, archive, q)
+		cancel()
+		if err != nil {
+			c.p.g.Logger().Error(fmt.Sprintf("Error catching up on %s: %v", room, err))
+
+			return
+		}
+
+		for _, m := range page.Messages {
+			if m.MB.Body == "" || c.p.isSelf(m.MB.From) {
+				continue
+			}
+
+			e := gofra.Event{Name: "messageReceived", MB: m.MB, Payload: map[string]interface{}{"archived": true}}
+			e.SetStanza(m.MB)
+			c.p.g.Publish(e)
+			replayed++
+		}
+
+		if page.Complete || page.Last == "" || page.Last == q.After {
+			break
+		}
+		q.After = page.Last
+	}
+
+	c.p.events.push(gofra.Event{Name: "muc/caughtUp", Payload: map[string]interface{}{
+		"roomJid":  room,
+		"messages": replayed,
+	}})
+}
+
+// flushEvery saves the last messages seen every interval, rather than on
+// every message, and once more when the engine stops.
+func (c *catchUp) flushEvery(interval time.Duration) {
+	for {
+		select {
+		case <-c.p.g.Clock().After(interval):
+			c.flush()
+		case <-c.p.g.Context().Done():
+			c.flush()
+
+			return
+		}
+	}
+}
+
+// flush saves the last messages seen if they changed.
+func (c *catchUp) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return
+	}
+	c.dirty = false
+	c.persist()
+}
+
+func (c *catchUp) persist() {
+	serialized, err := json.MarshalIndent(c.seen, "", " ")
+	if err != nil {
+		c.p.g.Logger().Error(err.Error())
+		return
+	}
+
+	if err := os.MkdirAll(c.p.config.DataDir, 0o755); err != nil {
+		c.p.g.Logger().Error(err.Error())
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(c.p.config.DataDir, seenFile), serialized, 0o600); err != nil {
+		c.p.g.Logger().Error(err.Error())
+	}
+}
+
+func (c *catchUp) load() {
+	serialized, err := os.ReadFile(filepath.Join(c.p.config.DataDir, seenFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		c.p.g.Logger().Error(err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := json.Unmarshal(serialized, &c.seen); err != nil {
+		c.p.g.Logger().Error(err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func withCatchUp(dataDir string) gofratest.Option {
+	return gofratest.WithConfig(func(c *gofra.Config) {
+		if dataDir != "" {
+			c.DataDir = dataDir
+		}
+		c.MUCs = []gofra.MUCConfig{{Jid: room, Nick: "Gofra", CatchUp: true}}
+	})
+}
+
+func archived(queryID, id, nick, body string) string {
+	return `<message xmlns="jabber:client" from="` + room + `" to="gofra@example.com/gofratest">` +
+		`<result xmlns="urn:xmpp:mam:2" queryid="` + queryID + `" id="` + id + `"><forwarded xmlns="urn:xmpp:forward:0">` +
+		`<delay xmlns="urn:xmpp:delay" stamp="2024-01-02T15:04:05Z"/>` +
+		`<message xmlns="jabber:client" type="groupchat" from="` + room + `/` + nick + `"><body>` + body + `</body></message>` +
+		`</forwarded></result></message>`
+}
+
+func TestCatchUp(t *testing.T) {
+	clock := gofratest.NewFakeClock(time.Date(2024, 1, 2, 16, 0, 0, 0, time.UTC))
+	h := gofratest.New(t, withCatchUp(""), gofratest.WithClock(clock))
+	h.Server.AddRoom(room, "alice")
+	p := Plugin.NewInstance().(*plugin)
+	h.Start(p, gofratest.Commands("!"))
+	h.ExpectPresence(room+"/Gofra", "")
+
+	// The last message seen is remembered, and saved every minute rather
+	// than on every message
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" id="m1" from="` + room + `/alice" to="gofra@example.com/gofratest">` +
+		`<body>hi</body><stanza-id xmlns="urn:xmpp:sid:0" id="s1" by="` + room + `"/></message>`)
+	assert.Eventually(t, func() bool { return p.catchUp.since(room) == "s1" }, time.Second, 10*time.Millisecond)
+
+	seen := filepath.Join(h.Config.DataDir, seenFile)
+	_, err := os.Stat(seen)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Eventually(t, func() bool {
+		clock.Advance(catchUpFlush)
+		_, err := os.Stat(seen)
+
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// Once back, the messages archived since are replayed
+	restarted := gofratest.New(t, withCatchUp(h.Config.DataDir))
+	restarted.Server.AddRoom(room, "alice")
+	var iq struct {
+		Query struct {
+			QueryID string `xml:"queryid,attr"`
+			After   string `xml:"set>after"`
+		} `xml:"urn:xmpp:mam:2 query"`
+	}
+	restarted.Server.HandleIQTo(room, gofra.MAMNS, "query", func(st gofratest.Stanza) (string, error) {
+		if err := st.Decode(&iq); err != nil {
+			return "", err
+		}
+
+		restarted.Server.Send(archived(iq.Query.QueryID, "s2", "alice", "!ping"))
+		restarted.Server.Send(archived(iq.Query.QueryID, "s3", "Gofra", "!ping"))
+
+		return `<fin xmlns="urn:xmpp:mam:2" complete="true"><set xmlns="http://jabber.org/protocol/rsm"><first>s2</first><last>s3</last></set></fin>`, nil
+	})
+	r := gofratest.NewRecorder("command/ping", "muc/caughtUp")
+	restarted.Start(Plugin.NewInstance(), gofratest.Commands("!"), r)
+
+	e := r.Next(t)
+	assert.Equal(t, "command/ping", e.Name)
+	assert.Equal(t, room+"/alice", e.MB.From.String())
+	assert.Equal(t, true, e.Payload["archived"])
+	assert.Equal(t, "s1", iq.Query.After)
+
+	// The echoes of the bot are not
+	e = r.Next(t)
+	assert.Equal(t, "muc/caughtUp", e.Name)
+	assert.Equal(t, 1, e.Payload["messages"])
+}
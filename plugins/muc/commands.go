@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	"github.com/XaviFP/gofra/internal"
+)
+
+// ownerCommand is a command the owners of the bot can send it in a chat
+// message, with the room it applies to as the first argument.
+type ownerCommand struct {
+	usage string
+	// Arguments needed, the room included
+	args int
+}
+
+var ownerCommands = map[string]ownerCommand{
+	"kick":        {"kick room@muc nick [reason]", 2},
+	"ban":         {"ban room@muc jid [reason]", 2},
+	"voice":       {"voice room@muc nick", 2},
+	"devoice":     {"devoice room@muc nick", 2},
+	"affiliation": {"affiliation room@muc jid none|outcast|member|admin|owner [reason]", 3},
+	"subject":     {"subject room@muc subject", 2},
+	"configure":   {"configure room@muc [setting=value…]", 1},
+	"join":        {"join room@muc [nick] [password]", 1},
+	"leave":       {"leave room@muc", 1},
+}
+
+func (p *plugin) checkConfig(config gofra.Config) {
+	if config.Roster.Owner != "" {
+		p.owners = append(p.owners, config.Roster.Owner)
+	}
+
+	pluginConfig := config.Plugins[p.Name()]
+	p.owners = append(p.owners, stringList(pluginConfig["owners"])...)
+
+	if enabled, _ := pluginConfig["bookmarks"].(bool); enabled {
+		p.bookmarks = newBookmarks(p)
+	}
+
+	p.invitations, _ = pluginConfig["invitations"].(string)
+	p.inviters = stringList(pluginConfig["inviters"])
+	switch p.invitations {
+	case "", invitationsAccept, invitationsAllowlist:
+	default:
+		p.g.Logger().Warn(fmt.Sprintf("Unknown invitations policy %q, invitations are ignored", p.invitations))
+	}
+}
+
+// stringList returns the strings in a list of the configuration.
+func stringList(value interface{}) []string {
+	values, _ := value.([]interface{})
+
+	var s []string
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			s = append(s, str)
+		}
+	}
+
+	return s
+}
+
+// subscribeCommands handles the owner commands, leaving their names to other
+// plugins when there is no owner to send them.
+func (p *plugin) subscribeCommands() {
+	if len(p.owners) == 0 {
+		return
+	}
+
+	for name := range ownerCommands {
+		p.g.Subscribe("command/"+name, p.Name(), p.handleCommand, 0)
+	}
+}
+
+func (p *plugin) isOwner(mb gofra.MessageBody) bool {
+	return mb.Type == stanza.ChatMessage && p.isOwnerJID(mb.From)
+}
+
+func (p *plugin) isOwnerJID(j jid.JID) bool {
+	for _, owner := range p.owners {
+		if strings.EqualFold(owner, j.Bare().String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *plugin) handleCommand(e gofra.Event) *gofra.Reply {
+	if !p.isOwner(e.MB) {
+		return nil
+	}
+
+	fields := strings.Fields(e.MB.Body)
+	command, args := fields[0][1:], fields[1:]
+
+	usage := "Usage: " + ownerCommands[command].usage
+	if len(args) < ownerCommands[command].args {
+		p.reply(e, usage)
+
+		return nil
+	}
+
+	room := args[0]
+	reason := func(from int) string {
+		if len(args) <= from {
+			return ""
+		}
+
+		return strings.Join(args[from:], " ")
+	}
+
+	var err error
+	switch command {
+	case "kick":
+		err = p.Kick(room, args[1], reason(2))
+	case "ban":
+		err = p.Ban(room, args[1], reason(2))
+	case "voice":
+		err = p.SetRole(room, args[1], "participant", "")
+	case "devoice":
+		err = p.SetRole(room, args[1], "visitor", "")
+	case "affiliation":
+		err = p.SetAffiliation(room, args[1], args[2], reason(3))
+	case "subject":
+		err = p.SetSubject(room, reason(1))
+	case "configure":
+		if len(args) == 1 {
+			p.showConfig(e, room)
+
+			return nil
+		}
+
+		settings := make(map[string][]string)
+		for _, arg := range args[1:] {
+			name, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				p.reply(e, usage)
+
+				return nil
+			}
+			settings[name] = append(settings[name], value)
+		}
+		err = p.Configure(room, settings)
+	case "join":
+		mc := gofra.MUCConfig{Jid: room}
+		if len(args) > 1 {
+			mc.Nick = args[1]
+		}
+		if len(args) > 2 {
+			mc.Password = args[2]
+		}
+		err = p.Join(mc)
+	case "leave":
+		err = p.Leave(room)
+	}
+
+	if err != nil {
+		p.reply(e, fmt.Sprintf("Could not %s in %s: %v", command, room, err))
+
+		return nil
+	}
+
+	if err := p.g.React(e.MB, "✅"); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+
+	return nil
+}
+
+// showConfig answers with the settings of the room and their values.
+func (p *plugin) showConfig(e gofra.Event, room string) {
+	form, err := p.RoomConfig(room)
+	if err != nil {
+		p.reply(e, fmt.Sprintf("Could not get the configuration of %s: %v", room, err))
+
+		return
+	}
+
+	var rows [][]string
+	for _, field := range form.Fields {
+		if field.Var == "" || field.Type == "hidden" {
+			continue
+		}
+
+		rows = append(rows, []string{field.Var, strings.Join(field.Values, ", "), field.Label})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+
+	f := gofra.NewFormatted().
+		Paragraph(gofra.Plain("Settings of "), gofra.Bold(room)).
+		Table([]string{"Setting", "Value", "Description"}, rows...)
+
+	if err := p.g.SendStanza(e.MB.FormattedReply(f)); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+}
+
+func (p *plugin) reply(e gofra.Event, body string) {
+	if err := p.g.SendStanza(e.MB.Reply(body)); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"mellium.im/xmlstream"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/muc"
+	"mellium.im/xmpp/mux"
+	"mellium.im/xmpp/stanza"
+
+	"github.com/XaviFP/gofra/internal"
+)
+
+const nsConference = "jabber:x:conference"
+
+// Policies for the invitations to rooms. Direct invitations of owners are
+// always obeyed, and other invitations are ignored without a policy.
+const (
+	invitationsAccept    = "accept"
+	invitationsAllowlist = "allowlist"
+)
+
+// invitationMessage is a mediated (XEP-0045) or direct (XEP-0249) invitation.
+type invitationMessage struct {
+	User struct {
+		Invite *struct {
+			From   string `xml:"from,attr"`
+			Reason string `xml:"reason"`
+		} `xml:"invite"`
+		Password string `xml:"password"`
+	} `xml:"http://jabber.org/protocol/muc#user x"`
+	Conference *struct {
+		JID      string `xml:"jid,attr"`
+		Password string `xml:"password,attr"`
+		Reason   string `xml:"reason,attr"`
+	} `xml:"jabber:x:conference x"`
+}
+
+// declineMessage declines a mediated invitation, through the room.
+type declineMessage struct {
+	stanza.Message
+	X struct {
+		Decline struct {
+			To     string `xml:"to,attr"`
+			Reason string `xml:"reason,omitempty"`
+		} `xml:"decline"`
+	} `xml:"http://jabber.org/protocol/muc#user x"`
+}
+
+// invitation is an invitation of inviter to a room.
+type invitation struct {
+	room     jid.JID
+	inviter  jid.JID
+	password string
+	reason   string
+	mediated bool
+}
+
+// invitations handles the invitations the bot receives.
+type invitations struct {
+	p *plugin
+}
+
+func (i invitations) muxOptions() []mux.Option {
+	user := xml.Name{Space: muc.NSUser, Local: "x"}
+	conference := xml.Name{Space: nsConference, Local: "x"}
+
+	return []mux.Option{
+		mux.Message(stanza.NormalMessage, user, i),
+		mux.Message(stanza.NormalMessage, conference, i),
+		mux.Message(stanza.ChatMessage, conference, i),
+	}
+}
+
+func (i invitations) HandleMessage(msg stanza.Message, t xmlstream.TokenReadEncoder) error {
+	var m invitationMessage
+	if err := xml.NewTokenDecoder(t).Decode(&m); err != nil && err != io.EOF {
+		return nil
+	}
+
+	var inv invitation
+	switch {
+	case m.User.Invite != nil:
+		inviter, err := jid.Parse(m.User.Invite.From)
+		if err != nil {
+			return nil
+		}
+
+		inv = invitation{
+			room:     msg.From.Bare(),
+			inviter:  inviter,
+			password: m.User.Password,
+			reason:   m.User.Invite.Reason,
+			mediated: true,
+		}
+	case m.Conference != nil:
+		room, err := jid.Parse(m.Conference.JID)
+		if err != nil {
+			return nil
+		}
+
+		inv = invitation{
+			room:     room.Bare(),
+			inviter:  msg.From,
+			password: m.Conference.Password,
+			reason:   m.Conference.Reason,
+		}
+	default:
+		return nil
+	}
+
+	go i.p.handleInvitation(inv)
+
+	return nil
+}
+
+// handleInvitation joins the room if the policy allows it, and declines
+// mediated invitations otherwise.
+func (p *plugin) handleInvitation(inv invitation) {
+	accepted := p.acceptsInvitation(inv)
+
+	p.events.push(gofra.Event{Name: "muc/invitation", Payload: map[string]interface{}{
+		"room":     inv.room.String(),
+		"from":     inv.inviter.Bare().String(),
+		"reason":   inv.reason,
+		"accepted": accepted,
+	}})
+
+	if !accepted {
+		p.g.Logger().Info(fmt.Sprintf("Ignoring the invitation of %s to %s", inv.inviter, inv.room))
+
+		if inv.mediated {
+			p.decline(inv)
+		}
+
+		return
+	}
+
+	mc := gofra.MUCConfig{Jid: inv.room.String(), Password: inv.password}
+	if err := p.Join(mc); err != nil {
+		p.g.Logger().Error(fmt.Sprintf("error joining %s on the invitation of %s: %v", inv.room, inv.inviter, err))
+	}
+}
+
+// acceptsInvitation reports whether the policy allows joining the room. The
+// inviter of mediated invitations is whatever the room claims, so only the
+// room is trusted for them and owners are obeyed on direct invitations only.
+func (p *plugin) acceptsInvitation(inv invitation) bool {
+	trusted := []jid.JID{inv.room}
+	if !inv.mediated {
+		if p.isOwnerJID(inv.inviter) {
+			return true
+		}
+
+		trusted = append(trusted, inv.inviter.Bare())
+	}
+
+	switch p.invitations {
+	case invitationsAccept:
+		return true
+	case invitationsAllowlist:
+		for _, allowed := range p.inviters {
+			for _, j := range trusted {
+				if strings.EqualFold(allowed, j.String()) || strings.EqualFold(allowed, j.Domainpart()) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *plugin) decline(inv invitation) {
+	msg := declineMessage{Message: stanza.Message{To: inv.room}}
+	msg.X.Decline.To = inv.inviter.Bare().String()
+	msg.X.Decline.Reason = "Sorry, I can't join this room"
+
+	if err := p.g.SendStanza(msg); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+const lobby = "lobby@muc.example.com"
+
+func withInvitations(policy string, inviters ...interface{}) gofratest.Option {
+	return gofratest.WithConfig(func(c *gofra.Config) {
+		c.Plugins = map[string]map[string]interface{}{
+			"MUC": {
+				"owners":      []interface{}{"owner@example.com"},
+				"invitations": policy,
+				"inviters":    inviters,
+			},
+		}
+	})
+}
+
+func TestInvitations_Direct(t *testing.T) {
+	h := gofratest.New(t, withInvitations(invitationsAllowlist, "example.org"))
+	h.Server.AddRoom(lobby, "carol")
+	r := gofratest.NewRecorder("muc/invitation", "muc/joinedRoom")
+	h.Start(Plugin.NewInstance(), r)
+
+	h.Server.Send(`<message xmlns="jabber:client" from="alice@example.org/phone" to="gofra@example.com/gofratest">` +
+		`<x xmlns="jabber:x:conference" jid="` + lobby + `" reason="Join us"/></message>`)
+
+	e := r.Next(t)
+	assert.Equal(t, "muc/invitation", e.Name)
+	assert.Equal(t, "alice@example.org", e.Payload["from"])
+	assert.Equal(t, "Join us", e.Payload["reason"])
+	assert.Equal(t, true, e.Payload["accepted"])
+	assert.Equal(t, lobby, r.Next(t).Payload["roomJid"])
+
+	// The room is joined again after a restart
+	restarted := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.DataDir = h.Config.DataDir
+	}))
+	restarted.Server.AddRoom(lobby, "carol")
+	restarted.Start(Plugin.NewInstance())
+	restarted.ExpectPresence(lobby+"/Gofra", "")
+}
+
+func TestInvitations_Declined(t *testing.T) {
+	h := gofratest.New(t, withInvitations(invitationsAllowlist, "example.org"))
+	r := gofratest.NewRecorder("muc/invitation")
+	h.Start(Plugin.NewInstance(), r)
+
+	h.Server.Send(`<message xmlns="jabber:client" from="secret@muc.example.com" to="gofra@example.com/gofratest">` +
+		`<x xmlns="http://jabber.org/protocol/muc#user"><invite from="mallory@example.com/laptop"/></x></message>`)
+
+	e := r.Next(t)
+	assert.Equal(t, "secret@muc.example.com", e.Payload["room"])
+	assert.Equal(t, false, e.Payload["accepted"])
+
+	st := h.ExpectStanza("declined invitation", func(st gofratest.Stanza) bool {
+		return st.XMLName.Local == "message" && st.Attr("to") == "secret@muc.example.com"
+	})
+	assert.Contains(t, st.Inner, `<decline to="mallory@example.com">`)
+}
+
+func TestInvitations_Owner(t *testing.T) {
+	h := gofratest.New(t, withInvitations(""))
+	h.Server.AddRoom(lobby, "carol")
+	r := gofratest.NewRecorder("muc/invitation", "muc/joinedRoom")
+	h.Start(Plugin.NewInstance(), r)
+
+	// Owners are obeyed without a policy
+	h.Server.Send(`<message xmlns="jabber:client" from="owner@example.com/phone" to="gofra@example.com/gofratest">` +
+		`<x xmlns="jabber:x:conference" jid="` + lobby + `" password="1234"/></message>`)
+	assert.Equal(t, true, r.Next(t).Payload["accepted"])
+
+	st := h.ExpectPresence(lobby+"/Gofra", "")
+	assert.Contains(t, st.Inner, "<password>1234</password>")
+}
+
+func TestInvitations_ForgedMediated(t *testing.T) {
+	h := gofratest.New(t, withInvitations(invitationsAllowlist, "example.org"))
+	r := gofratest.NewRecorder("muc/invitation")
+	h.Start(Plugin.NewInstance(), r)
+
+	// Anyone can claim to relay an invitation of an owner, or of an allowed
+	// inviter
+	for _, from := range []string{"owner@example.com/phone", "alice@example.org/phone"} {
+		h.Server.Send(`<message xmlns="jabber:client" from="mallory@evil.example" to="gofra@example.com/gofratest">` +
+			`<x xmlns="http://jabber.org/protocol/muc#user"><invite from="` + from + `"/></x></message>`)
+
+		e := r.Next(t)
+		assert.Equal(t, "mallory@evil.example", e.Payload["room"])
+		assert.Equal(t, false, e.Payload["accepted"], "invitation of %s", from)
+	}
+
+	for _, st := range h.Server.Sent() {
+		assert.False(t, st.XMLName.Local == "presence" && strings.HasPrefix(st.Attr("to"), "mallory@evil.example"), "unexpected %s", st)
+	}
+}
+
+func TestRooms_JoinAndLeave(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice"), withInvitations(""), gofratest.WithUpload(1024))
+	h.Server.AddRoom(lobby, "carol")
+	p := Plugin.NewInstance().(*plugin)
+	h.Start(p, gofratest.Commands("!"))
+
+	h.ExpectReaction(owner, h.Say(owner, "!join "+lobby+" Bot"))
+	bot, ok := p.Occupant(lobby, "Bot")
+	assert.True(t, ok)
+	assert.True(t, bot.Self)
+
+	// Files go to the rooms the bot is in as groupchat messages only
+	assert.NoError(t, h.Gofra.SendFile(lobby, "chart.png", strings.NewReader("png"), "image/png"))
+	assert.Equal(t, stanza.GroupChatMessage, h.ExpectMessage(lobby, "chart.png$").Type)
+
+	h.ExpectReaction(owner, h.Say(owner, "!leave "+room))
+	h.ExpectPresence(room+"/Gofra", stanza.UnavailablePresence)
+	assert.Empty(t, p.Occupants(room))
+
+	assert.NoError(t, h.Gofra.SendFile(room, "chart.png", strings.NewReader("png"), "image/png"))
+	assert.Equal(t, stanza.ChatMessage, h.ExpectMessage(room, "chart.png$").Type)
+
+	h.Say(owner, "!leave "+room)
+	h.ExpectMessage(owner, "^Could not leave in "+room+": not in "+room+"$")
+
+	// The configured room left is not joined again after a restart, the
+	// other one is
+	restarted := gofratest.New(t, gofratest.WithRoom(room, "alice"), gofratest.WithConfig(func(c *gofra.Config) {
+		c.DataDir = h.Config.DataDir
+	}))
+	p = Plugin.NewInstance().(*plugin)
+	restarted.Start(p)
+
+	assert.Equal(t, []gofra.MUCConfig{{Jid: lobby, Nick: "Bot"}}, p.rooms())
+}
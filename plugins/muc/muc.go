@@ -1,14 +1,28 @@
 /*
-muc is a gofra plugin that allows joining muti-user chatrooms and keeps track of them
+muc is a gofra plugin that allows joining muti-user chatrooms and keeps track of them.
+Besides the configured rooms, it joins the ones it is invited to, as its policy
+allows, and keeps them across restarts.
+It also moderates them on behalf of other plugins, through muc/* events, and of
+the owners of the bot, through commands.
 */
 
 package main
 
 import (
+	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"mellium.im/xmlstream"
 	"mellium.im/xmpp/jid"
 	"mellium.im/xmpp/muc"
+	"mellium.im/xmpp/mux"
 	"mellium.im/xmpp/stanza"
 
 	"github.com/XaviFP/gofra/internal"
@@ -16,225 +30,455 @@ import (
 
 var Plugin plugin
 
-type plugin struct{}
+// joinTimeout bounds how long joining a room waits for it to answer.
+const joinTimeout = 30 * time.Second
+
+type plugin struct {
+	g      gofra.API
+	config gofra.Config
+	owners []string
+	// Policy for invitations, and the JIDs and domains of the inviters and
+	// rooms allowed by the allowlist
+	invitations string
+	inviters    []string
+	// Set when the rooms are kept as bookmarks of the account
+	bookmarks *bookmarks
+
+	mu sync.Mutex
+	// Occupant JID of the bot in every room it joined, or is joining
+	mucs  map[string]jid.JID
+	state roomState
+
+	joins     *joins
+	occupants *occupantStore
+	events    *eventQueue
+	subjects  *subjects
+	catchUp   *catchUp
+}
 
-var g *gofra.Gofra
-var config gofra.Config
-var mucs = make(map[string]jid.JID)
-var client = &muc.Client{}
-var occupants = make(map[string][]string)
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{
+		mucs:      make(map[string]jid.JID),
+		joins:     &joins{pending: make(map[string]chan error)},
+		occupants: newOccupantStore(),
+		events:    &eventQueue{},
+		subjects:  &subjects{pending: make(map[string]subjectChange)},
+	}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "MUC"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Handles multi user chat rooms"
 }
 
-func (p plugin) Help() string {
-	return "MUC is a meta-plugin and does not expose user-triggered interaction"
+func (p *plugin) Help() string {
+	if len(p.owners) == 0 {
+		return "MUC joins the configured rooms"
+	}
+
+	commands := make([]string, 0, len(ownerCommands))
+	for _, command := range ownerCommands {
+		commands = append(commands, command.usage)
+	}
+	sort.Strings(commands)
+
+	return "MUC joins the configured rooms, and the ones its owners invite it to. They can manage them with: " + strings.Join(commands, "; ")
 }
 
-func (p plugin) Init(conf gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
-	config = conf
-	prepareMUCs()
-	g.Subscribe(
+func (p *plugin) Init(conf gofra.Config, gofra gofra.API) {
+	p.g = gofra
+	p.config = conf
+	p.events.publish = p.g.Publish
+	p.checkConfig(conf)
+	p.loadRooms()
+	p.catchUp = newCatchUp(p)
+	p.catchUp.load()
+	go p.catchUp.flushEvery(catchUpFlush)
+	p.subscribeAdmin()
+	p.subscribeCommands()
+	p.g.Subscribe(
 		"connected",
 		p.Name(),
-		joinMUCs,
+		p.joinMUCs,
 		0,
 	)
-	g.Subscribe(
-		"presenceReceived",
+	p.g.Subscribe(
+		"muc/getOccupants",
 		p.Name(),
-		handlePresence,
+		p.getOccupants,
 		0,
 	)
-	g.Subscribe(
-		"muc/getOccupants",
+	p.g.Subscribe(
+		"muc/getOccupant",
 		p.Name(),
-		getOccupants,
+		p.getOccupant,
 		0,
 	)
-	g.AddMuxOption(muc.HandleClient(client))
-}
+	p.g.Subscribe(
+		"disconnected",
+		p.Name(),
+		p.handleDisconnected,
+		0,
+	)
+	p.g.Subscribe(
+		"messageReceived",
+		p.Name(),
+		p.catchUp.record,
+		0,
+	)
+	if p.config.Keepalive.MUCSelfPing {
+		p.g.Subscribe(
+			"keepalive",
+			p.Name(),
+			p.handleKeepalive,
+			0,
+		)
+	}
+	p.g.AddMuxOptions([]mux.Option{
+		mux.Presence(stanza.AvailablePresence, xml.Name{Space: muc.NSUser, Local: "x"}, p),
+		mux.Presence(stanza.UnavailablePresence, xml.Name{Space: muc.NSUser, Local: "x"}, p),
+		mux.Presence(stanza.ErrorPresence, xml.Name{Space: "jabber:client", Local: "error"}, p),
+	})
+	p.g.AddMuxOptions(p.subjects.muxOptions())
+	p.g.AddMuxOptions(invitations{p: p}.muxOptions())
+	if p.bookmarks != nil {
+		p.g.Subscribe("pubsub/item", p.Name(), p.bookmarks.handleItem, 0)
+		p.g.Subscribe("pubsub/retract", p.Name(), p.bookmarks.handleItem, 0)
+		p.g.Disco().AddFeature(nsBookmarks + "+notify")
+	}
 
-func getOccupants(e gofra.Event) *gofra.Reply {
-	return &gofra.Reply{Payload: map[string]interface{}{"occupants": occupants}}
+	p.g.Disco().AddFeature(muc.NS)
 }
 
-func prepareMUCs() {
-	if len(config.MUCs) == 0 {
-		g.Logger.Warn(fmt.Sprintf("No MUCs in config: %v", config))
+// HandlePresence tracks the occupants of the rooms, and completes joining
+// them, from their presences.
+func (p *plugin) HandlePresence(pres stanza.Presence, r xmlstream.TokenReadEncoder) error {
+	var m mucPresence
+	if err := xml.NewTokenDecoder(r).Decode(&m); err != nil && err != io.EOF {
+		return nil
+	}
+	m.Presence = pres
 
-		return
+	if pres.Type == stanza.ErrorPresence {
+		p.joins.done(pres.From.Bare().String(), m.Error)
+
+		return nil
 	}
 
-	for _, muc := range config.MUCs {
-		occupants[muc.Jid] = []string{}
+	p.handleOccupant(m)
+
+	return nil
+}
+
+// Forget joined rooms so that they are joined again once reconnected
+func (p *plugin) handleDisconnected(e gofra.Event) *gofra.Reply {
+	p.mu.Lock()
+	p.mucs = make(map[string]jid.JID)
+	p.mu.Unlock()
+	p.occupants.clear("")
+	p.catchUp.flush()
+
+	return nil
+}
+
+// XEP-0410 MUC self-ping: check every joined room is still joined and rejoin
+// the ones that are not.
+func (p *plugin) handleKeepalive(e gofra.Event) *gofra.Reply {
+	timeout, _ := e.Payload["timeout"].(time.Duration)
+
+	p.mu.Lock()
+	joined := make(map[string]jid.JID, len(p.mucs))
+	for room, me := range p.mucs {
+		joined[room] = me
 	}
+	p.mu.Unlock()
+
+	go func() {
+		for room, me := range joined {
+			p.selfPing(room, me, timeout)
+		}
+	}()
+
+	return nil
 }
 
-func handlePresence(e gofra.Event) *gofra.Reply {
-	pres, ok := e.GetStanza().(stanza.Presence)
-	if !ok {
-		g.Logger.Debug(fmt.Sprintf("Ignoring packet: %T\n", pres))
+func (p *plugin) selfPing(room string, me jid.JID, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(p.g.Context(), timeout)
+	defer cancel()
 
-		return nil
+	err := p.g.Ping(ctx, me)
+	if !isNotJoined(err) {
+		return
 	}
 
-	occupantNick := ""
-	// Parse presence and determine if it's MUC-related
-	mucJid := pres.From.Bare().String()
+	p.g.Logger().Warn(fmt.Sprintf("Self-ping to %s failed, rejoining: %v", me, err))
 
-	if pres.From.Resourcepart() != "" {
-		occupantNick = pres.From.Resourcepart()
+	if mc, ok := p.room(room); ok {
+		p.mu.Lock()
+		delete(p.mucs, room)
+		p.mu.Unlock()
+		p.joinMUC(mc)
 	}
-	_, exists := occupants[mucJid]
+}
 
-	if !exists {
+// isNotJoined interprets a self-ping result as described in XEP-0410.
+// Rooms not answering pings themselves are still joined, and timeouts and
+// unreachable services are inconclusive, so neither triggers a rejoin.
+func isNotJoined(err error) bool {
+	var stanzaErr stanza.Error
+	if !errors.As(err, &stanzaErr) {
+		return false
+	}
 
-		return nil
+	switch stanzaErr.Condition {
+	case stanza.ServiceUnavailable,
+		stanza.FeatureNotImplemented,
+		stanza.ItemNotFound,
+		stanza.RemoteServerNotFound,
+		stanza.RemoteServerTimeout:
+		return false
 	}
 
-	if occupantNick == "" {
+	return true
+}
+
+func (p *plugin) joinMUCs(e gofra.Event) *gofra.Reply {
+	if p.bookmarks != nil {
+		go p.bookmarks.sync()
 
 		return nil
 	}
 
-	if pres.Type == stanza.UnavailablePresence {
-		if occupantLeft(mucJid, occupantNick) {
-			g.Publish(
-				gofra.Event{
-					Name: "muc/occupantLeftMuc",
-					Payload: map[string]interface{}{
-						occupantNick: occupantNick,
-						mucJid:       mucJid,
-					},
-				},
-			)
-
-			g.Publish(
-				gofra.Event{
-					Name: "muc/occupants",
-					Payload: map[string]interface{}{
-						"occupants": occupants,
-					},
-				},
-			)
-		}
-	}
+	rooms := p.rooms()
+	if len(rooms) == 0 {
+		p.g.Logger().Warn(fmt.Sprintf("No MUCs in config: %v", p.config))
 
-	if !occupantJoined(mucJid, occupantNick) {
 		return nil
 	}
 
-	g.Publish(
-		gofra.Event{
-			Name: "muc/occupantJoinedMuc",
-			Payload: map[string]interface{}{
-				occupantNick: occupantNick,
-				mucJid:       mucJid,
-			},
-		},
-	)
-
-	g.Publish(
-		gofra.Event{
-			Name: "muc/occupants",
-			Payload: map[string]interface{}{
-				"occupants": occupants,
-			},
-		},
-	)
+	for _, muc := range rooms {
+		p.joinMUC(muc)
+	}
 
 	return nil
 }
 
-func occupantLeft(room, occupant string) bool {
-	position, exists := isOccupant(room, occupant)
-	if !exists {
+type joinHistory struct {
+	MaxStanzas int `xml:"maxstanzas,attr"`
+}
 
-		return false
-	}
-	occupants[room][position] = occupants[room][len(room)-1]
-	occupants[room] = occupants[room][:len(room)-1]
+// joinPresence is the presence the bot joins rooms with.
+type joinPresence struct {
+	stanza.Presence
+	X struct {
+		History  joinHistory `xml:"history"`
+		Password string      `xml:"password,omitempty"`
+	} `xml:"http://jabber.org/protocol/muc x"`
+}
 
-	return true
+// joins tracks the rooms being joined, until their self-presence or an error
+// arrives.
+type joins struct {
+	mu      sync.Mutex
+	pending map[string]chan error
 }
 
-func occupantJoined(room, occupant string) bool {
-	_, exists := isOccupant(room, occupant)
-	if exists {
-		return false
-	}
+func (j *joins) wait(room string) chan error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
 
-	occupants[room] = append(occupants[room], occupant)
+	result := make(chan error, 1)
+	j.pending[room] = result
 
-	return true
+	return result
+}
+
+func (j *joins) forget(room string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.pending, room)
 }
 
-func isOccupant(room, occupant string) (int, bool) {
-	position := -1
-	for index, occ := range occupants[room] {
-		if occ == occupant {
-			position = index
-			break
+func (j *joins) done(room string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if result, ok := j.pending[room]; ok {
+		result <- err
+		delete(j.pending, room)
+	}
+}
+
+func (p *plugin) joinMUC(mc gofra.MUCConfig) {
+	go func() {
+		if err := p.joinRoom(mc); err != nil {
+			p.g.Logger().Error(fmt.Sprintf("error joining %s: %v", mc.Jid, err))
 		}
+	}()
+}
+
+// Join joins the room, keeping the bot in it across restarts, and bookmarks
+// it.
+func (p *plugin) Join(mc gofra.MUCConfig) error {
+	r, err := jid.Parse(mc.Jid)
+	if err != nil {
+		return err
+	}
+	mc.Jid = r.Bare().String()
+
+	if err := p.enter(mc); err != nil {
+		return err
+	}
+
+	if p.bookmarks != nil {
+		return p.bookmarks.publish(mc, true)
 	}
 
-	return position, position != -1
+	return nil
 }
 
-func joinMUCs(e gofra.Event) *gofra.Reply {
-	if len(config.MUCs) == 0 {
-		return nil
+// Leave leaves the room for good, and stops joining its bookmark.
+func (p *plugin) Leave(room string) error {
+	r, err := jid.Parse(room)
+	if err != nil {
+		return err
+	}
+	room = r.Bare().String()
+
+	if !p.joined(room) {
+		p.forgetRoom(room)
+
+		return fmt.Errorf("not in %s", room)
+	}
+
+	if err := p.exit(room); err != nil {
+		return err
 	}
 
-	for _, muc := range config.MUCs {
-		joinMUC(muc)
+	if p.bookmarks != nil {
+		return p.bookmarks.publish(gofra.MUCConfig{Jid: room}, false)
 	}
 
 	return nil
 }
 
-func joinMUC(mc gofra.MUCConfig) {
-	g.Logger.Debug("Tried to join room: " + mc.Jid)
-	j := jid.MustParse(mc.Jid + "/" + mc.Nick)
+// enter joins the room and keeps the bot in it across restarts.
+func (p *plugin) enter(mc gofra.MUCConfig) error {
+	if err := p.joinRoom(mc); err != nil {
+		return err
+	}
 
-	_, exists := mucs[mc.Jid]
-	if exists {
-		return
+	p.rememberRoom(mc)
+
+	return nil
+}
+
+// exit leaves the room, if joined, and keeps the bot out of it across
+// restarts.
+func (p *plugin) exit(room string) error {
+	p.mu.Lock()
+	me, joined := p.mucs[room]
+	delete(p.mucs, room)
+	p.mu.Unlock()
+
+	p.forgetRoom(room)
+	if !joined {
+		return nil
 	}
 
-	mucOpts := []muc.Option{}
+	p.occupants.clear(room)
+	p.events.push(p.snapshot())
+	p.catchUp.flush()
+	// Files are no longer sent to the room as groupchat messages
+	p.g.SetMUCNick(room, "")
+
+	return p.g.SendStanza(stanza.Presence{To: me, Type: stanza.UnavailablePresence})
+}
+
+// joined reports whether the bot is in the room, or joining it.
+func (p *plugin) joined(room string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.mucs[room]
+
+	return ok
+}
+
+// joinRoom joins the room, unless it is already joined or being joined, and
+// waits for it to accept the bot.
+func (p *plugin) joinRoom(mc gofra.MUCConfig) error {
+	p.g.Logger().Debug("Tried to join room: " + mc.Jid)
+
+	nick := mc.Nick
+	if nick == "" {
+		nick = p.config.Nick
+	}
 
-	if mc.Nick != "" {
-		mucOpts = append(mucOpts, muc.Nick(mc.Nick))
-	} else {
-		mucOpts = append(mucOpts, muc.Nick(config.Nick))
+	me, err := jid.Parse(mc.Jid + "/" + nick)
+	if err != nil {
+		return err
 	}
 
-	mucOpts = append(mucOpts, muc.MaxHistory(uint64(mc.JoinHistory)))
+	p.mu.Lock()
+	if _, exists := p.mucs[mc.Jid]; exists {
+		p.mu.Unlock()
 
-	if mc.Password != "" {
-		mucOpts = append(mucOpts, muc.Password(mc.Password))
+		return nil
+	}
+	p.mucs[mc.Jid] = me
+	p.mu.Unlock()
+
+	// The echoes of the bot are recognized from the history on
+	p.g.SetMUCNick(mc.Jid, nick)
+	p.occupants.track(mc.Jid)
+	since := p.catchUp.since(mc.Jid)
+
+	if err := p.join(me, mc); err != nil {
+		// The bot is not in the room, nor known to be there
+		p.occupants.clear(mc.Jid)
+		p.g.SetMUCNick(mc.Jid, "")
+		p.mu.Lock()
+		delete(p.mucs, mc.Jid)
+		p.mu.Unlock()
+
+		return err
 	}
 
-	go func() {
-		_, err := client.Join(g.Context, jid.MustParse(mc.Jid+"/"+mc.Nick), g.Client, mucOpts...)
+	p.events.push(gofra.Event{Name: "muc/joinedRoom", Payload: map[string]interface{}{"roomJid": mc.Jid}})
 
-		if err != nil {
-			g.Logger.Error(fmt.Sprintf("error joining: %v", err))
-		}
+	if p.catchUp.enabled(mc.Jid) {
+		// Messages since joining are received live
+		go p.catchUp.run(mc.Jid, since, p.g.Clock().Now())
+	}
 
-		e := gofra.Event{Name: "muc/joinedRoom", Payload: map[string]interface{}{"roomJid": mc.Jid}}
+	return nil
+}
 
-		occupantJoined(mc.Jid, mc.Nick)
-		mucs[mc.Jid] = j
+// join sends the presence joining the room and waits for the room to accept
+// it, once it has sent the presences of the occupants.
+func (p *plugin) join(me jid.JID, mc gofra.MUCConfig) error {
+	result := p.joins.wait(mc.Jid)
+	defer p.joins.forget(mc.Jid)
+
+	pres := joinPresence{Presence: stanza.Presence{To: me}}
+	pres.X.History.MaxStanzas = mc.JoinHistory
+	pres.X.Password = mc.Password
+	if err := p.g.SendStanza(pres); err != nil {
+		return err
+	}
 
-		g.Publish(e)
-	}()
+	ctx, cancel := context.WithTimeout(p.g.Context(), joinTimeout)
+	defer cancel()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestIsNotJoined(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		notJoined bool
+	}{
+		{"pong", nil, false},
+		{"timeout", context.DeadlineExceeded, false},
+		{"service unavailable", stanza.Error{Condition: stanza.ServiceUnavailable}, false},
+		{"feature not implemented", stanza.Error{Condition: stanza.FeatureNotImplemented}, false},
+		{"item not found", stanza.Error{Condition: stanza.ItemNotFound}, false},
+		{"remote server not found", stanza.Error{Condition: stanza.RemoteServerNotFound}, false},
+		{"remote server timeout", stanza.Error{Condition: stanza.RemoteServerTimeout}, false},
+		{"not acceptable", stanza.Error{Condition: stanza.NotAcceptable}, true},
+		{"wrapped not acceptable", errors.Join(errors.New("self-ping"), stanza.Error{Condition: stanza.NotAcceptable}), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.notJoined, isNotJoined(tt.err))
+		})
+	}
+}
+
+func TestSelfPing(t *testing.T) {
+	api := gofratest.NewAPI("gofra@example.com")
+	var pinged []jid.JID
+	api.IQHandler = func(to jid.JID, typ stanza.IQType, payload interface{}) (gofra.IQResponse, error) {
+		out, err := xml.Marshal(payload)
+		assert.NoError(t, err)
+		assert.Equal(t, stanza.GetIQ, typ)
+		assert.Equal(t, `<ping xmlns="urn:xmpp:ping"></ping>`, string(out))
+		pinged = append(pinged, to)
+
+		return gofra.IQResponse{}, stanza.Error{Condition: stanza.ServiceUnavailable}
+	}
+	p := &plugin{g: api}
+
+	me := jid.MustParse(room + "/Gofra")
+	p.selfPing(room, me, time.Second)
+	assert.Equal(t, []jid.JID{me}, pinged)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	"github.com/XaviFP/gofra/internal"
+)
+
+// Status codes of MUC presences (XEP-0045, section 15.6).
+const (
+	statusSelf       = 110
+	statusBanned     = 301
+	statusNickChange = 303
+	statusKicked     = 307
+)
+
+var errNoOccupant = errors.New("no such occupant")
+
+type userItem struct {
+	Affiliation string `xml:"affiliation,attr"`
+	Role        string `xml:"role,attr"`
+	JID         string `xml:"jid,attr"`
+	Nick        string `xml:"nick,attr"`
+	Reason      string `xml:"reason"`
+	Actor       struct {
+		Nick string `xml:"nick,attr"`
+		JID  string `xml:"jid,attr"`
+	} `xml:"actor"`
+}
+
+type userStatus struct {
+	Code int `xml:"code,attr"`
+}
+
+// mucPresence is a presence of a room, about one of its occupants or an error
+// joining it.
+type mucPresence struct {
+	stanza.Presence
+	X struct {
+		Item   userItem     `xml:"item"`
+		Status []userStatus `xml:"status"`
+	} `xml:"http://jabber.org/protocol/muc#user x"`
+	Error stanza.Error `xml:"error"`
+}
+
+func (p mucPresence) codes() []int {
+	codes := make([]int, 0, len(p.X.Status))
+	for _, status := range p.X.Status {
+		codes = append(codes, status.Code)
+	}
+
+	return codes
+}
+
+// occupantStore keeps the occupants of the rooms the bot joins, by room and
+// nick.
+type occupantStore struct {
+	mu    sync.RWMutex
+	rooms map[string]map[string]gofra.Occupant
+}
+
+func newOccupantStore() *occupantStore {
+	return &occupantStore{rooms: make(map[string]map[string]gofra.Occupant)}
+}
+
+// track starts keeping the occupants of room, with none until their
+// presences arrive.
+func (s *occupantStore) track(room string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rooms[room] = make(map[string]gofra.Occupant)
+}
+
+func (s *occupantStore) tracks(room string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.rooms[room]
+
+	return ok
+}
+
+// clear forgets the occupants of room, or of every room when it is empty, as
+// the bot is no longer there to see them leave.
+func (s *occupantStore) clear(room string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for r := range s.rooms {
+		if room == "" || r == room {
+			s.rooms[r] = make(map[string]gofra.Occupant)
+		}
+	}
+}
+
+// update stores o, keeping the time it joined, and returns its previous
+// state if it was already in the room.
+func (s *occupantStore) update(o gofra.Occupant) (gofra.Occupant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	occupants, ok := s.rooms[o.Room]
+	if !ok {
+		return gofra.Occupant{}, false
+	}
+
+	previous, existed := occupants[o.Nick]
+	if existed {
+		o.Joined = previous.Joined
+	}
+	occupants[o.Nick] = o
+
+	return previous, existed
+}
+
+func (s *occupantStore) remove(room, nick string) (gofra.Occupant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.rooms[room][nick]
+	delete(s.rooms[room], nick)
+
+	return o, ok
+}
+
+// rename moves the occupant to its new nick, keeping everything else.
+func (s *occupantStore) rename(room, nick, newNick string) (gofra.Occupant, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.rooms[room][nick]
+	if !ok {
+		return o, false
+	}
+
+	delete(s.rooms[room], nick)
+	o.Nick = newNick
+	s.rooms[room][newNick] = o
+
+	return o, true
+}
+
+func (s *occupantStore) get(room, nick string) (gofra.Occupant, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.rooms[room][nick]
+
+	return o, ok
+}
+
+// byJID finds the occupant with the real JID, bare or full.
+func (s *occupantStore) byJID(room, user string) (gofra.Occupant, bool) {
+	j, err := jid.Parse(user)
+	if err != nil {
+		return gofra.Occupant{}, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, o := range s.rooms[room] {
+		real, err := jid.Parse(o.JID)
+		if err != nil || o.JID == "" {
+			continue
+		}
+
+		if real.Equal(j) || j.Resourcepart() == "" && real.Bare().Equal(j) {
+			return o, true
+		}
+	}
+
+	return gofra.Occupant{}, false
+}
+
+// list returns the occupants of room sorted by nick.
+func (s *occupantStore) list(room string) []gofra.Occupant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	occupants := make([]gofra.Occupant, 0, len(s.rooms[room]))
+	for _, o := range s.rooms[room] {
+		occupants = append(occupants, o)
+	}
+	sort.Slice(occupants, func(i, j int) bool { return occupants[i].Nick < occupants[j].Nick })
+
+	return occupants
+}
+
+// nicks returns the nicks in every room, sorted.
+func (s *occupantStore) nicks() map[string][]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nicks := make(map[string][]string, len(s.rooms))
+	for room, occupants := range s.rooms {
+		nicks[room] = make([]string, 0, len(occupants))
+		for nick := range occupants {
+			nicks[room] = append(nicks[room], nick)
+		}
+		sort.Strings(nicks[room])
+	}
+
+	return nicks
+}
+
+// eventQueue publishes events in order without blocking the presence
+// handler, as subscribers may send stanzas and wait for their answers.
+type eventQueue struct {
+	publish func(e gofra.Event) *gofra.Reply
+
+	mu      sync.Mutex
+	queue   []gofra.Event
+	running bool
+}
+
+func (q *eventQueue) push(events ...gofra.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queue = append(q.queue, events...)
+	if q.running {
+		return
+	}
+	q.running = true
+
+	go q.run()
+}
+
+func (q *eventQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.queue) == 0 {
+			q.running = false
+			q.mu.Unlock()
+
+			return
+		}
+		e := q.queue[0]
+		q.queue = q.queue[1:]
+		q.mu.Unlock()
+
+		q.publish(e)
+	}
+}
+
+// Occupants returns the occupants of the room, sorted by nick.
+func (p *plugin) Occupants(room string) []gofra.Occupant {
+	return p.occupants.list(room)
+}
+
+// Occupant returns the occupant of the room with the nick.
+func (p *plugin) Occupant(room, nick string) (gofra.Occupant, bool) {
+	return p.occupants.get(room, nick)
+}
+
+// handleOccupant updates the occupants of the room from one of its presences
+// and publishes what changed.
+func (p *plugin) handleOccupant(pres mucPresence) {
+	room, nick := pres.From.Bare().String(), pres.From.Resourcepart()
+	if nick == "" || !p.occupants.tracks(room) {
+		return
+	}
+
+	item := pres.X.Item
+	o := gofra.Occupant{
+		Room:        room,
+		Nick:        nick,
+		JID:         item.JID,
+		Role:        item.Role,
+		Affiliation: item.Affiliation,
+		Joined:      p.g.Clock().Now(),
+		Codes:       pres.codes(),
+	}
+	o.Self = o.HasStatus(statusSelf) || p.isSelf(pres.From)
+
+	if pres.Type == stanza.UnavailablePresence {
+		p.occupantLeft(o, item)
+
+		return
+	}
+
+	if o.Self {
+		// The room may have changed the nick of the bot
+		p.mu.Lock()
+		p.mucs[room] = pres.From
+		p.mu.Unlock()
+		p.g.SetMUCNick(room, o.Nick)
+		p.joins.done(room, nil)
+	}
+
+	previous, existed := p.occupants.update(o)
+	if !existed {
+		p.events.push(
+			occupantEvent("muc/occupantJoinedMuc", o),
+			p.snapshot(),
+		)
+
+		return
+	}
+
+	o.Joined = previous.Joined
+	if previous.Role != o.Role {
+		e := occupantEvent("muc/roleChanged", o)
+		e.Payload["previousRole"] = previous.Role
+		p.events.push(e)
+	}
+	if previous.Affiliation != o.Affiliation {
+		e := occupantEvent("muc/affiliationChanged", o)
+		e.Payload["previousAffiliation"] = previous.Affiliation
+		p.events.push(e)
+	}
+}
+
+func (p *plugin) occupantLeft(o gofra.Occupant, item userItem) {
+	if o.HasStatus(statusNickChange) && item.Nick != "" {
+		renamed, ok := p.occupants.rename(o.Room, o.Nick, item.Nick)
+		if !ok {
+			return
+		}
+
+		if renamed.Self {
+			if me, err := jid.Parse(o.Room + "/" + item.Nick); err == nil {
+				p.mu.Lock()
+				p.mucs[o.Room] = me
+				p.mu.Unlock()
+				p.g.SetMUCNick(o.Room, item.Nick)
+			}
+		}
+
+		e := occupantEvent("muc/nickChanged", renamed)
+		e.Payload["nick"] = o.Nick
+		e.Payload["newNick"] = item.Nick
+		p.events.push(e, p.snapshot())
+
+		return
+	}
+
+	previous, ok := p.occupants.remove(o.Room, o.Nick)
+	if !ok {
+		return
+	}
+	o.Joined = previous.Joined
+
+	if o.Self {
+		// Nobody else is seen leaving once the bot is out
+		p.occupants.clear(o.Room)
+		p.g.SetMUCNick(o.Room, "")
+		p.mu.Lock()
+		delete(p.mucs, o.Room)
+		p.mu.Unlock()
+	}
+
+	events := []gofra.Event{occupantEvent("muc/occupantLeftMuc", o)}
+	switch {
+	case o.HasStatus(statusKicked):
+		events = append(events, occupantEvent("muc/occupantKicked", o))
+	case o.HasStatus(statusBanned):
+		events = append(events, occupantEvent("muc/occupantBanned", o))
+	}
+
+	for _, e := range events {
+		e.Payload["reason"] = item.Reason
+		e.Payload["actor"] = item.Actor.Nick
+	}
+
+	p.events.push(append(events, p.snapshot())...)
+}
+
+// isSelf reports whether from is the occupant of the bot, for rooms that do
+// not send the self-presence status code.
+func (p *plugin) isSelf(from jid.JID) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	me, ok := p.mucs[from.Bare().String()]
+
+	return ok && me.Equal(from)
+}
+
+func occupantEvent(name string, o gofra.Occupant) gofra.Event {
+	return gofra.Event{Name: name, Payload: map[string]interface{}{
+		"room":     o.Room,
+		"nick":     o.Nick,
+		"occupant": o,
+	}}
+}
+
+// snapshot is the muc/occupants event with the nicks in every room.
+func (p *plugin) snapshot() gofra.Event {
+	return gofra.Event{Name: "muc/occupants", Payload: map[string]interface{}{
+		"occupants": p.occupants.nicks(),
+	}}
+}
+
+// getOccupants answers with the nicks in every room, and the occupants of the
+// room in the payload, if any.
+func (p *plugin) getOccupants(e gofra.Event) *gofra.Reply {
+	reply := &gofra.Reply{Payload: map[string]interface{}{"occupants": p.occupants.nicks()}}
+	if room := payload(e, "room"); room != "" {
+		reply.Payload["list"] = p.Occupants(room)
+	}
+
+	return reply
+}
+
+// getOccupant answers with the occupant of the room with the nick, or the
+// real JID, in the payload.
+func (p *plugin) getOccupant(e gofra.Event) *gofra.Reply {
+	room := payload(e, "room")
+
+	o, ok := p.occupants.get(room, payload(e, "nick"))
+	if user := payload(e, "jid"); user != "" {
+		o, ok = p.occupants.byJID(room, user)
+	}
+
+	reply := &gofra.Reply{}
+	if !ok {
+		reply.SetError(errNoOccupant)
+
+		return reply
+	}
+
+	reply.SetError(nil)
+	reply.Payload["occupant"] = o
+
+	return reply
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+// occupantPresence is a presence of an occupant of the room with the given
+// muc#user item attributes and status codes.
+func occupantPresence(nick, typ, item string, codes ...int) string {
+	status := ""
+	for _, code := range codes {
+		status += fmt.Sprintf(`<status code="%d"/>`, code)
+	}
+
+	return fmt.Sprintf(`<presence xmlns="jabber:client" from="%s/%s" to="gofra@example.com/gofratest" type="%s">`+
+		`<x xmlns="http://jabber.org/protocol/muc#user"><item %s/>%s</x></presence>`, room, nick, typ, item, status)
+}
+
+func joinRoom(t *testing.T, names ...string) (*gofratest.Harness, *plugin, *gofratest.Recorder) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice", "bob"))
+	p := Plugin.NewInstance().(*plugin)
+	r := gofratest.NewRecorder(append([]string{"muc/joinedRoom"}, names...)...)
+	h.Start(p, r)
+
+	for {
+		if e := r.Next(t); e.Name == "muc/joinedRoom" {
+			return h, p, r
+		}
+	}
+}
+
+func TestOccupants_Join(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice", "bob"))
+	p := Plugin.NewInstance().(*plugin)
+	r := gofratest.NewRecorder("muc/joinedRoom", "muc/occupantJoinedMuc")
+	h.Start(p, r)
+
+	for _, nick := range []string{"alice", "bob", "Gofra"} {
+		e := r.Next(t)
+		assert.Equal(t, "muc/occupantJoinedMuc", e.Name)
+		assert.Equal(t, nick, e.Payload["nick"])
+	}
+	assert.Equal(t, room, r.Next(t).Payload["roomJid"])
+
+	occupants := p.Occupants(room)
+	if assert.Len(t, occupants, 3) {
+		assert.Equal(t, "Gofra", occupants[0].Nick)
+		assert.True(t, occupants[0].Self)
+		assert.Equal(t, []int{110}, occupants[0].Codes)
+		assert.Equal(t, "alice", occupants[1].Nick)
+		assert.False(t, occupants[1].Self)
+		assert.Equal(t, "participant", occupants[1].Role)
+		assert.Equal(t, "member", occupants[1].Affiliation)
+	}
+
+	reply := h.Gofra.Publish(gofra.Event{Name: "muc/getOccupants", Payload: map[string]interface{}{"room": room}})
+	assert.Equal(t, map[string][]string{room: {"Gofra", "alice", "bob"}}, reply.Payload["occupants"])
+	assert.Equal(t, occupants, reply.Payload["list"])
+}
+
+func TestOccupants_JoinError(t *testing.T) {
+	locked := "locked@muc.example.com"
+	h := gofratest.New(t, gofratest.WithConfig(func(c *gofra.Config) {
+		c.MUCs = []gofra.MUCConfig{{Jid: locked, Nick: "Gofra", Password: "1234"}}
+	}))
+	h.Server.Observe(func(st gofratest.Stanza) {
+		if st.XMLName.Local == "presence" && st.Attr("to") == locked+"/Gofra" {
+			h.Server.Send(`<presence xmlns="jabber:client" type="error" from="` + locked + `/Gofra" to="gofra@example.com/gofratest">` +
+				`<error type="auth"><not-authorized xmlns="urn:ietf:params:xml:ns:xmpp-stanzas"/></error></presence>`)
+		}
+	})
+	p := Plugin.NewInstance().(*plugin)
+	r := gofratest.NewRecorder("messageReceived")
+	h.Start(p, r)
+
+	st := h.ExpectPresence(locked+"/Gofra", "")
+	assert.Contains(t, st.Inner, "<password>1234</password>")
+
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		_, joined := p.mucs[locked]
+
+		return !joined
+	}, time.Second, 10*time.Millisecond)
+
+	// Whoever has the nick of the bot in the room is not taken for it
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" from="` + locked + `/Gofra" to="gofra@example.com/gofratest"><body>hi</body></message>`)
+	assert.False(t, r.Next(t).IsSelf)
+}
+
+func TestOccupants_Changes(t *testing.T) {
+	h, p, r := joinRoom(t, "muc/nickChanged", "muc/roleChanged", "muc/affiliationChanged", "muc/occupantLeftMuc", "muc/occupantKicked", "muc/occupantBanned")
+	alice, _ := p.Occupant(room, "alice")
+
+	h.Server.Send(occupantPresence("alice", "unavailable", `affiliation="member" role="participant" nick="alicia"`, 303))
+	h.Server.Send(occupantPresence("alicia", "", `affiliation="member" role="participant"`))
+	e := r.Next(t)
+	assert.Equal(t, "muc/nickChanged", e.Name)
+	assert.Equal(t, "alice", e.Payload["nick"])
+	assert.Equal(t, "alicia", e.Payload["newNick"])
+
+	alicia, ok := p.Occupant(room, "alicia")
+	assert.True(t, ok)
+	assert.Equal(t, alice.Joined, alicia.Joined)
+	_, ok = p.Occupant(room, "alice")
+	assert.False(t, ok)
+
+	h.Server.Send(occupantPresence("bob", "", `affiliation="admin" role="moderator" jid="bob@example.com/laptop"`))
+	e = r.Next(t)
+	assert.Equal(t, "muc/roleChanged", e.Name)
+	assert.Equal(t, "participant", e.Payload["previousRole"])
+	assert.Equal(t, "moderator", e.Payload["occupant"].(gofra.Occupant).Role)
+	assert.Equal(t, "muc/affiliationChanged", r.Next(t).Name)
+
+	reply := h.Gofra.Publish(gofra.Event{Name: "muc/getOccupant", Payload: map[string]interface{}{"room": room, "jid": "bob@example.com"}})
+	if assert.NoError(t, reply.Err()) {
+		assert.Equal(t, "bob", reply.Payload["occupant"].(gofra.Occupant).Nick)
+	}
+
+	h.Server.Send(`<presence xmlns="jabber:client" from="` + room + `/bob" to="gofra@example.com/gofratest" type="unavailable">` +
+		`<x xmlns="http://jabber.org/protocol/muc#user"><item affiliation="admin" role="none"><actor nick="alicia"/><reason>Flooding</reason></item>` +
+		`<status code="307"/></x></presence>`)
+	assert.Equal(t, "muc/occupantLeftMuc", r.Next(t).Name)
+	e = r.Next(t)
+	assert.Equal(t, "muc/occupantKicked", e.Name)
+	assert.Equal(t, "bob", e.Payload["nick"])
+	assert.Equal(t, "Flooding", e.Payload["reason"])
+	assert.Equal(t, "alicia", e.Payload["actor"])
+
+	reply = h.Gofra.Publish(gofra.Event{Name: "muc/getOccupant", Payload: map[string]interface{}{"room": room, "nick": "bob"}})
+	assert.Error(t, reply.Err())
+
+	// Once the bot is banned, nobody is left
+	h.Server.Send(occupantPresence("Gofra", "unavailable", `affiliation="outcast" role="none"`, 110, 301))
+	assert.Equal(t, "muc/occupantLeftMuc", r.Next(t).Name)
+	e = r.Next(t)
+	assert.Equal(t, "muc/occupantBanned", e.Name)
+	assert.True(t, e.Payload["occupant"].(gofra.Occupant).Self)
+	assert.Empty(t, p.Occupants(room))
+}
+
+func TestOccupants_SelfKicked(t *testing.T) {
+	h, p, r := joinRoom(t, "muc/occupantKicked", "messageReceived")
+
+	h.Server.Send(occupantPresence("Gofra", "unavailable", `affiliation="none" role="none"`, 110, 307))
+	assert.Equal(t, "muc/occupantKicked", r.Next(t).Name)
+	assert.False(t, p.joined(room))
+
+	// Whoever takes the nick of the bot once it is out is not taken for it
+	h.Server.Send(`<message xmlns="jabber:client" type="groupchat" from="` + room + `/Gofra" to="gofra@example.com/gofratest"><body>hi</body></message>`)
+	assert.False(t, r.Next(t).IsSelf)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/XaviFP/gofra/internal"
+)
+
+const roomsFile = "rooms.json"
+
+// roomState is what changed at runtime in the set of rooms the bot stays in,
+// kept across restarts.
+type roomState struct {
+	// Rooms the bot was invited to or told to join
+	Joined []gofra.MUCConfig `json:"joined"`
+	// Configured rooms the bot was told to leave
+	Left []string `json:"left"`
+}
+
+// rooms returns the rooms the bot stays in: the configured ones but those it
+// left, and the ones it joined since.
+func (p *plugin) rooms() []gofra.MUCConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var rooms []gofra.MUCConfig
+	for _, mc := range p.config.MUCs {
+		if !contains(p.state.Left, mc.Jid) {
+			rooms = append(rooms, mc)
+		}
+	}
+
+	return append(rooms, p.state.Joined...)
+}
+
+// room returns the configuration of a room the bot stays in.
+func (p *plugin) room(room string) (gofra.MUCConfig, bool) {
+	for _, mc := range p.rooms() {
+		if mc.Jid == room {
+			return mc, true
+		}
+	}
+
+	return gofra.MUCConfig{}, false
+}
+
+// rememberRoom adds the room to the ones the bot stays in.
+func (p *plugin) rememberRoom(mc gofra.MUCConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	left := p.state.Left[:0]
+	for _, room := range p.state.Left {
+		if room != mc.Jid {
+			left = append(left, room)
+		}
+	}
+	p.state.Left = left
+
+	joined := p.state.Joined[:0]
+	for _, j := range p.state.Joined {
+		if j.Jid != mc.Jid {
+			joined = append(joined, j)
+		}
+	}
+	p.state.Joined = joined
+
+	if !p.isConfigured(mc.Jid) {
+		p.state.Joined = append(p.state.Joined, mc)
+	}
+
+	p.persistRooms()
+}
+
+// forgetRoom removes the room from the ones the bot stays in.
+func (p *plugin) forgetRoom(room string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	joined := p.state.Joined[:0]
+	for _, j := range p.state.Joined {
+		if j.Jid != room {
+			joined = append(joined, j)
+		}
+	}
+	p.state.Joined = joined
+
+	if p.isConfigured(room) && !contains(p.state.Left, room) {
+		p.state.Left = append(p.state.Left, room)
+	}
+
+	p.persistRooms()
+}
+
+func (p *plugin) isConfigured(room string) bool {
+	for _, mc := range p.config.MUCs {
+		if mc.Jid == room {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *plugin) persistRooms() {
+	serialized, err := json.MarshalIndent(p.state, "", " ")
+	if err != nil {
+		p.g.Logger().Error(err.Error())
+		return
+	}
+
+	if err := os.MkdirAll(p.config.DataDir, 0o755); err != nil {
+		p.g.Logger().Error(err.Error())
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(p.config.DataDir, roomsFile), serialized, 0o600); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+}
+
+func (p *plugin) loadRooms() {
+	serialized, err := os.ReadFile(filepath.Join(p.config.DataDir, roomsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		p.g.Logger().Error(err.Error())
+		return
+	}
+
+	if err := json.Unmarshal(serialized, &p.state); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+}
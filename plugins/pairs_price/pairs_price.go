@@ -21,36 +21,40 @@ const metadataSufix = "/price"
 const defaultExchange = "kraken"
 const defaultPair = "btcusd"
 
-var g *gofra.Gofra
+type plugin struct {
+	g gofra.API
+}
 
-type plugin struct{}
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "Price"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Provides price equivalences of crypto assets"
 }
 
-func (p plugin) Help() string {
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf("Usage: %sprice btcusd -> btcusd: 37567, %sprice btceur -> btceur: 33314.3", commandChar, commandChar)
 }
 
-func (p plugin) Init(c gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
+func (p *plugin) Init(c gofra.Config, gofra gofra.API) {
+	p.g = gofra
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"command/price",
 		p.Name(),
-		handlePrice,
+		p.handlePrice,
 		0,
 	)
 }
 
-func handlePrice(e gofra.Event) *gofra.Reply {
+func (p *plugin) handlePrice(e gofra.Event) *gofra.Reply {
 	var exchange, pair string
 
 	var r *gofra.Reply
@@ -59,8 +63,8 @@ func handlePrice(e gofra.Event) *gofra.Reply {
 
 	switch {
 	case argLength > 2:
-		if err := g.SendStanza(e.MB.Reply("Too many arguments")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Too many arguments")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -77,9 +81,9 @@ func handlePrice(e gofra.Event) *gofra.Reply {
 
 	resp, err := http.Get(metadataPrefix + exchange + "/" + pair + metadataSufix)
 	if err != nil {
-		g.Logger.Error(err.Error())
-		if err := g.SendStanza(e.MB.Reply(fmt.Sprintf("Could not retrieve asset price: %s", err.Error()))); err != nil {
-			g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(fmt.Sprintf("Could not retrieve asset price: %s", err.Error()))); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -88,8 +92,8 @@ func handlePrice(e gofra.Event) *gofra.Reply {
 
 	if resp.StatusCode != http.StatusOK {
 		errMsg := fmt.Sprintf("Could not retrieve asset price. Status code: %d", resp.StatusCode)
-		if err := g.SendStanza(e.MB.Reply(errMsg)); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(errMsg)); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -98,8 +102,8 @@ func handlePrice(e gofra.Event) *gofra.Reply {
 	var result map[string]map[string]interface{}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		if err := g.SendStanza(e.MB.Reply(fmt.Sprintf("Could not decode response: %s", err.Error()))); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(fmt.Sprintf("Could not decode response: %s", err.Error()))); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -107,8 +111,8 @@ func handlePrice(e gofra.Event) *gofra.Reply {
 
 	priceField, ok := result["result"]["price"]
 	if !ok {
-		if err := g.SendStanza(e.MB.Reply("Price for pair not found")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Price for pair not found")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return r
@@ -117,8 +121,8 @@ func handlePrice(e gofra.Event) *gofra.Reply {
 	priceFloat := priceField.(float64)
 	price := strconv.FormatFloat(priceFloat, 'f', -1, 64)
 
-	if err := g.SendStanza(e.MB.Reply(fmt.Sprintf("%s: %s", pair, price))); err != nil {
-		g.Logger.Error(err.Error())
+	if err := p.g.SendStanza(e.MB.Reply(fmt.Sprintf("%s: %s", pair, price))); err != nil {
+		p.g.Logger().Error(err.Error())
 	}
 
 	return r
@@ -15,31 +15,36 @@ import (
 )
 
 var Plugin plugin
-var g *gofra.Gofra
 
-type plugin struct{}
+type plugin struct {
+	g gofra.API
+}
+
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "Pick"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Picks among a given list"
 }
 
-func (p plugin) Help() string {
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf("Usage:\n %spick Tokyo, Osaka, Kyoto -> Chose: Osaka\n%spick 2 Strawberry, Chocolate, Vanilla, Caramel -> Chose: Caramel and Vanilla", commandChar, commandChar)
 }
 
-func (p plugin) Init(c gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
+func (p *plugin) Init(c gofra.Config, gofra gofra.API) {
+	p.g = gofra
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"command/pick",
 		p.Name(),
-		pick,
+		p.pick,
 		0,
 	)
 }
@@ -99,13 +104,13 @@ func choose(quantity int, options []string, r *rand.Rand) string {
 	return fmt.Sprintf("%sand %s", out, options[r.Intn(len(options))])
 }
 
-func pick(e gofra.Event) *gofra.Reply {
+func (p *plugin) pick(e gofra.Event) *gofra.Reply {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	quantity, options := parseArgs(e.MB.Body)
 	answer := choose(quantity, options, r)
 
-	if err := g.SendStanza(e.MB.Reply(answer)); err != nil {
-		g.Logger.Error(err.Error())
+	if err := p.g.SendStanza(e.MB.Reply(answer)); err != nil {
+		p.g.Logger().Error(err.Error())
 
 		return nil
 	}
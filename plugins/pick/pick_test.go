@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mellium.im/xmpp/jid"
+	"mellium.im/xmpp/stanza"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func command(body string) gofra.Event {
+	return gofra.Event{
+		Name: "command/pick",
+		MB: gofra.MessageBody{
+			Message: stanza.Message{Type: stanza.ChatMessage, From: jid.MustParse("alice@example.com/phone")},
+			Body:    body,
+		},
+	}
+}
+
+func TestPick(t *testing.T) {
+	api := gofratest.NewAPI("gofra@example.com")
+	p := Plugin.NewInstance()
+	p.Init(gofra.Config{}, api)
+
+	assert.Equal(t, []gofratest.Subscription{{Event: "command/pick", Plugin: "Pick"}}, api.Subscriptions())
+
+	api.Publish(command("!pick Tokyo, Osaka, Kyoto"))
+
+	messages := api.Messages()
+	if assert.Len(t, messages, 1) {
+		assert.Contains(t, []string{"Chose: Tokyo", "Chose: Osaka", "Chose: Kyoto"}, messages[0].Body)
+		assert.Equal(t, "alice@example.com/phone", messages[0].To.String())
+	}
+}
+
+func TestPick_AllOptions(t *testing.T) {
+	api := gofratest.NewAPI("gofra@example.com")
+	p := Plugin.NewInstance()
+	p.Init(gofra.Config{}, api)
+
+	api.Publish(command("!pick 3 Strawberry, Chocolate"))
+
+	messages := api.Messages()
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "Chose: All the options", messages[0].Body)
+	}
+}
+
+func TestTranscripts(t *testing.T) {
+	gofratest.RunTranscripts(t, "testdata/*.transcript", func() []gofra.Plugin {
+		return []gofra.Plugin{Plugin.NewInstance(), gofratest.Commands("!")}
+	})
+}
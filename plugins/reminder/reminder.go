@@ -8,9 +8,11 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/olebedev/when"
@@ -24,13 +26,7 @@ import (
 
 var Plugin plugin
 
-var g *gofra.Gofra
-var reminders []reminder
-var dueReminders = make(chan reminder, 10)
-var newReminders = make(chan reminder, 10)
-var sendReminders = make(chan reminder, 10)
-var occupants = make(map[string][]string)
-var w = when.New(nil)
+const stateFile = "reminders.txt"
 
 type reminder struct {
 	time    int64
@@ -38,74 +34,170 @@ type reminder struct {
 	from    jid.JID
 	msg     string
 	msgType stanza.MessageType
+	// Times it was sent again for lack of a delivery receipt
+	resent int
 }
 
-type plugin struct{}
+type plugin struct {
+	g             gofra.API
+	dataDir       string
+	resendAfter   time.Duration
+	resends       int
+	escalateTo    string
+	reminders     []reminder
+	dueReminders  chan reminder
+	newReminders  chan reminder
+	sendReminders chan reminder
+	w             *when.Parser
+
+	// occupants of the rooms, updated by muc/occupants events
+	mu        sync.Mutex
+	occupants map[string][]string
+}
+
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{
+		dueReminders:  make(chan reminder, 10),
+		newReminders:  make(chan reminder, 10),
+		sendReminders: make(chan reminder, 10),
+		w:             when.New(nil),
+		occupants:     make(map[string][]string),
+	}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "Remind"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Reminds you or another recipient of something you noted"
 }
 
-func (p plugin) Help() string {
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf("Usage: Format %sremind [nick] [text to remind] [time to remind]\n[nick] can be omitted on 1 to 1 converstation with the bot. \"me\" can be used in a MUC setting if reminder is for oneself. \n Example: \n%sremind me call the mechanic in one second -> Reminder added", commandChar, commandChar)
 }
 
-func (p plugin) Init(c gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
-	g.Subscribe(
+func (p *plugin) Init(c gofra.Config, gofra gofra.API) {
+	p.g = gofra
+	p.dataDir = c.DataDir
+	p.checkConfig(c)
+	p.g.Subscribe(
 		"command/remind",
 		p.Name(),
-		handleReminder,
+		p.handleReminder,
 		0,
 	)
-	g.Subscribe(
+	p.g.Subscribe(
 		"muc/occupants",
 		p.Name(),
-		handleOccupants,
+		p.handleOccupants,
 		0,
 	)
 
-	w.Add(en.All...)
-	w.Add(common.All...)
-	go reminderMonitor()
-	go loadState()
+	p.w.Add(en.All...)
+	p.w.Add(common.All...)
+	// Reminders are loaded before the monitor starts changing them
+	p.loadState()
+	go p.reminderMonitor()
+}
+
+// Reminders in private conversations are sent again when no delivery receipt
+// arrives within resendAfter, up to resends times, and then escalateTo is told.
+func (p *plugin) checkConfig(c gofra.Config) {
+	pluginConfig := c.Plugins[p.Name()]
+
+	if after, ok := pluginConfig["resendAfter"].(string); ok {
+		d, err := time.ParseDuration(after)
+		if err != nil {
+			p.g.Logger().Warn(fmt.Sprintf("Invalid resendAfter for plugin Remind: %v", err))
+		}
+		p.resendAfter = d
+	}
+
+	if resends, ok := pluginConfig["resends"].(int); ok {
+		p.resends = resends
+	}
+
+	if escalateTo, ok := pluginConfig["escalateTo"].(string); ok {
+		p.escalateTo = escalateTo
+	}
 }
 
-func (p plugin) Run() {
-	for rmdr := range sendReminders {
+func (p *plugin) Run() {
+	for rmdr := range p.sendReminders {
 
 		r := gofra.MessageBody{Message: stanza.Message{Type: rmdr.msgType, To: rmdr.to.Bare()}, Body: rmdr.msg}
 
-		err := g.SendStanza(r)
+		if p.resendAfter <= 0 || rmdr.msgType == stanza.GroupChatMessage {
+			err := p.g.SendStanza(r)
+			if err != nil {
+				p.g.Logger().Error(fmt.Sprintf("Error encoding message in Run() method of reminder Plugin: %v", err))
+			}
+
+			continue
+		}
+
+		timeout := p.g.Clock().After(p.resendAfter)
+
+		id, err := p.g.Receipts().Send(r)
 		if err != nil {
-			g.Logger.Error(fmt.Sprintf("Error encoding message in Run() method of reminder Plugin: %v", err))
+			p.g.Logger().Error(fmt.Sprintf("Error encoding message in Run() method of reminder Plugin: %v", err))
 		}
+
+		go p.awaitDelivery(rmdr, id, timeout)
 	}
 }
 
-func handleReminder(e gofra.Event) *gofra.Reply {
+// awaitDelivery sends a reminder again, or escalates it, unless it was
+// delivered by the time timeout fires.
+func (p *plugin) awaitDelivery(rmdr reminder, id string, timeout <-chan time.Time) {
+	<-timeout
+
+	d, ok := p.g.Receipts().Status(id)
+	p.g.Receipts().Forget(id)
+
+	if !ok || d.Status >= gofra.DeliveryDelivered {
+		return
+	}
+
+	if rmdr.resent < p.resends {
+		rmdr.resent++
+		p.sendReminders <- rmdr
+
+		return
+	}
+
+	if p.escalateTo == "" {
+		p.g.Logger().Warn(fmt.Sprintf("Reminder %q was not delivered to %s", rmdr.msg, rmdr.to.Bare()))
+
+		return
+	}
+
+	escalation := fmt.Sprintf("%s did not get their reminder: %s", rmdr.to.Bare(), rmdr.msg)
+	if err := p.g.SendMessage(p.escalateTo, escalation, stanza.ChatMessage); err != nil {
+		p.g.Logger().Error(err.Error())
+	}
+}
+
+func (p *plugin) handleReminder(e gofra.Event) *gofra.Reply {
 	msg := e.MB
 	args := strings.Fields(msg.Body)[1:]
 
 	if len(args) < 1 || (len(args) > 0 && args[0] == "") {
-		if err := g.SendStanza(e.MB.Reply("Need a message to remind")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Need a message to remind")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
 	}
 
-	t, err := w.Parse(msg.Body, time.Now())
+	t, err := p.w.Parse(msg.Body, p.g.Clock().Now())
 	if err != nil {
-		g.Logger.Error(err.Error())
-		if err := g.SendStanza(e.MB.Reply("Couldn't parse date")); err != nil {
-			g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Couldn't parse date")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
@@ -113,7 +205,7 @@ func handleReminder(e gofra.Event) *gofra.Reply {
 
 	answer := ""
 	if msg.Type == stanza.GroupChatMessage {
-		_, isParticipant := isOccupant(msg.From.Bare().String(), args[0])
+		_, isParticipant := p.isOccupant(msg.From.Bare().String(), args[0])
 
 		if args[0] == "me" || !isParticipant {
 			answer += msg.From.Resourcepart() + ", "
@@ -136,24 +228,30 @@ func handleReminder(e gofra.Event) *gofra.Reply {
 		msgType: msg.Type,
 	}
 
-	newReminders <- rmdr
+	p.newReminders <- rmdr
 
-	if err := g.SendStanza(e.MB.Reply("Reminder added")); err != nil {
-		g.Logger.Error(err.Error())
+	if err := p.g.SendStanza(e.MB.Reply("Reminder added")); err != nil {
+		p.g.Logger().Error(err.Error())
 	}
 
 	return nil
 }
 
-func handleOccupants(e gofra.Event) *gofra.Reply {
-	occupants = e.Payload["occupants"].(map[string][]string)
+func (p *plugin) handleOccupants(e gofra.Event) *gofra.Reply {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.occupants = e.Payload["occupants"].(map[string][]string)
 
 	return nil
 }
 
-func isOccupant(room, occupant string) (int, bool) {
+func (p *plugin) isOccupant(room, occupant string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	position := -1
-	for index, occ := range occupants[room] {
+	for index, occ := range p.occupants[room] {
 		if occ == occupant {
 			position = index
 			break
@@ -163,59 +261,64 @@ func isOccupant(room, occupant string) (int, bool) {
 	return position, position != -1
 }
 
-func addReminder(rmdr reminder) {
-	reminders = append(reminders, rmdr)
-	sort.Slice(reminders, func(i, j int) bool {
-		return reminders[i].time < reminders[j].time
+func (p *plugin) addReminder(rmdr reminder) {
+	p.reminders = append(p.reminders, rmdr)
+	sort.Slice(p.reminders, func(i, j int) bool {
+		return p.reminders[i].time < p.reminders[j].time
 	})
-	g.Logger.Info(fmt.Sprintf("REMINDER ADDED %v", rmdr))
+	p.g.Logger().Info(fmt.Sprintf("REMINDER ADDED %v", rmdr))
 }
 
-func pop(rmdr reminder) {
+func (p *plugin) pop(rmdr reminder) {
 	var index int
-	for i, reminder := range reminders {
+	for i, reminder := range p.reminders {
 		if reminder.time == rmdr.time &&
 			reminder.msg == rmdr.msg &&
 			reminder.msgType == rmdr.msgType {
 			index = i
 		}
 	}
-	g.Logger.Info(fmt.Sprintf("REMINDER REMOVED %v", reminders[index]))
+	p.g.Logger().Info(fmt.Sprintf("REMINDER REMOVED %v", p.reminders[index]))
 	if index == 0 {
-		reminders = reminders[1:]
-	} else if index == len(reminders)-1 {
-		reminders = reminders[:len(reminders)-1]
+		p.reminders = p.reminders[1:]
+	} else if index == len(p.reminders)-1 {
+		p.reminders = p.reminders[:len(p.reminders)-1]
 	} else {
-		reminders = append(reminders[:index], reminders[index+1:]...)
+		p.reminders = append(p.reminders[:index], p.reminders[index+1:]...)
 	}
 }
 
-func persistState() {
-	g.Logger.Info("INTO PERSIST STATE")
+func (p *plugin) persistState() {
+	p.g.Logger().Info("INTO PERSIST STATE")
 	var state strings.Builder
-	for _, reminder := range reminders {
+	for _, reminder := range p.reminders {
 		state.WriteString(fmt.Sprintf("%d %s %s %s %s\n", reminder.time, reminder.msgType, reminder.from, reminder.to, reminder.msg))
 	}
 
-	file, err := os.Create("/data/reminders.txt")
+	if err := os.MkdirAll(p.dataDir, 0o755); err != nil {
+		p.g.Logger().Error(err.Error())
+		return
+	}
+
+	file, err := os.Create(filepath.Join(p.dataDir, stateFile))
 	if err != nil {
-		g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
 		return
 	}
-	g.Logger.Info("OPENED FILE SUCCESSFULLY")
+	p.g.Logger().Info("OPENED FILE SUCCESSFULLY")
 	defer file.Close()
 
 	_, err = file.WriteString(state.String())
 	if err != nil {
-		g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
 	}
-	g.Logger.Info("GOING OUT OF PERSIST STATE")
+	p.g.Logger().Info("GOING OUT OF PERSIST STATE")
 }
 
-func loadState() {
-	file, err := os.Open("/data/reminders.txt")
+func (p *plugin) loadState() {
+	file, err := os.Open(filepath.Join(p.dataDir, stateFile))
 	if err != nil {
-		g.Logger.Error(err.Error())
+		p.g.Logger().Error(err.Error())
 		return
 	}
 	defer file.Close()
@@ -248,46 +351,42 @@ func loadState() {
 		msg := strings.Join(args[4:], " ")
 
 		rmdr := reminder{
-			time,
-			to,
-			from,
-			msg,
-			msgType,
+			time:    time,
+			to:      to,
+			from:    from,
+			msg:     msg,
+			msgType: msgType,
 		}
-		g.Logger.Info(fmt.Sprintf("REMINDER LOADED FROM FILESYSTEM %v", rmdr))
-		addReminder(rmdr)
-		go waitTimer(rmdr)
+		p.g.Logger().Info(fmt.Sprintf("REMINDER LOADED FROM FILESYSTEM %v", rmdr))
+		p.addReminder(rmdr)
+		go p.waitTimer(rmdr)
 	}
 	// Handle reason of stop
 	if err := scanner.Err(); err != nil {
-		g.Logger.Error("Broken file stream " + err.Error())
+		p.g.Logger().Error("Broken file stream " + err.Error())
 		return
 	}
 	// If error is nil means error was EOF
 }
 
-func reminderMonitor() {
+func (p *plugin) reminderMonitor() {
 	for {
 		select {
-		case rmdr := <-newReminders:
-			addReminder(rmdr)
-			go waitTimer(rmdr)
-			persistState()
-		case rmdr := <-dueReminders:
-			pop(rmdr)
-			persistState()
-			sendReminders <- rmdr
+		case rmdr := <-p.newReminders:
+			p.addReminder(rmdr)
+			go p.waitTimer(rmdr)
+			p.persistState()
+		case rmdr := <-p.dueReminders:
+			p.pop(rmdr)
+			p.persistState()
+			p.sendReminders <- rmdr
 		}
 	}
 }
 
-func waitTimer(rmdr reminder) {
-	var tmr *time.Timer
-	if rmdr.time <= time.Now().Unix() {
-		tmr = time.NewTimer(time.Unix(time.Now().Unix()+1, 0).Sub(time.Now()))
-	} else {
-		tmr = time.NewTimer(time.Unix(rmdr.time, 0).Sub(time.Now()))
-	}
-	<-tmr.C
-	dueReminders <- rmdr
+// Reminders already due, like the ones loaded after being offline, are sent
+// right away
+func (p *plugin) waitTimer(rmdr reminder) {
+	<-p.g.Clock().At(time.Unix(rmdr.time, 0))
+	p.dueReminders <- rmdr
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestReminder(t *testing.T) {
+	clock := gofratest.NewFakeClock(time.Date(2023, time.March, 1, 9, 0, 0, 0, time.UTC))
+
+	h := gofratest.New(t, gofratest.WithClock(clock))
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	h.Say("alice@example.com/phone", "!remind me to call the mechanic in 1 minute")
+	h.ExpectMessage("alice@example.com/phone", "^Reminder added$")
+
+	clock.Advance(59 * time.Second)
+	h.ExpectNoMessage("alice@example.com", 100*time.Millisecond)
+
+	clock.Advance(time.Second)
+	h.ExpectMessage("alice@example.com", "call the mechanic")
+}
+
+func TestReminder_Loaded(t *testing.T) {
+	clock := gofratest.NewFakeClock(time.Date(2023, time.March, 1, 9, 0, 0, 0, time.UTC))
+
+	var dataDir string
+	h := gofratest.New(t, gofratest.WithClock(clock), gofratest.WithConfig(func(c *gofra.Config) {
+		dataDir = c.DataDir
+	}))
+	state := fmt.Sprintf("%d chat alice@example.com/phone alice@example.com/phone water the plants\n", clock.Now().Add(2*time.Minute).Unix())
+	assert.NoError(t, os.WriteFile(filepath.Join(dataDir, stateFile), []byte(state), 0o644))
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	// Reminders added right away are kept along the loaded ones
+	h.Say("alice@example.com/phone", "!remind me to call the mechanic in 1 minute")
+	h.ExpectMessage("alice@example.com/phone", "^Reminder added$")
+
+	clock.Advance(time.Minute)
+	h.ExpectMessage("alice@example.com", "call the mechanic")
+
+	clock.Advance(time.Minute)
+	h.ExpectMessage("alice@example.com", "^water the plants$")
+}
+
+func startResending(t *testing.T) (*gofratest.Harness, *gofratest.FakeClock) {
+	clock := gofratest.NewFakeClock(time.Date(2023, time.March, 1, 9, 0, 0, 0, time.UTC))
+
+	h := gofratest.New(t, gofratest.WithClock(clock), gofratest.WithConfig(func(c *gofra.Config) {
+		c.Plugins = map[string]map[string]interface{}{
+			"Remind": {"resendAfter": "5m", "resends": 1, "escalateTo": "owner@example.com"},
+		}
+	}))
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	h.Say("alice@example.com/phone", "!remind me to call the mechanic in 1 minute")
+	h.ExpectMessage("alice@example.com/phone", "^Reminder added$")
+
+	return h, clock
+}
+
+func TestReminder_Resend(t *testing.T) {
+	h, clock := startResending(t)
+
+	clock.Advance(time.Minute)
+	h.ExpectMessage("alice@example.com", "call the mechanic")
+
+	clock.Advance(5 * time.Minute)
+	h.ExpectMessage("alice@example.com", "call the mechanic")
+
+	clock.Advance(5 * time.Minute)
+	h.ExpectMessage("owner@example.com", "^alice@example.com did not get their reminder: .*call the mechanic")
+}
+
+func TestReminder_Delivered(t *testing.T) {
+	h, clock := startResending(t)
+
+	clock.Advance(time.Minute)
+	mb := h.ExpectMessage("alice@example.com", "call the mechanic")
+
+	h.Server.Send(`<message xmlns="jabber:client" from="alice@example.com/phone" to="gofra@example.com/gofratest"><received xmlns="urn:xmpp:receipts" id="` + mb.ID + `"/></message>`)
+	assert.Eventually(t, func() bool {
+		d, _ := h.Gofra.Receipts().Status(mb.ID)
+		return d.Status == gofra.DeliveryDelivered
+	}, time.Second, 10*time.Millisecond)
+
+	clock.Advance(5 * time.Minute)
+	h.ExpectNoMessage("alice@example.com", 100*time.Millisecond)
+	h.ExpectNoMessage("owner@example.com", 0)
+}
+
+func TestReminder_NeedsMessage(t *testing.T) {
+	h := gofratest.New(t)
+	h.Start(Plugin.NewInstance(), gofratest.Commands("!"))
+
+	h.Say("alice@example.com/phone", "!remind")
+	h.ExpectMessage("alice@example.com/phone", "^Need a message to remind$")
+}
+
+func TestTranscripts(t *testing.T) {
+	gofratest.RunTranscripts(t, "testdata/*.transcript", func() []gofra.Plugin {
+		return []gofra.Plugin{Plugin.NewInstance(), gofratest.Commands("!")}
+	})
+}
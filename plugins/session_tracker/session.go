@@ -35,8 +35,6 @@ type task struct {
 	time        time.Time
 }
 
-var sessions = make(map[string]session)
-
 type session struct {
 	status     sessionStatus
 	tasks      []task
@@ -45,26 +43,26 @@ type session struct {
 	lastUpdate time.Time
 }
 
-func (s *session) update() {
+func (s *session) update(now time.Time) {
 	if s.status == Running {
-		s.duration += time.Since(s.lastUpdate)
+		s.duration += now.Sub(s.lastUpdate)
 	}
-	s.lastUpdate = time.Now()
+	s.lastUpdate = now
 }
 
-func (s *session) pause() {
-	s.update()
+func (s *session) pause(now time.Time) {
+	s.update(now)
 	s.status = Paused
 }
 
-func (s *session) resume() {
+func (s *session) resume(now time.Time) {
 	s.status = Running
-	s.lastUpdate = time.Now()
+	s.lastUpdate = now
 }
 
-func (s *session) stop() {
+func (s *session) stop(now time.Time) {
 	s.status = NoSession
-	s.lastUpdate = time.Now()
+	s.lastUpdate = now
 }
 
 func (s *session) String() string {
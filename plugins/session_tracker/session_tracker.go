@@ -7,6 +7,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/XaviFP/gofra/internal"
@@ -14,52 +15,64 @@ import (
 
 var Plugin plugin
 
-var g *gofra.Gofra
+type plugin struct {
+	g gofra.API
 
-type plugin struct{}
+	// Commands of the same user arrive concurrently
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{sessions: make(map[string]session)}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "SessionTracker"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Keeps track of tasks done in a working session"
 }
 
-func (p plugin) Help() string {
-	reply := g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
 	commandChar := reply.GetAnswer()
 	return fmt.Sprintf("Usage: %sremind [arg]\nInvoked without arguments returns the status of current session.\n List of args:\nstart - Starts a session\npause - Pauses a session\nresume - resumes a session\nstop - Stops a session\nadd [task] - Appends [task] to the current session", commandChar)
 }
 
-func (p plugin) Init(c gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
-	g.Subscribe(
+func (p *plugin) Init(c gofra.Config, gofra gofra.API) {
+	p.g = gofra
+	p.g.Subscribe(
 		"command/st",
 		p.Name(),
-		handleSession,
+		p.handleSession,
 		0,
 	)
 }
 
-func handleSession(e gofra.Event) *gofra.Reply {
+func (p *plugin) handleSession(e gofra.Event) *gofra.Reply {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	args := strings.Fields(e.MB.Body)[1:]
+	now := p.g.Clock().Now()
 
-	s, exists := sessions[e.MB.From.String()]
+	s, exists := p.sessions[e.MB.From.String()]
 	if len(args) < 1 {
 		if !exists || s.status == NoSession {
-			if err := g.SendStanza(e.MB.Reply("You don't have an ongoing session")); err != nil {
-				g.Logger.Error(err.Error())
+			if err := p.g.SendStanza(e.MB.Reply("You don't have an ongoing session")); err != nil {
+				p.g.Logger().Error(err.Error())
 			}
 
 			return nil
 		}
 
-		s.update()
-		sessions[e.MB.From.String()] = s
+		s.update(now)
+		p.sessions[e.MB.From.String()] = s
 
-		if err := g.SendStanza(e.MB.Reply(s.String())); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(s.String())); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
@@ -68,8 +81,8 @@ func handleSession(e gofra.Event) *gofra.Reply {
 	command := args[0]
 
 	if (!exists || s.status == NoSession) && command != "start" {
-		if err := g.SendStanza(e.MB.Reply("You don't have an ongoing session")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("You don't have an ongoing session")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
@@ -78,88 +91,88 @@ func handleSession(e gofra.Event) *gofra.Reply {
 	switch args[0] {
 	case "start":
 		if s.status != NoSession {
-			if err := g.SendStanza(e.MB.Reply("You already have an ongoing session")); err != nil {
-				g.Logger.Error(err.Error())
+			if err := p.g.SendStanza(e.MB.Reply("You already have an ongoing session")); err != nil {
+				p.g.Logger().Error(err.Error())
 			}
 		}
 
-		sessions[e.MB.From.String()] = session{
+		p.sessions[e.MB.From.String()] = session{
 			status:     Running,
 			tasks:      []task{},
-			startedAt:  time.Now(),
+			startedAt:  now,
 			duration:   time.Duration(0),
-			lastUpdate: time.Now(),
+			lastUpdate: now,
 		}
 
-		if err := g.SendStanza(e.MB.Reply("Session started!")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Session started!")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
 
 	case "pause":
 		if s.status == Paused {
-			if err := g.SendStanza(e.MB.Reply("Session is already paused")); err != nil {
-				g.Logger.Error(err.Error())
+			if err := p.g.SendStanza(e.MB.Reply("Session is already paused")); err != nil {
+				p.g.Logger().Error(err.Error())
 			}
 
 			return nil
 		}
 
-		s.pause()
-		sessions[e.MB.From.String()] = s
+		s.pause(now)
+		p.sessions[e.MB.From.String()] = s
 
-		if err := g.SendStanza(e.MB.Reply("Session paused")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Session paused")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
 
 	case "resume":
 		if s.status == Running {
-			if err := g.SendStanza(e.MB.Reply("Session is already running")); err != nil {
-				g.Logger.Error(err.Error())
+			if err := p.g.SendStanza(e.MB.Reply("Session is already running")); err != nil {
+				p.g.Logger().Error(err.Error())
 			}
 
 			return nil
 		}
 
-		s.resume()
-		sessions[e.MB.From.String()] = s
+		s.resume(now)
+		p.sessions[e.MB.From.String()] = s
 
-		if err := g.SendStanza(e.MB.Reply("Session is running again")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Session is running again")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
 
 	case "stop":
-		s.update()
+		s.update(now)
 		s.status = Stopped
-		if err := g.SendStanza(e.MB.Reply(s.String())); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply(s.String())); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
-		s.stop()
-		sessions[e.MB.From.String()] = s
+		s.stop(now)
+		p.sessions[e.MB.From.String()] = s
 
 		return nil
 
 	case "add":
 		description := strings.Join(args[1:], " ")
-		session := sessions[e.MB.From.String()]
-		session.tasks = append(session.tasks, task{description: description, time: time.Now()})
-		sessions[e.MB.From.String()] = session
+		session := p.sessions[e.MB.From.String()]
+		session.tasks = append(session.tasks, task{description: description, time: now})
+		p.sessions[e.MB.From.String()] = session
 
-		if err := g.SendStanza(e.MB.Reply("Task added")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Task added")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
 
 	default:
-		if err := g.SendStanza(e.MB.Reply("Session tracker subcommand not recognized.\nTry with start, pause, resume or stop")); err != nil {
-			g.Logger.Error(err.Error())
+		if err := p.g.SendStanza(e.MB.Reply("Session tracker subcommand not recognized.\nTry with start, pause, resume or stop")); err != nil {
+			p.g.Logger().Error(err.Error())
 		}
 
 		return nil
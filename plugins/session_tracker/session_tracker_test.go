@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	gofra "github.com/XaviFP/gofra/internal"
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+func TestTranscripts(t *testing.T) {
+	gofratest.RunTranscripts(t, "testdata/*.transcript", func() []gofra.Plugin {
+		return []gofra.Plugin{Plugin.NewInstance(), gofratest.Commands("!")}
+	})
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+
+	gofra "github.com/XaviFP/gofra/internal"
 )
 
 type gameSession struct {
@@ -31,7 +34,7 @@ func (s *gameSession) completeCurrent(player, answer string) bool {
 	return false
 }
 
-func (s *gameSession) summary() string {
+func (s *gameSession) summary() *gofra.Formatted {
 	length := len(s.completed)
 	scoreboard := make(map[string]int, length)
 
@@ -43,22 +46,35 @@ func (s *gameSession) summary() string {
 		}
 	}
 
-	summary := "Results:\n"
+	players := make([]string, 0, len(scoreboard))
+	for player := range scoreboard {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if scoreboard[players[i]] != scoreboard[players[j]] {
+			return scoreboard[players[i]] > scoreboard[players[j]]
+		}
+
+		return players[i] < players[j]
+	})
 
-	for player, score := range scoreboard {
-		summary = fmt.Sprintf("%s%s\t%d/%d\n", summary, player, score, length)
+	rows := make([][]string, len(players))
+	for i, player := range players {
+		rows[i] = []string{player, fmt.Sprintf("%d/%d", scoreboard[player], length)}
 	}
 
-	return summary
+	return gofra.NewFormatted().
+		Paragraph(gofra.Plain("Results:")).
+		Table([]string{"Player", "Score"}, rows...)
 }
 
-func (s *gameSession) next() (string, error) {
+func (s *gameSession) next() (*gofra.Formatted, error) {
 	if len(s.rounds) == 0 {
-		return "", errNoRounds
+		return nil, errNoRounds
 	}
 
 	s.current = s.rounds[0]
 	s.rounds = s.rounds[1:]
 
-	return s.current.String(), nil
+	return s.current.format(), nil
 }
@@ -5,6 +5,8 @@ import (
 	"html"
 	"math/rand"
 	"time"
+
+	gofra "github.com/XaviFP/gofra/internal"
 )
 
 type completedRound struct {
@@ -22,8 +24,22 @@ type round struct {
 	answers          map[string]string
 }
 
-func (r *round) String() string {
-	return fmt.Sprintf("%s\n%s\n%s\n%s", r.Category, r.Difficulty, r.Question, r.formatAnswers())
+func (r *round) format() *gofra.Formatted {
+	f := gofra.NewFormatted().
+		Paragraph(gofra.Italic(r.Category)).
+		Paragraph(gofra.Plain(r.Difficulty)).
+		Paragraph(gofra.Bold(r.Question))
+
+	letters := []string{"A", "B"}
+	if r.Type == "multiple" {
+		letters = append(letters, "C", "D")
+	}
+
+	for _, letter := range letters {
+		f.Paragraph(gofra.Plain(fmt.Sprintf("%s) %s", letter, r.answers[letter])))
+	}
+
+	return f
 }
 
 func (r *round) init() {
@@ -37,25 +53,6 @@ func (r *round) init() {
 	r.randomize()
 }
 
-func (r *round) formatAnswers() string {
-	out := fmt.Sprintf(
-		"A) %s\nB) %s",
-		r.answers["A"],
-		r.answers["B"],
-	)
-
-	if r.Type == "multiple" {
-		out = fmt.Sprintf(
-			"%s\nC) %s\nD) %s",
-			out,
-			r.answers["C"],
-			r.answers["D"],
-		)
-	}
-
-	return out
-}
-
 func (r *round) randomize() {
 	answers := append(r.IncorrectAnswers, r.CorrectAnswer)
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/juju/errors"
 
@@ -14,88 +15,128 @@ var Plugin plugin
 
 var errNoRounds = errors.New("no rounds available")
 
-var g *gofra.Gofra
-var session *gameSession
-var repo repository
+type plugin struct {
+	g    gofra.API
+	repo repository
 
-type plugin struct{}
+	// Answers arrive concurrently
+	mu      sync.Mutex
+	session *gameSession
+}
+
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "trivia"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Trivia plugin"
 }
 
-func (p plugin) Init(conf gofra.Config, api *gofra.Gofra) {
-	g = api
-	g.Subscribe(
+func (p *plugin) Help() string {
+	reply := p.g.Publish(gofra.Event{Name: "command/getCommandChar", MB: gofra.MessageBody{}, Payload: nil})
+	commandChar := reply.GetAnswer()
+	return fmt.Sprintf("Usage: %strivia start [category id] starts a new game, %strivia categories lists the available categories", commandChar, commandChar)
+}
+
+func (p *plugin) Init(conf gofra.Config, api gofra.API) {
+	p.g = api
+	p.g.Subscribe(
 		"messageReceived",
 		p.Name(),
-		handleMessage,
+		p.handleMessage,
 		9999,
 	)
-	g.Subscribe(
+	p.g.Subscribe(
 		fmt.Sprintf("command/%s", p.Name()),
 		p.Name(),
-		handleCommand,
+		p.handleCommand,
 		9999,
 	)
 
-	repo = newOTDRepository()
-	session = new(gameSession)
+	if p.repo == nil {
+		p.repo = newOTDRepository()
+	}
+	p.session = new(gameSession)
 }
 
-func StartNewSession(req roundRequest) error {
-	rounds, err := repo.GetRounds(req)
+// StartNewSession fetches the rounds of a new game and replaces the current
+// one with it. Answers are not held back while the rounds are fetched.
+func (p *plugin) StartNewSession(req roundRequest) error {
+	rounds, err := p.repo.GetRounds(req)
 	if err != nil {
 		return errors.Annotate(err, "fetching rounds")
 	}
 
-	session = &gameSession{started: true}
+	session := &gameSession{started: true}
 	session.init(rounds)
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.session = session
+
 	return nil
 }
 
-func handleCommand(e gofra.Event) *gofra.Reply {
+// playing reports whether a game is in progress.
+func (p *plugin) playing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.session.started && !p.session.finished
+}
+
+// currentQuestion returns the question of the game being played.
+func (p *plugin) currentQuestion() *gofra.Formatted {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.session.current.format()
+}
+
+func (p *plugin) handleCommand(e gofra.Event) *gofra.Reply {
 	args := strings.Fields(e.MB.Body)[1:]
 	r := e.MB.Reply
 
 	if len(args) == 0 {
-		g.SendStanza(r(`Use "!trivia start" to start a new game`))
+		p.g.SendStanza(r(`Use "!trivia start" to start a new game`))
 
 		return nil
 	}
 
 	switch args[0] {
 	case "start":
+		req := roundRequest{categories: []int{}, limit: 10}
 		if len(args) == 1 {
-			if !session.started || session.finished {
-				if err := StartNewSession(roundRequest{categories: []int{}, limit: 10}); err != nil {
-					g.SendStanza(r(fmt.Sprintf("Could not start new session: %s", "a")))
-				}
-
-				g.SendStanza(r(session.current.String()))
+			if p.playing() {
+				return nil
 			}
-
 		} else {
 			categoryID, err := strconv.Atoi(args[1])
 			if err != nil {
-				g.SendStanza(r("invalid category id"))
+				p.g.SendStanza(r("invalid category id"))
 
 				return nil
 			}
+			req.categories = []int{categoryID}
+		}
+
+		if err := p.StartNewSession(req); err != nil {
+			p.g.SendStanza(r(fmt.Sprintf("Could not start new session: %s", err)))
 
-			StartNewSession(roundRequest{categories: []int{categoryID}, limit: 10})
-			g.SendStanza(r(session.current.String()))
+			return nil
 		}
 
+		p.g.SendStanza(e.MB.FormattedReply(p.currentQuestion()))
+
 	case "categories":
-		res, err := repo.GetCategories()
+		res, err := p.repo.GetCategories()
 		if err != nil {
-			g.SendStanza(r(
+			p.g.SendStanza(r(
 				fmt.Sprintf("could not retrieve categories: %s", err),
 			))
 
@@ -107,36 +148,44 @@ func handleCommand(e gofra.Event) *gofra.Reply {
 			categories = fmt.Sprintf("%s%d: %s\n", categories, c.ID, c.Name)
 		}
 
-		g.SendStanza(r(categories))
+		p.g.SendStanza(r(categories))
 	}
 
 	return nil
 }
 
-func handleMessage(e gofra.Event) *gofra.Reply {
-	nextQuestion, ok := processRound(e.MB.From.Resourcepart(), e.MB.Body)
+func (p *plugin) handleMessage(e gofra.Event) *gofra.Reply {
+	// Old answers and the questions of the bot are no guesses
+	if e.IsHistory || e.IsSelf {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nextQuestion, ok := p.processRound(e.MB.From.Resourcepart(), e.MB.Body)
 	if !ok {
 		return nil
 	}
 
-	g.SendStanza(e.MB.Reply(nextQuestion))
+	p.g.SendStanza(e.MB.FormattedReply(nextQuestion))
 
 	return nil
 }
 
-func processRound(player, answer string) (string, bool) {
-	if !session.started || session.finished {
-		return "", false
+func (p *plugin) processRound(player, answer string) (*gofra.Formatted, bool) {
+	if !p.session.started || p.session.finished {
+		return nil, false
 	}
 
-	if ok := session.completeCurrent(player, answer); !ok {
-		return "", false
+	if ok := p.session.completeCurrent(player, answer); !ok {
+		return nil, false
 	}
 
-	nextQuestion, err := session.next()
+	nextQuestion, err := p.session.next()
 	if errors.Cause(err) == errNoRounds {
-		session.finished = true
-		return session.summary(), true
+		p.session.finished = true
+		return p.session.summary(), true
 	}
 
 	return nextQuestion, true
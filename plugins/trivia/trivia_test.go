@@ -0,0 +1,109 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/XaviFP/gofra/internal/gofratest"
+)
+
+const room = "room@muc.example.com"
+
+type fakeRepository struct {
+	rounds []round
+}
+
+func (r fakeRepository) GetRounds(roundRequest) ([]*round, error) {
+	rounds := make([]*round, len(r.rounds))
+	for i := range r.rounds {
+		rnd := r.rounds[i]
+		rnd.IncorrectAnswers = append([]string{}, rnd.IncorrectAnswers...)
+		rounds[i] = &rnd
+	}
+
+	return rounds, nil
+}
+
+func (r fakeRepository) GetCategories() ([]category, error) {
+	return []category{{ID: 9, Name: "General Knowledge"}, {ID: 17, Name: "Science & Nature"}}, nil
+}
+
+func TestTrivia(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice", "bob"))
+	h.Start(&plugin{repo: fakeRepository{rounds: []round{
+		{Category: "Science", Type: "boolean", Difficulty: "easy", Question: "Water boils at 100 &deg;C at sea level.", CorrectAnswer: "True", IncorrectAnswers: []string{"False"}},
+		{Category: "Geography", Type: "multiple", Difficulty: "medium", Question: "What is the capital of Australia?", CorrectAnswer: "Canberra", IncorrectAnswers: []string{"Sydney", "Melbourne", "Perth"}},
+	}}}, gofratest.Commands("!"))
+
+	h.Say(room+"/alice", "!trivia start")
+	question := h.ExpectMessage(room, "Water boils at 100 °C at sea level")
+
+	h.Say(room+"/alice", answerLetter(t, question.Body, "True"))
+	question = h.ExpectMessage(room, "What is the capital of Australia")
+
+	h.Say(room+"/bob", answerLetter(t, question.Body, "Sydney"))
+	h.Say(room+"/bob", answerLetter(t, question.Body, "Canberra"))
+	h.ExpectMessage(room, "^Results:\n```\nPlayer  Score\n------  -----\nalice   1/2\nbob     1/2\n```$")
+}
+
+func TestTrivia_Categories(t *testing.T) {
+	h := gofratest.New(t)
+	h.Start(&plugin{repo: fakeRepository{}}, gofratest.Commands("!"))
+
+	h.Say("alice@example.com/phone", "!trivia categories")
+	h.ExpectMessage("alice@example.com/phone", "^9: General Knowledge\n17: Science & Nature\n$")
+}
+
+// answerLetter returns the letter the answer is listed under in a question.
+func answerLetter(t *testing.T, question, answer string) string {
+	t.Helper()
+
+	match := regexp.MustCompile(`(?m)^([A-D])\) ` + regexp.QuoteMeta(answer) + `$`).FindStringSubmatch(question)
+	if match == nil {
+		t.Fatalf("answer %q not found in question:\n%s", answer, question)
+	}
+
+	return match[1]
+}
+
+// slowRepository holds back the rounds of categories until released.
+type slowRepository struct {
+	fakeRepository
+	fetching chan struct{}
+	release  chan struct{}
+}
+
+func (r slowRepository) GetRounds(req roundRequest) ([]*round, error) {
+	if len(req.categories) > 0 {
+		close(r.fetching)
+		<-r.release
+	}
+
+	return r.fakeRepository.GetRounds(req)
+}
+
+func TestTrivia_AnswersWhileFetching(t *testing.T) {
+	h := gofratest.New(t, gofratest.WithRoom(room, "alice"))
+	repo := slowRepository{
+		fakeRepository: fakeRepository{rounds: []round{
+			{Category: "Science", Type: "boolean", Difficulty: "easy", Question: "Water boils at 100 &deg;C at sea level.", CorrectAnswer: "True", IncorrectAnswers: []string{"False"}},
+			{Category: "Geography", Type: "multiple", Difficulty: "medium", Question: "What is the capital of Australia?", CorrectAnswer: "Canberra", IncorrectAnswers: []string{"Sydney", "Melbourne", "Perth"}},
+		}},
+		fetching: make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	h.Start(&plugin{repo: repo}, gofratest.Commands("!"))
+
+	h.Say(room+"/alice", "!trivia start")
+	question := h.ExpectMessage(room, "Water boils at 100 °C at sea level")
+
+	h.Say(room+"/alice", "!trivia start 17")
+	<-repo.fetching
+
+	// The game goes on while the next one is fetched
+	h.Say(room+"/alice", answerLetter(t, question.Body, "True"))
+	h.ExpectMessage(room, "What is the capital of Australia")
+
+	close(repo.release)
+	h.ExpectMessage(room, "Water boils at 100 °C at sea level")
+}
@@ -12,68 +12,80 @@ import (
 
 var Plugin plugin
 
-var g *gofra.Gofra
+type plugin struct {
+	g          gofra.API
+	seen       map[string]time.Time
+	chatStates gofra.ChatStatesConfig
+}
 
-type plugin struct{}
+func (p *plugin) NewInstance() gofra.Plugin {
+	return &plugin{seen: make(map[string]time.Time)}
+}
 
-func (p plugin) Name() string {
+func (p *plugin) Name() string {
 	return "Web title"
 }
 
-func (p plugin) Description() string {
+func (p *plugin) Description() string {
 	return "Parses urls and writes a message back with the website's title"
 }
 
-func (p plugin) Help() string {
+func (p *plugin) Help() string {
 	return "Writes back title of websites if message contains url and website's url has a title"
 }
 
-var seen = make(map[string]time.Time)
-
-func (p plugin) Init(config gofra.Config, gofra *gofra.Gofra) {
-	g = gofra
+func (p *plugin) Init(config gofra.Config, gofra gofra.API) {
+	p.g = gofra
+	p.chatStates = config.ChatStates
 
-	g.Subscribe(
+	p.g.Subscribe(
 		"messageReceived",
 		p.Name(),
-		handleMessage,
+		p.handleMessage,
 		1,
 	)
 
 	go func() {
 		for {
 			time.Sleep(30 * time.Minute)
-			for url, t := range seen {
+			for url, t := range p.seen {
 				if time.Since(t) > time.Hour {
-					delete(seen, url)
+					delete(p.seen, url)
 				}
 			}
 		}
 	}()
 }
 
-func handleMessage(e gofra.Event) *gofra.Reply {
+func (p *plugin) handleMessage(e gofra.Event) *gofra.Reply {
+	// Links were titled when first sent, and the titles of the bot have none
+	if e.IsHistory || e.IsSelf {
+		return nil
+	}
+
 	// Parse e.MB.Body to see if it contains a URL
 	url := containsURL(e.MB.Body)
 	if url == "" {
-		g.Logger.Error("no url found in message")
+		p.g.Logger().Error("no url found in message")
 		return nil
 	}
-	g.Logger.Error(fmt.Sprintf("url in message: %s", url))
+	p.g.Logger().Error(fmt.Sprintf("url in message: %s", url))
+	done := gofra.Typing(p.g, e.MB, p.chatStates)
 	title, err := getTitle(url)
+	done()
 	if err != nil {
-		g.Logger.Error(fmt.Sprintf("no title couldn't be retrieved, error: %s", err))
+		p.g.Logger().Error(fmt.Sprintf("no title couldn't be retrieved, error: %s", err))
 		return nil
 	}
-	g.Logger.Error(fmt.Sprintf("title found for url: %s", title))
+	p.g.Logger().Error(fmt.Sprintf("title found for url: %s", title))
 
-	if err := g.SendStanza(e.MB.Reply(title)); err != nil {
-		g.Logger.Error(err.Error())
+	if err := p.g.SendStanza(e.MB.Reply(title)); err != nil {
+		p.g.Logger().Error(err.Error())
 
 		return nil
 	}
 
-	seen[url] = time.Now()
+	p.seen[url] = time.Now()
 
 	return nil
 }
@@ -24,6 +24,6 @@ func (p plugin) Help() string {
 	return "Just hanging 'round y'know?"
 }
 
-func (p plugin) Init(c gofra.Config, gofra *gofra.Gofra) {
+func (p plugin) Init(c gofra.Config, gofra gofra.API) {
 	// Yeah, business as usual
 }